@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -58,6 +59,12 @@ var (
 	serverStateDir     string
 	serverReadTimeout  int
 	serverWriteTimeout int
+	serverAutoRecover  bool
+	serverSimulate     bool
+
+	serverSnapshotMaxCount    int
+	serverSnapshotMaxAge      time.Duration
+	serverSnapshotKeepApplies int
 
 	// Client flags
 	clientAPIKey  string
@@ -72,6 +79,11 @@ func init() {
 	serverCmd.Flags().StringVar(&serverStateDir, "state-dir", "", "Directory for state storage")
 	serverCmd.Flags().IntVar(&serverReadTimeout, "read-timeout", 30, "HTTP read timeout in seconds")
 	serverCmd.Flags().IntVar(&serverWriteTimeout, "write-timeout", 60, "HTTP write timeout in seconds")
+	serverCmd.Flags().BoolVar(&serverAutoRecover, "auto-recover", true, "Roll back an apply interrupted by a crash on startup")
+	serverCmd.Flags().BoolVar(&serverSimulate, "simulate", false, "Apply profiles to an emulated host instead of this system")
+	serverCmd.Flags().IntVar(&serverSnapshotMaxCount, "snapshot-max-count", 0, "Snapshots to keep besides pinned and protected ones (0 = unlimited)")
+	serverCmd.Flags().DurationVar(&serverSnapshotMaxAge, "snapshot-max-age", 0, "Delete unprotected snapshots older than this, e.g. 720h (0 = never)")
+	serverCmd.Flags().IntVar(&serverSnapshotKeepApplies, "snapshot-keep-applies", 5, "Always keep the snapshots of the last N successful applies")
 	serverCmd.MarkFlagRequired("api-key")
 
 	// Client flags
@@ -104,9 +116,17 @@ func runServer(cmd *cobra.Command, args []string) error {
 	cfg.Listen = serverListen
 	cfg.ReadTimeout = serverReadTimeout
 	cfg.WriteTimeout = serverWriteTimeout
+	cfg.AutoRecover = serverAutoRecover
+	cfg.Simulate = serverSimulate
+	cfg.SnapshotMaxCount = serverSnapshotMaxCount
+	cfg.SnapshotMaxAge = serverSnapshotMaxAge
+	cfg.SnapshotKeepApplies = serverSnapshotKeepApplies
 
 	if serverStateDir != "" {
 		cfg.StateDir = serverStateDir
+	} else if cfg.Simulate {
+		// Keep simulated snapshots away from ones that describe the real host
+		cfg.StateDir = filepath.Join(cfg.StateDir, "simulate")
 	}
 
 	logger.Info("starting nettune server",
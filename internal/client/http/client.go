@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/jtsang4/nettune/internal/shared/types"
@@ -257,9 +258,13 @@ func (c *Client) CreateProfile(profile *types.Profile) (*types.ProfileMeta, erro
 	return &result, nil
 }
 
-// CreateSnapshot calls POST /sys/snapshot
-func (c *Client) CreateSnapshot() (*types.Snapshot, error) {
-	resp, err := c.doRequest("POST", "/sys/snapshot", nil)
+// CreateSnapshot calls POST /sys/snapshot; req may be nil
+func (c *Client) CreateSnapshot(req *types.SnapshotRequest) (*types.Snapshot, error) {
+	var body interface{}
+	if req != nil {
+		body = req
+	}
+	resp, err := c.doRequest("POST", "/sys/snapshot", body)
 	if err != nil {
 		return nil, err
 	}
@@ -270,17 +275,194 @@ func (c *Client) CreateSnapshot() (*types.Snapshot, error) {
 	var result struct {
 		SnapshotID   string             `json:"snapshot_id"`
 		CurrentState *types.SystemState `json:"current_state"`
+		Pinned       bool               `json:"pinned"`
+		Label        string             `json:"label"`
 	}
 	if err := json.Unmarshal(resp.Data, &result); err != nil {
 		return nil, err
 	}
 
 	return &types.Snapshot{
-		ID:    result.SnapshotID,
-		State: result.CurrentState,
+		ID:     result.SnapshotID,
+		State:  result.CurrentState,
+		Pinned: result.Pinned,
+		Label:  result.Label,
 	}, nil
 }
 
+// ListSnapshots calls GET /sys/snapshots; filter may be nil
+func (c *Client) ListSnapshots(filter *types.SnapshotFilter) ([]*types.SnapshotMeta, error) {
+	query := url.Values{}
+	if filter != nil {
+		for name, value := range map[string]string{
+			"label":     filter.Label,
+			"profile":   filter.ProfileID,
+			"reason":    filter.Reason,
+			"client_ip": filter.ClientIP,
+			"q":         filter.Query,
+		} {
+			if value != "" {
+				query.Set(name, value)
+			}
+		}
+		if filter.Pinned {
+			query.Set("pinned", "true")
+		}
+	}
+	path := "/sys/snapshots"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	resp, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, resp.Error
+	}
+
+	var result struct {
+		Snapshots []*types.SnapshotMeta `json:"snapshots"`
+	}
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, err
+	}
+	return result.Snapshots, nil
+}
+
+// DiffSnapshot calls GET /sys/snapshot/:id/diff; against is a snapshot ID or "current"
+func (c *Client) DiffSnapshot(id, against string) (*types.SnapshotDiff, error) {
+	path := "/sys/snapshot/" + url.PathEscape(id) + "/diff"
+	if against != "" {
+		path += "?against=" + url.QueryEscape(against)
+	}
+	resp, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, resp.Error
+	}
+
+	var diff types.SnapshotDiff
+	if err := json.Unmarshal(resp.Data, &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// ExportSnapshot calls GET /sys/snapshot/:id/export and returns the tar.gz archive
+func (c *Client) ExportSnapshot(id string) ([]byte, error) {
+	req, err := http.NewRequest("GET", c.baseURL+"/sys/snapshot/"+url.PathEscape(id)+"/export", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var response Response
+		if err := json.Unmarshal(body, &response); err == nil && response.Error != nil {
+			return nil, response.Error
+		}
+		return nil, fmt.Errorf("export failed with status %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// ImportSnapshot calls POST /sys/snapshot/import with an archive from ExportSnapshot.
+// An empty label or note keeps the one of the exported snapshot.
+func (c *Client) ImportSnapshot(archive []byte, label, note string, pin bool) (*types.SnapshotMeta, error) {
+	query := url.Values{}
+	if label != "" {
+		query.Set("label", label)
+	}
+	if note != "" {
+		query.Set("note", note)
+	}
+	if pin {
+		query.Set("pin", "true")
+	}
+	path := "/sys/snapshot/import"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+path, bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/gzip")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	var response Response
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if !response.Success {
+		return nil, response.Error
+	}
+
+	var meta types.SnapshotMeta
+	if err := json.Unmarshal(response.Data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// DeleteSnapshot calls DELETE /sys/snapshot/:id
+func (c *Client) DeleteSnapshot(id string) error {
+	resp, err := c.doRequest("DELETE", "/sys/snapshot/"+url.PathEscape(id), nil)
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return resp.Error
+	}
+	return nil
+}
+
+// PinSnapshot calls PUT /sys/snapshot/:id/pin, or DELETE to unpin
+func (c *Client) PinSnapshot(id string, pinned bool) (*types.SnapshotMeta, error) {
+	method := "PUT"
+	if !pinned {
+		method = "DELETE"
+	}
+	resp, err := c.doRequest(method, "/sys/snapshot/"+url.PathEscape(id)+"/pin", nil)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, resp.Error
+	}
+
+	var meta types.SnapshotMeta
+	if err := json.Unmarshal(resp.Data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
 // Apply calls POST /sys/apply
 func (c *Client) Apply(req *types.ApplyRequest) (*types.ApplyResult, error) {
 	resp, err := c.doRequest("POST", "/sys/apply", req)
@@ -298,6 +480,98 @@ func (c *Client) Apply(req *types.ApplyRequest) (*types.ApplyResult, error) {
 	return &result, nil
 }
 
+// ApplyAsync calls POST /sys/apply with async set and returns the started job
+func (c *Client) ApplyAsync(req *types.ApplyRequest) (*types.Job, error) {
+	asyncReq := *req
+	asyncReq.Async = true
+
+	resp, err := c.doRequest("POST", "/sys/apply", &asyncReq)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, resp.Error
+	}
+
+	var job types.Job
+	if err := json.Unmarshal(resp.Data, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetJob calls GET /sys/jobs/:id
+func (c *Client) GetJob(id string) (*types.Job, error) {
+	resp, err := c.doRequest("GET", "/sys/jobs/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, resp.Error
+	}
+
+	var job types.Job
+	if err := json.Unmarshal(resp.Data, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListJobs calls GET /sys/jobs
+func (c *Client) ListJobs(limit int) ([]*types.Job, error) {
+	resp, err := c.doRequest("GET", fmt.Sprintf("/sys/jobs?limit=%d", limit), nil)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, resp.Error
+	}
+
+	var result struct {
+		Jobs []*types.Job `json:"jobs"`
+	}
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, err
+	}
+	return result.Jobs, nil
+}
+
+// WaitForJob polls a job until it finishes or the timeout expires.
+// Each poll is a short request, so the wait is not bound by the client timeout.
+func (c *Client) WaitForJob(id string, interval, timeout time.Duration) (*types.Job, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		job, err := c.GetJob(id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Done() {
+			return job, nil
+		}
+		if time.Now().After(deadline) {
+			return job, fmt.Errorf("job %s still %s after %s", id, job.Status, timeout)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Confirm calls POST /sys/confirm
+func (c *Client) Confirm(req *types.ConfirmRequest) (*types.ConfirmResult, error) {
+	resp, err := c.doRequest("POST", "/sys/confirm", req)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, resp.Error
+	}
+
+	var result types.ConfirmResult
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 // Rollback calls POST /sys/rollback
 func (c *Client) Rollback(req *types.RollbackRequest) (*types.RollbackResult, error) {
 	resp, err := c.doRequest("POST", "/sys/rollback", req)
@@ -1,7 +1,10 @@
 package http
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -258,7 +261,7 @@ func TestClient_CreateSnapshot(t *testing.T) {
 	defer server.Close()
 
 	client := NewClient(server.URL, "test-key", 5*time.Second)
-	snapshot, err := client.CreateSnapshot()
+	snapshot, err := client.CreateSnapshot(nil)
 
 	if err != nil {
 		t.Fatalf("CreateSnapshot failed: %v", err)
@@ -268,6 +271,156 @@ func TestClient_CreateSnapshot(t *testing.T) {
 	}
 }
 
+func TestClient_CreateSnapshot_Full(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req types.SnapshotRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Full {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		resp := map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"snapshot_id": "2024-01-01T00-00-00Z_full",
+			},
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-key", 5*time.Second)
+	snapshot, err := client.CreateSnapshot(&types.SnapshotRequest{Full: true})
+
+	if err != nil {
+		t.Fatalf("CreateSnapshot failed: %v", err)
+	}
+	if snapshot.ID != "2024-01-01T00-00-00Z_full" {
+		t.Errorf("Snapshot ID = %s, want 2024-01-01T00-00-00Z_full", snapshot.ID)
+	}
+}
+
+func TestClient_ListSnapshots_Filter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/sys/snapshots" || query.Get("profile") != "satellite-link" || query.Get("q") != "before test" ||
+			query.Get("pinned") != "true" || query.Has("label") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		resp := map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"snapshots": []map[string]interface{}{
+					{"id": "snap-1", "label": "before test", "provenance": map[string]string{"reason": "apply", "profile_id": "satellite-link"}},
+				},
+			},
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-key", 5*time.Second)
+	snapshots, err := client.ListSnapshots(&types.SnapshotFilter{ProfileID: "satellite-link", Query: "before test", Pinned: true})
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Provenance == nil || snapshots[0].Provenance.ProfileID != "satellite-link" {
+		t.Errorf("ListSnapshots() = %+v", snapshots)
+	}
+}
+
+func TestClient_DiffSnapshot(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/sys/snapshot/snap-1/diff" || r.URL.Query().Get("against") != "snap-2" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		resp := map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"snapshot_id": "snap-1",
+				"against":     "snap-2",
+				"sysctl": map[string]interface{}{
+					"net.ipv4.tcp_congestion_control": map[string]string{"from": "cubic", "to": "bbr"},
+				},
+				"total": 1,
+			},
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-key", 5*time.Second)
+	diff, err := client.DiffSnapshot("snap-1", "snap-2")
+	if err != nil {
+		t.Fatalf("DiffSnapshot failed: %v", err)
+	}
+	if diff.Total != 1 || diff.Sysctl["net.ipv4.tcp_congestion_control"].To != "bbr" {
+		t.Errorf("DiffSnapshot() = %+v", diff)
+	}
+}
+
+func TestClient_DeleteSnapshot_Protected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" || r.URL.Path != "/sys/snapshot/snap-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusConflict)
+		resp := map[string]interface{}{
+			"success": false,
+			"error": map[string]interface{}{
+				"code":    types.ErrCodeSnapshotProtected,
+				"message": "snapshot is protected: pinned; unpin it first",
+			},
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-key", 5*time.Second)
+	err := client.DeleteSnapshot("snap-1")
+
+	var apiErr *types.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != types.ErrCodeSnapshotProtected {
+		t.Errorf("DeleteSnapshot error = %v, want %s", err, types.ErrCodeSnapshotProtected)
+	}
+}
+
+func TestClient_PinSnapshot(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sys/snapshot/snap-1/pin" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		resp := map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"id":     "snap-1",
+				"pinned": r.Method == "PUT",
+			},
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-key", 5*time.Second)
+	for _, pinned := range []bool{true, false} {
+		meta, err := client.PinSnapshot("snap-1", pinned)
+		if err != nil {
+			t.Fatalf("PinSnapshot(%v) failed: %v", pinned, err)
+		}
+		if meta.ID != "snap-1" || meta.Pinned != pinned {
+			t.Errorf("PinSnapshot(%v) = %+v", pinned, meta)
+		}
+	}
+}
+
 func TestClient_Apply(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" || r.URL.Path != "/sys/apply" {
@@ -302,6 +455,62 @@ func TestClient_Apply(t *testing.T) {
 	}
 }
 
+func TestClient_ApplyAsync_WaitForJob(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/sys/apply":
+			var req types.ApplyRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if !req.Async {
+				t.Error("ApplyAsync should set async")
+			}
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": true,
+				"data":    map[string]interface{}{"id": "job-1", "status": types.JobStatusRunning},
+			})
+		case r.Method == "GET" && r.URL.Path == "/sys/jobs/job-1":
+			polls++
+			status := types.JobStatusRunning
+			if polls >= 2 {
+				status = types.JobStatusSucceeded
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": true,
+				"data": map[string]interface{}{
+					"id":     "job-1",
+					"status": status,
+					"result": map[string]interface{}{"success": true, "snapshot_id": "snapshot-123"},
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-key", 5*time.Second)
+	job, err := client.ApplyAsync(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "commit"})
+	if err != nil {
+		t.Fatalf("ApplyAsync failed: %v", err)
+	}
+	if job.ID != "job-1" {
+		t.Errorf("job ID = %s, want job-1", job.ID)
+	}
+
+	job, err = client.WaitForJob(job.ID, 10*time.Millisecond, time.Second)
+	if err != nil {
+		t.Fatalf("WaitForJob failed: %v", err)
+	}
+	if job.Status != types.JobStatusSucceeded {
+		t.Errorf("status = %s, want %s", job.Status, types.JobStatusSucceeded)
+	}
+	if job.Result == nil || job.Result.SnapshotID != "snapshot-123" {
+		t.Errorf("result = %+v, want snapshot-123", job.Result)
+	}
+}
+
 func TestClient_Rollback(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" || r.URL.Path != "/sys/rollback" {
@@ -478,3 +687,70 @@ func TestClient_ProbeInfo(t *testing.T) {
 		t.Fatal("ProbeInfo returned nil")
 	}
 }
+
+func TestClient_ExportSnapshot(t *testing.T) {
+	archive := []byte{0x1f, 0x8b, 0x08, 0x00}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sys/snapshot/snap-1/export":
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Write(archive)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   map[string]string{"code": "NOT_FOUND", "message": "snapshot not found"},
+			})
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-key", 5*time.Second)
+	data, err := client.ExportSnapshot("snap-1")
+	if err != nil || !bytes.Equal(data, archive) {
+		t.Errorf("ExportSnapshot() = %v, %v", data, err)
+	}
+
+	_, err = client.ExportSnapshot("missing")
+	var apiErr *types.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "NOT_FOUND" {
+		t.Errorf("ExportSnapshot(missing) error = %v, want the API error", err)
+	}
+}
+
+func TestClient_ImportSnapshot(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != "POST" || r.URL.Path != "/sys/snapshot/import" || string(body) != "archive" ||
+			r.Header.Get("Content-Type") != "application/gzip" ||
+			r.URL.Query().Get("label") != "edge-42" || r.URL.Query().Get("pin") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		resp := map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"id":     "snap-2",
+				"label":  "edge-42",
+				"pinned": true,
+				"provenance": map[string]string{
+					"reason":        "import",
+					"imported_from": "snap-1",
+					"source_host":   "edge-42",
+				},
+			},
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-key", 5*time.Second)
+	meta, err := client.ImportSnapshot([]byte("archive"), "edge-42", "", true)
+	if err != nil {
+		t.Fatalf("ImportSnapshot failed: %v", err)
+	}
+	if meta.ID != "snap-2" || !meta.Pinned || meta.Provenance.ImportedFrom != "snap-1" {
+		t.Errorf("ImportSnapshot() = %+v", meta)
+	}
+}
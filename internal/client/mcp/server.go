@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
@@ -16,6 +17,12 @@ import (
 	"go.uber.org/zap"
 )
 
+// Polling settings for commits submitted as server-side jobs
+const (
+	applyJobPollInterval = time.Second
+	applyJobWaitTimeout  = 10 * time.Minute
+)
+
 // Server is the MCP stdio server using mcp-go SDK
 type Server struct {
 	mcpServer  *server.MCPServer
@@ -116,10 +123,128 @@ func (s *Server) registerTools() {
 	s.mcpServer.AddTool(
 		mcp.NewTool("nettune.snapshot_server",
 			mcp.WithDescription("Create a snapshot of the current server configuration for potential rollback."),
+			mcp.WithBoolean("full",
+				mcp.Description("Capture every writable sysctl under /proc/sys/net instead of the tracked network keys (default: false)"),
+			),
+			mcp.WithBoolean("pin",
+				mcp.Description("Pin the snapshot so retention never deletes it (default: false)"),
+			),
+			mcp.WithString("label",
+				mcp.Description("Short one-line label to find the snapshot by later, e.g. 'before satellite tuning' (max 64 bytes)"),
+			),
+			mcp.WithString("note",
+				mcp.Description("Free-text note on why the snapshot was taken (max 1024 bytes)"),
+			),
 		),
 		s.handleSnapshotServer,
 	)
 
+	// Tool: nettune.list_snapshots
+	s.mcpServer.AddTool(
+		mcp.NewTool("nettune.list_snapshots",
+			mcp.WithDescription("List snapshots, newest first, with their label, note, pin and provenance (reason, profile and client IP). Filters narrow the list, e.g. profile='satellite-link' finds the snapshot taken before that profile was committed."),
+			mcp.WithString("label",
+				mcp.Description("Only snapshots with this label (case-insensitive)"),
+			),
+			mcp.WithString("profile",
+				mcp.Description("Only snapshots taken by commits of this profile"),
+			),
+			mcp.WithString("reason",
+				mcp.Description("Only snapshots taken for this reason"),
+				mcp.Enum(types.SnapshotReasonManual, types.SnapshotReasonApply, types.SnapshotReasonBaseline, types.SnapshotReasonImport),
+			),
+			mcp.WithString("client_ip",
+				mcp.Description("Only snapshots requested from this address"),
+			),
+			mcp.WithString("query",
+				mcp.Description("Only snapshots whose label or note contains this text (case-insensitive)"),
+			),
+			mcp.WithBoolean("pinned",
+				mcp.Description("Only pinned snapshots (default: false)"),
+			),
+		),
+		s.handleListSnapshots,
+	)
+
+	// Tool: nettune.diff_snapshots
+	s.mcpServer.AddTool(
+		mcp.NewTool("nettune.diff_snapshots",
+			mcp.WithDescription("Show what changed between a snapshot and another snapshot or the live system: sysctl values, qdiscs, link settings, queue steering, route attributes, systemd units and managed files. Use it to explain drift since a known-good state."),
+			mcp.WithString("snapshot_id",
+				mcp.Required(),
+				mcp.Description("The ID of the earlier snapshot"),
+			),
+			mcp.WithString("against",
+				mcp.Description("Snapshot ID to compare with, or \"current\" for the live system (default: current)"),
+			),
+		),
+		s.handleDiffSnapshots,
+	)
+
+	// Tool: nettune.pin_snapshot
+	s.mcpServer.AddTool(
+		mcp.NewTool("nettune.pin_snapshot",
+			mcp.WithDescription("Pin a snapshot so snapshot retention never deletes it, or unpin it again."),
+			mcp.WithString("snapshot_id",
+				mcp.Required(),
+				mcp.Description("The ID of the snapshot to pin"),
+			),
+			mcp.WithBoolean("pinned",
+				mcp.Description("false unpins the snapshot (default: true)"),
+			),
+		),
+		s.handlePinSnapshot,
+	)
+
+	// Tool: nettune.delete_snapshot
+	s.mcpServer.AddTool(
+		mcp.NewTool("nettune.delete_snapshot",
+			mcp.WithDescription("Delete a snapshot. Pinned snapshots and snapshots a pending auto-rollback or an interrupted apply still needs are refused."),
+			mcp.WithString("snapshot_id",
+				mcp.Required(),
+				mcp.Description("The ID of the snapshot to delete"),
+			),
+		),
+		s.handleDeleteSnapshot,
+	)
+
+	// Tool: nettune.export_snapshot
+	s.mcpServer.AddTool(
+		mcp.NewTool("nettune.export_snapshot",
+			mcp.WithDescription("Export a snapshot as a self-contained tar.gz archive (state, file backups and a checksum manifest) to a file on this machine, e.g. to keep a known-good configuration in a config repository or move it to another server with nettune.import_snapshot."),
+			mcp.WithString("snapshot_id",
+				mcp.Required(),
+				mcp.Description("The ID of the snapshot to export, or \"baseline\""),
+			),
+			mcp.WithString("path",
+				mcp.Required(),
+				mcp.Description("Local file to write the archive to; an existing file is not overwritten"),
+			),
+		),
+		s.handleExportSnapshot,
+	)
+
+	// Tool: nettune.import_snapshot
+	s.mcpServer.AddTool(
+		mcp.NewTool("nettune.import_snapshot",
+			mcp.WithDescription("Import a snapshot archive written by nettune.export_snapshot from a file on this machine. The server verifies the checksums and registers it as a new snapshot. Roll back to it with nettune.rollback; if the archive comes from a host with other interface names, pass interface_map there."),
+			mcp.WithString("path",
+				mcp.Required(),
+				mcp.Description("Local archive file to import"),
+			),
+			mcp.WithString("label",
+				mcp.Description("Label for the imported snapshot (default: the label it was exported with)"),
+			),
+			mcp.WithString("note",
+				mcp.Description("Note for the imported snapshot (default: the note it was exported with)"),
+			),
+			mcp.WithBoolean("pin",
+				mcp.Description("Pin the imported snapshot so retention keeps it (default: false)"),
+			),
+		),
+		s.handleImportSnapshot,
+	)
+
 	// Tool: nettune.list_profiles
 	s.mcpServer.AddTool(
 		mcp.NewTool("nettune.list_profiles",
@@ -154,12 +279,52 @@ func (s *Server) registerTools() {
 				mcp.Enum("dry_run", "commit"),
 			),
 			mcp.WithNumber("auto_rollback_seconds",
-				mcp.Description("Seconds to wait before auto-rollback if verification fails (default: 60, 0 to disable)"),
+				mcp.Description("Seconds the server waits for nettune.confirm_apply after a commit before rolling back automatically (default: 60, 0 to disable)"),
+			),
+			mcp.WithString("snapshot_label",
+				mcp.Description("Label for the snapshot a commit takes (max 64 bytes)"),
+			),
+			mcp.WithString("snapshot_note",
+				mcp.Description("Note for the snapshot a commit takes, e.g. why the profile is being tried"),
 			),
 		),
 		s.handleApplyProfile,
 	)
 
+	// Tool: nettune.get_job
+	s.mcpServer.AddTool(
+		mcp.NewTool("nettune.get_job",
+			mcp.WithDescription("Get the progress of an apply job, step by step (snapshot, modules, sysctl, link, steering, route, qdisc, systemd, verification), and its result once finished."),
+			mcp.WithString("job_id",
+				mcp.Required(),
+				mcp.Description("The job ID returned by nettune.apply_profile"),
+			),
+		),
+		s.handleGetJob,
+	)
+
+	// Tool: nettune.list_jobs
+	s.mcpServer.AddTool(
+		mcp.NewTool("nettune.list_jobs",
+			mcp.WithDescription("List recent apply jobs on the server, newest first."),
+			mcp.WithNumber("limit",
+				mcp.Description("Maximum number of jobs to return (default: 10)"),
+			),
+		),
+		s.handleListJobs,
+	)
+
+	// Tool: nettune.confirm_apply
+	s.mcpServer.AddTool(
+		mcp.NewTool("nettune.confirm_apply",
+			mcp.WithDescription("Confirm a committed profile so the server keeps it. Without confirmation before the auto_rollback_seconds deadline, the server rolls back on its own."),
+			mcp.WithString("snapshot_id",
+				mcp.Description("Snapshot ID returned by the commit (optional; defaults to whatever apply is pending)"),
+			),
+		),
+		s.handleConfirmApply,
+	)
+
 	// Tool: nettune.rollback
 	s.mcpServer.AddTool(
 		mcp.NewTool("nettune.rollback",
@@ -170,6 +335,12 @@ func (s *Server) registerTools() {
 			mcp.WithBoolean("rollback_last",
 				mcp.Description("If true, rollback to the most recent snapshot"),
 			),
+			mcp.WithBoolean("rollback_baseline",
+				mcp.Description("If true, rollback to the baseline the server captured the first time it ran on the host, undoing every change nettune made"),
+			),
+			mcp.WithObject("interface_map",
+				mcp.Description("Maps interfaces of the snapshot to interfaces of this server, e.g. {\"ens3\": \"eth0\"}; an empty name skips the interface. Required for imported snapshots whose interfaces are not up on this server."),
+			),
 		),
 		s.handleRollback,
 	)
@@ -206,15 +377,22 @@ func (s *Server) registerTools() {
 				mcp.Description("Whether applying this profile requires a system reboot (default: false)"),
 			),
 			mcp.WithObject("sysctl",
-				mcp.Description("Sysctl parameters to set. Keys are sysctl paths (e.g., 'net.core.rmem_max'), values are the desired settings."),
+				mcp.Description("Sysctl parameters to set. Keys are sysctl paths (e.g., 'net.core.rmem_max'), values are the desired settings. Known keys are checked for type and range: buffer triples like 'net.ipv4.tcp_rmem' must be three integers with min <= default <= max, 'net.ipv4.ip_local_port_range' needs low <= high, and boolean keys accept 0 or 1."),
+			),
+			mcp.WithArray("kernel_modules",
+				mcp.Description("Kernel modules to load and persist in /etc/modules-load.d/nettune.conf before sysctl values are set (e.g., ['tcp_bbr']). The module of tcp_congestion_control is added automatically when it is not built in."),
+				mcp.WithStringItems(),
 			),
 			mcp.WithString("qdisc_type",
 				mcp.Description("Queue discipline type for traffic control"),
 				mcp.Enum("fq", "fq_codel", "cake", "pfifo_fast"),
 			),
 			mcp.WithString("qdisc_interfaces",
-				mcp.Description("Which interfaces to apply qdisc to"),
-				mcp.Enum("default-route", "all"),
+				mcp.Description("Which interfaces to apply qdisc to: 'default-route' (default), 'all' interfaces that are up, or a comma-separated list of names and glob patterns (e.g., 'eth0,ens1f*')"),
+			),
+			mcp.WithArray("qdisc_exclude",
+				mcp.Description("Glob patterns of interfaces to leave untouched (e.g., ['docker*', 'veth*', 'wg*'])"),
+				mcp.WithStringItems(),
 			),
 			mcp.WithObject("qdisc_params",
 				mcp.Description("Additional qdisc parameters. Valid params by type: "+
@@ -223,6 +401,66 @@ func (s *Server) registerTools() {
 					"cake: bandwidth, besteffort, diffserv3, diffserv4, diffserv8, flowblind, srchost, dsthost, hosts, flows, memlimit, rtt, overhead; "+
 					"pfifo_fast: (no params). Example: {'limit': 10000} for fq."),
 			),
+			mcp.WithObject("qdisc_per_interface",
+				mcp.Description("Per-interface qdisc overrides keyed by interface name or glob pattern; an exact name wins over globs. "+
+					"Example: {'wg*': {'type': 'fq_codel'}, 'eth1': {'type': 'cake', 'params': {'bandwidth': '1gbit'}}}"),
+			),
+			mcp.WithString("link_interfaces",
+				mcp.Description("Which interfaces get the link settings (ethtool offloads, rings, coalescing), with the same syntax as qdisc_interfaces (default: 'default-route'). Link settings are always persisted with the nettune-link.service unit."),
+			),
+			mcp.WithArray("link_exclude",
+				mcp.Description("Glob patterns of interfaces to leave out of the link settings"),
+				mcp.WithStringItems(),
+			),
+			mcp.WithNumber("link_mtu",
+				mcp.Description("MTU of the selected interfaces. Changing the MTU of the interface the nettune client connects through requires auto_rollback_seconds on apply."),
+			),
+			mcp.WithNumber("link_txqueuelen",
+				mcp.Description("Transmit queue length (packets) of the selected interfaces; a shorter queue pairs well with fq_codel or cake"),
+			),
+			mcp.WithObject("link_offloads",
+				mcp.Description("Offload features to switch on (true) or off (false), by ethtool short name or feature name. Example: {'gro': true, 'lro': false, 'rx-gro-hw': true}"),
+			),
+			mcp.WithObject("link_rings",
+				mcp.Description("Ring buffer sizes for 'rx', 'tx', 'rx-mini' or 'rx-jumbo'. Example: {'rx': 4096, 'tx': 4096}"),
+			),
+			mcp.WithObject("link_coalesce",
+				mcp.Description("Interrupt coalescing: 'adaptive-rx' and 'adaptive-tx' as booleans, counters such as 'rx-usecs', 'rx-frames', 'tx-usecs', 'tx-frames' as integers. Example: {'adaptive-rx': false, 'rx-usecs': 50}"),
+			),
+			mcp.WithObject("link_per_interface",
+				mcp.Description("Per-interface link settings keyed by interface name or glob pattern, replacing the shared ones; an exact name wins over globs. "+
+					"Example: {'ens1f*': {'rings': {'rx': 8192}, 'offloads': {'lro': true}}, 'eth1': {'mtu': 9000}}"),
+			),
+			mcp.WithString("steering_interfaces",
+				mcp.Description("Which interfaces get the queue steering and IRQ affinity settings, with the same syntax as qdisc_interfaces (default: 'default-route'). These are runtime settings and are not reapplied at boot."),
+			),
+			mcp.WithArray("steering_exclude",
+				mcp.Description("Glob patterns of interfaces to leave out of the steering settings"),
+				mcp.WithStringItems(),
+			),
+			mcp.WithString("rps_cpus",
+				mcp.Description("Hex CPU mask written to rps_cpus of every rx queue, such as 'f' or 'ff,ffffffff'; 'all' for every online CPU, '0' to disable RPS. Every CPU in a mask must be online."),
+			),
+			mcp.WithNumber("rps_flow_cnt",
+				mcp.Description("RFS flow table size of every rx queue; 0 or a power of two. Pair with net.core.rps_sock_flow_entries."),
+			),
+			mcp.WithString("xps_cpus",
+				mcp.Description("Hex CPU mask written to xps_cpus of every tx queue, 'all', or 'spread' to give each queue one CPU in turn"),
+			),
+			mcp.WithString("irq_affinity",
+				mcp.Description("Hex CPU mask written to smp_affinity of every IRQ of the NIC, 'all', or 'spread' to give each IRQ one CPU in turn. irqbalance may overwrite it."),
+			),
+			mcp.WithObject("steering_per_interface",
+				mcp.Description("Per-interface steering settings keyed by interface name or glob pattern, replacing the shared ones; an exact name wins over globs. "+
+					"Example: {'eth1': {'rps_cpus': 'f0', 'irq_affinity': 'spread'}}"),
+			),
+			mcp.WithObject("route_default",
+				mcp.Description("TCP attributes for the IPv4 and IPv6 default routes: 'initcwnd' and 'initrwnd' in segments, 'congctl' a congestion control name. Unset attributes keep their value. Route attributes are always persisted with the nettune-route.service unit. "+
+					"Example: {'initcwnd': 10, 'initrwnd': 10}"),
+			),
+			mcp.WithObject("route_prefixes",
+				mcp.Description("TCP attributes keyed by destination prefix of an existing main table route. Example: {'10.0.0.0/8': {'initcwnd': 20, 'congctl': 'bbr'}}"),
+			),
 			mcp.WithBoolean("systemd_ensure_qdisc_service",
 				mcp.Description("Whether to create a systemd service to persist qdisc settings across reboots (default: false)"),
 			),
@@ -284,7 +522,16 @@ func (s *Server) handleTestLatencyUnderLoad(ctx context.Context, request mcp.Cal
 }
 
 func (s *Server) handleSnapshotServer(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	snapshot, err := s.client.CreateSnapshot()
+	args := parseArgs(request.Params.Arguments)
+	full := getBoolArg(args, "full", false)
+	pin := getBoolArg(args, "pin", false)
+
+	snapshot, err := s.client.CreateSnapshot(&types.SnapshotRequest{
+		Full:  full,
+		Pin:   pin,
+		Label: getStringArg(args, "label", ""),
+		Note:  getStringArg(args, "note", ""),
+	})
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Error: %v", err)), nil
 	}
@@ -292,9 +539,139 @@ func (s *Server) handleSnapshotServer(ctx context.Context, request mcp.CallToolR
 	return mcp.NewToolResultText(toJSON(map[string]interface{}{
 		"snapshot_id":   snapshot.ID,
 		"current_state": snapshot.State,
+		"pinned":        snapshot.Pinned,
+		"label":         snapshot.Label,
 	})), nil
 }
 
+func (s *Server) handleListSnapshots(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := parseArgs(request.Params.Arguments)
+
+	snapshots, err := s.client.ListSnapshots(&types.SnapshotFilter{
+		Label:     getStringArg(args, "label", ""),
+		ProfileID: getStringArg(args, "profile", ""),
+		Reason:    getStringArg(args, "reason", ""),
+		ClientIP:  getStringArg(args, "client_ip", ""),
+		Query:     getStringArg(args, "query", ""),
+		Pinned:    getBoolArg(args, "pinned", false),
+	})
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(toJSON(map[string]interface{}{
+		"snapshots": snapshots,
+	})), nil
+}
+
+func (s *Server) handleDiffSnapshots(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := parseArgs(request.Params.Arguments)
+	snapshotID := getStringArg(args, "snapshot_id", "")
+	if snapshotID == "" {
+		return mcp.NewToolResultError("Error: snapshot_id is required"), nil
+	}
+
+	diff, err := s.client.DiffSnapshot(snapshotID, getStringArg(args, "against", types.SnapshotCurrent))
+	if err != nil {
+		if containsAny(err.Error(), "NOT_FOUND") {
+			return mcp.NewToolResultError("Error: snapshot not found. Snapshots may have been removed by retention; pin the ones you want to compare against later."), nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Error: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(toJSON(diff)), nil
+}
+
+func (s *Server) handlePinSnapshot(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := parseArgs(request.Params.Arguments)
+	snapshotID := getStringArg(args, "snapshot_id", "")
+	if snapshotID == "" {
+		return mcp.NewToolResultError("Error: snapshot_id is required"), nil
+	}
+
+	meta, err := s.client.PinSnapshot(snapshotID, getBoolArg(args, "pinned", true))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(toJSON(meta)), nil
+}
+
+func (s *Server) handleDeleteSnapshot(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := parseArgs(request.Params.Arguments)
+	snapshotID := getStringArg(args, "snapshot_id", "")
+	if snapshotID == "" {
+		return mcp.NewToolResultError("Error: snapshot_id is required"), nil
+	}
+
+	if err := s.client.DeleteSnapshot(snapshotID); err != nil {
+		if containsAny(err.Error(), "SNAPSHOT_PROTECTED") {
+			return mcp.NewToolResultError(fmt.Sprintf(
+				"Error: the snapshot is protected and was not deleted. Unpin it with nettune.pin_snapshot pinned=false, or confirm or roll back the apply that needs it first. Original error: %v",
+				err)), nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Error: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(toJSON(map[string]interface{}{
+		"snapshot_id": snapshotID,
+		"deleted":     true,
+	})), nil
+}
+
+func (s *Server) handleExportSnapshot(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := parseArgs(request.Params.Arguments)
+	snapshotID := getStringArg(args, "snapshot_id", "")
+	path := getStringArg(args, "path", "")
+	if snapshotID == "" || path == "" {
+		return mcp.NewToolResultError("Error: snapshot_id and path are required"), nil
+	}
+
+	archive, err := s.client.ExportSnapshot(snapshotID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error: %v", err)), nil
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error: cannot create %s: %v", path, err)), nil
+	}
+	if _, err := file.Write(archive); err != nil {
+		file.Close()
+		return mcp.NewToolResultError(fmt.Sprintf("Error: failed to write %s: %v", path, err)), nil
+	}
+	if err := file.Close(); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error: failed to write %s: %v", path, err)), nil
+	}
+
+	return mcp.NewToolResultText(toJSON(map[string]interface{}{
+		"snapshot_id": snapshotID,
+		"path":        path,
+		"bytes":       len(archive),
+	})), nil
+}
+
+func (s *Server) handleImportSnapshot(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := parseArgs(request.Params.Arguments)
+	path := getStringArg(args, "path", "")
+	if path == "" {
+		return mcp.NewToolResultError("Error: path is required"), nil
+	}
+
+	archive, err := os.ReadFile(path)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error: cannot read %s: %v", path, err)), nil
+	}
+
+	meta, err := s.client.ImportSnapshot(archive,
+		getStringArg(args, "label", ""), getStringArg(args, "note", ""), getBoolArg(args, "pin", false))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(toJSON(meta)), nil
+}
+
 func (s *Server) handleListProfiles(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	profiles, err := s.client.ListProfiles()
 	if err != nil {
@@ -342,9 +719,18 @@ func (s *Server) handleApplyProfile(ctx context.Context, request mcp.CallToolReq
 		ProfileID:           profileID,
 		Mode:                mode,
 		AutoRollbackSeconds: autoRollback,
+		SnapshotLabel:       getStringArg(args, "snapshot_label", ""),
+		SnapshotNote:        getStringArg(args, "snapshot_note", ""),
 	}
 
-	result, err := s.client.Apply(req)
+	// Commits run as server-side jobs and are polled, so slow applies don't hit the client timeout
+	var result *types.ApplyResult
+	var err error
+	if mode == "commit" {
+		result, err = s.commitAndWait(req)
+	} else {
+		result, err = s.client.Apply(req)
+	}
 	if err != nil {
 		errMsg := err.Error()
 		// Provide helpful guidance based on error type
@@ -353,6 +739,14 @@ func (s *Server) handleApplyProfile(ctx context.Context, request mcp.CallToolReq
 				"Error: profile '%s' not found. Use nettune.list_profiles to see available profiles, or nettune.create_profile to create a new one.",
 				profileID)), nil
 		}
+		if containsAny(errMsg, "CONFIRM_PENDING") {
+			return mcp.NewToolResultError(
+				"Error: a previous commit is still awaiting confirmation. Use nettune.confirm_apply to keep it or nettune.rollback to revert it before committing another profile."), nil
+		}
+		if containsAny(errMsg, "RECOVERY_PENDING") {
+			return mcp.NewToolResultError(
+				"Error: the server found an apply that was interrupted by a crash and did not roll it back automatically. Check nettune.status for the recorded snapshot and use nettune.rollback before committing again."), nil
+		}
 		if containsAny(errMsg, "connection refused", "no such host", "timeout") {
 			return mcp.NewToolResultError(fmt.Sprintf(
 				"Error: cannot connect to nettune server. Please verify: 1) Server is running, 2) Server URL is correct, 3) Network connectivity. Original error: %v",
@@ -364,23 +758,113 @@ func (s *Server) handleApplyProfile(ctx context.Context, request mcp.CallToolReq
 	return mcp.NewToolResultText(toJSON(result)), nil
 }
 
+// commitAndWait submits a commit as a job and waits for it to finish
+func (s *Server) commitAndWait(req *types.ApplyRequest) (*types.ApplyResult, error) {
+	job, err := s.client.ApplyAsync(req)
+	if err != nil {
+		return nil, err
+	}
+
+	jobID := job.ID
+	job, err = s.client.WaitForJob(jobID, applyJobPollInterval, applyJobWaitTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w; use nettune.get_job with job_id %s to follow it", err, jobID)
+	}
+	if job.Result == nil {
+		return nil, fmt.Errorf("apply job %s failed: %s", job.ID, job.Error)
+	}
+	return job.Result, nil
+}
+
+func (s *Server) handleGetJob(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := parseArgs(request.Params.Arguments)
+	jobID := getStringArg(args, "job_id", "")
+	if jobID == "" {
+		return mcp.NewToolResultError("Error: job_id is required. Use nettune.list_jobs to see recent jobs."), nil
+	}
+
+	job, err := s.client.GetJob(jobID)
+	if err != nil {
+		if containsAny(err.Error(), "JOB_NOT_FOUND") {
+			return mcp.NewToolResultError(fmt.Sprintf(
+				"Error: job '%s' not found. Jobs are kept in memory only and are lost when the server restarts. Use nettune.list_jobs to see recent jobs.",
+				jobID)), nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Error: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(toJSON(job)), nil
+}
+
+func (s *Server) handleListJobs(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := parseArgs(request.Params.Arguments)
+	limit := getIntArg(args, "limit", 10)
+
+	jobs, err := s.client.ListJobs(limit)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Error: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(toJSON(map[string]interface{}{
+		"jobs": jobs,
+	})), nil
+}
+
+func (s *Server) handleConfirmApply(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := parseArgs(request.Params.Arguments)
+	snapshotID := getStringArg(args, "snapshot_id", "")
+
+	result, err := s.client.Confirm(&types.ConfirmRequest{SnapshotID: snapshotID})
+	if err != nil {
+		if containsAny(err.Error(), "NO_PENDING_ROLLBACK") {
+			return mcp.NewToolResultError(
+				"Error: no apply is awaiting confirmation. It may have been confirmed already, or the deadline passed and the server rolled back. Check nettune.status."), nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Error: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(toJSON(result)), nil
+}
+
 func (s *Server) handleRollback(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	args := parseArgs(request.Params.Arguments)
 	snapshotID := getStringArg(args, "snapshot_id", "")
 	rollbackLast := getBoolArg(args, "rollback_last", false)
+	rollbackBaseline := getBoolArg(args, "rollback_baseline", false)
 
-	if snapshotID == "" && !rollbackLast {
-		return mcp.NewToolResultError("Error: either snapshot_id or rollback_last=true is required. Use rollback_last=true to rollback to the most recent snapshot, or provide a specific snapshot_id."), nil
+	if snapshotID == "" && !rollbackLast && !rollbackBaseline {
+		return mcp.NewToolResultError("Error: one of snapshot_id, rollback_last=true or rollback_baseline=true is required. Use rollback_last=true to rollback to the most recent snapshot, rollback_baseline=true to undo everything nettune changed, or provide a specific snapshot_id."), nil
 	}
 
 	req := &types.RollbackRequest{
-		SnapshotID:   snapshotID,
-		RollbackLast: rollbackLast,
+		SnapshotID:       snapshotID,
+		RollbackLast:     rollbackLast,
+		RollbackBaseline: rollbackBaseline,
+	}
+	if ifaceMap := getMapArg(args, "interface_map"); ifaceMap != nil {
+		req.InterfaceMap = make(map[string]string, len(ifaceMap))
+		for from, to := range ifaceMap {
+			// null skips the interface like an empty name
+			if to != nil {
+				req.InterfaceMap[from] = fmt.Sprint(to)
+			} else {
+				req.InterfaceMap[from] = ""
+			}
+		}
 	}
 
 	result, err := s.client.Rollback(req)
 	if err != nil {
 		errMsg := err.Error()
+		if containsAny(errMsg, "interface_map") {
+			return mcp.NewToolResultError(fmt.Sprintf(
+				"Error: the snapshot does not fit this server's interfaces and nothing was changed. Pass interface_map to map each listed interface to a local one, or to \"\" to skip it. Original error: %v",
+				err)), nil
+		}
+		if containsAny(errMsg, "no baseline") {
+			return mcp.NewToolResultError(
+				"Error: this host has no baseline snapshot. nettune had already changed it before the oldest surviving snapshot, so there is no pristine state to return to."), nil
+		}
 		if containsAny(errMsg, "no snapshot", "snapshot not found", "NOT_FOUND") {
 			return mcp.NewToolResultError(
 				"Error: snapshot not found. Make sure you have created a snapshot using nettune.snapshot_server before applying changes. Use rollback_last=true to rollback to the most recent snapshot."), nil
@@ -452,6 +936,8 @@ func (s *Server) handleCreateProfile(ctx context.Context, request mcp.CallToolRe
 		profile.Sysctl = sysctl
 	}
 
+	profile.KernelModules = getStringSliceArg(args, "kernel_modules")
+
 	// Parse qdisc config
 	qdiscType := getStringArg(args, "qdisc_type", "")
 	qdiscInterfaces := getStringArg(args, "qdisc_interfaces", "")
@@ -466,6 +952,78 @@ func (s *Server) handleCreateProfile(ctx context.Context, request mcp.CallToolRe
 		if qdiscParams := getMapArg(args, "qdisc_params"); qdiscParams != nil {
 			profile.Qdisc.Params = qdiscParams
 		}
+		profile.Qdisc.Exclude = getStringSliceArg(args, "qdisc_exclude")
+		if perInterface := getMapArg(args, "qdisc_per_interface"); perInterface != nil {
+			profile.Qdisc.PerInterface = make(map[string]*types.QdiscOverride)
+			for pattern, value := range perInterface {
+				override, _ := value.(map[string]interface{})
+				profile.Qdisc.PerInterface[pattern] = &types.QdiscOverride{
+					Type:   getStringArg(override, "type", ""),
+					Params: getMapArg(override, "params"),
+				}
+			}
+		}
+	}
+
+	// Parse link config
+	linkSettings := linkSettingsArg(args)
+	linkPerInterface := getMapArg(args, "link_per_interface")
+	if !linkSettings.IsEmpty() || linkPerInterface != nil {
+		profile.Link = &types.LinkConfig{
+			Interfaces:   getStringArg(args, "link_interfaces", "default-route"),
+			Exclude:      getStringSliceArg(args, "link_exclude"),
+			LinkSettings: linkSettings,
+		}
+		if linkPerInterface != nil {
+			profile.Link.PerInterface = make(map[string]*types.LinkSettings)
+			for pattern, value := range linkPerInterface {
+				override, _ := value.(map[string]interface{})
+				settings := linkSettingsArg(map[string]interface{}{
+					"link_mtu":        override["mtu"],
+					"link_txqueuelen": override["txqueuelen"],
+					"link_offloads":   override["offloads"],
+					"link_rings":      override["rings"],
+					"link_coalesce":   override["coalesce"],
+				})
+				profile.Link.PerInterface[pattern] = &settings
+			}
+		}
+	}
+
+	// Parse steering config
+	steeringSettings := steeringSettingsArg(args)
+	steeringPerInterface := getMapArg(args, "steering_per_interface")
+	if !steeringSettings.IsEmpty() || steeringPerInterface != nil {
+		profile.Steering = &types.SteeringConfig{
+			Interfaces:       getStringArg(args, "steering_interfaces", "default-route"),
+			Exclude:          getStringSliceArg(args, "steering_exclude"),
+			SteeringSettings: steeringSettings,
+		}
+		if steeringPerInterface != nil {
+			profile.Steering.PerInterface = make(map[string]*types.SteeringSettings)
+			for pattern, value := range steeringPerInterface {
+				override, _ := value.(map[string]interface{})
+				settings := steeringSettingsArg(override)
+				profile.Steering.PerInterface[pattern] = &settings
+			}
+		}
+	}
+
+	// Parse route config
+	routeDefault := getMapArg(args, "route_default")
+	routePrefixes := getMapArg(args, "route_prefixes")
+	if routeDefault != nil || routePrefixes != nil {
+		profile.Routes = &types.RouteConfig{}
+		if routeDefault != nil {
+			profile.Routes.Default = routeAttrsArg(routeDefault)
+		}
+		if routePrefixes != nil {
+			profile.Routes.Prefixes = make(map[string]*types.RouteAttrs)
+			for prefix, value := range routePrefixes {
+				attrs, _ := value.(map[string]interface{})
+				profile.Routes.Prefixes[prefix] = routeAttrsArg(attrs)
+			}
+		}
 	}
 
 	// Parse systemd config
@@ -484,7 +1042,7 @@ func (s *Server) handleCreateProfile(ctx context.Context, request mcp.CallToolRe
 		if containsAny(errMsg, "validation", "invalid") {
 			// Validation error - the error message already contains details about what's wrong
 			return mcp.NewToolResultError(fmt.Sprintf(
-				"Error creating profile: %v. Please check parameter values and try again.",
+				"Error creating profile: %v. Each 'sysctl <key>: ...' entry names a value that failed the schema check; fix those values and try again.",
 				err)), nil
 		}
 		if containsAny(errMsg, "connection refused", "no such host", "timeout") {
@@ -504,6 +1062,68 @@ func (s *Server) handleCreateProfile(ctx context.Context, request mcp.CallToolRe
 
 // Helper functions for argument parsing
 
+// linkSettingsArg reads link_mtu, link_txqueuelen, link_offloads, link_rings and
+// link_coalesce. Offloads may also be given as "on" or "off"; ring sizes that are
+// not numbers become 0 so that profile validation reports them.
+func linkSettingsArg(args map[string]interface{}) types.LinkSettings {
+	var settings types.LinkSettings
+	if args["link_mtu"] != nil {
+		mtu := getIntArg(args, "link_mtu", 0)
+		settings.MTU = &mtu
+	}
+	if args["link_txqueuelen"] != nil {
+		qlen := getIntArg(args, "link_txqueuelen", -1)
+		settings.TxQueueLen = &qlen
+	}
+	if offloads := getMapArg(args, "link_offloads"); offloads != nil {
+		settings.Offloads = make(map[string]bool, len(offloads))
+		for name, value := range offloads {
+			switch v := value.(type) {
+			case bool:
+				settings.Offloads[name] = v
+			case string:
+				settings.Offloads[name] = v == "on" || v == "true"
+			}
+		}
+	}
+	if rings := getMapArg(args, "link_rings"); rings != nil {
+		settings.Rings = make(map[string]int, len(rings))
+		for name := range rings {
+			settings.Rings[name] = getIntArg(rings, name, 0)
+		}
+	}
+	settings.Coalesce = getMapArg(args, "link_coalesce")
+	return settings
+}
+
+// steeringSettingsArg reads rps_cpus, rps_flow_cnt, xps_cpus and irq_affinity
+func steeringSettingsArg(args map[string]interface{}) types.SteeringSettings {
+	settings := types.SteeringSettings{
+		RPSCPUs:     getStringArg(args, "rps_cpus", ""),
+		XPSCPUs:     getStringArg(args, "xps_cpus", ""),
+		IRQAffinity: getStringArg(args, "irq_affinity", ""),
+	}
+	if _, ok := args["rps_flow_cnt"]; ok {
+		flows := getIntArg(args, "rps_flow_cnt", 0)
+		settings.RPSFlowCnt = &flows
+	}
+	return settings
+}
+
+// routeAttrsArg reads initcwnd, initrwnd and congctl
+func routeAttrsArg(args map[string]interface{}) *types.RouteAttrs {
+	attrs := &types.RouteAttrs{CongCtl: getStringArg(args, "congctl", "")}
+	if args["initcwnd"] != nil {
+		cwnd := getIntArg(args, "initcwnd", 0)
+		attrs.InitCwnd = &cwnd
+	}
+	if args["initrwnd"] != nil {
+		rwnd := getIntArg(args, "initrwnd", 0)
+		attrs.InitRwnd = &rwnd
+	}
+	return attrs
+}
+
 // parseArgs converts the any type arguments to map[string]interface{}
 func parseArgs(args any) map[string]interface{} {
 	if args == nil {
@@ -577,6 +1197,20 @@ func getMapArg(args map[string]interface{}, key string) map[string]interface{} {
 	return nil
 }
 
+func getStringSliceArg(args map[string]interface{}, key string) []string {
+	items, ok := args[key].([]interface{})
+	if !ok {
+		return nil
+	}
+	var result []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
 func toJSON(v interface{}) string {
 	data, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
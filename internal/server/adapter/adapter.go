@@ -1,23 +1,77 @@
 package adapter
 
-import "go.uber.org/zap"
+import (
+	"path/filepath"
+
+	"go.uber.org/zap"
+)
 
 // SystemAdapter aggregates all system adapters
 type SystemAdapter struct {
-	Sysctl  *SysctlManager
-	Qdisc   *QdiscManager
-	Systemd *SystemdManager
-	SysInfo *SystemInfoManager
-	logger  *zap.Logger
+	Sysctl   SysctlAdapter
+	Qdisc    QdiscAdapter
+	Link     LinkAdapter
+	Steering SteeringAdapter
+	Route    RouteAdapter
+	Systemd  SystemdAdapter
+	Modules  ModuleAdapter
+	SysInfo  SystemInfoAdapter
+	// Root prefixes the host paths nettune reads and writes; empty on a real system
+	Root   string
+	logger *zap.Logger
 }
 
 // NewSystemAdapter creates a new SystemAdapter with all managers
 func NewSystemAdapter(logger *zap.Logger) *SystemAdapter {
 	return &SystemAdapter{
-		Sysctl:  NewSysctlManager(logger),
-		Qdisc:   NewQdiscManager(logger),
-		Systemd: NewSystemdManager(logger),
-		SysInfo: NewSystemInfoManager(logger),
-		logger:  logger,
+		Sysctl:   NewSysctlManager(logger),
+		Qdisc:    NewQdiscManager(logger),
+		Link:     NewLinkManager(logger),
+		Steering: NewSteeringManager(logger),
+		Route:    NewRouteManager(logger),
+		Systemd:  NewSystemdManager(logger),
+		Modules:  NewModuleManager(logger),
+		SysInfo:  NewSystemInfoManager(logger),
+		logger:   logger,
+	}
+}
+
+// Path returns where a host path such as a managed file lives under Root
+func (a *SystemAdapter) Path(path string) string {
+	if a.Root == "" {
+		return path
+	}
+	return filepath.Join(a.Root, path)
+}
+
+// SysctlConfigFiles lists the sysctl configuration files under Root in boot order.
+// Extra host paths are listed as if they already existed.
+func (a *SystemAdapter) SysctlConfigFiles(extra ...string) []string {
+	if a.Root == "" {
+		return SysctlConfigFiles(extra...)
+	}
+
+	dirs := make([]string, len(SysctlConfigDirs))
+	for i, dir := range SysctlConfigDirs {
+		dirs[i] = a.Path(dir)
+	}
+	rooted := make([]string, len(extra))
+	for i, path := range extra {
+		rooted[i] = a.Path(path)
+	}
+	return sysctlConfigFiles(dirs, a.Path(SysctlConfFile), rooted)
+}
+
+// ManagedFiles returns the files nettune writes and tracks in snapshots
+func ManagedFiles() []string {
+	return []string{
+		NettuneSysctlFilePath,
+		NettuneQdiscScriptPath,
+		NettuneQdiscUnitPath,
+		NettuneLinkScriptPath,
+		NettuneLinkUnitPath,
+		NettuneRouteScriptPath,
+		NettuneRouteUnitPath,
+		NettuneModulesLoadPath,
 	}
 }
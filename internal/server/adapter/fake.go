@@ -0,0 +1,850 @@
+package adapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"github.com/jtsang4/nettune/internal/shared/utils"
+	"go.uber.org/zap"
+)
+
+// fakeStatePath holds the emulated qdisc, link, route, systemd and module state under a fake root
+const fakeStatePath = "/var/lib/nettune-fake/state.json"
+
+// fakeInterfaces are the interfaces of an emulated host; eth0 holds both default routes
+var fakeInterfaces = []string{"eth0", "eth1"}
+
+// fakeAvailableModules are the modules modprobe finds on an emulated host
+var fakeAvailableModules = map[string]bool{
+	"sch_cake": true, "sch_fq": true, "sch_fq_codel": true,
+	"tcp_bbr": true, "tcp_htcp": true, "tcp_hybla": true, "tcp_illinois": true,
+	"tcp_vegas": true, "tcp_westwood": true,
+}
+
+// fakeSysctlDefaults are the sysctl values of a freshly booted emulated host
+var fakeSysctlDefaults = map[string]string{
+	"net.core.default_qdisc":             "fq_codel",
+	"net.core.netdev_max_backlog":        "1000",
+	"net.core.rmem_default":              "212992",
+	"net.core.rmem_max":                  "212992",
+	"net.core.somaxconn":                 "4096",
+	"net.core.wmem_default":              "212992",
+	"net.core.wmem_max":                  "212992",
+	"net.ipv4.ip_local_port_range":       "32768\t60999",
+	"net.ipv4.tcp_congestion_control":    "cubic",
+	"net.ipv4.tcp_ecn":                   "2",
+	"net.ipv4.tcp_fastopen":              "1",
+	"net.ipv4.tcp_fin_timeout":           "60",
+	"net.ipv4.tcp_keepalive_time":        "7200",
+	"net.ipv4.tcp_max_syn_backlog":       "1024",
+	"net.ipv4.tcp_mtu_probing":           "0",
+	"net.ipv4.tcp_no_metrics_save":       "0",
+	"net.ipv4.tcp_notsent_lowat":         "4294967295",
+	"net.ipv4.tcp_rmem":                  "4096\t131072\t6291456",
+	"net.ipv4.tcp_sack":                  "1",
+	"net.ipv4.tcp_slow_start_after_idle": "1",
+	"net.ipv4.tcp_timestamps":            "1",
+	"net.ipv4.tcp_tw_reuse":              "2",
+	"net.ipv4.tcp_window_scaling":        "1",
+	"net.ipv4.tcp_wmem":                  "4096\t16384\t4194304",
+}
+
+// fakeLinkDefaults are the MTU, queue length, offloads, rings and coalescing
+// of each emulated NIC
+var fakeLinkDefaults = types.LinkSettings{
+	MTU:        intPtr(1500),
+	TxQueueLen: intPtr(1000),
+	Offloads: map[string]bool{
+		"rx-checksumming":              true,
+		"tx-checksumming":              true,
+		"scatter-gather":               true,
+		"tcp-segmentation-offload":     true,
+		"generic-segmentation-offload": true,
+		"generic-receive-offload":      true,
+		"large-receive-offload":        false,
+		"rx-gro-hw":                    false,
+		"receive-hashing":              true,
+	},
+	Rings: map[string]int{"rx": 256, "tx": 256},
+	Coalesce: map[string]interface{}{
+		"adaptive-rx": false, "adaptive-tx": false,
+		"rx-usecs": 3, "rx-frames": 0, "tx-usecs": 0, "tx-frames": 0,
+	},
+}
+
+// fakeOnlineCPUs are the CPUs of an emulated host
+const fakeOnlineCPUs = "0-3"
+
+// fakeIRQs are the MSI vectors of each emulated NIC; each has two rx and two tx queues
+var fakeIRQs = map[string][]int{"eth0": {24, 25, 26}, "eth1": {27, 28, 29}}
+
+// fakeAddrs are the addresses of the emulated interfaces
+var fakeAddrs = map[string]string{
+	"127.0.0.1":     "lo",
+	"::1":           "lo",
+	"192.0.2.10":    "eth0",
+	"2001:db8::10":  "eth0",
+	"198.51.100.10": "eth1",
+}
+
+// fakeRouteTable is the main routing table of an emulated host
+var fakeRouteTable = []*Route{
+	{Family: RouteFamilyIPv4, Spec: "default via 192.0.2.1 dev eth0 proto dhcp src 192.0.2.10 metric 100"},
+	{Family: RouteFamilyIPv4, Spec: "10.0.0.0/8 via 198.51.100.1 dev eth1 proto static"},
+	{Family: RouteFamilyIPv4, Spec: "192.0.2.0/24 dev eth0 proto kernel scope link src 192.0.2.10"},
+	{Family: RouteFamilyIPv4, Spec: "198.51.100.0/24 dev eth1 proto kernel scope link src 198.51.100.10"},
+	{Family: RouteFamilyIPv6, Spec: "2001:db8::/64 dev eth0 proto kernel metric 256 pref medium"},
+	{Family: RouteFamilyIPv6, Spec: "default via fe80::1 dev eth0 proto ra metric 1024 pref medium"},
+}
+
+// fakeMaxMTU is the largest MTU the emulated NICs accept
+const fakeMaxMTU = 9000
+
+// fakeRingMax is the largest ring size the emulated NICs accept
+const fakeRingMax = 4096
+
+// fakeAvailableCCKey lists the loaded congestion controls and is read-only
+const fakeAvailableCCKey = "net.ipv4.tcp_available_congestion_control"
+
+// NewFakeSystemAdapter creates a SystemAdapter that emulates a Linux host under
+// root. Sysctl values live in root/proc/sys, managed files under their usual
+// paths below root, NIC queues and IRQs in root/sys and root/proc, and qdisc,
+// link, route, systemd and module state in a JSON file there.
+// Nothing on the real host is read or changed, and state from earlier runs is kept.
+func NewFakeSystemAdapter(root string, logger *zap.Logger) (*SystemAdapter, error) {
+	a := &SystemAdapter{Root: root, logger: logger}
+
+	for _, file := range append(ManagedFiles(), fakeStatePath) {
+		if err := utils.EnsureDir(filepath.Dir(a.Path(file))); err != nil {
+			return nil, fmt.Errorf("failed to create fake root: %w", err)
+		}
+	}
+
+	sysctl := NewRootedSysctlManager(root, logger)
+	if err := seedFakeSysctl(sysctl, fakeSysctlDefaults); err != nil {
+		return nil, err
+	}
+	if err := seedFakeSysctl(sysctl, map[string]string{fakeAvailableCCKey: "reno cubic"}); err != nil {
+		return nil, err
+	}
+
+	if err := seedFakeSteering(a); err != nil {
+		return nil, err
+	}
+
+	state, err := loadFakeState(a.Path(fakeStatePath))
+	if err != nil {
+		return nil, err
+	}
+
+	qdisc := &fakeQdisc{state: state, sysctl: sysctl}
+	a.Sysctl = sysctl
+	a.Qdisc = qdisc
+	link := &fakeLink{state: state}
+	a.Link = link
+	a.Route = &fakeRoute{state: state, sysctl: sysctl}
+	a.Steering = NewRootedSteeringManager(root, logger)
+	a.Systemd = &fakeSystemd{state: state, unitDir: a.Path(SystemdUnitDir), logger: logger}
+	a.Modules = &fakeModules{state: state, sysctl: sysctl, files: NewModuleManager(logger), logger: logger}
+	a.SysInfo = &fakeSystemInfo{sysctl: sysctl, qdisc: qdisc, link: link}
+	return a, nil
+}
+
+// seedFakeSysctl creates the sysctl files that do not exist yet
+func seedFakeSysctl(sysctl *SysctlManager, values map[string]string) error {
+	for key, value := range values {
+		path, err := sysctl.keyToPath(key)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		mode := os.FileMode(0644)
+		if key == fakeAvailableCCKey {
+			mode = 0444
+		}
+		if err := utils.AtomicWriteFile(path, []byte(value+"\n"), mode); err != nil {
+			return fmt.Errorf("failed to seed fake sysctl %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// seedFakeSteering creates the CPU, queue and IRQ files of the emulated NICs
+// that do not exist yet
+func seedFakeSteering(a *SystemAdapter) error {
+	files := map[string]string{cpuOnlinePath: fakeOnlineCPUs}
+	for _, iface := range fakeInterfaces {
+		for _, queue := range []string{"rx-0", "rx-1"} {
+			files[QueuePath(iface, queue, "rps_cpus")] = "0"
+			files[QueuePath(iface, queue, "rps_flow_cnt")] = "0"
+		}
+		for _, queue := range []string{"tx-0", "tx-1"} {
+			files[QueuePath(iface, queue, "xps_cpus")] = "0"
+		}
+		for _, irq := range fakeIRQs[iface] {
+			files[filepath.Join(sysClassNetDir, iface, "device", "msi_irqs", strconv.Itoa(irq))] = "msix"
+			files[IRQAffinityPath(irq)] = "f"
+		}
+	}
+
+	for file, value := range files {
+		path := a.Path(file)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		if err := utils.EnsureDir(filepath.Dir(path)); err != nil {
+			return fmt.Errorf("failed to create fake root: %w", err)
+		}
+		if err := utils.AtomicWriteFile(path, []byte(value+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to seed fake %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// fakeState is the emulated kernel and init system state shared by the fake managers
+type fakeState struct {
+	mu         sync.Mutex
+	path       string
+	Qdiscs     map[string]*types.QdiscInfo    `json:"qdiscs"`
+	Links      map[string]*types.LinkSettings `json:"links"`
+	Routes     types.DefaultRoutes            `json:"default_routes"`
+	RouteTable []*Route                       `json:"route_table"`
+	Units      map[string]*fakeUnit           `json:"units"`
+	Modules    map[string]bool                `json:"loaded_modules"`
+	NextHandle uint32                         `json:"next_handle"`
+}
+
+// fakeUnit is the state of an emulated systemd unit
+type fakeUnit struct {
+	Enabled bool `json:"enabled"`
+	Active  bool `json:"active"`
+}
+
+// loadFakeState reads the emulated state, starting from a fresh host when absent
+func loadFakeState(path string) (*fakeState, error) {
+	state := &fakeState{
+		path:       path,
+		Qdiscs:     make(map[string]*types.QdiscInfo),
+		Links:      make(map[string]*types.LinkSettings),
+		Routes:     types.DefaultRoutes{IPv4: fakeInterfaces[0], IPv6: fakeInterfaces[0]},
+		RouteTable: copyRoutes(fakeRouteTable),
+		Units:      make(map[string]*fakeUnit),
+		Modules:    make(map[string]bool),
+		NextHandle: 0x8001,
+	}
+	for _, iface := range fakeInterfaces {
+		state.Qdiscs[iface] = &types.QdiscInfo{Type: "fq_codel", Handle: "0", Params: make(map[string]interface{})}
+		state.Links[iface] = copyLinkSettings(&fakeLinkDefaults)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read fake state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse fake state: %w", err)
+	}
+	return state, nil
+}
+
+// save persists the state (caller must hold mu)
+func (s *fakeState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal fake state: %w", err)
+	}
+	if err := utils.AtomicWriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write fake state: %w", err)
+	}
+	return nil
+}
+
+// fakeQdisc emulates root qdiscs. Deleting one reattaches net.core.default_qdisc
+// with handle 0, as the kernel does.
+type fakeQdisc struct {
+	state  *fakeState
+	sysctl SysctlAdapter
+}
+
+// Get returns the root qdisc of an interface
+func (q *fakeQdisc) Get(iface string) (*types.QdiscInfo, error) {
+	q.state.mu.Lock()
+	defer q.state.mu.Unlock()
+
+	info, ok := q.state.Qdiscs[iface]
+	if !ok {
+		return nil, fmt.Errorf("failed to get qdisc for %s: no such interface", iface)
+	}
+	return copyQdiscInfo(info), nil
+}
+
+// Set replaces the root qdisc of an interface
+func (q *fakeQdisc) Set(iface, qdiscType string, params map[string]interface{}) error {
+	if err := checkQdiscParams(qdiscType, params); err != nil {
+		return fmt.Errorf("failed to set qdisc for %s: %w", iface, err)
+	}
+
+	q.state.mu.Lock()
+	defer q.state.mu.Unlock()
+
+	if _, ok := q.state.Qdiscs[iface]; !ok {
+		return fmt.Errorf("failed to set qdisc for %s: no such interface", iface)
+	}
+	q.state.Qdiscs[iface] = &types.QdiscInfo{
+		Type:   qdiscType,
+		Handle: fmt.Sprintf("%x", q.state.NextHandle),
+		Params: fakeQdiscParams(params),
+	}
+	q.state.NextHandle++
+	return q.state.save()
+}
+
+// Delete removes the root qdisc so the default one is attached again
+func (q *fakeQdisc) Delete(iface string) error {
+	defaultQdisc, err := q.sysctl.Get("net.core.default_qdisc")
+	if err != nil || defaultQdisc == "" {
+		defaultQdisc = "pfifo_fast"
+	}
+
+	q.state.mu.Lock()
+	defer q.state.mu.Unlock()
+
+	info, ok := q.state.Qdiscs[iface]
+	if !ok {
+		return fmt.Errorf("failed to delete qdisc for %s: no such interface", iface)
+	}
+	if info.Handle == "0" {
+		return fmt.Errorf("failed to delete qdisc for %s: cannot delete qdisc with handle of zero", iface)
+	}
+	q.state.Qdiscs[iface] = &types.QdiscInfo{Type: defaultQdisc, Handle: "0", Params: make(map[string]interface{})}
+	return q.state.save()
+}
+
+// GetAll returns the root qdisc of every interface
+func (q *fakeQdisc) GetAll() (map[string]*types.QdiscInfo, error) {
+	q.state.mu.Lock()
+	defer q.state.mu.Unlock()
+
+	result := make(map[string]*types.QdiscInfo, len(q.state.Qdiscs))
+	for iface, info := range q.state.Qdiscs {
+		result[iface] = copyQdiscInfo(info)
+	}
+	return result, nil
+}
+
+// ListInterfaces returns the emulated interfaces, all of which are up
+func (q *fakeQdisc) ListInterfaces() ([]string, error) {
+	q.state.mu.Lock()
+	defer q.state.mu.Unlock()
+
+	names := make([]string, 0, len(q.state.Qdiscs))
+	for iface := range q.state.Qdiscs {
+		names = append(names, iface)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetDefaultRoutes returns the emulated default routes
+func (q *fakeQdisc) GetDefaultRoutes() (*types.DefaultRoutes, error) {
+	q.state.mu.Lock()
+	defer q.state.mu.Unlock()
+
+	routes := q.state.Routes
+	return &routes, nil
+}
+
+// ValidateQdiscParams validates qdisc parameters for a given qdisc type
+func (q *fakeQdisc) ValidateQdiscParams(qdiscType string, params map[string]interface{}) error {
+	return checkQdiscParams(qdiscType, params)
+}
+
+// fakeQdiscParams stores parameters the way tc reports them: flags as true and
+// values as the strings passed to tc
+func fakeQdiscParams(params map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		args := QdiscArgs(map[string]interface{}{key: value})
+		switch len(args) {
+		case 1:
+			result[key] = true
+		case 2:
+			result[key] = args[1]
+		}
+	}
+	return result
+}
+
+// copyQdiscInfo returns a copy that callers may modify
+func copyQdiscInfo(info *types.QdiscInfo) *types.QdiscInfo {
+	params := make(map[string]interface{}, len(info.Params))
+	for key, value := range info.Params {
+		params[key] = value
+	}
+	return &types.QdiscInfo{Type: info.Type, Handle: info.Handle, Params: params}
+}
+
+// fakeLink emulates ethtool. Features, rings and coalescing settings an
+// emulated NIC does not have are rejected, as are rings above fakeRingMax.
+type fakeLink struct {
+	state *fakeState
+}
+
+// Get returns the link settings of an interface
+func (l *fakeLink) Get(iface string) (*types.LinkSettings, error) {
+	l.state.mu.Lock()
+	defer l.state.mu.Unlock()
+
+	settings, ok := l.state.Links[iface]
+	if !ok {
+		return nil, fmt.Errorf("failed to get link settings for %s: no such interface", iface)
+	}
+	return copyLinkSettings(settings), nil
+}
+
+// Set changes the link settings of an interface
+func (l *fakeLink) Set(iface string, settings *types.LinkSettings) error {
+	l.state.mu.Lock()
+	defer l.state.mu.Unlock()
+
+	current, ok := l.state.Links[iface]
+	if !ok {
+		return fmt.Errorf("failed to set link settings for %s: no such interface", iface)
+	}
+	updated := copyLinkSettings(current)
+	if settings == nil {
+		settings = &types.LinkSettings{}
+	}
+
+	if settings.MTU != nil {
+		if *settings.MTU < 68 || *settings.MTU > fakeMaxMTU {
+			return fmt.Errorf("failed to set link settings for %s: mtu %d out of range 68-%d", iface, *settings.MTU, fakeMaxMTU)
+		}
+		updated.MTU = intPtr(*settings.MTU)
+	}
+	if settings.TxQueueLen != nil {
+		if *settings.TxQueueLen < 0 {
+			return fmt.Errorf("failed to set link settings for %s: invalid txqueuelen %d", iface, *settings.TxQueueLen)
+		}
+		updated.TxQueueLen = intPtr(*settings.TxQueueLen)
+	}
+	for name, enabled := range settings.Offloads {
+		feature := OffloadFeatureName(name)
+		if _, ok := updated.Offloads[feature]; !ok {
+			return fmt.Errorf("failed to set link settings for %s: feature %s is not supported", iface, name)
+		}
+		updated.Offloads[feature] = enabled
+	}
+	for name, size := range settings.Rings {
+		if _, ok := updated.Rings[name]; !ok {
+			return fmt.Errorf("failed to set link settings for %s: ring %s is not supported", iface, name)
+		}
+		if size < 1 || size > fakeRingMax {
+			return fmt.Errorf("failed to set link settings for %s: ring %s size %d exceeds maximum %d", iface, name, size, fakeRingMax)
+		}
+		updated.Rings[name] = size
+	}
+	for name, value := range settings.Coalesce {
+		if _, ok := updated.Coalesce[name]; !ok {
+			return fmt.Errorf("failed to set link settings for %s: coalescing parameter %s is not supported", iface, name)
+		}
+		updated.Coalesce[name] = value
+	}
+
+	l.state.Links[iface] = copyLinkSettings(updated)
+	return l.state.save()
+}
+
+// GetAll returns the link settings of every interface
+func (l *fakeLink) GetAll() (map[string]*types.LinkSettings, error) {
+	l.state.mu.Lock()
+	defer l.state.mu.Unlock()
+
+	result := make(map[string]*types.LinkSettings, len(l.state.Links))
+	for iface, settings := range l.state.Links {
+		result[iface] = copyLinkSettings(settings)
+	}
+	return result, nil
+}
+
+// AddrInterface returns the emulated interface that holds an IP address
+func (l *fakeLink) AddrInterface(addr string) (string, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address '%s'", addr)
+	}
+	if iface, ok := fakeAddrs[ip.String()]; ok {
+		return iface, nil
+	}
+	return "", fmt.Errorf("no interface holds %s", addr)
+}
+
+// copyLinkSettings returns a copy that callers may modify, with coalescing
+// values normalized to the bool and int ethtool output parses to. A missing
+// MTU or queue length, as in state saved by older versions, gets the default.
+func copyLinkSettings(settings *types.LinkSettings) *types.LinkSettings {
+	result := &types.LinkSettings{
+		MTU:        intPtr(*fakeLinkDefaults.MTU),
+		TxQueueLen: intPtr(*fakeLinkDefaults.TxQueueLen),
+		Offloads:   make(map[string]bool, len(settings.Offloads)),
+		Rings:      make(map[string]int, len(settings.Rings)),
+		Coalesce:   make(map[string]interface{}, len(settings.Coalesce)),
+	}
+	if settings.MTU != nil {
+		*result.MTU = *settings.MTU
+	}
+	if settings.TxQueueLen != nil {
+		*result.TxQueueLen = *settings.TxQueueLen
+	}
+	for name, enabled := range settings.Offloads {
+		result.Offloads[name] = enabled
+	}
+	for name, size := range settings.Rings {
+		result.Rings[name] = size
+	}
+	for name, value := range settings.Coalesce {
+		if n, err := strconv.Atoi(LinkValueString(value)); err == nil {
+			result.Coalesce[name] = n
+		} else {
+			result.Coalesce[name] = value
+		}
+	}
+	return result
+}
+
+// intPtr returns a pointer to a copy of n
+func intPtr(n int) *int {
+	return &n
+}
+
+// fakeSystemd emulates systemd units whose files live under the fake root
+type fakeSystemd struct {
+	state   *fakeState
+	unitDir string
+	logger  *zap.Logger
+}
+
+// IsActive reports whether a unit is running
+func (d *fakeSystemd) IsActive(unit string) (bool, error) {
+	d.state.mu.Lock()
+	defer d.state.mu.Unlock()
+
+	u := d.state.Units[unit]
+	return u != nil && u.Active, nil
+}
+
+// IsEnabled reports whether a unit starts at boot
+func (d *fakeSystemd) IsEnabled(unit string) (bool, error) {
+	d.state.mu.Lock()
+	defer d.state.mu.Unlock()
+
+	u := d.state.Units[unit]
+	return u != nil && u.Enabled, nil
+}
+
+// Enable makes a unit start at boot
+func (d *fakeSystemd) Enable(unit string) error {
+	return d.update(unit, "enable", func(u *fakeUnit) { u.Enabled = true })
+}
+
+// Disable stops a unit from starting at boot
+func (d *fakeSystemd) Disable(unit string) error {
+	return d.update(unit, "disable", func(u *fakeUnit) { u.Enabled = false })
+}
+
+// Start runs a unit
+func (d *fakeSystemd) Start(unit string) error {
+	return d.update(unit, "start", func(u *fakeUnit) { u.Active = true })
+}
+
+// Stop stops a unit
+func (d *fakeSystemd) Stop(unit string) error {
+	return d.update(unit, "stop", func(u *fakeUnit) { u.Active = false })
+}
+
+// update changes the state of a unit whose file exists
+func (d *fakeSystemd) update(unit, action string, change func(u *fakeUnit)) error {
+	if !d.UnitExists(unit) {
+		return fmt.Errorf("failed to %s %s: unit %s not found", action, unit, unit)
+	}
+
+	d.state.mu.Lock()
+	defer d.state.mu.Unlock()
+
+	u, ok := d.state.Units[unit]
+	if !ok {
+		u = &fakeUnit{}
+		d.state.Units[unit] = u
+	}
+	change(u)
+	return d.state.save()
+}
+
+// DaemonReload has nothing to reload
+func (d *fakeSystemd) DaemonReload() error {
+	return nil
+}
+
+// CreateUnit writes a unit file under the fake root
+func (d *fakeSystemd) CreateUnit(name, content string) error {
+	unitPath := filepath.Join(d.unitDir, name)
+	if err := utils.AtomicWriteFile(unitPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write unit file: %w", err)
+	}
+	d.logger.Info("created systemd unit", zap.String("name", name), zap.String("path", unitPath))
+	return nil
+}
+
+// RemoveUnit stops and disables a unit and deletes its file
+func (d *fakeSystemd) RemoveUnit(name string) error {
+	d.state.mu.Lock()
+	delete(d.state.Units, name)
+	err := d.state.save()
+	d.state.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filepath.Join(d.unitDir, name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove unit file: %w", err)
+	}
+	d.logger.Info("removed systemd unit", zap.String("name", name))
+	return nil
+}
+
+// UnitExists checks if a unit file exists
+func (d *fakeSystemd) UnitExists(name string) bool {
+	_, err := os.Stat(filepath.Join(d.unitDir, name))
+	return err == nil
+}
+
+// fakeRoute emulates ip route on the main table. Routes that do not exist and
+// congestion controls the kernel has not loaded are rejected.
+type fakeRoute struct {
+	state  *fakeState
+	sysctl SysctlAdapter
+}
+
+// Find returns the routes to exactly dest
+func (r *fakeRoute) Find(family, dest string) ([]*Route, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+
+	if dest != "default" {
+		if _, prefix, err := net.ParseCIDR(dest); err == nil {
+			dest = prefix.String()
+		}
+	}
+	var result []*Route
+	for _, route := range r.state.RouteTable {
+		if route.Family == family && route.Dest() == dest {
+			result = append(result, copyRoutes([]*Route{route})[0])
+		}
+	}
+	return result, nil
+}
+
+// GetAll returns the default routes and the routes with TCP attributes
+func (r *fakeRoute) GetAll() ([]*Route, error) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+
+	var result []*Route
+	for _, route := range r.state.RouteTable {
+		if route.Dest() == "default" || !route.Attrs.IsEmpty() {
+			result = append(result, route)
+		}
+	}
+	return copyRoutes(result), nil
+}
+
+// Set replaces the TCP attributes of a route
+func (r *fakeRoute) Set(route *Route) error {
+	if cc := route.Attrs.CongCtl; cc != "" {
+		available, _ := r.sysctl.Get(fakeAvailableCCKey)
+		found := false
+		for _, name := range strings.Fields(available) {
+			found = found || name == cc
+		}
+		if !found {
+			return fmt.Errorf("failed to set attributes of route %s: congestion control %s is not available", route.Key(), cc)
+		}
+	}
+
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+
+	for i, current := range r.state.RouteTable {
+		if current.Key() == route.Key() {
+			r.state.RouteTable[i] = copyRoutes([]*Route{route})[0]
+			return r.state.save()
+		}
+	}
+	return fmt.Errorf("failed to set attributes of route %s: no such route", route.Key())
+}
+
+// copyRoutes returns copies of routes that callers may modify
+func copyRoutes(routes []*Route) []*Route {
+	result := make([]*Route, len(routes))
+	for i, route := range routes {
+		copied := &Route{Family: route.Family, Spec: route.Spec, Attrs: types.RouteAttrs{CongCtl: route.Attrs.CongCtl}}
+		if route.Attrs.InitCwnd != nil {
+			copied.Attrs.InitCwnd = intPtr(*route.Attrs.InitCwnd)
+		}
+		if route.Attrs.InitRwnd != nil {
+			copied.Attrs.InitRwnd = intPtr(*route.Attrs.InitRwnd)
+		}
+		result[i] = copied
+	}
+	return result
+}
+
+// fakeModules emulates modprobe. Loading a tcp_* module makes its congestion
+// control available, as the kernel does.
+type fakeModules struct {
+	state  *fakeState
+	sysctl *SysctlManager
+	files  *ModuleManager
+	logger *zap.Logger
+}
+
+// Loaded returns the loaded modules
+func (m *fakeModules) Loaded() (map[string]bool, error) {
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	loaded := make(map[string]bool, len(m.state.Modules))
+	for name, ok := range m.state.Modules {
+		loaded[name] = ok
+	}
+	return loaded, nil
+}
+
+// Available reports whether the emulated modprobe can find a module
+func (m *fakeModules) Available(name string) error {
+	if !fakeAvailableModules[name] {
+		return fmt.Errorf("modprobe: FATAL: Module %s not found", name)
+	}
+	return nil
+}
+
+// Load loads a module
+func (m *fakeModules) Load(name string) error {
+	if err := m.Available(name); err != nil {
+		return fmt.Errorf("failed to load module %s: %w", name, err)
+	}
+
+	m.state.mu.Lock()
+	m.state.Modules[name] = true
+	err := m.state.save()
+	m.state.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if cc, ok := strings.CutPrefix(name, "tcp_"); ok {
+		if err := m.addAvailableCC(cc); err != nil {
+			return err
+		}
+	}
+	m.logger.Info("loaded kernel module", zap.String("module", name))
+	return nil
+}
+
+// addAvailableCC lists a congestion control in the read-only available list
+func (m *fakeModules) addAvailableCC(cc string) error {
+	current, err := m.sysctl.Get(fakeAvailableCCKey)
+	if err != nil {
+		return err
+	}
+	ccs := strings.Fields(current)
+	for _, name := range ccs {
+		if name == cc {
+			return nil
+		}
+	}
+	ccs = append(ccs, cc)
+	path, err := m.sysctl.keyToPath(fakeAvailableCCKey)
+	if err != nil {
+		return err
+	}
+	return utils.AtomicWriteFile(path, []byte(strings.Join(ccs, " ")+"\n"), 0444)
+}
+
+// ReadModulesLoadFile returns the modules listed in a modules-load.d file
+func (m *fakeModules) ReadModulesLoadFile(path string) ([]string, error) {
+	return m.files.ReadModulesLoadFile(path)
+}
+
+// WriteModulesLoadFile atomically writes a modules-load.d file
+func (m *fakeModules) WriteModulesLoadFile(path string, modules []string) error {
+	return m.files.WriteModulesLoadFile(path, modules)
+}
+
+// fakeSystemInfo describes the emulated host
+type fakeSystemInfo struct {
+	sysctl SysctlAdapter
+	qdisc  *fakeQdisc
+	link   *fakeLink
+}
+
+// GetServerInfo returns information about the emulated host
+func (i *fakeSystemInfo) GetServerInfo() (*types.ServerInfo, error) {
+	routes, _ := i.qdisc.GetDefaultRoutes()
+	cc, _ := i.sysctl.Get("net.ipv4.tcp_congestion_control")
+	defaultQdisc, _ := i.sysctl.Get("net.core.default_qdisc")
+	mtu := 0
+	if settings, err := i.link.Get(routes.Primary()); err == nil {
+		mtu = *settings.MTU
+	}
+
+	return &types.ServerInfo{
+		Hostname:          "nettune-simulated",
+		KernelVersion:     "6.8.0-simulated",
+		Distribution:      "Simulated Linux",
+		CongestionControl: cc,
+		DefaultQdisc:      defaultQdisc,
+		DefaultInterface:  routes.Primary(),
+		DefaultRoutes:     routes,
+		InterfaceMTU:      mtu,
+		AvailableCCs:      i.AvailableCCs(),
+		Dependencies: map[string]string{
+			"tc":       "simulated",
+			"ethtool":  "simulated",
+			"systemd":  "simulated",
+			"iproute2": "simulated",
+		},
+	}, nil
+}
+
+// AvailableCCs returns the congestion controls of the emulated kernel
+func (i *fakeSystemInfo) AvailableCCs() []string {
+	value, err := i.sysctl.Get(fakeAvailableCCKey)
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(value)
+}
+
+var (
+	_ QdiscAdapter      = (*fakeQdisc)(nil)
+	_ LinkAdapter       = (*fakeLink)(nil)
+	_ RouteAdapter      = (*fakeRoute)(nil)
+	_ SystemdAdapter    = (*fakeSystemd)(nil)
+	_ ModuleAdapter     = (*fakeModules)(nil)
+	_ SystemInfoAdapter = (*fakeSystemInfo)(nil)
+)
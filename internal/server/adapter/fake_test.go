@@ -0,0 +1,80 @@
+package adapter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"go.uber.org/zap"
+)
+
+func TestFakeSystemAdapter(t *testing.T) {
+	root := t.TempDir()
+	a, err := NewFakeSystemAdapter(root, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewFakeSystemAdapter failed: %v", err)
+	}
+
+	if err := a.Sysctl.Set("net.core.default_qdisc", "fq"); err != nil {
+		t.Fatalf("Sysctl.Set failed: %v", err)
+	}
+	if err := a.Sysctl.Set("net.ipv4.no_such_key", "1"); err == nil {
+		t.Error("setting an unknown sysctl should fail")
+	}
+
+	if err := a.Qdisc.Set("eth0", "cake", map[string]interface{}{"bandwidth": "100mbit", "nat": true, "wash": false}); err != nil {
+		t.Fatalf("Qdisc.Set failed: %v", err)
+	}
+	info, _ := a.Qdisc.Get("eth0")
+	if info.Type != "cake" || info.Handle != "8001" ||
+		!reflect.DeepEqual(info.Params, map[string]interface{}{"bandwidth": "100mbit", "nat": true}) {
+		t.Errorf("Qdisc.Get() = %+v", info)
+	}
+	if err := a.Qdisc.Set("eth9", "fq", nil); err == nil {
+		t.Error("setting a qdisc on a missing interface should fail")
+	}
+
+	if err := a.Link.Set("eth0", &types.LinkSettings{Offloads: map[string]bool{"gro": false}, Rings: map[string]int{"rx": 1024}}); err != nil {
+		t.Fatalf("Link.Set failed: %v", err)
+	}
+	if link, _ := a.Link.Get("eth0"); link.Offloads["generic-receive-offload"] || link.Rings["rx"] != 1024 {
+		t.Errorf("Link.Get() = %+v", link)
+	}
+	if err := a.Link.Set("eth0", &types.LinkSettings{Rings: map[string]int{"rx": 8192}}); err == nil {
+		t.Error("a ring above the maximum should be rejected")
+	}
+	if err := a.Link.Set("eth0", &types.LinkSettings{Offloads: map[string]bool{"highdma": false}}); err == nil {
+		t.Error("an unsupported feature should be rejected")
+	}
+
+	if err := a.Modules.Load("tcp_bbr"); err != nil {
+		t.Fatalf("Modules.Load failed: %v", err)
+	}
+	if ccs := a.SysInfo.AvailableCCs(); !reflect.DeepEqual(ccs, []string{"reno", "cubic", "bbr"}) {
+		t.Errorf("AvailableCCs() = %v, want bbr added", ccs)
+	}
+	if err := a.Modules.Load("tcp_nope"); err == nil {
+		t.Error("loading an unknown module should fail")
+	}
+
+	// A restarted adapter sees the same host
+	a, err = NewFakeSystemAdapter(root, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewFakeSystemAdapter failed: %v", err)
+	}
+	if loaded, _ := a.Modules.Loaded(); !loaded["tcp_bbr"] {
+		t.Error("loaded modules should persist")
+	}
+
+	// Deleting the root qdisc reattaches the default one
+	if err := a.Qdisc.Delete("eth0"); err != nil {
+		t.Fatalf("Qdisc.Delete failed: %v", err)
+	}
+	info, _ = a.Qdisc.Get("eth0")
+	if info.Type != "fq" || info.Handle != "0" {
+		t.Errorf("after Delete, Qdisc.Get() = %+v, want default fq", info)
+	}
+	if err := a.Qdisc.Delete("eth0"); err == nil {
+		t.Error("deleting the default qdisc should fail")
+	}
+}
@@ -0,0 +1,94 @@
+package adapter
+
+import "github.com/jtsang4/nettune/internal/shared/types"
+
+// SysctlAdapter reads and writes kernel parameters and sysctl configuration files
+type SysctlAdapter interface {
+	Get(key string) (string, error)
+	Set(key, value string) error
+	GetMultiple(keys []string) (map[string]string, error)
+	SetMultiple(values map[string]string) error
+	GetTree(prefix string) (map[string]string, error)
+	InInitNetNamespace() bool
+	Probe(key string, initNetNS bool) *types.SysctlPreflight
+	ReadManagedFile(path string) (map[string]*SysctlFileEntry, error)
+	WriteManagedFile(path string, entries map[string]*SysctlFileEntry) error
+	LoadFromFile(path string) error
+}
+
+// QdiscAdapter manages root qdiscs and the interfaces they attach to
+type QdiscAdapter interface {
+	Get(iface string) (*types.QdiscInfo, error)
+	Set(iface, qdiscType string, params map[string]interface{}) error
+	Delete(iface string) error
+	GetAll() (map[string]*types.QdiscInfo, error)
+	ListInterfaces() ([]string, error)
+	GetDefaultRoutes() (*types.DefaultRoutes, error)
+	ValidateQdiscParams(qdiscType string, params map[string]interface{}) error
+}
+
+// LinkAdapter manages the MTU, queue length, offloads, ring buffers and
+// interrupt coalescing of interfaces
+type LinkAdapter interface {
+	Get(iface string) (*types.LinkSettings, error)
+	Set(iface string, settings *types.LinkSettings) error
+	GetAll() (map[string]*types.LinkSettings, error)
+	AddrInterface(addr string) (string, error)
+}
+
+// SteeringAdapter manages RPS, XPS and IRQ affinity. Values are keyed by the
+// host path of their sysfs or procfs file.
+type SteeringAdapter interface {
+	OnlineCPUs() ([]int, error)
+	Layout(iface string) (*SteeringLayout, error)
+	Get(iface string) (map[string]string, error)
+	GetAll() (map[string]string, error)
+	Set(values map[string]string) error
+}
+
+// RouteAdapter manages TCP attributes of routes in the main table
+type RouteAdapter interface {
+	Find(family, dest string) ([]*Route, error)
+	GetAll() ([]*Route, error)
+	Set(route *Route) error
+}
+
+// SystemdAdapter manages systemd units
+type SystemdAdapter interface {
+	IsActive(unit string) (bool, error)
+	IsEnabled(unit string) (bool, error)
+	Enable(unit string) error
+	Disable(unit string) error
+	Start(unit string) error
+	Stop(unit string) error
+	DaemonReload() error
+	CreateUnit(name, content string) error
+	RemoveUnit(name string) error
+	UnitExists(name string) bool
+}
+
+// ModuleAdapter loads kernel modules and manages their boot persistence
+type ModuleAdapter interface {
+	Loaded() (map[string]bool, error)
+	Available(name string) error
+	Load(name string) error
+	ReadModulesLoadFile(path string) ([]string, error)
+	WriteModulesLoadFile(path string, modules []string) error
+}
+
+// SystemInfoAdapter describes the host
+type SystemInfoAdapter interface {
+	GetServerInfo() (*types.ServerInfo, error)
+	AvailableCCs() []string
+}
+
+var (
+	_ SysctlAdapter     = (*SysctlManager)(nil)
+	_ QdiscAdapter      = (*QdiscManager)(nil)
+	_ LinkAdapter       = (*LinkManager)(nil)
+	_ SteeringAdapter   = (*SteeringManager)(nil)
+	_ RouteAdapter      = (*RouteManager)(nil)
+	_ SystemdAdapter    = (*SystemdManager)(nil)
+	_ ModuleAdapter     = (*ModuleManager)(nil)
+	_ SystemInfoAdapter = (*SystemInfoManager)(nil)
+)
@@ -0,0 +1,447 @@
+package adapter
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"go.uber.org/zap"
+)
+
+// LinkRingParams are the ring buffer sizes set with ethtool -G
+var LinkRingParams = []string{"rx", "rx-mini", "rx-jumbo", "tx"}
+
+// LinkCoalesceFlags are the coalescing settings switched on or off with ethtool -C
+var LinkCoalesceFlags = []string{"adaptive-rx", "adaptive-tx"}
+
+// LinkCoalesceParams are the numeric coalescing settings set with ethtool -C
+var LinkCoalesceParams = []string{
+	"pkt-rate-high", "pkt-rate-low", "sample-interval", "stats-block-usecs",
+	"rx-usecs", "rx-frames", "rx-usecs-irq", "rx-frames-irq",
+	"rx-usecs-low", "rx-frames-low", "rx-usecs-high", "rx-frames-high",
+	"tx-usecs", "tx-frames", "tx-usecs-irq", "tx-frames-irq",
+	"tx-usecs-low", "tx-frames-low", "tx-usecs-high", "tx-frames-high",
+}
+
+// offloadFeatureNames maps the short names ethtool -K accepts to the feature
+// names ethtool -k prints
+var offloadFeatureNames = map[string]string{
+	"rx":     "rx-checksumming",
+	"tx":     "tx-checksumming",
+	"sg":     "scatter-gather",
+	"tso":    "tcp-segmentation-offload",
+	"ufo":    "udp-fragmentation-offload",
+	"gso":    "generic-segmentation-offload",
+	"gro":    "generic-receive-offload",
+	"lro":    "large-receive-offload",
+	"rxvlan": "rx-vlan-offload",
+	"txvlan": "tx-vlan-offload",
+	"ntuple": "ntuple-filters",
+	"rxhash": "receive-hashing",
+}
+
+// ethtoolRingNames maps the rows of ethtool -g output to ring parameters
+var ethtoolRingNames = map[string]string{
+	"RX":       "rx",
+	"RX Mini":  "rx-mini",
+	"RX Jumbo": "rx-jumbo",
+	"TX":       "tx",
+}
+
+// LinkTarget is the link settings to apply to one interface
+type LinkTarget struct {
+	Interface string              `json:"interface"`
+	Settings  *types.LinkSettings `json:"settings"`
+}
+
+// LinkManager handles the MTU and transmit queue length of interfaces through
+// ip link, and NIC offloads, ring buffers and interrupt coalescing through ethtool
+type LinkManager struct {
+	logger *zap.Logger
+}
+
+// NewLinkManager creates a new LinkManager
+func NewLinkManager(logger *zap.Logger) *LinkManager {
+	return &LinkManager{logger: logger}
+}
+
+// Get returns the link settings of an interface. The MTU and queue length are
+// always reported; offloads, rings and coalescing are left empty when ethtool
+// or the driver does not support them.
+func (m *LinkManager) Get(iface string) (*types.LinkSettings, error) {
+	netIface, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link settings for %s: %w", iface, err)
+	}
+
+	mtu := netIface.MTU
+	settings := &types.LinkSettings{MTU: &mtu}
+	data, err := os.ReadFile(filepath.Join(sysClassNetDir, iface, "tx_queue_len"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue length for %s: %w", iface, err)
+	}
+	qlen, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse queue length for %s: %w", iface, err)
+	}
+	settings.TxQueueLen = &qlen
+
+	if output, err := runEthtool("-k", iface); err == nil {
+		settings.Offloads = parseEthtoolFeatures(output)
+	} else {
+		m.logger.Debug("offloads not available",
+			zap.String("interface", iface),
+			zap.Error(err))
+	}
+
+	if output, err := runEthtool("-g", iface); err == nil {
+		settings.Rings = parseEthtoolRings(output)
+	} else {
+		m.logger.Debug("ring parameters not available",
+			zap.String("interface", iface),
+			zap.Error(err))
+	}
+
+	if output, err := runEthtool("-c", iface); err == nil {
+		settings.Coalesce = parseEthtoolCoalesce(output)
+	} else {
+		m.logger.Debug("coalescing parameters not available",
+			zap.String("interface", iface),
+			zap.Error(err))
+	}
+
+	return settings, nil
+}
+
+// Set changes the link settings of an interface. Values already in effect are
+// skipped, since ethtool refuses ring and coalescing requests that change nothing.
+func (m *LinkManager) Set(iface string, settings *types.LinkSettings) error {
+	current, err := m.Get(iface)
+	if err != nil {
+		return err
+	}
+
+	changed := LinkSettingsDiff(current, settings)
+	if args := IPLinkArgs(iface, changed); args != nil {
+		if output, err := exec.Command("ip", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to set link settings for %s: %w\noutput: %s", iface, err, strings.TrimSpace(string(output)))
+		}
+	}
+	for _, args := range EthtoolArgs(iface, changed) {
+		if _, err := runEthtool(args...); err != nil {
+			return fmt.Errorf("failed to set link settings for %s: %w", iface, err)
+		}
+	}
+
+	m.logger.Info("set link settings successfully",
+		zap.String("interface", iface),
+		zap.Bool("mtu", changed.MTU != nil),
+		zap.Bool("txqueuelen", changed.TxQueueLen != nil),
+		zap.Int("offloads", len(changed.Offloads)),
+		zap.Int("rings", len(changed.Rings)),
+		zap.Int("coalesce", len(changed.Coalesce)))
+	return nil
+}
+
+// GetAll returns the link settings of every interface that is up
+func (m *LinkManager) GetAll() (map[string]*types.LinkSettings, error) {
+	ifaces, err := listUpInterfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*types.LinkSettings)
+	for _, iface := range ifaces {
+		settings, err := m.Get(iface)
+		if err != nil {
+			m.logger.Debug("failed to get link settings for interface",
+				zap.String("interface", iface),
+				zap.Error(err))
+			continue
+		}
+		result[iface] = settings
+	}
+	return result, nil
+}
+
+// AddrInterface returns the interface that holds an IP address
+func (m *LinkManager) AddrInterface(addr string) (string, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address '%s'", addr)
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return iface.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no interface holds %s", addr)
+}
+
+// runEthtool runs ethtool and returns its output
+func runEthtool(args ...string) (string, error) {
+	output, err := exec.Command("ethtool", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("ethtool %s: %w\noutput: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+// OffloadFeatureName returns the name ethtool -k prints for an offload, so that
+// "gro" and "generic-receive-offload" refer to the same feature
+func OffloadFeatureName(name string) string {
+	if feature, ok := offloadFeatureNames[name]; ok {
+		return feature
+	}
+	return name
+}
+
+// offloadArgName returns the name ethtool -K accepts for a feature printed by ethtool -k
+func offloadArgName(feature string) string {
+	for short, long := range offloadFeatureNames {
+		if long == feature {
+			return short
+		}
+	}
+	return feature
+}
+
+// LinkValueString formats a link setting the way ethtool takes it: booleans
+// as "on" or "off" and numbers as integers
+func LinkValueString(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "on"
+		}
+		return "off"
+	case float64:
+		if v == float64(int64(v)) {
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// LinkSettingsDiff returns the settings of desired whose values differ from
+// current. Offloads are keyed by the feature names ethtool -k prints.
+func LinkSettingsDiff(current, desired *types.LinkSettings) *types.LinkSettings {
+	if current == nil {
+		current = &types.LinkSettings{}
+	}
+	diff := &types.LinkSettings{}
+	if desired == nil {
+		return diff
+	}
+
+	if desired.MTU != nil && (current.MTU == nil || *current.MTU != *desired.MTU) {
+		diff.MTU = desired.MTU
+	}
+	if desired.TxQueueLen != nil && (current.TxQueueLen == nil || *current.TxQueueLen != *desired.TxQueueLen) {
+		diff.TxQueueLen = desired.TxQueueLen
+	}
+
+	for name, enabled := range desired.Offloads {
+		feature := OffloadFeatureName(name)
+		if live, ok := current.Offloads[feature]; ok && live == enabled {
+			continue
+		}
+		if diff.Offloads == nil {
+			diff.Offloads = make(map[string]bool)
+		}
+		diff.Offloads[feature] = enabled
+	}
+	for name, size := range desired.Rings {
+		if live, ok := current.Rings[name]; ok && live == size {
+			continue
+		}
+		if diff.Rings == nil {
+			diff.Rings = make(map[string]int)
+		}
+		diff.Rings[name] = size
+	}
+	for name, value := range desired.Coalesce {
+		if live, ok := current.Coalesce[name]; ok && LinkValueString(live) == LinkValueString(value) {
+			continue
+		}
+		if diff.Coalesce == nil {
+			diff.Coalesce = make(map[string]interface{})
+		}
+		diff.Coalesce[name] = value
+	}
+	return diff
+}
+
+// IPLinkArgs converts the MTU and queue length of link settings to arguments
+// of ip, or nil when neither is set
+func IPLinkArgs(iface string, settings *types.LinkSettings) []string {
+	if settings == nil || settings.MTU == nil && settings.TxQueueLen == nil {
+		return nil
+	}
+	args := []string{"link", "set", "dev", iface}
+	if settings.MTU != nil {
+		args = append(args, "mtu", strconv.Itoa(*settings.MTU))
+	}
+	if settings.TxQueueLen != nil {
+		args = append(args, "txqueuelen", strconv.Itoa(*settings.TxQueueLen))
+	}
+	return args
+}
+
+// EthtoolArgs converts link settings to ethtool invocations for an interface:
+// one each for offloads (-K), rings (-G) and coalescing (-C), in a deterministic order
+func EthtoolArgs(iface string, settings *types.LinkSettings) [][]string {
+	if settings == nil {
+		return nil
+	}
+	var calls [][]string
+
+	if len(settings.Offloads) > 0 {
+		args := []string{"-K", iface}
+		for _, name := range sortedKeys(settings.Offloads) {
+			args = append(args, offloadArgName(OffloadFeatureName(name)), LinkValueString(settings.Offloads[name]))
+		}
+		calls = append(calls, args)
+	}
+
+	if len(settings.Rings) > 0 {
+		args := []string{"-G", iface}
+		for _, name := range LinkRingParams {
+			if size, ok := settings.Rings[name]; ok {
+				args = append(args, name, strconv.Itoa(size))
+			}
+		}
+		calls = append(calls, args)
+	}
+
+	if len(settings.Coalesce) > 0 {
+		args := []string{"-C", iface}
+		for _, name := range sortedKeys(settings.Coalesce) {
+			args = append(args, name, LinkValueString(settings.Coalesce[name]))
+		}
+		calls = append(calls, args)
+	}
+
+	return calls
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parseEthtoolFeatures parses ethtool -k output into feature -> enabled.
+// Features marked [fixed] cannot be changed and are left out.
+func parseEthtoolFeatures(output string) map[string]bool {
+	features := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok || strings.HasPrefix(name, "Features for") {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 || strings.Contains(value, "[fixed]") {
+			continue
+		}
+		switch fields[0] {
+		case "on":
+			features[name] = true
+		case "off":
+			features[name] = false
+		}
+	}
+	return features
+}
+
+// parseEthtoolRings parses the current sizes from ethtool -g output. Rings the
+// driver reports as n/a are left out.
+func parseEthtoolRings(output string) map[string]int {
+	rings := make(map[string]int)
+	current := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Pre-set maximums"):
+			current = false
+			continue
+		case strings.HasPrefix(line, "Current hardware settings"):
+			current = true
+			continue
+		}
+		if !current {
+			continue
+		}
+
+		label, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, known := ethtoolRingNames[strings.TrimSpace(label)]
+		if !known {
+			continue
+		}
+		if size, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			rings[name] = size
+		}
+	}
+	return rings
+}
+
+// parseEthtoolCoalesce parses ethtool -c output. Adaptive coalescing is reported
+// as booleans and the known counters as integers; n/a values are left out.
+func parseEthtoolCoalesce(output string) map[string]interface{} {
+	numeric := make(map[string]bool, len(LinkCoalesceParams))
+	for _, name := range LinkCoalesceParams {
+		numeric[name] = true
+	}
+
+	coalesce := make(map[string]interface{})
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+
+		// "Adaptive RX: off  TX: off"
+		if rest, ok := strings.CutPrefix(line, "Adaptive RX:"); ok {
+			fields := strings.Fields(rest)
+			if len(fields) > 0 && (fields[0] == "on" || fields[0] == "off") {
+				coalesce["adaptive-rx"] = fields[0] == "on"
+			}
+			if len(fields) > 2 && fields[1] == "TX:" && (fields[2] == "on" || fields[2] == "off") {
+				coalesce["adaptive-tx"] = fields[2] == "on"
+			}
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || !numeric[name] {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			coalesce[name] = n
+		}
+	}
+	return coalesce
+}
@@ -0,0 +1,154 @@
+package adapter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+)
+
+func TestParseEthtoolFeatures(t *testing.T) {
+	output := `Features for eth0:
+rx-checksumming: on
+tx-checksumming: on
+	tx-checksum-ipv4: off [fixed]
+	tx-checksum-ip-generic: on
+scatter-gather: on
+tcp-segmentation-offload: on
+	tx-tcp-segmentation: on
+generic-receive-offload: off [requested on]
+large-receive-offload: off [fixed]
+highdma: on [fixed]
+rx-gro-hw: off
+`
+	want := map[string]bool{
+		"rx-checksumming":          true,
+		"tx-checksumming":          true,
+		"tx-checksum-ip-generic":   true,
+		"scatter-gather":           true,
+		"tcp-segmentation-offload": true,
+		"tx-tcp-segmentation":      true,
+		"generic-receive-offload":  false,
+		"rx-gro-hw":                false,
+	}
+	if got := parseEthtoolFeatures(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseEthtoolFeatures() = %v, want %v", got, want)
+	}
+}
+
+func TestParseEthtoolRings(t *testing.T) {
+	output := `Ring parameters for eth0:
+Pre-set maximums:
+RX:		4096
+RX Mini:	n/a
+RX Jumbo:	0
+TX:		4096
+Current hardware settings:
+RX:		256
+RX Mini:	n/a
+RX Jumbo:	0
+TX:		512
+RX Buf Len:		n/a
+TX Push:	off
+`
+	want := map[string]int{"rx": 256, "rx-jumbo": 0, "tx": 512}
+	if got := parseEthtoolRings(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseEthtoolRings() = %v, want %v", got, want)
+	}
+}
+
+func TestParseEthtoolCoalesce(t *testing.T) {
+	output := `Coalesce parameters for eth0:
+Adaptive RX: on  TX: off
+stats-block-usecs: 0
+sample-interval: 0
+pkt-rate-low: n/a
+
+rx-usecs: 50
+rx-frames: 0
+rx-usecs-irq: n/a
+
+tx-usecs: 100
+tx-frames: 32
+
+CQE mode RX: n/a  TX: n/a
+`
+	want := map[string]interface{}{
+		"adaptive-rx":       true,
+		"adaptive-tx":       false,
+		"stats-block-usecs": 0,
+		"sample-interval":   0,
+		"rx-usecs":          50,
+		"rx-frames":         0,
+		"tx-usecs":          100,
+		"tx-frames":         32,
+	}
+	if got := parseEthtoolCoalesce(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseEthtoolCoalesce() = %v, want %v", got, want)
+	}
+}
+
+func TestLinkSettingsDiff(t *testing.T) {
+	mtu, jumbo, qlen := 1500, 9000, 1000
+	current := &types.LinkSettings{
+		MTU:        &mtu,
+		TxQueueLen: &qlen,
+		Offloads:   map[string]bool{"generic-receive-offload": true, "tcp-segmentation-offload": true},
+		Rings:      map[string]int{"rx": 256, "tx": 256},
+		Coalesce:   map[string]interface{}{"adaptive-rx": false, "rx-usecs": 3},
+	}
+	desired := &types.LinkSettings{
+		MTU:        &jumbo,
+		TxQueueLen: &qlen,
+		Offloads:   map[string]bool{"gro": false, "tso": true},
+		Rings:      map[string]int{"rx": 1024, "tx": 256},
+		Coalesce:   map[string]interface{}{"adaptive-rx": false, "rx-usecs": float64(50)},
+	}
+	want := &types.LinkSettings{
+		MTU:      &jumbo,
+		Offloads: map[string]bool{"generic-receive-offload": false},
+		Rings:    map[string]int{"rx": 1024},
+		Coalesce: map[string]interface{}{"rx-usecs": float64(50)},
+	}
+	if got := LinkSettingsDiff(current, desired); !reflect.DeepEqual(got, want) {
+		t.Errorf("LinkSettingsDiff() = %+v, want %+v", got, want)
+	}
+	if got := LinkSettingsDiff(current, current); !got.IsEmpty() {
+		t.Errorf("LinkSettingsDiff() of equal settings = %+v, want empty", got)
+	}
+}
+
+func TestEthtoolArgs(t *testing.T) {
+	got := EthtoolArgs("eth0", &types.LinkSettings{
+		Offloads: map[string]bool{"rx-gro-hw": true, "generic-receive-offload": false},
+		Rings:    map[string]int{"tx": 512},
+		Coalesce: map[string]interface{}{"tx-usecs": 8},
+	})
+	want := [][]string{
+		{"-K", "eth0", "gro", "off", "rx-gro-hw", "on"},
+		{"-G", "eth0", "tx", "512"},
+		{"-C", "eth0", "tx-usecs", "8"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EthtoolArgs() = %v, want %v", got, want)
+	}
+}
+
+func TestIPLinkArgs(t *testing.T) {
+	mtu, qlen := 9000, 500
+	tests := []struct {
+		settings *types.LinkSettings
+		want     []string
+	}{
+		{&types.LinkSettings{MTU: &mtu, TxQueueLen: &qlen}, []string{"link", "set", "dev", "eth0", "mtu", "9000", "txqueuelen", "500"}},
+		{&types.LinkSettings{TxQueueLen: &qlen}, []string{"link", "set", "dev", "eth0", "txqueuelen", "500"}},
+		{&types.LinkSettings{Rings: map[string]int{"rx": 512}}, nil},
+		{nil, nil},
+	}
+
+	for _, tt := range tests {
+		if got := IPLinkArgs("eth0", tt.settings); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("IPLinkArgs(%+v) = %v, want %v", tt.settings, got, tt.want)
+		}
+	}
+}
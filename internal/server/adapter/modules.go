@@ -0,0 +1,145 @@
+package adapter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// NettuneModulesLoadPath is the modules-load.d entry nettune manages
+const NettuneModulesLoadPath = "/etc/modules-load.d/nettune.conf"
+
+// procModulesPath lists the loadable modules currently in the kernel
+const procModulesPath = "/proc/modules"
+
+// ModuleManager handles kernel module loading and boot persistence
+type ModuleManager struct {
+	logger *zap.Logger
+}
+
+// NewModuleManager creates a new ModuleManager
+func NewModuleManager(logger *zap.Logger) *ModuleManager {
+	return &ModuleManager{logger: logger}
+}
+
+// Loaded returns the names of loaded modules. Built-in modules are not listed.
+func (m *ModuleManager) Loaded() (map[string]bool, error) {
+	return parseProcModules(procModulesPath)
+}
+
+// parseProcModules reads module names from a /proc/modules style file
+func parseProcModules(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer file.Close()
+
+	loaded := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 {
+			loaded[fields[0]] = true
+		}
+	}
+	return loaded, scanner.Err()
+}
+
+// Available reports whether modprobe can find a module without loading it
+func (m *ModuleManager) Available(name string) error {
+	cmd := exec.Command("modprobe", "--dry-run", "--quiet", name)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%s: %w", msg, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Load loads a module with modprobe
+func (m *ModuleManager) Load(name string) error {
+	cmd := exec.Command("modprobe", name)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to load module %s: %w\noutput: %s", name, err, string(output))
+	}
+	m.logger.Info("loaded kernel module", zap.String("module", name))
+	return nil
+}
+
+// ReadModulesLoadFile returns the modules listed in a modules-load.d file;
+// a missing file yields no modules
+func (m *ModuleManager) ReadModulesLoadFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return ParseModulesLoadFile(string(data)), nil
+}
+
+// WriteModulesLoadFile atomically writes a modules-load.d file
+func (m *ModuleManager) WriteModulesLoadFile(path string, modules []string) error {
+	content := FormatModulesLoadFile(modules)
+
+	// Ensure directory exists
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	// Atomic write
+	tmpFile := path + ".tmp"
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	if err := os.Rename(tmpFile, path); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+
+	m.logger.Info("wrote modules-load configuration file",
+		zap.String("path", path),
+		zap.Strings("modules", modules))
+	return nil
+}
+
+// ParseModulesLoadFile returns the module names in modules-load.d content
+func ParseModulesLoadFile(content string) []string {
+	var modules []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		modules = append(modules, line)
+	}
+	return modules
+}
+
+// FormatModulesLoadFile renders module names sorted, one per line
+func FormatModulesLoadFile(modules []string) string {
+	sorted := append([]string(nil), modules...)
+	sort.Strings(sorted)
+
+	lines := []string{"# Managed by nettune - DO NOT EDIT"}
+	lines = append(lines, sorted...)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// CongestionControlModule returns the module providing a TCP congestion control
+func CongestionControlModule(cc string) string {
+	return "tcp_" + cc
+}
@@ -0,0 +1,38 @@
+package adapter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseProcModules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "modules")
+	content := "tcp_bbr 20480 3 - Live 0x0000000000000000\nsch_fq 24576 2 - Live 0x0000000000000000\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := parseProcModules(path)
+	if err != nil {
+		t.Fatalf("parseProcModules failed: %v", err)
+	}
+	want := map[string]bool{"tcp_bbr": true, "sch_fq": true}
+	if !reflect.DeepEqual(loaded, want) {
+		t.Errorf("parseProcModules() = %v, want %v", loaded, want)
+	}
+}
+
+func TestModulesLoadFileRoundTrip(t *testing.T) {
+	content := FormatModulesLoadFile([]string{"tcp_bbr", "sch_fq"})
+	want := "# Managed by nettune - DO NOT EDIT\nsch_fq\ntcp_bbr\n"
+	if content != want {
+		t.Errorf("FormatModulesLoadFile() = %q, want %q", content, want)
+	}
+
+	modules := ParseModulesLoadFile(content + "; comment\n\n  tcp_htcp  \n")
+	if !reflect.DeepEqual(modules, []string{"sch_fq", "tcp_bbr", "tcp_htcp"}) {
+		t.Errorf("ParseModulesLoadFile() = %v", modules)
+	}
+}
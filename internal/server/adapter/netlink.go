@@ -0,0 +1,559 @@
+package adapter
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+)
+
+// errNetlinkUnsupported means an operation must go through tc instead
+var errNetlinkUnsupported = errors.New("not supported by the netlink backend")
+
+// rtnetlink message types and flags from include/uapi/linux/{netlink,rtnetlink}.h
+const (
+	nlmsgHdrLen = 16
+	nlmsgError  = 0x2
+	nlmsgDone   = 0x3
+
+	nlmFRequest = 0x1
+	nlmFMulti   = 0x2
+	nlmFAck     = 0x4
+	nlmFDump    = 0x300
+	nlmFReplace = 0x100
+	nlmFCreate  = 0x400
+
+	rtmNewQdisc = 36
+	rtmDelQdisc = 37
+	rtmGetQdisc = 38
+)
+
+// Traffic control attributes from include/uapi/linux/{rtnetlink,pkt_sched}.h
+const (
+	tcmsgLen   = 20
+	tcHRoot    = 0xFFFFFFFF
+	tcaKind    = 1
+	tcaOptions = 2
+
+	tcaFqPlimit           = 1
+	tcaFqFlowPlimit       = 2
+	tcaFqQuantum          = 3
+	tcaFqInitialQuantum   = 4
+	tcaFqRateEnable       = 5
+	tcaFqFlowMaxRate      = 7
+	tcaFqBucketsLog       = 8
+	tcaFqFlowRefillDelay  = 9
+	tcaFqOrphanMask       = 10
+	tcaFqLowRateThreshold = 11
+	tcaFqCeThreshold      = 12
+	tcaFqTimerSlack       = 13
+	tcaFqHorizon          = 14
+	tcaFqHorizonDrop      = 15
+
+	tcaFqCodelTarget        = 1
+	tcaFqCodelLimit         = 2
+	tcaFqCodelInterval      = 3
+	tcaFqCodelEcn           = 4
+	tcaFqCodelFlows         = 5
+	tcaFqCodelQuantum       = 6
+	tcaFqCodelCeThreshold   = 7
+	tcaFqCodelDropBatchSize = 8
+	tcaFqCodelMemoryLimit   = 9
+
+	tcaCakeBaseRate64   = 2
+	tcaCakeDiffservMode = 3
+	tcaCakeAtm          = 4
+	tcaCakeFlowMode     = 5
+	tcaCakeOverhead     = 6
+	tcaCakeRtt          = 7
+	tcaCakeMemory       = 10
+	tcaCakeNat          = 11
+	tcaCakeRaw          = 12
+	tcaCakeWash         = 13
+	tcaCakeMpu          = 14
+	tcaCakeIngress      = 15
+	tcaCakeAckFilter    = 16
+	tcaCakeSplitGso     = 17
+	tcaCakeFwmark       = 18
+)
+
+// cake enums, indexed by their kernel value
+var (
+	cakeDiffservModes = []string{"diffserv3", "diffserv4", "diffserv8", "besteffort", "precedence"}
+	cakeFlowModes     = []string{"flowblind", "srchost", "dsthost", "hosts", "flows", "dual-srchost", "dual-dsthost", "triple-isolate"}
+	cakeAtmModes      = []string{"noatm", "atm", "ptm"}
+	cakeAckFilters    = []string{"no-ack-filter", "ack-filter", "ack-filter-aggressive"}
+)
+
+// netlinkMessage is one message of a netlink reply
+type netlinkMessage struct {
+	Type  uint16
+	Flags uint16
+	Seq   uint32
+	Data  []byte
+}
+
+// netlinkAttr is one route attribute
+type netlinkAttr struct {
+	Type  uint16
+	Value []byte
+}
+
+// netlinkGetRootQdisc finds the root qdisc of an interface in a qdisc dump.
+// A dump is used like tc does because some kernels answer a plain get with
+// only an acknowledgement.
+func netlinkGetRootQdisc(ifindex int) (*types.QdiscInfo, error) {
+	replies, err := netlinkRequest(rtmGetQdisc, nlmFDump, encodeTcmsg(ifindex, 0, 0))
+	if err != nil {
+		return nil, err
+	}
+	for _, reply := range replies {
+		msgIfindex, parent, info, err := decodeQdiscMessage(reply)
+		if err != nil {
+			return nil, err
+		}
+		if msgIfindex == ifindex && parent == tcHRoot {
+			return info, nil
+		}
+	}
+	return nil, fmt.Errorf("no root qdisc in netlink reply")
+}
+
+// netlinkReplaceRootQdisc creates or replaces the root qdisc of an interface
+func netlinkReplaceRootQdisc(ifindex int, kind string, params map[string]interface{}) error {
+	options, err := encodeQdiscOptions(kind, params)
+	if err != nil {
+		return err
+	}
+
+	payload := encodeTcmsg(ifindex, 0, tcHRoot)
+	payload = appendAttr(payload, tcaKind, append([]byte(kind), 0))
+	if options != nil {
+		payload = appendAttr(payload, tcaOptions, options)
+	}
+
+	_, err = netlinkRequest(rtmNewQdisc, nlmFAck|nlmFCreate|nlmFReplace, payload)
+	return err
+}
+
+// netlinkDeleteRootQdisc deletes the root qdisc of an interface
+func netlinkDeleteRootQdisc(ifindex int) error {
+	_, err := netlinkRequest(rtmDelQdisc, nlmFAck, encodeTcmsg(ifindex, 0, tcHRoot))
+	return err
+}
+
+// encodeNetlinkMessage builds a request message around a payload
+func encodeNetlinkMessage(msgType, flags uint16, seq uint32, payload []byte) []byte {
+	msg := make([]byte, nlmsgHdrLen, nlmsgHdrLen+len(payload))
+	binary.NativeEndian.PutUint32(msg[0:4], uint32(nlmsgHdrLen+len(payload)))
+	binary.NativeEndian.PutUint16(msg[4:6], msgType)
+	binary.NativeEndian.PutUint16(msg[6:8], flags|nlmFRequest)
+	binary.NativeEndian.PutUint32(msg[8:12], seq)
+	return append(msg, payload...)
+}
+
+// parseNetlinkMessages splits a datagram into netlink messages
+func parseNetlinkMessages(b []byte) ([]netlinkMessage, error) {
+	var msgs []netlinkMessage
+	for len(b) >= nlmsgHdrLen {
+		length := int(binary.NativeEndian.Uint32(b[0:4]))
+		if length < nlmsgHdrLen || length > len(b) {
+			return nil, fmt.Errorf("malformed netlink message length %d", length)
+		}
+		msgs = append(msgs, netlinkMessage{
+			Type:  binary.NativeEndian.Uint16(b[4:6]),
+			Flags: binary.NativeEndian.Uint16(b[6:8]),
+			Seq:   binary.NativeEndian.Uint32(b[8:12]),
+			Data:  b[nlmsgHdrLen:length],
+		})
+		if nlmAlign(length) >= len(b) {
+			break
+		}
+		b = b[nlmAlign(length):]
+	}
+	return msgs, nil
+}
+
+// nlmAlign rounds a length up to the 4-byte netlink alignment
+func nlmAlign(length int) int {
+	return (length + 3) &^ 3
+}
+
+// encodeTcmsg builds the struct tcmsg header of a traffic control request
+func encodeTcmsg(ifindex int, handle, parent uint32) []byte {
+	b := make([]byte, tcmsgLen)
+	binary.NativeEndian.PutUint32(b[4:8], uint32(int32(ifindex)))
+	binary.NativeEndian.PutUint32(b[8:12], handle)
+	binary.NativeEndian.PutUint32(b[12:16], parent)
+	return b
+}
+
+// appendAttr appends a route attribute, padded to the netlink alignment
+func appendAttr(b []byte, attrType uint16, value []byte) []byte {
+	header := make([]byte, 4)
+	binary.NativeEndian.PutUint16(header[0:2], uint16(4+len(value)))
+	binary.NativeEndian.PutUint16(header[2:4], attrType)
+	b = append(b, header...)
+	b = append(b, value...)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// parseAttrs splits route attributes; the nested and byte-order flags are masked off
+func parseAttrs(b []byte) ([]netlinkAttr, error) {
+	var attrs []netlinkAttr
+	for len(b) >= 4 {
+		length := int(binary.NativeEndian.Uint16(b[0:2]))
+		if length < 4 || length > len(b) {
+			return nil, fmt.Errorf("malformed netlink attribute length %d", length)
+		}
+		attrs = append(attrs, netlinkAttr{
+			Type:  binary.NativeEndian.Uint16(b[2:4]) & 0x3FFF,
+			Value: b[4:length],
+		})
+		if nlmAlign(length) >= len(b) {
+			break
+		}
+		b = b[nlmAlign(length):]
+	}
+	return attrs, nil
+}
+
+// decodeQdiscMessage decodes an RTM_NEWQDISC message into qdisc information
+func decodeQdiscMessage(b []byte) (ifindex int, parent uint32, info *types.QdiscInfo, err error) {
+	if len(b) < tcmsgLen {
+		return 0, 0, nil, fmt.Errorf("short tcmsg")
+	}
+	ifindex = int(int32(binary.NativeEndian.Uint32(b[4:8])))
+	handle := binary.NativeEndian.Uint32(b[8:12])
+	parent = binary.NativeEndian.Uint32(b[12:16])
+
+	attrs, err := parseAttrs(b[tcmsgLen:])
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	info = &types.QdiscInfo{
+		Handle: strconv.FormatUint(uint64(handle>>16), 16),
+		Params: make(map[string]interface{}),
+	}
+	var options []byte
+	for _, attr := range attrs {
+		switch attr.Type {
+		case tcaKind:
+			info.Type = cString(attr.Value)
+		case tcaOptions:
+			options = attr.Value
+		}
+	}
+	if info.Type == "" {
+		return 0, 0, nil, fmt.Errorf("qdisc message without kind")
+	}
+	// Other kinds such as pfifo_fast carry a raw struct, not attributes
+	if options != nil && (info.Type == "fq" || info.Type == "fq_codel" || info.Type == "cake") {
+		if err := decodeQdiscOptions(info.Type, options, info.Params); err != nil {
+			return 0, 0, nil, err
+		}
+	}
+	return ifindex, parent, info, nil
+}
+
+// decodeQdiscOptions converts the TCA_OPTIONS attributes of fq, fq_codel and
+// cake into tc-style parameters that QdiscArgs and tc accept back
+func decodeQdiscOptions(kind string, b []byte, params map[string]interface{}) error {
+	attrs, err := parseAttrs(b)
+	if err != nil {
+		return err
+	}
+
+	for _, attr := range attrs {
+		v, ok := attrUint32(attr)
+		if !ok && !(kind == "cake" && attr.Type == tcaCakeBaseRate64) && !(kind == "fq" && attr.Type == tcaFqHorizonDrop) {
+			continue
+		}
+
+		switch kind {
+		case "fq":
+			switch attr.Type {
+			case tcaFqPlimit:
+				params["limit"] = uintString(v)
+			case tcaFqFlowPlimit:
+				params["flow_limit"] = uintString(v)
+			case tcaFqQuantum:
+				params["quantum"] = uintString(v)
+			case tcaFqInitialQuantum:
+				params["initial_quantum"] = uintString(v)
+			case tcaFqRateEnable:
+				if v == 0 {
+					params["nopacing"] = true
+				} else {
+					params["pacing"] = true
+				}
+			case tcaFqFlowMaxRate:
+				if v != math.MaxUint32 {
+					params["maxrate"] = rateString(uint64(v))
+				}
+			case tcaFqBucketsLog:
+				params["buckets"] = uintString(1 << v)
+			case tcaFqFlowRefillDelay:
+				params["refill_delay"] = uintString(v) + "us"
+			case tcaFqOrphanMask:
+				params["orphan_mask"] = uintString(v)
+			case tcaFqLowRateThreshold:
+				params["low_rate_threshold"] = rateString(uint64(v))
+			case tcaFqCeThreshold:
+				if v != math.MaxUint32 {
+					params["ce_threshold"] = uintString(v) + "us"
+				}
+			case tcaFqTimerSlack:
+				params["timer_slack"] = uintString(v) + "ns"
+			case tcaFqHorizon:
+				params["horizon"] = uintString(v) + "us"
+			case tcaFqHorizonDrop:
+				if len(attr.Value) >= 1 {
+					if attr.Value[0] == 0 {
+						params["horizon_cap"] = true
+					} else {
+						params["horizon_drop"] = true
+					}
+				}
+			}
+
+		case "fq_codel":
+			switch attr.Type {
+			case tcaFqCodelTarget:
+				params["target"] = uintString(v) + "us"
+			case tcaFqCodelLimit:
+				params["limit"] = uintString(v)
+			case tcaFqCodelInterval:
+				params["interval"] = uintString(v) + "us"
+			case tcaFqCodelEcn:
+				if v == 0 {
+					params["noecn"] = true
+				} else {
+					params["ecn"] = true
+				}
+			case tcaFqCodelFlows:
+				params["flows"] = uintString(v)
+			case tcaFqCodelQuantum:
+				params["quantum"] = uintString(v)
+			case tcaFqCodelCeThreshold:
+				params["ce_threshold"] = uintString(v) + "us"
+			case tcaFqCodelDropBatchSize:
+				params["drop_batch"] = uintString(v)
+			case tcaFqCodelMemoryLimit:
+				params["memory_limit"] = uintString(v)
+			}
+
+		case "cake":
+			switch attr.Type {
+			case tcaCakeBaseRate64:
+				if len(attr.Value) >= 8 {
+					if rate := binary.NativeEndian.Uint64(attr.Value); rate == 0 {
+						params["unlimited"] = true
+					} else {
+						params["bandwidth"] = rateString(rate)
+					}
+				}
+			case tcaCakeDiffservMode:
+				setEnumFlag(params, cakeDiffservModes, v)
+			case tcaCakeFlowMode:
+				setEnumFlag(params, cakeFlowModes, v&0x7)
+				if v&0x8 != 0 {
+					params["nat"] = true
+				}
+			case tcaCakeAtm:
+				setEnumFlag(params, cakeAtmModes, v)
+			case tcaCakeAckFilter:
+				setEnumFlag(params, cakeAckFilters, v)
+			case tcaCakeOverhead:
+				params["overhead"] = strconv.Itoa(int(int32(v)))
+			case tcaCakeRtt:
+				params["rtt"] = uintString(v) + "us"
+			case tcaCakeMemory:
+				if v != 0 {
+					params["memlimit"] = uintString(v)
+				}
+			case tcaCakeNat:
+				setBoolFlag(params, v, "nat", "nonat")
+			case tcaCakeRaw:
+				if v != 0 {
+					params["raw"] = true
+				}
+			case tcaCakeWash:
+				setBoolFlag(params, v, "wash", "nowash")
+			case tcaCakeMpu:
+				params["mpu"] = uintString(v)
+			case tcaCakeIngress:
+				setBoolFlag(params, v, "ingress", "egress")
+			case tcaCakeSplitGso:
+				setBoolFlag(params, v, "split-gso", "no-split-gso")
+			case tcaCakeFwmark:
+				if v != 0 {
+					params["fwmark"] = uintString(v)
+				}
+			}
+		}
+	}
+
+	// A raw overhead of 0 is the cake default and not worth restoring separately
+	if kind == "cake" && params["raw"] == true {
+		delete(params, "overhead")
+	}
+	return nil
+}
+
+// encodeQdiscOptions builds TCA_OPTIONS for the plain integer and flag parameters
+// of fq and fq_codel. Parameters with units, and other kinds with parameters,
+// return errNetlinkUnsupported so tc parses them instead.
+func encodeQdiscOptions(kind string, params map[string]interface{}) ([]byte, error) {
+	if len(params) == 0 {
+		switch kind {
+		case "fq", "fq_codel", "pfifo_fast", "cake":
+			return nil, nil
+		}
+		return nil, errNetlinkUnsupported
+	}
+
+	var counters map[string]uint16
+	var flags map[string][2]uint32 // param -> {attribute, value}
+	switch kind {
+	case "fq":
+		counters = map[string]uint16{
+			"limit": tcaFqPlimit, "flow_limit": tcaFqFlowPlimit, "quantum": tcaFqQuantum,
+			"initial_quantum": tcaFqInitialQuantum, "orphan_mask": tcaFqOrphanMask,
+		}
+		flags = map[string][2]uint32{"pacing": {tcaFqRateEnable, 1}, "nopacing": {tcaFqRateEnable, 0}}
+	case "fq_codel":
+		counters = map[string]uint16{
+			"limit": tcaFqCodelLimit, "flows": tcaFqCodelFlows, "quantum": tcaFqCodelQuantum,
+			"drop_batch": tcaFqCodelDropBatchSize, "memory_limit": tcaFqCodelMemoryLimit,
+		}
+		flags = map[string][2]uint32{"ecn": {tcaFqCodelEcn, 1}, "noecn": {tcaFqCodelEcn, 0}}
+	default:
+		return nil, errNetlinkUnsupported
+	}
+
+	var options []byte
+	for _, key := range sortedParamKeys(params) {
+		value := params[key]
+		if flag, ok := flags[key]; ok {
+			if b, isBool := value.(bool); isBool && !b {
+				continue
+			}
+			options = appendAttr(options, uint16(flag[0]), uint32Bytes(flag[1]))
+			continue
+		}
+
+		if kind == "fq" && key == "buckets" {
+			n, err := paramUint32(value)
+			if err != nil || n == 0 || n&(n-1) != 0 {
+				return nil, errNetlinkUnsupported
+			}
+			options = appendAttr(options, tcaFqBucketsLog, uint32Bytes(uint32(bits.TrailingZeros32(n))))
+			continue
+		}
+
+		attr, ok := counters[key]
+		if !ok {
+			return nil, errNetlinkUnsupported
+		}
+		n, err := paramUint32(value)
+		if err != nil {
+			return nil, errNetlinkUnsupported
+		}
+		options = appendAttr(options, attr, uint32Bytes(n))
+	}
+	return options, nil
+}
+
+// sortedParamKeys returns parameter names sorted so requests are deterministic
+func sortedParamKeys(params map[string]interface{}) []string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// paramUint32 parses a parameter that must be a plain unsigned integer
+func paramUint32(value interface{}) (uint32, error) {
+	var s string
+	switch v := value.(type) {
+	case float64:
+		if v != math.Trunc(v) || v < 0 || v > math.MaxUint32 {
+			return 0, fmt.Errorf("not a 32-bit integer: %v", v)
+		}
+		return uint32(v), nil
+	case int:
+		s = strconv.Itoa(v)
+	case string:
+		s = v
+	default:
+		s = fmt.Sprintf("%v", v)
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(n), nil
+}
+
+// attrUint32 reads a 32-bit attribute value
+func attrUint32(attr netlinkAttr) (uint32, bool) {
+	if len(attr.Value) < 4 {
+		return 0, false
+	}
+	return binary.NativeEndian.Uint32(attr.Value), true
+}
+
+// uint32Bytes encodes a 32-bit attribute value
+func uint32Bytes(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.NativeEndian.PutUint32(b, v)
+	return b
+}
+
+// uintString formats an unsigned value in decimal
+func uintString(v uint32) string {
+	return strconv.FormatUint(uint64(v), 10)
+}
+
+// rateString formats a kernel rate in bytes per second the way tc parses it
+func rateString(bytesPerSecond uint64) string {
+	return strconv.FormatUint(bytesPerSecond*8, 10) + "bit"
+}
+
+// setEnumFlag sets the flag parameter naming an enum value
+func setEnumFlag(params map[string]interface{}, names []string, v uint32) {
+	if int(v) < len(names) {
+		params[names[v]] = true
+	}
+}
+
+// setBoolFlag sets the on or off flag parameter for a boolean attribute
+func setBoolFlag(params map[string]interface{}, v uint32, on, off string) {
+	if v != 0 {
+		params[on] = true
+	} else {
+		params[off] = true
+	}
+}
+
+// cString returns a NUL-terminated string attribute without its terminator
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
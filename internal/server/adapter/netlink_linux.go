@@ -0,0 +1,82 @@
+//go:build linux
+
+package adapter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// netlinkTimeout bounds how long a request waits for the kernel to answer
+const netlinkTimeout = 5 * time.Second
+
+// netlinkSeq numbers requests so stale replies are ignored
+var netlinkSeq atomic.Uint32
+
+func init() {
+	netlinkSeq.Store(uint32(time.Now().Unix()))
+}
+
+// netlinkRequest sends one rtnetlink request and returns the payloads of the
+// replies. It returns after the kernel acknowledges the request or ends a dump.
+func netlinkRequest(msgType, flags uint16, payload []byte) ([][]byte, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open netlink socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("failed to bind netlink socket: %w", err)
+	}
+	tv := unix.NsecToTimeval(netlinkTimeout.Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		return nil, fmt.Errorf("failed to set netlink timeout: %w", err)
+	}
+
+	seq := netlinkSeq.Add(1)
+	msg := encodeNetlinkMessage(msgType, flags, seq, payload)
+	if err := unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, fmt.Errorf("failed to send netlink request: %w", err)
+	}
+
+	var replies [][]byte
+	buf := make([]byte, 1<<16)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to receive netlink reply: %w", err)
+		}
+		msgs, err := parseNetlinkMessages(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range msgs {
+			if m.Seq != seq {
+				continue
+			}
+			switch m.Type {
+			case nlmsgDone:
+				return replies, nil
+			case nlmsgError:
+				if len(m.Data) < 4 {
+					return nil, fmt.Errorf("short netlink error message")
+				}
+				if code := int32(binary.NativeEndian.Uint32(m.Data[0:4])); code != 0 {
+					return nil, unix.Errno(-code)
+				}
+				return replies, nil
+			default:
+				replies = append(replies, append([]byte(nil), m.Data...))
+				if flags&nlmFAck == 0 && m.Flags&nlmFMulti == 0 {
+					return replies, nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package adapter
+
+// netlinkRequest is unavailable off Linux, so callers fall back to tc
+func netlinkRequest(msgType, flags uint16, payload []byte) ([][]byte, error) {
+	return nil, errNetlinkUnsupported
+}
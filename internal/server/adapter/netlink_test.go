@@ -0,0 +1,246 @@
+package adapter
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// qdiscMessage builds an RTM_NEWQDISC payload as the kernel sends it
+func qdiscMessage(ifindex int, handle, parent uint32, kind string, options []byte) []byte {
+	b := encodeTcmsg(ifindex, handle, parent)
+	b = appendAttr(b, tcaKind, append([]byte(kind), 0))
+	if options != nil {
+		b = appendAttr(b, tcaOptions, options)
+	}
+	return b
+}
+
+func u32Attr(b []byte, attrType uint16, v uint32) []byte {
+	return appendAttr(b, attrType, uint32Bytes(v))
+}
+
+func TestDecodeQdiscMessage(t *testing.T) {
+	var fq []byte
+	fq = u32Attr(fq, tcaFqPlimit, 10000)
+	fq = u32Attr(fq, tcaFqFlowPlimit, 100)
+	fq = u32Attr(fq, tcaFqQuantum, 3028)
+	fq = u32Attr(fq, tcaFqRateEnable, 1)
+	fq = u32Attr(fq, tcaFqFlowMaxRate, math.MaxUint32)
+	fq = u32Attr(fq, tcaFqBucketsLog, 10)
+	fq = u32Attr(fq, tcaFqFlowRefillDelay, 40000)
+	fq = u32Attr(fq, tcaFqLowRateThreshold, 68750)
+	fq = u32Attr(fq, tcaFqCeThreshold, math.MaxUint32)
+	fq = u32Attr(fq, tcaFqTimerSlack, 10000)
+	fq = appendAttr(fq, tcaFqHorizonDrop, []byte{1})
+
+	var fqCodel []byte
+	fqCodel = u32Attr(fqCodel, tcaFqCodelTarget, 4999)
+	fqCodel = u32Attr(fqCodel, tcaFqCodelLimit, 10240)
+	fqCodel = u32Attr(fqCodel, tcaFqCodelInterval, 99999)
+	fqCodel = u32Attr(fqCodel, tcaFqCodelEcn, 0)
+	fqCodel = u32Attr(fqCodel, tcaFqCodelMemoryLimit, 33554432)
+
+	rate := make([]byte, 8)
+	binary.NativeEndian.PutUint64(rate, 12500000)
+	var cake []byte
+	cake = appendAttr(cake, tcaCakeBaseRate64, rate)
+	cake = u32Attr(cake, tcaCakeDiffservMode, 0)
+	cake = u32Attr(cake, tcaCakeFlowMode, 7)
+	cake = u32Attr(cake, tcaCakeAtm, 0)
+	cake = u32Attr(cake, tcaCakeOverhead, 0)
+	cake = u32Attr(cake, tcaCakeRaw, 1)
+	cake = u32Attr(cake, tcaCakeRtt, 100000)
+	cake = u32Attr(cake, tcaCakeWash, 0)
+	cake = u32Attr(cake, tcaCakeAckFilter, 0)
+	cake = u32Attr(cake, tcaCakeSplitGso, 1)
+
+	tests := []struct {
+		name       string
+		msg        []byte
+		wantType   string
+		wantHandle string
+		wantParams map[string]interface{}
+	}{
+		{
+			name:       "fq",
+			msg:        qdiscMessage(2, 0x80010000, tcHRoot, "fq", fq),
+			wantType:   "fq",
+			wantHandle: "8001",
+			wantParams: map[string]interface{}{
+				"limit":              "10000",
+				"flow_limit":         "100",
+				"quantum":            "3028",
+				"pacing":             true,
+				"buckets":            "1024",
+				"refill_delay":       "40000us",
+				"low_rate_threshold": "550000bit",
+				"timer_slack":        "10000ns",
+				"horizon_drop":       true,
+			},
+		},
+		{
+			name:       "fq_codel",
+			msg:        qdiscMessage(2, 0, tcHRoot, "fq_codel", fqCodel),
+			wantType:   "fq_codel",
+			wantHandle: "0",
+			wantParams: map[string]interface{}{
+				"target":       "4999us",
+				"limit":        "10240",
+				"interval":     "99999us",
+				"noecn":        true,
+				"memory_limit": "33554432",
+			},
+		},
+		{
+			name:       "cake",
+			msg:        qdiscMessage(2, 0x80020000, tcHRoot, "cake", cake),
+			wantType:   "cake",
+			wantHandle: "8002",
+			wantParams: map[string]interface{}{
+				"bandwidth":      "100000000bit",
+				"diffserv3":      true,
+				"triple-isolate": true,
+				"noatm":          true,
+				"raw":            true,
+				"rtt":            "100000us",
+				"nowash":         true,
+				"no-ack-filter":  true,
+				"split-gso":      true,
+			},
+		},
+		{
+			name:       "kind without options",
+			msg:        qdiscMessage(3, 0, tcHRoot, "noqueue", nil),
+			wantType:   "noqueue",
+			wantHandle: "0",
+			wantParams: map[string]interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, parent, info, err := decodeQdiscMessage(tt.msg)
+			if err != nil {
+				t.Fatalf("decodeQdiscMessage() error = %v", err)
+			}
+			if parent != tcHRoot {
+				t.Errorf("parent = %x, want root", parent)
+			}
+			if info.Type != tt.wantType || info.Handle != tt.wantHandle {
+				t.Errorf("got %s %s, want %s %s", info.Type, info.Handle, tt.wantType, tt.wantHandle)
+			}
+			if !reflect.DeepEqual(info.Params, tt.wantParams) {
+				t.Errorf("params = %v, want %v", info.Params, tt.wantParams)
+			}
+			// Decoded parameters must be accepted back when restoring
+			if got := RestorableParams(info.Type, info.Params); len(got) != len(info.Params) {
+				t.Errorf("RestorableParams() dropped parameters: %v", got)
+			}
+		})
+	}
+}
+
+func TestDecodedQdiscMatchesProfileUnits(t *testing.T) {
+	var options []byte
+	options = u32Attr(options, tcaFqCodelTarget, 5000)
+	options = u32Attr(options, tcaFqCodelMemoryLimit, 33554432)
+	_, _, info, err := decodeQdiscMessage(qdiscMessage(2, 0x80010000, tcHRoot, "fq_codel", options))
+	if err != nil {
+		t.Fatalf("decodeQdiscMessage() error = %v", err)
+	}
+
+	want := map[string]interface{}{"memory_limit": "32Mb", "target": float64(5000)}
+	if diff := QdiscParamsDiff("fq_codel", want, info.Params); diff != nil {
+		t.Errorf("QdiscParamsDiff(%v, %v) = %v, want none", want, info.Params, diff)
+	}
+	want = map[string]interface{}{"memory_limit": "16Mb", "target": "5ms"}
+	if diff := QdiscParamsDiff("fq_codel", want, info.Params); !reflect.DeepEqual(diff, []string{"memory_limit"}) {
+		t.Errorf("QdiscParamsDiff(%v, %v) = %v, want [memory_limit]", want, info.Params, diff)
+	}
+}
+
+func TestEncodeQdiscOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		kind        string
+		params      map[string]interface{}
+		want        []byte
+		unsupported bool
+	}{
+		{
+			name: "no params",
+			kind: "fq",
+		},
+		{
+			name:   "fq counters and flags",
+			kind:   "fq",
+			params: map[string]interface{}{"buckets": float64(4096), "limit": "20000", "nopacing": true, "pacing": false},
+			want:   u32Attr(u32Attr(u32Attr(nil, tcaFqBucketsLog, 12), tcaFqPlimit, 20000), tcaFqRateEnable, 0),
+		},
+		{
+			name:   "fq_codel ecn",
+			kind:   "fq_codel",
+			params: map[string]interface{}{"ecn": true, "flows": 2048},
+			want:   u32Attr(u32Attr(nil, tcaFqCodelEcn, 1), tcaFqCodelFlows, 2048),
+		},
+		{
+			name:        "value with unit",
+			kind:        "fq_codel",
+			params:      map[string]interface{}{"target": "5ms"},
+			unsupported: true,
+		},
+		{
+			name:        "buckets not a power of two",
+			kind:        "fq",
+			params:      map[string]interface{}{"buckets": "1000"},
+			unsupported: true,
+		},
+		{
+			name:        "cake params",
+			kind:        "cake",
+			params:      map[string]interface{}{"bandwidth": "100mbit"},
+			unsupported: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := encodeQdiscOptions(tt.kind, tt.params)
+			if tt.unsupported {
+				if !errors.Is(err, errNetlinkUnsupported) {
+					t.Fatalf("encodeQdiscOptions() error = %v, want errNetlinkUnsupported", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("encodeQdiscOptions() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("encodeQdiscOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNetlinkMessages(t *testing.T) {
+	first := encodeNetlinkMessage(rtmNewQdisc, nlmFMulti, 7, qdiscMessage(2, 0, tcHRoot, "fq", nil))
+	done := encodeNetlinkMessage(nlmsgDone, nlmFMulti, 7, uint32Bytes(0))
+
+	msgs, err := parseNetlinkMessages(append(first, done...))
+	if err != nil {
+		t.Fatalf("parseNetlinkMessages() error = %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].Type != rtmNewQdisc || msgs[1].Type != nlmsgDone || msgs[0].Seq != 7 {
+		t.Fatalf("parseNetlinkMessages() = %+v", msgs)
+	}
+	if _, _, info, err := decodeQdiscMessage(msgs[0].Data); err != nil || info.Type != "fq" {
+		t.Errorf("decodeQdiscMessage() = %v, %v", info, err)
+	}
+
+	if _, err := parseNetlinkMessages(first[:len(first)-4]); err == nil {
+		t.Error("expected error for truncated message")
+	}
+}
@@ -1,11 +1,13 @@
 package adapter
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"net"
-	"os"
 	"os/exec"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/jtsang4/nettune/internal/shared/types"
@@ -22,8 +24,23 @@ func NewQdiscManager(logger *zap.Logger) *QdiscManager {
 	return &QdiscManager{logger: logger}
 }
 
-// Get returns qdisc information for an interface
+// Get returns qdisc information for an interface. The root qdisc is read over
+// netlink; tc is used when netlink is unavailable.
 func (m *QdiscManager) Get(iface string) (*types.QdiscInfo, error) {
+	if ifindex, err := interfaceIndex(iface); err == nil {
+		info, err := netlinkGetRootQdisc(ifindex)
+		if err == nil {
+			return info, nil
+		}
+		m.logger.Debug("netlink qdisc query failed, falling back to tc",
+			zap.String("interface", iface),
+			zap.Error(err))
+	}
+	return m.getViaTC(iface)
+}
+
+// getViaTC returns qdisc information for an interface from tc output
+func (m *QdiscManager) getViaTC(iface string) (*types.QdiscInfo, error) {
 	cmd := exec.Command("tc", "qdisc", "show", "dev", iface)
 	output, err := cmd.Output()
 	if err != nil {
@@ -47,15 +64,32 @@ func (m *QdiscManager) Get(iface string) (*types.QdiscInfo, error) {
 	return m.parseQdiscLine(lines[0])
 }
 
-// Set sets the root qdisc for an interface
+// Set sets the root qdisc for an interface. Parameters the netlink backend
+// cannot encode, such as values with units, are passed to tc instead.
 func (m *QdiscManager) Set(iface, qdiscType string, params map[string]interface{}) error {
+	if ifindex, err := interfaceIndex(iface); err == nil {
+		err := netlinkReplaceRootQdisc(ifindex, qdiscType, params)
+		if err == nil {
+			m.logger.Info("set qdisc successfully",
+				zap.String("interface", iface),
+				zap.String("type", qdiscType),
+				zap.String("backend", "netlink"))
+			return nil
+		}
+		if !errors.Is(err, errNetlinkUnsupported) {
+			m.logger.Debug("netlink qdisc replace failed, falling back to tc",
+				zap.String("interface", iface),
+				zap.Error(err))
+		}
+	}
+	return m.setViaTC(iface, qdiscType, params)
+}
+
+// setViaTC sets the root qdisc for an interface with tc
+func (m *QdiscManager) setViaTC(iface, qdiscType string, params map[string]interface{}) error {
 	// First try to replace existing qdisc
 	args := []string{"qdisc", "replace", "dev", iface, "root", qdiscType}
-
-	// Add parameters if any
-	for key, value := range params {
-		args = append(args, key, fmt.Sprintf("%v", value))
-	}
+	args = append(args, QdiscArgs(params)...)
 
 	cmd := exec.Command("tc", args...)
 	output, err := cmd.CombinedOutput()
@@ -71,9 +105,7 @@ func (m *QdiscManager) Set(iface, qdiscType string, params map[string]interface{
 
 		// Add new qdisc
 		addArgs := []string{"qdisc", "add", "dev", iface, "root", qdiscType}
-		for key, value := range params {
-			addArgs = append(addArgs, key, fmt.Sprintf("%v", value))
-		}
+		addArgs = append(addArgs, QdiscArgs(params)...)
 
 		addCmd := exec.Command("tc", addArgs...)
 		output, err = addCmd.CombinedOutput()
@@ -84,10 +116,43 @@ func (m *QdiscManager) Set(iface, qdiscType string, params map[string]interface{
 
 	m.logger.Info("set qdisc successfully",
 		zap.String("interface", iface),
-		zap.String("type", qdiscType))
+		zap.String("type", qdiscType),
+		zap.String("backend", "tc"))
+	return nil
+}
+
+// Delete removes the root qdisc so the kernel reattaches its default one
+func (m *QdiscManager) Delete(iface string) error {
+	if ifindex, err := interfaceIndex(iface); err == nil {
+		err := netlinkDeleteRootQdisc(ifindex)
+		if err == nil {
+			m.logger.Info("deleted root qdisc", zap.String("interface", iface))
+			return nil
+		}
+		m.logger.Debug("netlink qdisc delete failed, falling back to tc",
+			zap.String("interface", iface),
+			zap.Error(err))
+	}
+
+	cmd := exec.Command("tc", "qdisc", "del", "dev", iface, "root")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to delete qdisc for %s: %w\noutput: %s", iface, err, string(output))
+	}
+
+	m.logger.Info("deleted root qdisc", zap.String("interface", iface))
 	return nil
 }
 
+// interfaceIndex returns the kernel index of an interface
+func interfaceIndex(iface string) (int, error) {
+	netIface, err := net.InterfaceByName(iface)
+	if err != nil {
+		return 0, err
+	}
+	return netIface.Index, nil
+}
+
 // GetAll returns qdisc information for all interfaces
 func (m *QdiscManager) GetAll() (map[string]*types.QdiscInfo, error) {
 	ifaces, err := m.ListInterfaces()
@@ -109,35 +174,13 @@ func (m *QdiscManager) GetAll() (map[string]*types.QdiscInfo, error) {
 	return result, nil
 }
 
-// GetDefaultRouteInterface returns the interface for the default route
-func (m *QdiscManager) GetDefaultRouteInterface() (string, error) {
-	// Read /proc/net/route for default route
-	file, err := os.Open("/proc/net/route")
-	if err != nil {
-		// Fallback to ip route command
-		return m.getDefaultRouteViaIP()
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	// Skip header
-	scanner.Scan()
-
-	for scanner.Scan() {
-		fields := strings.Fields(scanner.Text())
-		if len(fields) >= 2 {
-			// Default route has destination "00000000"
-			if fields[1] == "00000000" {
-				return fields[0], nil
-			}
-		}
-	}
-
-	return "", fmt.Errorf("no default route found")
-}
-
 // ListInterfaces returns a list of network interface names
 func (m *QdiscManager) ListInterfaces() ([]string, error) {
+	return listUpInterfaces()
+}
+
+// listUpInterfaces returns the names of the interfaces that are up, without loopback
+func listUpInterfaces() ([]string, error) {
 	ifaces, err := net.Interfaces()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list interfaces: %w", err)
@@ -176,37 +219,52 @@ func (m *QdiscManager) parseQdiscLine(line string) (*types.QdiscInfo, error) {
 		Params: make(map[string]interface{}),
 	}
 
+	flags := qdiscFlagParams[info.Type]
+	valued := make(map[string]bool)
+	for _, p := range ValidQdiscParams[info.Type] {
+		if !flags[p] {
+			valued[p] = true
+		}
+	}
+
 	// Parse remaining parameters
-	for i := 3; i < len(fields)-1; i += 2 {
+	for i := 3; i < len(fields); i++ {
 		key := fields[i]
-		if key == "root" || key == "refcnt" {
-			continue
-		}
-		if i+1 < len(fields) {
-			info.Params[key] = fields[i+1]
+		switch {
+		case key == "root":
+			// Placement, not a parameter
+		case key == "refcnt" || key == "parent" || key == "dev":
+			i++ // Skip the placement value
+		case flags[key]:
+			info.Params[key] = true
+		case valued[key]:
+			if i+1 < len(fields) {
+				info.Params[key] = fields[i+1]
+				i++
+			}
+		case isQdiscValueToken(key):
+			// Extra values of a multi-value field such as "priomap 1 2 2 ..."
+		default:
+			// Unknown keyword: pair it with a following value, otherwise treat it as a flag
+			if i+1 < len(fields) && isQdiscValueToken(fields[i+1]) {
+				info.Params[key] = fields[i+1]
+				i++
+			} else {
+				info.Params[key] = true
+			}
 		}
 	}
 
 	return info, nil
 }
 
-// getDefaultRouteViaIP gets default route interface using ip command
-func (m *QdiscManager) getDefaultRouteViaIP() (string, error) {
-	cmd := exec.Command("ip", "route", "show", "default")
-	output, err := cmd.Output()
-	if err != nil {
-		return "", fmt.Errorf("failed to get default route: %w", err)
-	}
-
-	// Parse: "default via 192.168.1.1 dev eth0 ..."
-	fields := strings.Fields(string(output))
-	for i, field := range fields {
-		if field == "dev" && i+1 < len(fields) {
-			return fields[i+1], nil
-		}
+// isQdiscValueToken reports whether a tc output token is a value rather than a keyword
+func isQdiscValueToken(token string) bool {
+	if token == "" {
+		return false
 	}
-
-	return "", fmt.Errorf("no default route interface found")
+	c := token[0]
+	return (c >= '0' && c <= '9') || c == '-' || c == '.'
 }
 
 // GetInterfaceMTU returns the MTU for an interface
@@ -228,12 +286,13 @@ var ValidQdiscParams = map[string][]string{
 	},
 	"fq_codel": {
 		"limit", "flows", "target", "interval", "quantum",
-		"ecn", "noecn", "ce_threshold", "memory_limit",
+		"ecn", "noecn", "ce_threshold", "memory_limit", "drop_batch",
 	},
 	"cake": {
-		"bandwidth", "besteffort", "diffserv3", "diffserv4", "diffserv8",
+		"bandwidth", "unlimited", "besteffort", "precedence",
+		"diffserv3", "diffserv4", "diffserv8",
 		"flowblind", "srchost", "dsthost", "hosts", "flows",
-		"dual-srchost", "dual-dsthost", "nat", "nonat",
+		"dual-srchost", "dual-dsthost", "triple-isolate", "nat", "nonat",
 		"wash", "nowash", "split-gso", "no-split-gso",
 		"ack-filter", "ack-filter-aggressive", "no-ack-filter",
 		"memlimit", "fwmark", "atm", "noatm", "ptm", "noptm",
@@ -243,8 +302,244 @@ var ValidQdiscParams = map[string][]string{
 	"pfifo_fast": {}, // No additional params
 }
 
+// qdiscFlagParams lists the parameters that tc takes as bare keywords without a value
+var qdiscFlagParams = map[string]map[string]bool{
+	"fq": {
+		"pacing": true, "nopacing": true, "horizon_drop": true, "horizon_cap": true,
+	},
+	"fq_codel": {
+		"ecn": true, "noecn": true,
+	},
+	"cake": {
+		"unlimited": true, "besteffort": true, "precedence": true,
+		"diffserv3": true, "diffserv4": true, "diffserv8": true,
+		"flowblind": true, "srchost": true, "dsthost": true, "hosts": true, "flows": true,
+		"dual-srchost": true, "dual-dsthost": true, "triple-isolate": true,
+		"nat": true, "nonat": true, "wash": true, "nowash": true,
+		"split-gso": true, "no-split-gso": true,
+		"ack-filter": true, "ack-filter-aggressive": true, "no-ack-filter": true,
+		"atm": true, "noatm": true, "ptm": true, "noptm": true,
+		"ingress": true, "egress": true, "raw": true, "conservative": true,
+	},
+}
+
+// QdiscTarget is the root qdisc to set on one interface
+type QdiscTarget struct {
+	Interface string                 `json:"interface"`
+	Type      string                 `json:"type"`
+	Params    map[string]interface{} `json:"params,omitempty"`
+}
+
+// QdiscArgs converts qdisc parameters to tc arguments in a deterministic order.
+// Boolean true values become bare flags and boolean false values are omitted.
+func QdiscArgs(params map[string]interface{}) []string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var args []string
+	for _, key := range keys {
+		switch v := params[key].(type) {
+		case bool:
+			if v {
+				args = append(args, key)
+			}
+		case nil:
+			args = append(args, key)
+		case float64:
+			// Avoid scientific notation for large integers from JSON
+			if v == float64(int64(v)) {
+				args = append(args, key, strconv.FormatInt(int64(v), 10))
+			} else {
+				args = append(args, key, strconv.FormatFloat(v, 'f', -1, 64))
+			}
+		default:
+			args = append(args, key, fmt.Sprintf("%v", v))
+		}
+	}
+	return args
+}
+
+// RestorableParams converts parameters captured from tc output back into
+// parameters that tc accepts when setting the qdisc. Read-only or unknown
+// fields are dropped and display units tc cannot parse back are stripped.
+func RestorableParams(qdiscType string, params map[string]interface{}) map[string]interface{} {
+	valid := make(map[string]bool)
+	for _, p := range ValidQdiscParams[qdiscType] {
+		valid[p] = true
+	}
+
+	result := make(map[string]interface{})
+	for key, value := range params {
+		if !valid[key] {
+			continue
+		}
+		str, ok := value.(string)
+		if !ok {
+			result[key] = value
+			continue
+		}
+		// cake reports an unset shaper as "bandwidth unlimited"
+		if qdiscType == "cake" && key == "bandwidth" && str == "unlimited" {
+			result["unlimited"] = true
+			continue
+		}
+		result[key] = stripQdiscCountUnit(str)
+	}
+	return result
+}
+
+// qdiscFlagGroups lists qdisc flags that exclude each other; tc prints only
+// some members of a group, e.g. "nopacing" but never "pacing"
+var qdiscFlagGroups = [][]string{
+	{"pacing", "nopacing"},
+	{"ecn", "noecn"},
+	{"horizon_cap", "horizon_drop"},
+	{"nat", "nonat"},
+	{"wash", "nowash"},
+	{"split-gso", "no-split-gso"},
+	{"ingress", "egress"},
+	cakeDiffservModes,
+	cakeFlowModes,
+	{"noatm", "atm", "ptm", "noptm"},
+	cakeAckFilters,
+}
+
+// QdiscParamsDiff returns the sorted parameters of want that the params a
+// qdisc reports do not carry. Both sides are normalised like RestorableParams
+// and values compare by quantity, so "1gbit" matches "1000000000bit" and "5ms"
+// matches "5000us". A flag differs only when another flag of its group is
+// reported, since tc omits defaults and does not echo shorthands such as
+// cake's "conservative".
+func QdiscParamsDiff(qdiscType string, want, have map[string]interface{}) []string {
+	want = RestorableParams(qdiscType, want)
+	have = RestorableParams(qdiscType, have)
+
+	var diff []string
+	for _, key := range sortedKeys(want) {
+		switch value := want[key].(type) {
+		case bool:
+			if value && qdiscFlagExcluded(key, have) {
+				diff = append(diff, key)
+			}
+		case nil:
+			if qdiscFlagExcluded(key, have) {
+				diff = append(diff, key)
+			}
+		default:
+			args := QdiscArgs(map[string]interface{}{key: value})
+			got, ok := have[key]
+			if len(args) != 2 || !ok || !QdiscValuesEqual(key, args[1], fmt.Sprintf("%v", got)) {
+				diff = append(diff, key)
+			}
+		}
+	}
+	return diff
+}
+
+// qdiscFlagExcluded reports whether have carries a flag that excludes flag
+func qdiscFlagExcluded(flag string, have map[string]interface{}) bool {
+	if have[flag] == true {
+		return false
+	}
+	for _, group := range qdiscFlagGroups {
+		if !slices.Contains(group, flag) {
+			continue
+		}
+		for _, other := range group {
+			if other != flag && have[other] == true {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// qdiscUnitScales maps the rate (bits per second), time (nanoseconds) and
+// size (bytes) units tc accepts and prints to their scale
+var qdiscUnitScales = map[string]struct {
+	kind  string
+	scale float64
+}{
+	"bit": {"rate", 1}, "kbit": {"rate", 1e3}, "mbit": {"rate", 1e6}, "gbit": {"rate", 1e9}, "tbit": {"rate", 1e12},
+	"kibit": {"rate", 1 << 10}, "mibit": {"rate", 1 << 20}, "gibit": {"rate", 1 << 30}, "tibit": {"rate", 1 << 40},
+	"bps": {"rate", 8}, "kbps": {"rate", 8e3}, "mbps": {"rate", 8e6}, "gbps": {"rate", 8e9}, "tbps": {"rate", 8e12},
+	"s": {"time", 1e9}, "sec": {"time", 1e9}, "secs": {"time", 1e9},
+	"ms": {"time", 1e6}, "msec": {"time", 1e6}, "msecs": {"time", 1e6},
+	"us": {"time", 1e3}, "usec": {"time", 1e3}, "usecs": {"time", 1e3},
+	"ns": {"time", 1}, "nsec": {"time", 1}, "nsecs": {"time", 1},
+	"b": {"size", 1}, "k": {"size", 1 << 10}, "kb": {"size", 1 << 10},
+	"m": {"size", 1 << 20}, "mb": {"size", 1 << 20}, "g": {"size", 1 << 30}, "gb": {"size", 1 << 30},
+}
+
+// qdiscBaseUnits maps parameters that take a quantity to the unit tc assumes
+// for a bare number, which is also how netlink decoding reports sizes
+var qdiscBaseUnits = map[string]string{
+	"maxrate": "bit", "low_rate_threshold": "bit", "bandwidth": "bit",
+	"target": "us", "interval": "us", "ce_threshold": "us", "refill_delay": "us",
+	"horizon": "us", "timer_slack": "us", "rtt": "us",
+	"memory_limit": "b", "memlimit": "b",
+}
+
+// QdiscValuesEqual reports whether two values of the qdisc parameter key are
+// the same quantity, e.g. "1gbit" and "1000000000bit", "5ms" and "5000",
+// "32Mb" and "33554432", or "10000p" and "10000"
+func QdiscValuesEqual(key, a, b string) bool {
+	return normalizeQdiscQuantity(key, stripQdiscCountUnit(a)) == normalizeQdiscQuantity(key, stripQdiscCountUnit(b))
+}
+
+// normalizeQdiscQuantity returns a value of the parameter key with its unit,
+// or the base unit of key for a bare number, folded into the number, e.g.
+// "1Gbit" -> "rate 1000000000"; other values are only lowercased
+func normalizeQdiscQuantity(key, value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	end := strings.IndexFunc(value, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if end < 0 {
+		end = len(value)
+	}
+	if end == 0 {
+		return value
+	}
+	number, err := strconv.ParseFloat(value[:end], 64)
+	if err != nil {
+		return value
+	}
+	suffix := value[end:]
+	if suffix == "" {
+		suffix = qdiscBaseUnits[key]
+	}
+	unit, ok := qdiscUnitScales[suffix]
+	if !ok {
+		return value
+	}
+	return unit.kind + " " + strconv.FormatFloat(number*unit.scale, 'f', -1, 64)
+}
+
+// stripQdiscCountUnit removes the "p" (packets) and "b" (bytes) suffixes tc
+// prints on plain counters, e.g. "10000p" -> "10000", "3028b" -> "3028"
+func stripQdiscCountUnit(value string) string {
+	if len(value) < 2 {
+		return value
+	}
+	last := value[len(value)-1]
+	if last != 'p' && last != 'b' {
+		return value
+	}
+	if _, err := strconv.ParseUint(value[:len(value)-1], 10, 64); err != nil {
+		return value
+	}
+	return value[:len(value)-1]
+}
+
 // ValidateQdiscParams validates qdisc parameters for a given qdisc type
 func (m *QdiscManager) ValidateQdiscParams(qdiscType string, params map[string]interface{}) error {
+	return checkQdiscParams(qdiscType, params)
+}
+
+// checkQdiscParams rejects unknown qdisc types and parameters
+func checkQdiscParams(qdiscType string, params map[string]interface{}) error {
 	validParams, ok := ValidQdiscParams[qdiscType]
 	if !ok {
 		return fmt.Errorf("unknown qdisc type: %s", qdiscType)
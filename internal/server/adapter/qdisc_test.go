@@ -0,0 +1,218 @@
+package adapter
+
+import (
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestParseQdiscLine(t *testing.T) {
+	m := NewQdiscManager(zap.NewNop())
+
+	tests := []struct {
+		name       string
+		line       string
+		wantType   string
+		wantHandle string
+		wantParams map[string]interface{}
+	}{
+		{
+			name:       "fq with flag",
+			line:       "qdisc fq 8001: root refcnt 2 limit 10000p flow_limit 100p buckets 1024 orphan_mask 1023 quantum 3028b initial_quantum 15140b low_rate_threshold 550Kbit refill_delay 40ms timer_slack 10us horizon 10s horizon_drop",
+			wantType:   "fq",
+			wantHandle: "8001",
+			wantParams: map[string]interface{}{
+				"limit":              "10000p",
+				"flow_limit":         "100p",
+				"buckets":            "1024",
+				"orphan_mask":        "1023",
+				"quantum":            "3028b",
+				"initial_quantum":    "15140b",
+				"low_rate_threshold": "550Kbit",
+				"refill_delay":       "40ms",
+				"timer_slack":        "10us",
+				"horizon":            "10s",
+				"horizon_drop":       true,
+			},
+		},
+		{
+			name:       "default fq_codel",
+			line:       "qdisc fq_codel 0: root refcnt 2 limit 10240p flows 1024 quantum 1514 target 5ms interval 100ms memory_limit 32Mb ecn drop_batch 64",
+			wantType:   "fq_codel",
+			wantHandle: "0",
+			wantParams: map[string]interface{}{
+				"limit":        "10240p",
+				"flows":        "1024",
+				"quantum":      "1514",
+				"target":       "5ms",
+				"interval":     "100ms",
+				"memory_limit": "32Mb",
+				"ecn":          true,
+				"drop_batch":   "64",
+			},
+		},
+		{
+			name:       "cake flags",
+			line:       "qdisc cake 8002: root refcnt 2 bandwidth unlimited diffserv3 triple-isolate nonat nowash no-ack-filter split-gso rtt 100ms raw overhead 0",
+			wantType:   "cake",
+			wantHandle: "8002",
+			wantParams: map[string]interface{}{
+				"bandwidth":      "unlimited",
+				"diffserv3":      true,
+				"triple-isolate": true,
+				"nonat":          true,
+				"nowash":         true,
+				"no-ack-filter":  true,
+				"split-gso":      true,
+				"rtt":            "100ms",
+				"raw":            true,
+				"overhead":       "0",
+			},
+		},
+		{
+			name:       "multi-value field",
+			line:       "qdisc pfifo_fast 0: root refcnt 2 bands 3 priomap 1 2 2 2 1 2 0 0 1 1 1 1 1 1 1 1",
+			wantType:   "pfifo_fast",
+			wantHandle: "0",
+			wantParams: map[string]interface{}{
+				"bands":   "3",
+				"priomap": "1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := m.parseQdiscLine(tt.line)
+			if err != nil {
+				t.Fatalf("parseQdiscLine failed: %v", err)
+			}
+			if info.Type != tt.wantType {
+				t.Errorf("Type = %s, want %s", info.Type, tt.wantType)
+			}
+			if info.Handle != tt.wantHandle {
+				t.Errorf("Handle = %s, want %s", info.Handle, tt.wantHandle)
+			}
+			if !reflect.DeepEqual(info.Params, tt.wantParams) {
+				t.Errorf("Params = %v, want %v", info.Params, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestRestorableParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		qdiscType string
+		params    map[string]interface{}
+		want      map[string]interface{}
+	}{
+		{
+			name:      "fq strips count units and drops unknown fields",
+			qdiscType: "fq",
+			params: map[string]interface{}{
+				"limit":        "10000p",
+				"quantum":      "3028b",
+				"refill_delay": "40ms",
+				"horizon_drop": true,
+				"weights":      "589824",
+			},
+			want: map[string]interface{}{
+				"limit":        "10000",
+				"quantum":      "3028",
+				"refill_delay": "40ms",
+				"horizon_drop": true,
+			},
+		},
+		{
+			name:      "cake unlimited bandwidth becomes a flag",
+			qdiscType: "cake",
+			params: map[string]interface{}{
+				"bandwidth": "unlimited",
+				"diffserv3": true,
+				"rtt":       "100ms",
+			},
+			want: map[string]interface{}{
+				"unlimited": true,
+				"diffserv3": true,
+				"rtt":       "100ms",
+			},
+		},
+		{
+			name:      "size units are kept",
+			qdiscType: "fq_codel",
+			params: map[string]interface{}{
+				"memory_limit": "32Mb",
+			},
+			want: map[string]interface{}{
+				"memory_limit": "32Mb",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RestorableParams(tt.qdiscType, tt.params)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RestorableParams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQdiscArgs(t *testing.T) {
+	params := map[string]interface{}{
+		"quantum":      float64(3028),
+		"limit":        "10000",
+		"horizon_drop": true,
+		"nopacing":     false,
+		"maxrate":      "1gbit",
+	}
+
+	want := []string{"horizon_drop", "limit", "10000", "maxrate", "1gbit", "quantum", "3028"}
+	got := QdiscArgs(params)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("QdiscArgs() = %v, want %v", got, want)
+	}
+}
+
+func TestQdiscParamsDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		want map[string]interface{}
+		have map[string]interface{}
+		diff []string
+	}{
+		{
+			name: "rates, times and counts compare by quantity",
+			want: map[string]interface{}{"maxrate": "1gbit", "refill_delay": "40ms", "limit": float64(10000)},
+			have: map[string]interface{}{"maxrate": "1000000000bit", "refill_delay": "40000us", "limit": "10000p", "quantum": "3028"},
+		},
+		{
+			name: "changed and missing values differ",
+			want: map[string]interface{}{"maxrate": "1gbit", "flow_limit": float64(100)},
+			have: map[string]interface{}{"maxrate": "10Gbit"},
+			diff: []string{"flow_limit", "maxrate"},
+		},
+		{
+			name: "an unreported default flag matches",
+			want: map[string]interface{}{"pacing": true, "nopacing": false},
+			have: map[string]interface{}{"limit": "10000"},
+		},
+		{
+			name: "a reported opposite flag differs",
+			want: map[string]interface{}{"pacing": true},
+			have: map[string]interface{}{"nopacing": true},
+			diff: []string{"pacing"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QdiscParamsDiff("fq", tt.want, tt.have); !reflect.DeepEqual(got, tt.diff) {
+				t.Errorf("QdiscParamsDiff() = %v, want %v", got, tt.diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package adapter
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+)
+
+// Kernel routing tables
+const (
+	procIPv4RoutePath = "/proc/net/route"
+	procIPv6RoutePath = "/proc/net/ipv6_route"
+)
+
+// Route flags from include/uapi/linux/route.h
+const (
+	rtfUp     = 0x0001
+	rtfReject = 0x0200
+)
+
+// GetDefaultRouteInterface returns the interface of the primary default route:
+// IPv4 when the host has one, otherwise IPv6
+func (m *QdiscManager) GetDefaultRouteInterface() (string, error) {
+	routes, err := m.GetDefaultRoutes()
+	if err != nil {
+		return "", err
+	}
+	return routes.Primary(), nil
+}
+
+// GetDefaultRoutes returns the default route interface of each address family.
+// The kernel tables are read first; ip route is only used when a table cannot be opened.
+func (m *QdiscManager) GetDefaultRoutes() (*types.DefaultRoutes, error) {
+	routes := &types.DefaultRoutes{}
+
+	iface, err := parseIPv4DefaultRoute(procIPv4RoutePath)
+	if err != nil {
+		iface = m.defaultRouteViaIP("-4")
+	}
+	routes.IPv4 = iface
+
+	iface, err = parseIPv6DefaultRoute(procIPv6RoutePath)
+	if err != nil {
+		iface = m.defaultRouteViaIP("-6")
+	}
+	routes.IPv6 = iface
+
+	if routes.IPv4 == "" && routes.IPv6 == "" {
+		return nil, fmt.Errorf("no default route found")
+	}
+	return routes, nil
+}
+
+// parseIPv4DefaultRoute returns the interface of the lowest-metric IPv4 default
+// route in a /proc/net/route style file, or "" when there is none
+func parseIPv4DefaultRoute(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	best, bestMetric := "", uint64(math.MaxUint64)
+	scanner := bufio.NewScanner(file)
+	// Skip header
+	scanner.Scan()
+
+	// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		flags, _ := strconv.ParseUint(fields[3], 16, 32)
+		if flags&rtfUp == 0 || flags&rtfReject != 0 {
+			continue
+		}
+		metric, _ := strconv.ParseUint(fields[6], 10, 64)
+		if metric < bestMetric {
+			best, bestMetric = fields[0], metric
+		}
+	}
+	return best, scanner.Err()
+}
+
+// parseIPv6DefaultRoute returns the interface of the lowest-metric IPv6 default
+// route in a /proc/net/ipv6_route style file, or "" when there is none.
+// Unreachable routes the kernel parks on lo are skipped.
+func parseIPv6DefaultRoute(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	best, bestMetric := "", uint64(math.MaxUint64)
+	scanner := bufio.NewScanner(file)
+
+	// dest dest_len src src_len next_hop metric refcnt use flags iface
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || strings.Trim(fields[0], "0") != "" || fields[1] != "00" {
+			continue
+		}
+		flags, _ := strconv.ParseUint(fields[8], 16, 32)
+		if flags&rtfUp == 0 || flags&rtfReject != 0 || fields[9] == "lo" {
+			continue
+		}
+		metric, _ := strconv.ParseUint(fields[5], 16, 64)
+		if metric < bestMetric {
+			best, bestMetric = fields[9], metric
+		}
+	}
+	return best, scanner.Err()
+}
+
+// defaultRouteViaIP returns the default route interface for a family ("-4" or "-6")
+// using the ip command, or "" when there is none
+func (m *QdiscManager) defaultRouteViaIP(family string) string {
+	output, err := exec.Command("ip", family, "route", "show", "default").Output()
+	if err != nil {
+		return ""
+	}
+	return parseIPRouteDev(string(output))
+}
+
+// parseIPRouteDev returns the device of the first route in ip route output,
+// e.g. "default via 192.168.1.1 dev eth0 ..."
+func parseIPRouteDev(output string) string {
+	fields := strings.Fields(output)
+	for i, field := range fields {
+		if field == "dev" && i+1 < len(fields) {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,283 @@
+package adapter
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"go.uber.org/zap"
+)
+
+// Address families of routes, as ip route takes them with -family
+const (
+	RouteFamilyIPv4 = "inet"
+	RouteFamilyIPv6 = "inet6"
+)
+
+// RouteFamilies lists the address families in the order routes are handled
+var RouteFamilies = []string{RouteFamilyIPv4, RouteFamilyIPv6}
+
+// routeDropFlags are words of ip route output that ip route change does not accept
+var routeDropFlags = map[string]bool{
+	"linkdown": true, "dead": true, "offload": true, "trap": true,
+	"rt_offload": true, "rt_trap": true, "rt_offload_failed": true,
+}
+
+// Route is a route of the main table and its TCP attributes
+type Route struct {
+	Family string           `json:"family"` // RouteFamilyIPv4 or RouteFamilyIPv6
+	Spec   string           `json:"spec"`   // the route as ip route prints it, without TCP attributes
+	Attrs  types.RouteAttrs `json:"attrs"`
+}
+
+// Key identifies the route as "family spec"
+func (r *Route) Key() string {
+	return r.Family + " " + r.Spec
+}
+
+// Dest returns the destination of the route, such as "default" or "10.0.0.0/8"
+func (r *Route) Dest() string {
+	fields := strings.Fields(r.Spec)
+	if len(fields) == 0 {
+		return ""
+	}
+	// Typed routes such as "unreachable 10.0.0.0/8" put the destination second
+	switch fields[0] {
+	case "unicast", "unreachable", "blackhole", "prohibit", "throw":
+		if len(fields) > 1 {
+			return fields[1]
+		}
+	}
+	return fields[0]
+}
+
+// Dev returns the device of the route, or "" when it names none
+func (r *Route) Dev() string {
+	fields := strings.Fields(r.Spec)
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "dev" {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
+
+// ParseRouteKey splits a "family spec" key into a Route without attributes
+func ParseRouteKey(key string) (*Route, error) {
+	family, spec, ok := strings.Cut(key, " ")
+	if !ok || (family != RouteFamilyIPv4 && family != RouteFamilyIPv6) || strings.TrimSpace(spec) == "" {
+		return nil, fmt.Errorf("invalid route key '%s'", key)
+	}
+	return &Route{Family: family, Spec: spec}, nil
+}
+
+// RouteTarget is the TCP attributes to set on every route to a destination
+type RouteTarget struct {
+	Family string            `json:"family"`
+	Dest   string            `json:"dest"` // "default" or a prefix
+	Attrs  *types.RouteAttrs `json:"attrs"`
+}
+
+// RouteManager handles TCP attributes of routes through ip route
+type RouteManager struct {
+	logger *zap.Logger
+}
+
+// NewRouteManager creates a new RouteManager
+func NewRouteManager(logger *zap.Logger) *RouteManager {
+	return &RouteManager{logger: logger}
+}
+
+// Find returns the routes of the main table to exactly dest, such as the
+// default routes of different metrics
+func (m *RouteManager) Find(family, dest string) ([]*Route, error) {
+	output, err := runIPRoute(family, "show", "table", "main", "exact", dest)
+	if err != nil {
+		return nil, err
+	}
+	return parseRoutes(family, output), nil
+}
+
+// GetAll returns the default routes and every route of the main table that
+// carries TCP attributes
+func (m *RouteManager) GetAll() ([]*Route, error) {
+	var result []*Route
+	for _, family := range RouteFamilies {
+		output, err := runIPRoute(family, "show", "table", "main")
+		if err != nil {
+			m.logger.Debug("failed to list routes",
+				zap.String("family", family),
+				zap.Error(err))
+			continue
+		}
+		for _, route := range parseRoutes(family, output) {
+			if route.Dest() == "default" || !route.Attrs.IsEmpty() {
+				result = append(result, route)
+			}
+		}
+	}
+	return result, nil
+}
+
+// Set replaces the TCP attributes of a route with route.Attrs
+func (m *RouteManager) Set(route *Route) error {
+	if _, err := runIPRoute(route.Family, RouteChangeArgs(route)...); err != nil {
+		return fmt.Errorf("failed to set attributes of route %s: %w", route.Key(), err)
+	}
+
+	m.logger.Info("set route attributes successfully",
+		zap.String("route", route.Key()))
+	return nil
+}
+
+// runIPRoute runs ip -family route with args and returns its output
+func runIPRoute(family string, args ...string) (string, error) {
+	full := append([]string{"-family", family, "route"}, args...)
+	output, err := exec.Command("ip", full...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("ip %s: %w\noutput: %s", strings.Join(full, " "), err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+// RouteChangeArgs returns the ip route arguments that give a route its attributes
+func RouteChangeArgs(route *Route) []string {
+	args := append([]string{"change"}, strings.Fields(route.Spec)...)
+	return append(args, RouteAttrArgs(&route.Attrs)...)
+}
+
+// RouteAttrArgs converts TCP attributes to ip route arguments
+func RouteAttrArgs(attrs *types.RouteAttrs) []string {
+	var args []string
+	if attrs == nil {
+		return args
+	}
+	if attrs.InitCwnd != nil {
+		args = append(args, "initcwnd", strconv.Itoa(*attrs.InitCwnd))
+	}
+	if attrs.InitRwnd != nil {
+		args = append(args, "initrwnd", strconv.Itoa(*attrs.InitRwnd))
+	}
+	if attrs.CongCtl != "" {
+		args = append(args, "congctl", attrs.CongCtl)
+	}
+	return args
+}
+
+// MergeRouteAttrs returns current with the attributes desired sets replaced
+func MergeRouteAttrs(current, desired *types.RouteAttrs) types.RouteAttrs {
+	merged := types.RouteAttrs{}
+	if current != nil {
+		merged = *current
+	}
+	if desired == nil {
+		return merged
+	}
+	if desired.InitCwnd != nil {
+		merged.InitCwnd = desired.InitCwnd
+	}
+	if desired.InitRwnd != nil {
+		merged.InitRwnd = desired.InitRwnd
+	}
+	if desired.CongCtl != "" {
+		merged.CongCtl = desired.CongCtl
+	}
+	return merged
+}
+
+// RouteAttrValues flattens route attributes into attribute -> value
+func RouteAttrValues(attrs *types.RouteAttrs) map[string]interface{} {
+	values := make(map[string]interface{})
+	if attrs == nil {
+		return values
+	}
+	if attrs.InitCwnd != nil {
+		values["initcwnd"] = *attrs.InitCwnd
+	}
+	if attrs.InitRwnd != nil {
+		values["initrwnd"] = *attrs.InitRwnd
+	}
+	if attrs.CongCtl != "" {
+		values["congctl"] = attrs.CongCtl
+	}
+	return values
+}
+
+// RouteFamily returns the address family of a destination prefix or address
+func RouteFamily(dest string) (string, error) {
+	ip, _, err := net.ParseCIDR(dest)
+	if err != nil {
+		if ip = net.ParseIP(dest); ip == nil {
+			return "", fmt.Errorf("invalid route prefix '%s'", dest)
+		}
+	}
+	if ip.To4() != nil {
+		return RouteFamilyIPv4, nil
+	}
+	return RouteFamilyIPv6, nil
+}
+
+// parseRoutes parses ip route show output. Multipath routes, whose next hops
+// follow on their own lines, are left out since ip route change cannot keep them.
+func parseRoutes(family, output string) []*Route {
+	var routes []*Route
+	var last *Route
+	multipath := make(map[*Route]bool)
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "nexthop") {
+			if last != nil {
+				multipath[last] = true
+			}
+			continue
+		}
+		last = parseRouteLine(family, line)
+		routes = append(routes, last)
+	}
+
+	result := routes[:0]
+	for _, route := range routes {
+		if !multipath[route] {
+			result = append(result, route)
+		}
+	}
+	return result
+}
+
+// parseRouteLine splits a line of ip route output into its spec and TCP attributes
+func parseRouteLine(family, line string) *Route {
+	route := &Route{Family: family}
+	fields := strings.Fields(line)
+	var spec []string
+	for i := 0; i < len(fields); i++ {
+		switch field := fields[i]; {
+		case (field == "initcwnd" || field == "initrwnd") && i+1 < len(fields):
+			i++
+			if n, err := strconv.Atoi(fields[i]); err == nil {
+				if field == "initcwnd" {
+					route.Attrs.InitCwnd = &n
+				} else {
+					route.Attrs.InitRwnd = &n
+				}
+			}
+		case field == "congctl" && i+1 < len(fields):
+			i++
+			if fields[i] == "lock" && i+1 < len(fields) {
+				i++
+			}
+			route.Attrs.CongCtl = fields[i]
+		case field == "expires" && i+1 < len(fields):
+			i++
+		case routeDropFlags[field]:
+		default:
+			spec = append(spec, field)
+		}
+	}
+	route.Spec = strings.Join(spec, " ")
+	return route
+}
@@ -0,0 +1,100 @@
+package adapter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+)
+
+func TestParseRoutes(t *testing.T) {
+	output := `default via 192.0.2.1 dev eth0 proto dhcp src 192.0.2.10 metric 100 initcwnd 10 congctl lock bbr
+10.0.0.0/8 via 198.51.100.1 dev eth1 linkdown initrwnd 20
+default proto static metric 200
+	nexthop via 192.0.2.1 dev eth0 weight 1
+	nexthop via 198.51.100.1 dev eth1 weight 1
+unreachable 203.0.113.0/24 proto static
+`
+	routes := parseRoutes(RouteFamilyIPv4, output)
+	if len(routes) != 3 {
+		t.Fatalf("parseRoutes() returned %d routes, want 3 without the multipath route", len(routes))
+	}
+
+	cwnd, rwnd := 10, 20
+	want := []*Route{
+		{Family: RouteFamilyIPv4, Spec: "default via 192.0.2.1 dev eth0 proto dhcp src 192.0.2.10 metric 100",
+			Attrs: types.RouteAttrs{InitCwnd: &cwnd, CongCtl: "bbr"}},
+		{Family: RouteFamilyIPv4, Spec: "10.0.0.0/8 via 198.51.100.1 dev eth1",
+			Attrs: types.RouteAttrs{InitRwnd: &rwnd}},
+		{Family: RouteFamilyIPv4, Spec: "unreachable 203.0.113.0/24 proto static"},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		for i := range routes {
+			t.Errorf("route %d = %+v", i, routes[i])
+		}
+	}
+
+	dests := []string{"default", "10.0.0.0/8", "203.0.113.0/24"}
+	for i, route := range routes {
+		if got := route.Dest(); got != dests[i] {
+			t.Errorf("Dest() = %q, want %q", got, dests[i])
+		}
+	}
+
+	ipv6 := parseRoutes(RouteFamilyIPv6, "default via fe80::1 dev eth0 proto ra metric 1024 expires 1789sec pref medium\n")
+	if len(ipv6) != 1 || ipv6[0].Spec != "default via fe80::1 dev eth0 proto ra metric 1024 pref medium" {
+		t.Errorf("expires should be dropped, got %+v", ipv6)
+	}
+}
+
+func TestRouteChangeArgs(t *testing.T) {
+	cwnd := 32
+	route := &Route{
+		Family: RouteFamilyIPv4,
+		Spec:   "default via 192.0.2.1 dev eth0",
+		Attrs:  types.RouteAttrs{InitCwnd: &cwnd, CongCtl: "bbr"},
+	}
+	want := []string{"change", "default", "via", "192.0.2.1", "dev", "eth0", "initcwnd", "32", "congctl", "bbr"}
+	if got := RouteChangeArgs(route); !reflect.DeepEqual(got, want) {
+		t.Errorf("RouteChangeArgs() = %v, want %v", got, want)
+	}
+}
+
+func TestMergeRouteAttrs(t *testing.T) {
+	cwnd, rwnd, bigger := 10, 20, 40
+	merged := MergeRouteAttrs(
+		&types.RouteAttrs{InitCwnd: &cwnd, InitRwnd: &rwnd},
+		&types.RouteAttrs{InitCwnd: &bigger, CongCtl: "bbr"},
+	)
+	want := map[string]interface{}{"initcwnd": 40, "initrwnd": 20, "congctl": "bbr"}
+	if got := RouteAttrValues(&merged); !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeRouteAttrs() = %v, want %v", got, want)
+	}
+}
+
+func TestRouteFamilyAndKey(t *testing.T) {
+	tests := []struct {
+		dest    string
+		want    string
+		wantErr bool
+	}{
+		{"10.0.0.0/8", RouteFamilyIPv4, false},
+		{"2001:db8::/32", RouteFamilyIPv6, false},
+		{"192.0.2.7", RouteFamilyIPv4, false},
+		{"default", "", true},
+	}
+	for _, tt := range tests {
+		got, err := RouteFamily(tt.dest)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("RouteFamily(%q) = %q, %v", tt.dest, got, err)
+		}
+	}
+
+	route, err := ParseRouteKey("inet6 default via fe80::1 dev eth0")
+	if err != nil || route.Family != RouteFamilyIPv6 || route.Spec != "default via fe80::1 dev eth0" {
+		t.Errorf("ParseRouteKey() = %+v, %v", route, err)
+	}
+	if _, err := ParseRouteKey("ipx default"); err == nil {
+		t.Error("an unknown family should be rejected")
+	}
+}
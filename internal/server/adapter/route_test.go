@@ -0,0 +1,68 @@
+package adapter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeRouteFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "route")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseIPv4DefaultRoute(t *testing.T) {
+	path := writeRouteFile(t, `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth1	00000000	0102A8C0	0003	0	0	600	00000000	0	0	0
+eth0	00000000	0101A8C0	0003	0	0	100	00000000	0	0	0
+eth0	0001A8C0	00000000	0001	0	0	100	00FFFFFF	0	0	0
+`)
+	iface, err := parseIPv4DefaultRoute(path)
+	if err != nil {
+		t.Fatalf("parseIPv4DefaultRoute failed: %v", err)
+	}
+	if iface != "eth0" {
+		t.Errorf("parseIPv4DefaultRoute() = %q, want eth0 (lowest metric)", iface)
+	}
+
+	none := writeRouteFile(t, "Iface\tDestination\tGateway\tFlags\tRefCnt\tUse\tMetric\tMask\n")
+	if iface, err := parseIPv4DefaultRoute(none); err != nil || iface != "" {
+		t.Errorf("parseIPv4DefaultRoute() = %q, %v; want no route", iface, err)
+	}
+}
+
+func TestParseIPv6DefaultRoute(t *testing.T) {
+	path := writeRouteFile(t, `20010db8000000000000000000000000 20 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00000003     he-ipv6
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000064 00000001 00000000 00000003     wg0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200       lo
+`)
+	iface, err := parseIPv6DefaultRoute(path)
+	if err != nil {
+		t.Fatalf("parseIPv6DefaultRoute failed: %v", err)
+	}
+	if iface != "wg0" {
+		t.Errorf("parseIPv6DefaultRoute() = %q, want wg0 (lowest metric, unreachable lo skipped)", iface)
+	}
+
+	if _, err := parseIPv6DefaultRoute(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing table should return an error so callers fall back to ip route")
+	}
+}
+
+func TestParseIPRouteDev(t *testing.T) {
+	tests := map[string]string{
+		"default via 192.168.1.1 dev eth0 proto dhcp metric 100\n": "eth0",
+		"default dev wg0 scope link\n":                             "wg0",
+		"":                                                         "",
+	}
+	for output, want := range tests {
+		if got := parseIPRouteDev(output); got != want {
+			t.Errorf("parseIPRouteDev(%q) = %q, want %q", output, got, want)
+		}
+	}
+}
@@ -0,0 +1,480 @@
+package adapter
+
+import (
+	"bufio"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"go.uber.org/zap"
+)
+
+// Host paths of the queue steering and IRQ affinity files
+const (
+	sysClassNetDir     = "/sys/class/net"
+	cpuOnlinePath      = "/sys/devices/system/cpu/online"
+	procIRQDir         = "/proc/irq"
+	procInterruptsPath = "/proc/interrupts"
+)
+
+// Special CPU mask values of a steering config
+const (
+	CPUMaskAll    = "all"    // every online CPU
+	CPUMaskSpread = "spread" // one online CPU per queue or IRQ, round-robin
+)
+
+// SteeringLayout lists the queues and IRQs of an interface
+type SteeringLayout struct {
+	RxQueues []string `json:"rx_queues"` // "rx-0", "rx-1", ...
+	TxQueues []string `json:"tx_queues"` // "tx-0", "tx-1", ...
+	IRQs     []int    `json:"irqs"`
+}
+
+// SteeringManager handles RPS, XPS and IRQ affinity through sysfs and procfs
+type SteeringManager struct {
+	root   string
+	logger *zap.Logger
+}
+
+// NewSteeringManager creates a new SteeringManager
+func NewSteeringManager(logger *zap.Logger) *SteeringManager {
+	return &SteeringManager{logger: logger}
+}
+
+// NewRootedSteeringManager creates a SteeringManager that reads and writes
+// root/sys and root/proc
+func NewRootedSteeringManager(root string, logger *zap.Logger) *SteeringManager {
+	return &SteeringManager{root: root, logger: logger}
+}
+
+// path returns where a host path lives under the manager's root
+func (m *SteeringManager) path(p string) string {
+	if m.root == "" {
+		return p
+	}
+	return filepath.Join(m.root, p)
+}
+
+// OnlineCPUs returns the online CPUs in ascending order
+func (m *SteeringManager) OnlineCPUs() ([]int, error) {
+	data, err := os.ReadFile(m.path(cpuOnlinePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read online CPUs: %w", err)
+	}
+	return ParseCPUList(strings.TrimSpace(string(data)))
+}
+
+// Layout returns the queues of an interface and the IRQs of its device. IRQs
+// come from the device's MSI vectors, or from /proc/interrupts entries named
+// after the interface when the device has none.
+func (m *SteeringManager) Layout(iface string) (*SteeringLayout, error) {
+	entries, err := os.ReadDir(m.path(filepath.Join(sysClassNetDir, iface, "queues")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queues of %s: %w", iface, err)
+	}
+
+	layout := &SteeringLayout{}
+	for _, entry := range entries {
+		switch {
+		case strings.HasPrefix(entry.Name(), "rx-"):
+			layout.RxQueues = append(layout.RxQueues, entry.Name())
+		case strings.HasPrefix(entry.Name(), "tx-"):
+			layout.TxQueues = append(layout.TxQueues, entry.Name())
+		}
+	}
+	sortQueues(layout.RxQueues)
+	sortQueues(layout.TxQueues)
+
+	irqs, err := os.ReadDir(m.path(filepath.Join(sysClassNetDir, iface, "device", "msi_irqs")))
+	if err == nil {
+		for _, entry := range irqs {
+			if irq, err := strconv.Atoi(entry.Name()); err == nil {
+				layout.IRQs = append(layout.IRQs, irq)
+			}
+		}
+	} else {
+		layout.IRQs = m.namedIRQs(iface)
+	}
+	sort.Ints(layout.IRQs)
+	return layout, nil
+}
+
+// namedIRQs returns the IRQs whose /proc/interrupts name mentions the interface
+func (m *SteeringManager) namedIRQs(iface string) []int {
+	file, err := os.Open(m.path(procInterruptsPath))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var irqs []int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		irq, err := strconv.Atoi(strings.TrimSuffix(fields[0], ":"))
+		if err != nil {
+			continue
+		}
+		name := fields[len(fields)-1]
+		if name == iface || strings.HasPrefix(name, iface+"-") {
+			irqs = append(irqs, irq)
+		}
+	}
+	return irqs
+}
+
+// Get returns the steering files of an interface as host path -> value.
+// Files the kernel does not expose, such as xps_cpus on single-queue
+// devices, are left out.
+func (m *SteeringManager) Get(iface string) (map[string]string, error) {
+	layout, err := m.Layout(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, queue := range layout.RxQueues {
+		paths = append(paths, QueuePath(iface, queue, "rps_cpus"), QueuePath(iface, queue, "rps_flow_cnt"))
+	}
+	for _, queue := range layout.TxQueues {
+		paths = append(paths, QueuePath(iface, queue, "xps_cpus"))
+	}
+	for _, irq := range layout.IRQs {
+		paths = append(paths, IRQAffinityPath(irq))
+	}
+
+	values := make(map[string]string, len(paths))
+	for _, p := range paths {
+		data, err := os.ReadFile(m.path(p))
+		if err != nil {
+			m.logger.Debug("steering file not readable",
+				zap.String("path", p),
+				zap.Error(err))
+			continue
+		}
+		values[p] = strings.TrimSpace(string(data))
+	}
+	return values, nil
+}
+
+// GetAll returns the steering files of every interface except loopback
+func (m *SteeringManager) GetAll() (map[string]string, error) {
+	entries, err := os.ReadDir(m.path(sysClassNetDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+
+	result := make(map[string]string)
+	for _, entry := range entries {
+		if entry.Name() == "lo" {
+			continue
+		}
+		values, err := m.Get(entry.Name())
+		if err != nil {
+			m.logger.Debug("failed to get steering settings for interface",
+				zap.String("interface", entry.Name()),
+				zap.Error(err))
+			continue
+		}
+		for p, value := range values {
+			result[p] = value
+		}
+	}
+	return result, nil
+}
+
+// Set writes steering files given as host path -> value, in path order. Paths
+// other than queue steering and IRQ affinity files are refused.
+func (m *SteeringManager) Set(values map[string]string) error {
+	for _, p := range sortedKeys(values) {
+		if !IsSteeringPath(p) {
+			return fmt.Errorf("%s is not a steering file", p)
+		}
+		if err := writeExistingFile(m.path(p), values[p]); err != nil {
+			return fmt.Errorf("failed to write %s: %w", p, err)
+		}
+		m.logger.Debug("steering file set successfully",
+			zap.String("path", p),
+			zap.String("value", values[p]))
+	}
+	return nil
+}
+
+// QueuePath returns the sysfs path of a queue attribute such as rps_cpus
+func QueuePath(iface, queue, attr string) string {
+	return filepath.Join(sysClassNetDir, iface, "queues", queue, attr)
+}
+
+// QueuePathInterface returns the interface of a QueuePath, or false for other paths
+func QueuePathInterface(path string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, sysClassNetDir+"/")
+	if !ok {
+		return "", false
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) < 2 || parts[1] != "queues" {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// IsSteeringPath reports whether a path is a queue steering file as QueuePath
+// returns it, or an IRQ affinity file as IRQAffinityPath returns it
+func IsSteeringPath(p string) bool {
+	if iface, ok := QueuePathInterface(p); ok {
+		parts := strings.Split(strings.TrimPrefix(p, sysClassNetDir+"/"), "/")
+		if len(parts) != 4 || iface == "." || iface == ".." {
+			return false
+		}
+		queue, attr := parts[2], parts[3]
+		switch {
+		case strings.HasPrefix(queue, "rx-"):
+			return QueuePath(iface, queue, attr) == p && (attr == "rps_cpus" || attr == "rps_flow_cnt")
+		case strings.HasPrefix(queue, "tx-"):
+			return QueuePath(iface, queue, attr) == p && attr == "xps_cpus"
+		}
+		return false
+	}
+
+	irq, ok := strings.CutPrefix(p, procIRQDir+"/")
+	if !ok {
+		return false
+	}
+	irq, ok = strings.CutSuffix(irq, "/smp_affinity")
+	if !ok {
+		return false
+	}
+	n, err := strconv.Atoi(irq)
+	return err == nil && IRQAffinityPath(n) == p
+}
+
+// IRQAffinityPath returns the procfs path of an IRQ's CPU affinity mask
+func IRQAffinityPath(irq int) string {
+	return filepath.Join(procIRQDir, strconv.Itoa(irq), "smp_affinity")
+}
+
+// sortQueues sorts queue names such as "rx-10" by their index
+func sortQueues(queues []string) {
+	index := func(queue string) int {
+		_, n, _ := strings.Cut(queue, "-")
+		i, _ := strconv.Atoi(n)
+		return i
+	}
+	sort.Slice(queues, func(i, j int) bool {
+		return index(queues[i]) < index(queues[j])
+	})
+}
+
+// SteeringValues resolves the settings of an interface to host path -> value
+// for its layout. Every CPU a mask selects must be online.
+func SteeringValues(iface string, layout *SteeringLayout, settings *types.SteeringSettings, cpus []int) (map[string]string, error) {
+	values := make(map[string]string)
+	if settings == nil {
+		return values, nil
+	}
+
+	if settings.RPSCPUs != "" {
+		mask, err := resolveCPUMask("rps_cpus", settings.RPSCPUs, cpus, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, queue := range layout.RxQueues {
+			values[QueuePath(iface, queue, "rps_cpus")] = mask
+		}
+	}
+
+	if settings.RPSFlowCnt != nil {
+		for _, queue := range layout.RxQueues {
+			values[QueuePath(iface, queue, "rps_flow_cnt")] = strconv.Itoa(*settings.RPSFlowCnt)
+		}
+	}
+
+	if settings.XPSCPUs != "" {
+		paths := make([]string, len(layout.TxQueues))
+		for i, queue := range layout.TxQueues {
+			paths[i] = QueuePath(iface, queue, "xps_cpus")
+		}
+		if err := assignCPUMasks(values, "xps_cpus", settings.XPSCPUs, paths, cpus, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if settings.IRQAffinity != "" {
+		paths := make([]string, len(layout.IRQs))
+		for i, irq := range layout.IRQs {
+			paths[i] = IRQAffinityPath(irq)
+		}
+		if err := assignCPUMasks(values, "irq_affinity", settings.IRQAffinity, paths, cpus, false); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+// assignCPUMasks sets every path to the same mask, or with "spread" gives each
+// path the next online CPU in turn
+func assignCPUMasks(values map[string]string, name, mask string, paths []string, cpus []int, allowEmpty bool) error {
+	if mask == CPUMaskSpread {
+		if len(cpus) == 0 {
+			return fmt.Errorf("%s: no online CPUs to spread over", name)
+		}
+		for i, p := range paths {
+			values[p] = FormatCPUMask([]int{cpus[i%len(cpus)]})
+		}
+		return nil
+	}
+
+	resolved, err := resolveCPUMask(name, mask, cpus, allowEmpty)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		values[p] = resolved
+	}
+	return nil
+}
+
+// resolveCPUMask checks a mask against the online CPUs and returns it in
+// canonical form; "all" selects every online CPU
+func resolveCPUMask(name, mask string, cpus []int, allowEmpty bool) (string, error) {
+	if mask == CPUMaskAll {
+		return FormatCPUMask(cpus), nil
+	}
+
+	selected, err := ParseCPUMask(mask)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	if len(selected) == 0 && !allowEmpty {
+		return "", fmt.Errorf("%s: mask %s selects no CPUs", name, mask)
+	}
+
+	online := make(map[int]bool, len(cpus))
+	for _, cpu := range cpus {
+		online[cpu] = true
+	}
+	var offline []int
+	for _, cpu := range selected {
+		if !online[cpu] {
+			offline = append(offline, cpu)
+		}
+	}
+	if len(offline) > 0 {
+		return "", fmt.Errorf("%s: mask %s selects CPUs %s, but the online CPUs are %s",
+			name, mask, FormatCPUList(offline), FormatCPUList(cpus))
+	}
+	return FormatCPUMask(selected), nil
+}
+
+// SteeringValueEqual compares two values of a steering file, treating CPU
+// masks with different padding or grouping as equal
+func SteeringValueEqual(path, a, b string) bool {
+	if strings.HasSuffix(path, "rps_flow_cnt") {
+		return strings.TrimSpace(a) == strings.TrimSpace(b)
+	}
+	maskA, errA := ParseCPUMask(a)
+	maskB, errB := ParseCPUMask(b)
+	if errA != nil || errB != nil {
+		return strings.TrimSpace(a) == strings.TrimSpace(b)
+	}
+	return FormatCPUMask(maskA) == FormatCPUMask(maskB)
+}
+
+// ParseCPUMask parses a hex CPU mask as sysfs prints it, such as "f",
+// "0xff" or "00000000,0000000f", into the CPUs it selects
+func ParseCPUMask(mask string) ([]int, error) {
+	digits := strings.TrimPrefix(strings.TrimSpace(mask), "0x")
+	groups := strings.Split(digits, ",")
+	var hex strings.Builder
+	for i, group := range groups {
+		if group == "" || (len(groups) > 1 && len(group) > 8) {
+			return nil, fmt.Errorf("invalid CPU mask '%s'", mask)
+		}
+		if i > 0 {
+			group = strings.Repeat("0", 8-len(group)) + group
+		}
+		hex.WriteString(group)
+	}
+
+	value, ok := new(big.Int).SetString(hex.String(), 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid CPU mask '%s'", mask)
+	}
+	var cpus []int
+	for cpu := 0; cpu < value.BitLen(); cpu++ {
+		if value.Bit(cpu) == 1 {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// FormatCPUMask formats CPUs as a hex mask in comma-separated 32-bit groups,
+// the form the kernel parses; no CPUs format as "0"
+func FormatCPUMask(cpus []int) string {
+	value := new(big.Int)
+	for _, cpu := range cpus {
+		value.SetBit(value, cpu, 1)
+	}
+	hex := value.Text(16)
+
+	var groups []string
+	for len(hex) > 8 {
+		groups = append([]string{hex[len(hex)-8:]}, groups...)
+		hex = hex[:len(hex)-8]
+	}
+	return strings.Join(append([]string{hex}, groups...), ",")
+}
+
+// ParseCPUList parses a CPU list such as "0-3,8" into ascending CPUs
+func ParseCPUList(list string) ([]int, error) {
+	var cpus []int
+	if list == "" {
+		return cpus, nil
+	}
+	for _, part := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		lo, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU list '%s'", list)
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.Atoi(last); err != nil || hi < lo {
+				return nil, fmt.Errorf("invalid CPU list '%s'", list)
+			}
+		}
+		for cpu := lo; cpu <= hi; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// FormatCPUList formats ascending CPUs as a list such as "0-3,8"
+func FormatCPUList(cpus []int) string {
+	var parts []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(cpus[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
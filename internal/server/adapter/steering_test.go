@@ -0,0 +1,185 @@
+package adapter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"go.uber.org/zap"
+)
+
+func TestParseCPUMask(t *testing.T) {
+	tests := []struct {
+		mask    string
+		want    []int
+		wantErr bool
+	}{
+		{"0", nil, false},
+		{"f", []int{0, 1, 2, 3}, false},
+		{"0xa", []int{1, 3}, false},
+		{"00000000,0000000f", []int{0, 1, 2, 3}, false},
+		{"1,00000001", []int{0, 32}, false},
+		{"1,1", []int{0, 32}, false},
+		{"xyz", nil, true},
+		{"f,", nil, true},
+		{"1,000000001", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mask, func(t *testing.T) {
+			got, err := ParseCPUMask(tt.mask)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCPUMask(%q) error = %v, wantErr %v", tt.mask, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCPUMask(%q) = %v, want %v", tt.mask, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatCPUMask(t *testing.T) {
+	tests := []struct {
+		cpus []int
+		want string
+	}{
+		{nil, "0"},
+		{[]int{0, 1, 2, 3}, "f"},
+		{[]int{0, 32}, "1,00000001"},
+		{[]int{35}, "8,00000000"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatCPUMask(tt.cpus); got != tt.want {
+			t.Errorf("FormatCPUMask(%v) = %q, want %q", tt.cpus, got, tt.want)
+		}
+	}
+}
+
+func TestCPUList(t *testing.T) {
+	cpus, err := ParseCPUList("0-3,8,10-11")
+	if err != nil {
+		t.Fatalf("ParseCPUList failed: %v", err)
+	}
+	if want := []int{0, 1, 2, 3, 8, 10, 11}; !reflect.DeepEqual(cpus, want) {
+		t.Errorf("ParseCPUList() = %v, want %v", cpus, want)
+	}
+	if got := FormatCPUList(cpus); got != "0-3,8,10-11" {
+		t.Errorf("FormatCPUList() = %q", got)
+	}
+	if _, err := ParseCPUList("3-1"); err == nil {
+		t.Error("a reversed range should be rejected")
+	}
+}
+
+func TestSteeringValues(t *testing.T) {
+	layout := &SteeringLayout{
+		RxQueues: []string{"rx-0", "rx-1"},
+		TxQueues: []string{"tx-0", "tx-1", "tx-2"},
+		IRQs:     []int{40, 41},
+	}
+	cpus := []int{0, 1}
+	flows := 2048
+
+	values, err := SteeringValues("eth0", layout, &types.SteeringSettings{
+		RPSCPUs:     "all",
+		RPSFlowCnt:  &flows,
+		XPSCPUs:     "spread",
+		IRQAffinity: "0x2",
+	}, cpus)
+	if err != nil {
+		t.Fatalf("SteeringValues failed: %v", err)
+	}
+	want := map[string]string{
+		QueuePath("eth0", "rx-0", "rps_cpus"):     "3",
+		QueuePath("eth0", "rx-1", "rps_cpus"):     "3",
+		QueuePath("eth0", "rx-0", "rps_flow_cnt"): "2048",
+		QueuePath("eth0", "rx-1", "rps_flow_cnt"): "2048",
+		QueuePath("eth0", "tx-0", "xps_cpus"):     "1",
+		QueuePath("eth0", "tx-1", "xps_cpus"):     "2",
+		QueuePath("eth0", "tx-2", "xps_cpus"):     "1",
+		IRQAffinityPath(40):                       "2",
+		IRQAffinityPath(41):                       "2",
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("SteeringValues() = %v, want %v", values, want)
+	}
+
+	if _, err := SteeringValues("eth0", layout, &types.SteeringSettings{RPSCPUs: "4"}, cpus); err == nil ||
+		!strings.Contains(err.Error(), "online CPUs are 0-1") {
+		t.Errorf("an offline CPU should be rejected, got %v", err)
+	}
+	if _, err := SteeringValues("eth0", layout, &types.SteeringSettings{IRQAffinity: "0"}, cpus); err == nil {
+		t.Error("an empty IRQ affinity should be rejected")
+	}
+	if _, err := SteeringValues("eth0", layout, &types.SteeringSettings{RPSCPUs: "0"}, cpus); err != nil {
+		t.Errorf("rps_cpus 0 disables RPS and should be accepted: %v", err)
+	}
+}
+
+func TestSteeringManagerRooted(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		cpuOnlinePath:                             "0-1",
+		QueuePath("eth0", "rx-0", "rps_cpus"):     "00000000,00000000",
+		QueuePath("eth0", "rx-0", "rps_flow_cnt"): "0",
+		QueuePath("eth0", "tx-0", "xps_cpus"):     "0",
+		IRQAffinityPath(30):                       "3",
+		IRQAffinityPath(31):                       "3",
+		procInterruptsPath: "           CPU0       CPU1\n" +
+			" 30:        100        200   PCI-MSIX  eth0-TxRx-0\n" +
+			" 31:          1          0   PCI-MSIX  eth0\n" +
+			" 32:          5          5   PCI-MSIX  eth10-TxRx-0\n",
+	}
+	for path, value := range files {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(value+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewRootedSteeringManager(root, zap.NewNop())
+	if cpus, err := m.OnlineCPUs(); err != nil || !reflect.DeepEqual(cpus, []int{0, 1}) {
+		t.Errorf("OnlineCPUs() = %v, %v", cpus, err)
+	}
+
+	layout, err := m.Layout("eth0")
+	if err != nil {
+		t.Fatalf("Layout failed: %v", err)
+	}
+	if !reflect.DeepEqual(layout.IRQs, []int{30, 31}) {
+		t.Errorf("IRQs from /proc/interrupts = %v, want [30 31]", layout.IRQs)
+	}
+
+	if err := m.Set(map[string]string{QueuePath("eth0", "rx-0", "rps_cpus"): "2"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	values, err := m.GetAll()
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	if got := values[QueuePath("eth0", "rx-0", "rps_cpus")]; got != "2" {
+		t.Errorf("rps_cpus = %q, want 2", got)
+	}
+	if len(values) != 5 {
+		t.Errorf("GetAll() = %v, want 5 files", values)
+	}
+
+	if err := m.Set(map[string]string{QueuePath("eth0", "rx-9", "rps_cpus"): "1"}); err == nil {
+		t.Error("writing a missing queue should fail")
+	}
+	for _, p := range []string{"/sys/class/net/eth0/queues/rx-0/../../../../../etc/passwd", "/etc/passwd", "/proc/irq/24/../../sys/kernel/core_pattern"} {
+		if err := m.Set(map[string]string{p: "1"}); err == nil {
+			t.Errorf("writing %s should fail", p)
+		}
+	}
+	if !SteeringValueEqual(QueuePath("eth0", "rx-0", "rps_cpus"), "00000000,00000003", "3") {
+		t.Error("padded masks should compare equal")
+	}
+}
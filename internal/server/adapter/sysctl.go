@@ -3,31 +3,48 @@ package adapter
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/jtsang4/nettune/internal/shared/types"
 	"go.uber.org/zap"
 )
 
 // SysctlManager handles sysctl operations
 type SysctlManager struct {
-	logger *zap.Logger
+	procDir    string
+	useCommand bool // fall back to the sysctl command when /proc/sys fails
+	logger     *zap.Logger
 }
 
 // NewSysctlManager creates a new SysctlManager
 func NewSysctlManager(logger *zap.Logger) *SysctlManager {
-	return &SysctlManager{logger: logger}
+	return &SysctlManager{procDir: sysctlProcDir, useCommand: true, logger: logger}
+}
+
+// NewRootedSysctlManager creates a SysctlManager that reads and writes
+// root/proc/sys and never runs the sysctl command
+func NewRootedSysctlManager(root string, logger *zap.Logger) *SysctlManager {
+	return &SysctlManager{procDir: filepath.Join(root, sysctlProcDir), logger: logger}
 }
 
 // Get reads a sysctl value
 func (m *SysctlManager) Get(key string) (string, error) {
 	// Convert dot notation to path: net.core.rmem_max -> /proc/sys/net/core/rmem_max
-	path := m.keyToPath(key)
+	path, err := m.keyToPath(key)
+	if err != nil {
+		return "", err
+	}
 
 	data, err := os.ReadFile(path)
 	if err != nil {
+		if !m.useCommand {
+			return "", err
+		}
 		// Fallback to sysctl command
 		return m.getViaSysctl(key)
 	}
@@ -37,10 +54,16 @@ func (m *SysctlManager) Get(key string) (string, error) {
 
 // Set writes a sysctl value
 func (m *SysctlManager) Set(key, value string) error {
-	path := m.keyToPath(key)
+	path, err := m.keyToPath(key)
+	if err != nil {
+		return err
+	}
 
-	// Try writing to /proc/sys first
-	if err := os.WriteFile(path, []byte(value), 0644); err != nil {
+	// Try writing to /proc/sys first; keys are never created
+	if err := writeExistingFile(path, value); err != nil {
+		if !m.useCommand {
+			return err
+		}
 		m.logger.Debug("failed to write to proc, falling back to sysctl command",
 			zap.String("key", key),
 			zap.Error(err))
@@ -82,17 +105,132 @@ func (m *SysctlManager) SetMultiple(values map[string]string) error {
 	return nil
 }
 
-// WriteToFile writes sysctl configuration to a file
-func (m *SysctlManager) WriteToFile(path string, kvs map[string]string) error {
-	var lines []string
-	lines = append(lines, "# Managed by nettune - DO NOT EDIT")
-	lines = append(lines, "")
+// GetTree reads every writable sysctl under a prefix such as "net".
+// Read-only entries are skipped because they cannot be restored anyway.
+func (m *SysctlManager) GetTree(prefix string) (map[string]string, error) {
+	root, err := m.keyToPath(prefix)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// Unreadable subtrees (e.g. per-namespace restrictions) are skipped
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || info.Mode().Perm()&0200 == 0 || info.Mode().Perm()&0400 == 0 {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			m.logger.Debug("failed to read sysctl", zap.String("path", path), zap.Error(err))
+			return nil
+		}
+
+		rel, err := filepath.Rel(m.procDir, path)
+		if err != nil {
+			return nil
+		}
+		result[pathToKey(rel)] = strings.TrimSpace(string(data))
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to walk %s: %w", root, err)
+	}
+
+	return result, nil
+}
+
+// InInitNetNamespace reports whether this process shares the network namespace
+// of PID 1. It assumes so when the namespaces cannot be compared.
+func (m *SysctlManager) InInitNetNamespace() bool {
+	if m.procDir != sysctlProcDir {
+		return true
+	}
+	self, err := os.Readlink("/proc/self/ns/net")
+	if err != nil {
+		return true
+	}
+	host, err := os.Readlink("/proc/1/ns/net")
+	if err != nil {
+		return true
+	}
+	return self == host
+}
+
+// Probe checks that a key exists and is writable without changing it. Outside
+// the initial network namespace, net.* keys only affect the current namespace.
+func (m *SysctlManager) Probe(key string, initNetNS bool) *types.SysctlPreflight {
+	path, err := m.keyToPath(key)
+	if err != nil {
+		return &types.SysctlPreflight{Status: types.PreflightMissing, Detail: err.Error()}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &types.SysctlPreflight{
+				Status: types.PreflightMissing,
+				Detail: "not available on this kernel or in this network namespace",
+			}
+		}
+		return &types.SysctlPreflight{Status: types.PreflightMissing, Detail: err.Error()}
+	}
+	if info.IsDir() {
+		return &types.SysctlPreflight{Status: types.PreflightMissing, Detail: "is a directory, not a key"}
+	}
+
+	// Opening for write checks permissions and read-only mounts without writing
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return &types.SysctlPreflight{Status: types.PreflightReadOnly, Detail: err.Error()}
+	}
+	file.Close()
+
+	if !initNetNS && strings.HasPrefix(key, "net.") {
+		return &types.SysctlPreflight{
+			Status: types.PreflightNamespaced,
+			Detail: "only affects the current network namespace, not the host",
+		}
+	}
+	return &types.SysctlPreflight{Status: types.PreflightOK}
+}
+
+// SysctlFileEntry is one setting in the nettune sysctl drop-in with its provenance
+type SysctlFileEntry struct {
+	Value     string `json:"value"`
+	ProfileID string `json:"profile_id"`
+	ApplyID   string `json:"apply_id"` // snapshot ID of the apply that set the value
+}
+
+// sysctlProvenancePrefix starts the comment recording which apply set the next line
+const sysctlProvenancePrefix = "# nettune:"
 
-	for key, value := range kvs {
-		lines = append(lines, fmt.Sprintf("%s = %s", key, value))
+// ReadManagedFile parses the nettune sysctl drop-in; a missing file yields no entries
+func (m *SysctlManager) ReadManagedFile(path string) (map[string]*SysctlFileEntry, error) {
+	content, err := m.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
 	}
+	return ParseManagedSysctlFile(content), nil
+}
 
-	content := strings.Join(lines, "\n") + "\n"
+// WriteManagedFile atomically writes the nettune sysctl drop-in
+func (m *SysctlManager) WriteManagedFile(path string, entries map[string]*SysctlFileEntry) error {
+	content := FormatManagedSysctlFile(entries)
 
 	// Ensure directory exists
 	dir := filepath.Dir(path)
@@ -111,12 +249,89 @@ func (m *SysctlManager) WriteToFile(path string, kvs map[string]string) error {
 		return fmt.Errorf("failed to rename temp file: %w", err)
 	}
 
-	m.logger.Info("wrote sysctl configuration file", zap.String("path", path))
+	m.logger.Info("wrote sysctl configuration file",
+		zap.String("path", path),
+		zap.Int("keys", len(entries)))
 	return nil
 }
 
+// ParseManagedSysctlFile parses drop-in content. A provenance comment applies
+// to the setting on the following line; settings without one keep empty provenance.
+func ParseManagedSysctlFile(content string) map[string]*SysctlFileEntry {
+	entries := make(map[string]*SysctlFileEntry)
+	var profileID, applyID string
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, sysctlProvenancePrefix) {
+			profileID, applyID = "", ""
+			for _, field := range strings.Fields(strings.TrimPrefix(line, sysctlProvenancePrefix)) {
+				name, value, ok := strings.Cut(field, "=")
+				if !ok || value == "unknown" {
+					continue
+				}
+				switch name {
+				case "profile":
+					profileID = value
+				case "apply":
+					applyID = value
+				}
+			}
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		entries[strings.TrimSpace(key)] = &SysctlFileEntry{
+			Value:     strings.TrimSpace(value),
+			ProfileID: profileID,
+			ApplyID:   applyID,
+		}
+		profileID, applyID = "", ""
+	}
+
+	return entries
+}
+
+// FormatManagedSysctlFile renders entries sorted by key, each preceded by its provenance
+func FormatManagedSysctlFile(entries map[string]*SysctlFileEntry) string {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := []string{"# Managed by nettune - DO NOT EDIT"}
+	for _, key := range keys {
+		entry := entries[key]
+		lines = append(lines, "")
+		lines = append(lines, fmt.Sprintf("%s profile=%s apply=%s",
+			sysctlProvenancePrefix, provenanceField(entry.ProfileID), provenanceField(entry.ApplyID)))
+		lines = append(lines, fmt.Sprintf("%s = %s", key, entry.Value))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// provenanceField returns a placeholder for provenance lost from older files
+func provenanceField(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
+
 // LoadFromFile loads sysctl settings from a file using sysctl -p
 func (m *SysctlManager) LoadFromFile(path string) error {
+	if !m.useCommand {
+		return m.loadFromFileDirect(path)
+	}
+
 	cmd := exec.Command("sysctl", "-p", path)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -126,6 +341,37 @@ func (m *SysctlManager) LoadFromFile(path string) error {
 	return nil
 }
 
+// loadFromFileDirect applies the assignments of a file through /proc/sys
+func (m *SysctlManager) loadFromFileDirect(path string) error {
+	assignments, err := ParseSysctlConfig(path)
+	if err != nil {
+		return fmt.Errorf("failed to load sysctl from %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(assignments))
+	for _, assignment := range assignments {
+		values[assignment.Key] = assignment.Value
+	}
+	if err := m.SetMultiple(values); err != nil {
+		return fmt.Errorf("failed to load sysctl from %s: %w", path, err)
+	}
+	m.logger.Info("loaded sysctl configuration from file", zap.String("path", path))
+	return nil
+}
+
+// writeExistingFile overwrites a file without creating it, as /proc/sys requires
+func writeExistingFile(path, value string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(value); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
 // ReadFile reads a sysctl configuration file content
 func (m *SysctlManager) ReadFile(path string) (string, error) {
 	data, err := os.ReadFile(path)
@@ -138,11 +384,38 @@ func (m *SysctlManager) ReadFile(path string) (string, error) {
 	return string(data), nil
 }
 
-// keyToPath converts sysctl key to /proc/sys path
-func (m *SysctlManager) keyToPath(key string) string {
-	// Replace dots with slashes
-	pathKey := strings.ReplaceAll(key, ".", "/")
-	return filepath.Join("/proc/sys", pathKey)
+// sysctlProcDir is where the kernel exposes sysctl values
+const sysctlProcDir = "/proc/sys"
+
+// NettuneSysctlFilePath is the sysctl drop-in written by nettune
+const NettuneSysctlFilePath = "/etc/sysctl.d/99-nettune.conf"
+
+// keyToPath converts sysctl key to /proc/sys path. Keys with an empty, "." or
+// ".." component are refused, so no key names a file outside /proc/sys.
+func (m *SysctlManager) keyToPath(key string) (string, error) {
+	// Dots separate path components; a slash inside a component stands for a
+	// literal dot, e.g. net.ipv4.conf.eth0/100.rp_filter for VLAN eth0.100
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		parts[i] = strings.ReplaceAll(part, "/", ".")
+		if parts[i] == "" || parts[i] == "." || parts[i] == ".." {
+			return "", fmt.Errorf("invalid sysctl key %q", key)
+		}
+	}
+	path := filepath.Join(append([]string{m.procDir}, parts...)...)
+	if !strings.HasPrefix(path, m.procDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid sysctl key %q", key)
+	}
+	return path, nil
+}
+
+// pathToKey converts a path relative to /proc/sys back to a sysctl key
+func pathToKey(rel string) string {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i, part := range parts {
+		parts[i] = strings.ReplaceAll(part, ".", "/")
+	}
+	return strings.Join(parts, ".")
 }
 
 // getViaSysctl reads sysctl value using sysctl command
@@ -0,0 +1,142 @@
+package adapter
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SysctlConfigDirs are the directories systemd-sysctl reads, highest priority first.
+// A file in an earlier directory masks files with the same name in later ones.
+var SysctlConfigDirs = []string{
+	"/etc/sysctl.d",
+	"/run/sysctl.d",
+	"/usr/local/lib/sysctl.d",
+	"/usr/lib/sysctl.d",
+	"/lib/sysctl.d",
+}
+
+// SysctlConfFile is the legacy configuration file, applied after every drop-in
+const SysctlConfFile = "/etc/sysctl.conf"
+
+// SysctlAssignment is one key assignment in a sysctl configuration file
+type SysctlAssignment struct {
+	Key   string
+	Value string
+	File  string
+	Line  int
+}
+
+// SysctlConfigFiles lists sysctl configuration files in the order they are applied
+// at boot, so later files win. Extra paths are listed as if they already existed.
+func SysctlConfigFiles(extra ...string) []string {
+	return sysctlConfigFiles(SysctlConfigDirs, SysctlConfFile, extra)
+}
+
+// sysctlConfigFiles orders *.conf files by name, keeping the highest-priority
+// directory for each name, and appends confFile when present
+func sysctlConfigFiles(dirs []string, confFile string, extra []string) []string {
+	byName := make(map[string]string)
+	rank := func(path string) int {
+		for i, dir := range dirs {
+			if filepath.Dir(path) == dir {
+				return i
+			}
+		}
+		return len(dirs)
+	}
+	consider := func(path string) {
+		name := filepath.Base(path)
+		if current, ok := byName[name]; !ok || rank(path) < rank(current) {
+			byName[name] = path
+		}
+	}
+
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".conf") {
+				continue
+			}
+			consider(filepath.Join(dir, entry.Name()))
+		}
+	}
+	for _, path := range extra {
+		consider(path)
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		files = append(files, byName[name])
+	}
+	if _, err := os.Stat(confFile); err == nil {
+		files = append(files, confFile)
+	}
+	return files
+}
+
+// ParseSysctlConfig returns the key assignments in a sysctl configuration file
+func ParseSysctlConfig(path string) ([]SysctlAssignment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var assignments []SysctlAssignment
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		assignments = append(assignments, SysctlAssignment{
+			Key:   NormalizeSysctlConfigKey(key),
+			Value: strings.TrimSpace(value),
+			File:  path,
+			Line:  lineNum,
+		})
+	}
+
+	return assignments, scanner.Err()
+}
+
+// NormalizeSysctlConfigKey converts a configuration key to dot notation. A leading
+// "-" (ignore errors) is dropped, and slash-separated keys have their separators
+// swapped, so net/ipv4/conf/eth0.100/rp_filter becomes net.ipv4.conf.eth0/100.rp_filter.
+func NormalizeSysctlConfigKey(key string) string {
+	key = strings.TrimPrefix(strings.TrimSpace(key), "-")
+
+	slash := strings.Index(key, "/")
+	dot := strings.Index(key, ".")
+	if slash >= 0 && (dot < 0 || slash < dot) {
+		key = strings.Map(func(r rune) rune {
+			switch r {
+			case '/':
+				return '.'
+			case '.':
+				return '/'
+			}
+			return r
+		}, key)
+	}
+	return key
+}
@@ -0,0 +1,66 @@
+package adapter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSysctlConfigFiles(t *testing.T) {
+	root := t.TempDir()
+	etc := filepath.Join(root, "etc", "sysctl.d")
+	usr := filepath.Join(root, "usr", "lib", "sysctl.d")
+	confFile := filepath.Join(root, "etc", "sysctl.conf")
+
+	files := map[string]string{
+		filepath.Join(etc, "10-custom.conf"):    "",
+		filepath.Join(etc, "99-zz-custom.conf"): "",
+		filepath.Join(usr, "10-custom.conf"):    "", // masked by /etc
+		filepath.Join(usr, "50-default.conf"):   "",
+		filepath.Join(usr, "README"):            "", // not a .conf file
+		filepath.Join(usr, "99-nettune.conf"):   "", // masked by the extra path
+		confFile:                                "",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	nettune := filepath.Join(etc, "99-nettune.conf")
+	got := sysctlConfigFiles([]string{etc, usr}, confFile, []string{nettune})
+	want := []string{
+		filepath.Join(etc, "10-custom.conf"),
+		filepath.Join(usr, "50-default.conf"),
+		nettune,
+		filepath.Join(etc, "99-zz-custom.conf"),
+		confFile,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sysctlConfigFiles() = %v, want %v", got, want)
+	}
+}
+
+func TestParseSysctlConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "99-zz-custom.conf")
+	content := "# comment\n; other comment\n\nnet.core.rmem_max = 212992\n-net/ipv4/conf/eth0.100/rp_filter=2\ngarbage\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ParseSysctlConfig(path)
+	if err != nil {
+		t.Fatalf("ParseSysctlConfig failed: %v", err)
+	}
+	want := []SysctlAssignment{
+		{Key: "net.core.rmem_max", Value: "212992", File: path, Line: 4},
+		{Key: "net.ipv4.conf.eth0/100.rp_filter", Value: "2", File: path, Line: 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSysctlConfig() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,115 @@
+package adapter
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"go.uber.org/zap"
+)
+
+func TestSysctlKeyPathRoundTrip(t *testing.T) {
+	m := NewSysctlManager(zap.NewNop())
+
+	tests := []struct {
+		key  string
+		path string
+	}{
+		{"net.core.rmem_max", "/proc/sys/net/core/rmem_max"},
+		{"net.ipv4.tcp_rmem", "/proc/sys/net/ipv4/tcp_rmem"},
+		{"net.ipv4.conf.eth0/100.rp_filter", "/proc/sys/net/ipv4/conf/eth0.100/rp_filter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got, err := m.keyToPath(tt.key); err != nil || got != tt.path {
+				t.Errorf("keyToPath(%q) = %q, %v, want %q", tt.key, got, err, tt.path)
+			}
+			rel := tt.path[len(sysctlProcDir)+1:]
+			if got := pathToKey(rel); got != tt.key {
+				t.Errorf("pathToKey(%q) = %q, want %q", rel, got, tt.key)
+			}
+		})
+	}
+}
+
+func TestSysctlKeyToPathRejectsTraversal(t *testing.T) {
+	m := NewRootedSysctlManager(t.TempDir(), zap.NewNop())
+
+	for _, key := range []string{
+		"net.ipv4.conf.//.//.//.etc.shadow",
+		"net.ipv4.conf./.rp_filter",
+		"net..core",
+		".net.core.rmem_max",
+		"",
+	} {
+		if path, err := m.keyToPath(key); err == nil {
+			t.Errorf("keyToPath(%q) = %q, want an error", key, path)
+		}
+		if err := m.Set(key, "1"); err == nil {
+			t.Errorf("Set(%q) succeeded, want an error", key)
+		}
+	}
+}
+
+func TestManagedSysctlFileRoundTrip(t *testing.T) {
+	entries := map[string]*SysctlFileEntry{
+		"net.ipv4.tcp_congestion_control": {Value: "bbr", ProfileID: "bbr-fq-default", ApplyID: "snap-2"},
+		"net.core.default_qdisc":          {Value: "fq", ProfileID: "bbr-fq-default", ApplyID: "snap-2"},
+		"net.core.rmem_max":               {Value: "67108864", ProfileID: "high-bdp", ApplyID: "snap-1"},
+	}
+
+	content := FormatManagedSysctlFile(entries)
+	want := `# Managed by nettune - DO NOT EDIT
+
+# nettune: profile=bbr-fq-default apply=snap-2
+net.core.default_qdisc = fq
+
+# nettune: profile=high-bdp apply=snap-1
+net.core.rmem_max = 67108864
+
+# nettune: profile=bbr-fq-default apply=snap-2
+net.ipv4.tcp_congestion_control = bbr
+`
+	if content != want {
+		t.Errorf("FormatManagedSysctlFile() =\n%s\nwant\n%s", content, want)
+	}
+
+	parsed := ParseManagedSysctlFile(content)
+	if !reflect.DeepEqual(parsed, entries) {
+		t.Errorf("ParseManagedSysctlFile() = %v, want %v", parsed, entries)
+	}
+}
+
+func TestParseManagedSysctlFile_Legacy(t *testing.T) {
+	content := "# Managed by nettune - DO NOT EDIT\n\nnet.core.rmem_max = 1\nnet.ipv4.tcp_rmem=4096\t87380\t6291456\n"
+
+	parsed := ParseManagedSysctlFile(content)
+	want := map[string]*SysctlFileEntry{
+		"net.core.rmem_max": {Value: "1"},
+		"net.ipv4.tcp_rmem": {Value: "4096\t87380\t6291456"},
+	}
+	if !reflect.DeepEqual(parsed, want) {
+		t.Errorf("ParseManagedSysctlFile() = %v, want %v", parsed, want)
+	}
+
+	// Lines without provenance are written back with a placeholder
+	if got := FormatManagedSysctlFile(parsed); !strings.Contains(got, "# nettune: profile=unknown apply=unknown\nnet.core.rmem_max = 1\n") {
+		t.Errorf("legacy entry not formatted with placeholder provenance:\n%s", got)
+	}
+}
+
+func TestSysctlProbe_Missing(t *testing.T) {
+	if _, err := os.Stat("/proc/sys/net"); err != nil {
+		t.Skip("/proc/sys/net not available")
+	}
+	m := NewSysctlManager(zap.NewNop())
+
+	for _, key := range []string{"net.ipv4.tcp_no_such_key", "net.ipv4"} {
+		if got := m.Probe(key, true); got.Status != types.PreflightMissing {
+			t.Errorf("Probe(%s) = %+v, want %s", key, got, types.PreflightMissing)
+		}
+	}
+}
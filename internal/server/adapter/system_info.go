@@ -47,12 +47,14 @@ func (m *SystemInfoManager) GetServerInfo() (*types.ServerInfo, error) {
 	info.DefaultQdisc = m.getDefaultQdisc()
 
 	// Available congestion control algorithms
-	info.AvailableCCs = m.getAvailableCCs()
+	info.AvailableCCs = m.AvailableCCs()
 
 	// Default interface and MTU
 	qdiscMgr := NewQdiscManager(m.logger)
-	if iface, err := qdiscMgr.GetDefaultRouteInterface(); err == nil {
+	if routes, err := qdiscMgr.GetDefaultRoutes(); err == nil {
+		iface := routes.Primary()
 		info.DefaultInterface = iface
+		info.DefaultRoutes = routes
 		if mtu, err := qdiscMgr.GetInterfaceMTU(iface); err == nil {
 			info.InterfaceMTU = mtu
 		}
@@ -143,8 +145,8 @@ func (m *SystemInfoManager) getDefaultQdisc() string {
 	return strings.TrimSpace(string(data))
 }
 
-// getAvailableCCs returns available congestion control algorithms
-func (m *SystemInfoManager) getAvailableCCs() []string {
+// AvailableCCs returns the congestion control algorithms the kernel can use now
+func (m *SystemInfoManager) AvailableCCs() []string {
 	data, err := os.ReadFile("/proc/sys/net/ipv4/tcp_available_congestion_control")
 	if err != nil {
 		return nil
@@ -214,8 +216,15 @@ func (m *SystemInfoManager) checkDependencies() map[string]string {
 		deps["iproute2"] = "not found"
 	}
 
+	// Check ethtool
+	if output, err := exec.Command("ethtool", "--version").Output(); err == nil {
+		deps["ethtool"] = strings.TrimSpace(string(output))
+	} else {
+		deps["ethtool"] = "not found"
+	}
+
 	// Check if BBR is available
-	availableCCs := m.getAvailableCCs()
+	availableCCs := m.AvailableCCs()
 	hasBBR := false
 	for _, cc := range availableCCs {
 		if cc == "bbr" {
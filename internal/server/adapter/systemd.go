@@ -5,8 +5,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/jtsang4/nettune/internal/shared/types"
 	"go.uber.org/zap"
 )
 
@@ -110,7 +113,7 @@ func (m *SystemdManager) DaemonReload() error {
 // CreateUnit creates a systemd unit file
 func (m *SystemdManager) CreateUnit(name, content string) error {
 	// Determine unit path
-	unitPath := filepath.Join("/etc/systemd/system", name)
+	unitPath := filepath.Join(SystemdUnitDir, name)
 
 	// Write unit file atomically
 	tmpPath := unitPath + ".tmp"
@@ -134,7 +137,7 @@ func (m *SystemdManager) CreateUnit(name, content string) error {
 
 // RemoveUnit removes a systemd unit file
 func (m *SystemdManager) RemoveUnit(name string) error {
-	unitPath := filepath.Join("/etc/systemd/system", name)
+	unitPath := filepath.Join(SystemdUnitDir, name)
 
 	// Stop and disable first
 	m.Stop(name)
@@ -155,14 +158,14 @@ func (m *SystemdManager) RemoveUnit(name string) error {
 
 // UnitExists checks if a unit file exists
 func (m *SystemdManager) UnitExists(name string) bool {
-	unitPath := filepath.Join("/etc/systemd/system", name)
+	unitPath := filepath.Join(SystemdUnitDir, name)
 	_, err := os.Stat(unitPath)
 	return err == nil
 }
 
 // ReadUnit reads a unit file content
 func (m *SystemdManager) ReadUnit(name string) (string, error) {
-	unitPath := filepath.Join("/etc/systemd/system", name)
+	unitPath := filepath.Join(SystemdUnitDir, name)
 	data, err := os.ReadFile(unitPath)
 	if err != nil {
 		return "", err
@@ -176,42 +179,551 @@ func (m *SystemdManager) IsAvailable() bool {
 	return cmd.Run() == nil
 }
 
+// SystemdUnitDir is the directory where nettune installs its unit files
+const SystemdUnitDir = "/etc/systemd/system"
+
 // NettuneQdiscServiceName is the name of the nettune qdisc service
 const NettuneQdiscServiceName = "nettune-qdisc.service"
 
+// NettuneQdiscUnitPath is the path to the qdisc service unit file
+const NettuneQdiscUnitPath = SystemdUnitDir + "/" + NettuneQdiscServiceName
+
 // NettuneQdiscScriptPath is the path to the qdisc setup script
 const NettuneQdiscScriptPath = "/usr/local/bin/nettune-qdisc-setup.sh"
 
+// QdiscWaitSeconds bounds how long the setup script waits for late interfaces at boot
+const QdiscWaitSeconds = 60
+
 // GenerateQdiscServiceUnit generates the qdisc persistence service unit
 func GenerateQdiscServiceUnit() string {
-	return `[Unit]
+	return fmt.Sprintf(`[Unit]
 Description=Nettune Qdisc Persistence
-After=network.target
+Wants=network-online.target
+After=network-online.target
 
 [Service]
 Type=oneshot
 RemainAfterExit=yes
-ExecStart=/usr/local/bin/nettune-qdisc-setup.sh
+ExecStart=%s
 ExecStop=/bin/true
+TimeoutStartSec=%d
 
 [Install]
 WantedBy=multi-user.target
-`
+`, NettuneQdiscScriptPath, QdiscWaitSeconds+30)
 }
 
-// GenerateQdiscSetupScript generates the qdisc setup script
-func GenerateQdiscSetupScript(qdiscType string, iface string) string {
-	if iface == "" {
-		return fmt.Sprintf(`#!/bin/bash
+// GenerateQdiscSetupScript generates the qdisc setup script. It sets the root
+// qdisc with its parameters on every target, waiting up to QdiscWaitSeconds
+// (or $NETTUNE_QDISC_WAIT) for interfaces that are not up yet; ones that never
+// appear are reported and skipped.
+func GenerateQdiscSetupScript(targets []QdiscTarget) string {
+	var calls []string
+	for _, target := range targets {
+		args := append([]string{target.Interface, target.Type}, QdiscArgs(target.Params)...)
+		calls = append(calls, "set_qdisc "+shellQuoteAll(args))
+	}
+
+	return fmt.Sprintf(`#!/bin/bash
 # Managed by nettune - DO NOT EDIT
-DEFAULT_IFACE=$(ip route | grep default | awk '{print $5}' | head -n1)
-if [ -n "$DEFAULT_IFACE" ]; then
-    tc qdisc replace dev "$DEFAULT_IFACE" root %s
-fi
-`, qdiscType)
+DEADLINE=$((SECONDS + ${NETTUNE_QDISC_WAIT:-%d}))
+status=0
+
+# wait_for_interface waits until the interface exists or the deadline passes
+wait_for_interface() {
+    while [ ! -e "/sys/class/net/$1" ] && [ $SECONDS -lt $DEADLINE ]; do
+        sleep 1
+    done
+    [ -e "/sys/class/net/$1" ]
+}
+
+# set_qdisc IFACE QDISC [PARAMS...] sets the root qdisc of an interface
+set_qdisc() {
+    local iface="$1"
+    shift
+    if ! wait_for_interface "$iface"; then
+        echo "nettune: interface $iface not found, qdisc not set" >&2
+        return
+    fi
+    tc qdisc replace dev "$iface" root "$@" || status=1
+}
+
+%s
+exit $status
+`, QdiscWaitSeconds, strings.Join(calls, "\n"))
+}
+
+// NettuneLinkServiceName is the name of the nettune link settings service
+const NettuneLinkServiceName = "nettune-link.service"
+
+// NettuneLinkUnitPath is the path to the link service unit file
+const NettuneLinkUnitPath = SystemdUnitDir + "/" + NettuneLinkServiceName
+
+// NettuneLinkScriptPath is the path to the link setup script
+const NettuneLinkScriptPath = "/usr/local/bin/nettune-link-setup.sh"
+
+// LinkWaitSeconds bounds how long the link setup script waits for late interfaces at boot
+const LinkWaitSeconds = 60
+
+// GenerateLinkServiceUnit generates the link settings persistence service unit.
+// It runs before the qdisc service, since ring changes may reset the device queues.
+func GenerateLinkServiceUnit() string {
+	return fmt.Sprintf(`[Unit]
+Description=Nettune Link Settings Persistence
+Wants=network-online.target
+After=network-online.target
+Before=%s
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=%s
+ExecStop=/bin/true
+TimeoutStartSec=%d
+
+[Install]
+WantedBy=multi-user.target
+`, NettuneQdiscServiceName, NettuneLinkScriptPath, LinkWaitSeconds+30)
+}
+
+// GenerateLinkSetupScript generates the link setup script. It runs the ip link
+// and ethtool calls of every target once its interface exists, waiting up to
+// LinkWaitSeconds (or $NETTUNE_LINK_WAIT); interfaces that never appear are
+// reported and skipped.
+func GenerateLinkSetupScript(targets []LinkTarget) string {
+	var calls []string
+	for _, target := range targets {
+		if args := IPLinkArgs(target.Interface, target.Settings); args != nil {
+			calls = append(calls, "set_ip_link "+shellQuoteAll(append([]string{target.Interface}, args...)))
+		}
+		for _, args := range EthtoolArgs(target.Interface, target.Settings) {
+			calls = append(calls, "set_link "+shellQuoteAll(append([]string{target.Interface}, args...)))
+		}
 	}
+
 	return fmt.Sprintf(`#!/bin/bash
 # Managed by nettune - DO NOT EDIT
-tc qdisc replace dev %s root %s
-`, iface, qdiscType)
+DEADLINE=$((SECONDS + ${NETTUNE_LINK_WAIT:-%d}))
+status=0
+
+# wait_for_interface waits until the interface exists or the deadline passes
+wait_for_interface() {
+    while [ ! -e "/sys/class/net/$1" ] && [ $SECONDS -lt $DEADLINE ]; do
+        sleep 1
+    done
+    [ -e "/sys/class/net/$1" ]
+}
+
+# set_link IFACE ARGS... runs ethtool once the interface exists. Exit status 80
+# means the requested values were already in effect.
+set_link() {
+    local iface="$1"
+    shift
+    if ! wait_for_interface "$iface"; then
+        echo "nettune: interface $iface not found, link settings not applied" >&2
+        return
+    fi
+    ethtool "$@"
+    local rc=$?
+    [ $rc -eq 0 ] || [ $rc -eq 80 ] || status=1
+}
+
+# set_ip_link IFACE ARGS... runs ip once the interface exists
+set_ip_link() {
+    local iface="$1"
+    shift
+    if ! wait_for_interface "$iface"; then
+        echo "nettune: interface $iface not found, link settings not applied" >&2
+        return
+    fi
+    ip "$@" || status=1
+}
+
+%s
+exit $status
+`, LinkWaitSeconds, strings.Join(calls, "\n"))
+}
+
+// NettuneRouteServiceName is the name of the nettune route attributes service
+const NettuneRouteServiceName = "nettune-route.service"
+
+// NettuneRouteUnitPath is the path to the route service unit file
+const NettuneRouteUnitPath = SystemdUnitDir + "/" + NettuneRouteServiceName
+
+// NettuneRouteScriptPath is the path to the route setup script
+const NettuneRouteScriptPath = "/usr/local/bin/nettune-route-setup.sh"
+
+// RouteWaitSeconds bounds how long the route setup script waits for late routes at boot
+const RouteWaitSeconds = 60
+
+// GenerateRouteServiceUnit generates the route attributes persistence service unit.
+// It runs after the link service, since a link coming up late brings its routes with it.
+func GenerateRouteServiceUnit() string {
+	return fmt.Sprintf(`[Unit]
+Description=Nettune Route Attributes Persistence
+Wants=network-online.target
+After=network-online.target %s
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=%s
+ExecStop=/bin/true
+TimeoutStartSec=%d
+
+[Install]
+WantedBy=multi-user.target
+`, NettuneLinkServiceName, NettuneRouteScriptPath, RouteWaitSeconds+30)
+}
+
+// GenerateRouteSetupScript generates the route setup script. For every target
+// it waits up to RouteWaitSeconds (or $NETTUNE_ROUTE_WAIT) for a route to the
+// destination, then changes each such route to carry the target's attributes,
+// keeping the attributes the target leaves unset.
+func GenerateRouteSetupScript(targets []RouteTarget) string {
+	var calls []string
+	for _, target := range targets {
+		args := append([]string{target.Family, target.Dest}, RouteAttrArgs(target.Attrs)...)
+		calls = append(calls, "set_route "+shellQuoteAll(args))
+	}
+
+	return fmt.Sprintf(`#!/bin/bash
+# Managed by nettune - DO NOT EDIT
+DEADLINE=$((SECONDS + ${NETTUNE_ROUTE_WAIT:-%d}))
+status=0
+
+# set_route FAMILY DEST ATTR VALUE... sets the attributes on every main table
+# route to DEST once one exists. Multipath routes are left alone.
+set_route() {
+    local family="$1" dest="$2"
+    shift 2
+    local -A keys=()
+    local i
+    for ((i = 1; i <= $#; i += 2)); do
+        keys[${!i}]=1
+    done
+
+    while [ -z "$(ip -family "$family" route show table main exact "$dest")" ] && [ $SECONDS -lt $DEADLINE ]; do
+        sleep 1
+    done
+
+    local found=0 line
+    local -a words spec
+    while read -r line; do
+        [ -n "$line" ] || continue
+        read -r -a words <<< "$line"
+        [ "${words[0]}" != nexthop ] || continue
+        found=1
+        spec=()
+        for ((i = 0; i < ${#words[@]}; i++)); do
+            case "${words[i]}" in
+            initcwnd|initrwnd)
+                if [ -n "${keys[${words[i]}]}" ]; then
+                    i=$((i + 1))
+                    continue
+                fi
+                ;;
+            congctl)
+                if [ -n "${keys[congctl]}" ]; then
+                    [ "${words[i+1]}" != lock ] || i=$((i + 1))
+                    i=$((i + 1))
+                    continue
+                fi
+                ;;
+            expires)
+                i=$((i + 1))
+                continue
+                ;;
+            linkdown|dead|offload|trap|rt_offload|rt_trap|rt_offload_failed)
+                continue
+                ;;
+            esac
+            spec+=("${words[i]}")
+        done
+        ip -family "$family" route change "${spec[@]}" "$@" || status=1
+    done < <(ip -family "$family" route show table main exact "$dest")
+
+    if [ $found -eq 0 ]; then
+        echo "nettune: no $family route to $dest, route attributes not applied" >&2
+    fi
+}
+
+%s
+exit $status
+`, RouteWaitSeconds, strings.Join(calls, "\n"))
+}
+
+// shellQuoteAll single-quotes each word for use in a bash array
+func shellQuoteAll(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellUnquoteAll splits words written by shellQuoteAll
+func shellUnquoteAll(s string) ([]string, error) {
+	var words []string
+	for s != "" {
+		if s[0] != '\'' {
+			return nil, fmt.Errorf("unquoted word at %q", s)
+		}
+		s = s[1:]
+		var word strings.Builder
+		for {
+			end := strings.IndexByte(s, '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			word.WriteString(s[:end])
+			s = s[end+1:]
+			rest, ok := strings.CutPrefix(s, `\''`)
+			if !ok {
+				break
+			}
+			word.WriteByte('\'')
+			s = rest
+		}
+		words = append(words, word.String())
+
+		if s != "" {
+			rest, ok := strings.CutPrefix(s, " ")
+			if !ok || rest == "" {
+				return nil, fmt.Errorf("unexpected %q after a quoted word", s)
+			}
+			s = rest
+		}
+	}
+	return words, nil
+}
+
+// scriptCall is one call of a setup script function
+type scriptCall struct {
+	name string
+	args []string
+}
+
+// scriptCalls returns the calls of the named functions in a setup script, in
+// script order. Their arguments must be quoted as shellQuoteAll quotes them.
+func scriptCalls(content string, names ...string) ([]scriptCall, error) {
+	var calls []scriptCall
+	for _, line := range strings.Split(content, "\n") {
+		name, rest, _ := strings.Cut(line, " ")
+		if !slices.Contains(names, name) {
+			continue
+		}
+		args, err := shellUnquoteAll(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s call: %w", name, err)
+		}
+		calls = append(calls, scriptCall{name: name, args: args})
+	}
+	return calls, nil
+}
+
+// ParseQdiscSetupScript returns the targets of a script written by
+// GenerateQdiscSetupScript. Qdisc types and parameters are checked as for a profile.
+func ParseQdiscSetupScript(content string) ([]QdiscTarget, error) {
+	calls, err := scriptCalls(content, "set_qdisc")
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []QdiscTarget
+	for _, call := range calls {
+		if len(call.args) < 2 || call.args[0] == "" {
+			return nil, fmt.Errorf("set_qdisc needs an interface and a qdisc")
+		}
+		target := QdiscTarget{Interface: call.args[0], Type: call.args[1]}
+		flags := qdiscFlagParams[target.Type]
+		params := call.args[2:]
+		for i := 0; i < len(params); i++ {
+			if target.Params == nil {
+				target.Params = make(map[string]interface{})
+			}
+			if flags[params[i]] {
+				target.Params[params[i]] = true
+				continue
+			}
+			if i+1 == len(params) {
+				return nil, fmt.Errorf("qdisc parameter %s has no value", params[i])
+			}
+			target.Params[params[i]] = params[i+1]
+			i++
+		}
+		if err := checkQdiscParams(target.Type, target.Params); err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// ParseLinkSetupScript returns the targets of a script written by
+// GenerateLinkSetupScript, one per interface in script order
+func ParseLinkSetupScript(content string) ([]LinkTarget, error) {
+	calls, err := scriptCalls(content, "set_ip_link", "set_link")
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []LinkTarget
+	settings := make(map[string]*types.LinkSettings)
+	for _, call := range calls {
+		if len(call.args) == 0 {
+			return nil, fmt.Errorf("%s needs an interface", call.name)
+		}
+		iface := call.args[0]
+		if settings[iface] == nil {
+			settings[iface] = &types.LinkSettings{}
+			targets = append(targets, LinkTarget{Interface: iface, Settings: settings[iface]})
+		}
+		if err := parseLinkCall(settings[iface], call); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", call.name, iface, err)
+		}
+	}
+	return targets, nil
+}
+
+// parseLinkCall adds the settings of a set_ip_link or set_link call, whose
+// arguments are the interface and then IPLinkArgs or EthtoolArgs
+func parseLinkCall(settings *types.LinkSettings, call scriptCall) error {
+	iface := call.args[0]
+	var pairs []string
+	var set func(name, value string) error
+
+	switch {
+	case call.name == "set_ip_link" && len(call.args) >= 5 && slices.Equal(call.args[1:5], []string{"link", "set", "dev", iface}):
+		pairs = call.args[5:]
+		set = func(name, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q", name, value)
+			}
+			switch name {
+			case "mtu":
+				settings.MTU = &n
+			case "txqueuelen":
+				settings.TxQueueLen = &n
+			default:
+				return fmt.Errorf("unexpected ip link setting %s", name)
+			}
+			return nil
+		}
+	case call.name == "set_link" && len(call.args) >= 3 && call.args[2] == iface:
+		pairs = call.args[3:]
+		switch call.args[1] {
+		case "-K":
+			set = func(name, value string) error {
+				enabled, ok := parseLinkFlag(value)
+				if !ok {
+					return fmt.Errorf("invalid offload %s %q", name, value)
+				}
+				if settings.Offloads == nil {
+					settings.Offloads = make(map[string]bool)
+				}
+				settings.Offloads[name] = enabled
+				return nil
+			}
+		case "-G":
+			set = func(name, value string) error {
+				size, err := strconv.Atoi(value)
+				if err != nil {
+					return fmt.Errorf("invalid ring %s %q", name, value)
+				}
+				if settings.Rings == nil {
+					settings.Rings = make(map[string]int)
+				}
+				settings.Rings[name] = size
+				return nil
+			}
+		case "-C":
+			set = func(name, value string) error {
+				if settings.Coalesce == nil {
+					settings.Coalesce = make(map[string]interface{})
+				}
+				if enabled, ok := parseLinkFlag(value); ok {
+					settings.Coalesce[name] = enabled
+					return nil
+				}
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					return fmt.Errorf("invalid coalesce %s %q", name, value)
+				}
+				settings.Coalesce[name] = n
+				return nil
+			}
+		}
+	}
+	if set == nil {
+		return fmt.Errorf("unexpected arguments %q", call.args[1:])
+	}
+
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return fmt.Errorf("settings must come in name value pairs")
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		if err := set(pairs[i], pairs[i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseLinkFlag parses an ethtool "on" or "off"
+func parseLinkFlag(value string) (bool, bool) {
+	switch value {
+	case "on":
+		return true, true
+	case "off":
+		return false, true
+	}
+	return false, false
+}
+
+// ParseRouteSetupScript returns the targets of a script written by
+// GenerateRouteSetupScript
+func ParseRouteSetupScript(content string) ([]RouteTarget, error) {
+	calls, err := scriptCalls(content, "set_route")
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []RouteTarget
+	for _, call := range calls {
+		if len(call.args) < 2 || len(call.args)%2 != 0 {
+			return nil, fmt.Errorf("set_route needs a family, a destination and attribute value pairs")
+		}
+		target := RouteTarget{Family: call.args[0], Dest: call.args[1], Attrs: &types.RouteAttrs{}}
+		if !slices.Contains(RouteFamilies, target.Family) {
+			return nil, fmt.Errorf("unknown route family %q", target.Family)
+		}
+		if target.Dest != "default" {
+			if family, err := RouteFamily(target.Dest); err != nil || family != target.Family {
+				return nil, fmt.Errorf("invalid %s route destination %q", target.Family, target.Dest)
+			}
+		}
+		for i := 2; i < len(call.args); i += 2 {
+			name, value := call.args[i], call.args[i+1]
+			switch name {
+			case "initcwnd", "initrwnd":
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s %q", name, value)
+				}
+				if name == "initcwnd" {
+					target.Attrs.InitCwnd = &n
+				} else {
+					target.Attrs.InitRwnd = &n
+				}
+			case "congctl":
+				target.Attrs.CongCtl = value
+			default:
+				return nil, fmt.Errorf("unexpected route attribute %s", name)
+			}
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
 }
@@ -0,0 +1,261 @@
+package adapter
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+)
+
+func TestGenerateQdiscSetupScript(t *testing.T) {
+	script := GenerateQdiscSetupScript([]QdiscTarget{
+		{Interface: "eth0", Type: "cake", Params: map[string]interface{}{"bandwidth": "100mbit", "besteffort": true, "nat": false}},
+		{Interface: "wg0", Type: "fq_codel"},
+	})
+
+	for _, want := range []string{
+		"set_qdisc 'eth0' 'cake' 'bandwidth' '100mbit' 'besteffort'\n",
+		"set_qdisc 'wg0' 'fq_codel'\n",
+		`tc qdisc replace dev "$iface" root "$@"`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q:\n%s", want, script)
+		}
+	}
+
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	path := filepath.Join(t.TempDir(), "setup.sh")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if output, err := exec.Command("bash", "-n", path).CombinedOutput(); err != nil {
+		t.Errorf("script has syntax errors: %v\n%s", err, output)
+	}
+}
+
+func TestGenerateQdiscSetupScript_Run(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	if _, err := os.Stat("/sys/class/net/lo"); err != nil {
+		t.Skip("loopback interface not visible")
+	}
+
+	// A fake tc records its arguments instead of changing the host
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "tc.log")
+	fakeTC := "#!/bin/bash\necho \"$@\" >> " + logPath + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "tc"), []byte(fakeTC), 0755); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "setup.sh")
+	content := GenerateQdiscSetupScript([]QdiscTarget{
+		{Interface: "lo", Type: "fq", Params: map[string]interface{}{"flow_limit": float64(200)}},
+		{Interface: "nettune-missing0", Type: "fq"},
+	})
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("bash", script)
+	cmd.Env = append(os.Environ(), "PATH="+dir+":"+os.Getenv("PATH"), "NETTUNE_QDISC_WAIT=1")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("script failed: %v\n%s", err, output)
+	} else if !strings.Contains(string(output), "interface nettune-missing0 not found") {
+		t.Errorf("missing interface should be reported, got %q", output)
+	}
+
+	got, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "qdisc replace dev lo root fq flow_limit 200\n"; string(got) != want {
+		t.Errorf("tc called with %q, want %q", got, want)
+	}
+}
+
+func TestGenerateLinkSetupScript_Run(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	if _, err := os.Stat("/sys/class/net/lo"); err != nil {
+		t.Skip("loopback interface not visible")
+	}
+
+	// A fake ethtool records its arguments and reports unchanged rings with status 80
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "ethtool.log")
+	fakeEthtool := "#!/bin/bash\necho \"$@\" >> " + logPath + "\n[ \"$1\" = -G ] && exit 80\nexit 0\n"
+	if err := os.WriteFile(filepath.Join(dir, "ethtool"), []byte(fakeEthtool), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ipLogPath := filepath.Join(dir, "ip.log")
+	fakeIP := "#!/bin/bash\necho \"$@\" >> " + ipLogPath + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "ip"), []byte(fakeIP), 0755); err != nil {
+		t.Fatal(err)
+	}
+	mtu, qlen := 9000, 500
+	script := filepath.Join(dir, "setup.sh")
+	content := GenerateLinkSetupScript([]LinkTarget{
+		{Interface: "lo", Settings: &types.LinkSettings{
+			MTU:        &mtu,
+			TxQueueLen: &qlen,
+			Offloads:   map[string]bool{"generic-receive-offload": false, "tso": true},
+			Rings:      map[string]int{"tx": 512, "rx": 1024},
+			Coalesce:   map[string]interface{}{"adaptive-rx": true, "rx-usecs": float64(50)},
+		}},
+		{Interface: "nettune-missing0", Settings: &types.LinkSettings{Offloads: map[string]bool{"gro": true}}},
+	})
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("bash", script)
+	cmd.Env = append(os.Environ(), "PATH="+dir+":"+os.Getenv("PATH"), "NETTUNE_LINK_WAIT=1")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("script failed: %v\n%s", err, output)
+	} else if !strings.Contains(string(output), "interface nettune-missing0 not found") {
+		t.Errorf("missing interface should be reported, got %q", output)
+	}
+
+	got, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "-K lo gro off tso on\n-G lo rx 1024 tx 512\n-C lo adaptive-rx on rx-usecs 50\n"
+	if string(got) != want {
+		t.Errorf("ethtool called with %q, want %q", got, want)
+	}
+
+	got, err = os.ReadFile(ipLogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "link set dev lo mtu 9000 txqueuelen 500\n"; string(got) != want {
+		t.Errorf("ip called with %q, want %q", got, want)
+	}
+}
+
+func TestGenerateRouteSetupScript_Run(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	// A fake ip prints one IPv4 default route and records route changes
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "ip.log")
+	fakeIP := `#!/bin/bash
+if [ "$4" = show ]; then
+    if [ "$2" = inet ] && [ "$8" = default ]; then
+        echo "default via 192.0.2.1 dev eth0 proto dhcp metric 100 linkdown initcwnd 4 initrwnd 8"
+    fi
+    exit 0
+fi
+echo "$@" >> ` + logPath + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "ip"), []byte(fakeIP), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cwnd := 10
+	script := filepath.Join(dir, "setup.sh")
+	content := GenerateRouteSetupScript([]RouteTarget{
+		{Family: RouteFamilyIPv4, Dest: "default", Attrs: &types.RouteAttrs{InitCwnd: &cwnd, CongCtl: "bbr"}},
+		{Family: RouteFamilyIPv6, Dest: "2001:db8::/32", Attrs: &types.RouteAttrs{InitCwnd: &cwnd}},
+	})
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("bash", script)
+	cmd.Env = append(os.Environ(), "PATH="+dir+":"+os.Getenv("PATH"), "NETTUNE_ROUTE_WAIT=1")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("script failed: %v\n%s", err, output)
+	} else if !strings.Contains(string(output), "no inet6 route to 2001:db8::/32") {
+		t.Errorf("missing route should be reported, got %q", output)
+	}
+
+	got, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "-family inet route change default via 192.0.2.1 dev eth0 proto dhcp metric 100 initrwnd 8 initcwnd 10 congctl bbr\n"
+	if string(got) != want {
+		t.Errorf("ip called with %q, want %q", got, want)
+	}
+}
+
+func TestShellQuoteAll(t *testing.T) {
+	if got := shellQuoteAll([]string{"a b", "it's"}); got != `'a b' 'it'\''s'` {
+		t.Errorf("shellQuoteAll() = %s", got)
+	}
+}
+
+func TestParseSetupScripts(t *testing.T) {
+	mtu, cwnd := 9000, 20
+	qdisc := GenerateQdiscSetupScript([]QdiscTarget{
+		{Interface: "eth0", Type: "cake", Params: map[string]interface{}{"bandwidth": "100mbit", "besteffort": true}},
+		{Interface: "it's", Type: "fq_codel"},
+	})
+	link := GenerateLinkSetupScript([]LinkTarget{{Interface: "eth0", Settings: &types.LinkSettings{
+		MTU:      &mtu,
+		Offloads: map[string]bool{"gro": false, "tso": true},
+		Rings:    map[string]int{"rx": 4096},
+		Coalesce: map[string]interface{}{"adaptive-rx": true, "rx-usecs": 8},
+	}}})
+	route := GenerateRouteSetupScript([]RouteTarget{
+		{Family: RouteFamilyIPv4, Dest: "default", Attrs: &types.RouteAttrs{InitCwnd: &cwnd, CongCtl: "bbr"}},
+		{Family: RouteFamilyIPv6, Dest: "2001:db8::/64", Attrs: &types.RouteAttrs{InitRwnd: &cwnd}},
+	})
+
+	qdiscTargets, err := ParseQdiscSetupScript(qdisc)
+	if err != nil || GenerateQdiscSetupScript(qdiscTargets) != qdisc {
+		t.Errorf("qdisc script did not round-trip: %+v, %v", qdiscTargets, err)
+	}
+	linkTargets, err := ParseLinkSetupScript(link)
+	if err != nil || GenerateLinkSetupScript(linkTargets) != link {
+		t.Errorf("link script did not round-trip: %+v, %v", linkTargets, err)
+	}
+	routeTargets, err := ParseRouteSetupScript(route)
+	if err != nil || GenerateRouteSetupScript(routeTargets) != route {
+		t.Errorf("route script did not round-trip: %+v, %v", routeTargets, err)
+	}
+
+	for name, parse := range map[string]func() error{
+		"unquoted qdisc":   func() error { _, err := ParseQdiscSetupScript("set_qdisc eth0 fq\n"); return err },
+		"no interface":     func() error { _, err := ParseQdiscSetupScript("set_qdisc '' 'fq'\n"); return err },
+		"unknown qdisc":    func() error { _, err := ParseQdiscSetupScript("set_qdisc 'eth0' 'netem'\n"); return err },
+		"qdisc parameter":  func() error { _, err := ParseQdiscSetupScript("set_qdisc 'eth0' 'fq' 'limit'\n"); return err },
+		"command in quote": func() error { _, err := ParseQdiscSetupScript("set_qdisc 'eth0' 'fq'; reboot\n"); return err },
+		"ip subcommand": func() error {
+			_, err := ParseLinkSetupScript("set_ip_link 'eth0' 'netns' 'exec' 'x' 'sh'\n")
+			return err
+		},
+		"ethtool option": func() error { _, err := ParseLinkSetupScript("set_link 'eth0' '-f' 'eth0' 'fw.bin' '0'\n"); return err },
+		"route family": func() error {
+			_, err := ParseRouteSetupScript("set_route 'link' 'default' 'initcwnd' '10'\n")
+			return err
+		},
+		"route attribute": func() error {
+			_, err := ParseRouteSetupScript("set_route 'inet' 'default' 'via' '192.0.2.99'\n")
+			return err
+		},
+	} {
+		if err := parse(); err == nil {
+			t.Errorf("%s: parse succeeded, want an error", name)
+		}
+	}
+}
+
+func TestGenerateQdiscServiceUnit(t *testing.T) {
+	unit := GenerateQdiscServiceUnit()
+	for _, want := range []string{"After=network-online.target", "Wants=network-online.target", "ExecStart=" + NettuneQdiscScriptPath} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("unit missing %q:\n%s", want, unit)
+		}
+	}
+}
@@ -63,7 +63,11 @@ type CreateProfileRequest struct {
 	RequiresReboot bool                   `json:"requires_reboot,omitempty"`
 	Sysctl         map[string]interface{} `json:"sysctl,omitempty"`
 	Qdisc          *types.QdiscConfig     `json:"qdisc,omitempty"`
+	Link           *types.LinkConfig      `json:"link,omitempty"`
+	Steering       *types.SteeringConfig  `json:"steering,omitempty"`
+	Routes         *types.RouteConfig     `json:"routes,omitempty"`
 	Systemd        *types.SystemdConfig   `json:"systemd,omitempty"`
+	KernelModules  []string               `json:"kernel_modules,omitempty"`
 }
 
 // Create handles POST /profiles
@@ -83,7 +87,11 @@ func (h *ProfileHandler) Create(c *gin.Context) {
 		RequiresReboot: req.RequiresReboot,
 		Sysctl:         req.Sysctl,
 		Qdisc:          req.Qdisc,
+		Link:           req.Link,
+		Steering:       req.Steering,
+		Routes:         req.Routes,
 		Systemd:        req.Systemd,
+		KernelModules:  req.KernelModules,
 	}
 
 	// Save profile (validation happens inside Save)
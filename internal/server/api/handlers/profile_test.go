@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jtsang4/nettune/internal/server/service"
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"go.uber.org/zap"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestCreateProfileKeepsAllSections(t *testing.T) {
+	profiles, err := service.NewProfileService(t.TempDir(), zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewProfileService failed: %v", err)
+	}
+	handler := NewProfileHandler(profiles)
+	router := gin.New()
+	router.POST("/profiles", handler.Create)
+	router.GET("/profiles/:id", handler.Get)
+
+	body := `{
+		"id": "every-section",
+		"name": "Every section",
+		"risk_level": "medium",
+		"sysctl": {"net.ipv4.tcp_congestion_control": "bbr"},
+		"qdisc": {"type": "fq", "interfaces": "default-route"},
+		"link": {"interfaces": "eth0", "mtu": 9000, "offloads": {"gro": false}},
+		"steering": {"interfaces": "eth0", "rps_cpus": "f", "irq_affinity": "spread"},
+		"routes": {"default": {"initcwnd": 20, "congctl": "bbr"}},
+		"systemd": {"ensure_qdisc_service": true},
+		"kernel_modules": ["tcp_bbr", "sch_fq"]
+	}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/profiles", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /profiles = %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profiles/every-section", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /profiles/every-section = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data types.Profile `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	var want types.Profile
+	if err := json.Unmarshal([]byte(body), &want); err != nil {
+		t.Fatal(err)
+	}
+	got := resp.Data
+	sections := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"sysctl", got.Sysctl, want.Sysctl},
+		{"qdisc", got.Qdisc, want.Qdisc},
+		{"link", got.Link, want.Link},
+		{"steering", got.Steering, want.Steering},
+		{"routes", got.Routes, want.Routes},
+		{"systemd", got.Systemd, want.Systemd},
+		{"kernel_modules", got.KernelModules, want.KernelModules},
+	}
+	for _, section := range sections {
+		if !reflect.DeepEqual(section.got, section.want) {
+			gotJSON, _ := json.Marshal(section.got)
+			wantJSON, _ := json.Marshal(section.want)
+			t.Errorf("%s = %s, want %s", section.name, gotJSON, wantJSON)
+		}
+	}
+}
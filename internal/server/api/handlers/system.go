@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jtsang4/nettune/internal/server/service"
@@ -12,23 +17,48 @@ import (
 type SystemHandler struct {
 	snapshotService *service.SnapshotService
 	applyService    *service.ApplyService
+	jobService      *service.JobService
 }
 
 // NewSystemHandler creates a new SystemHandler
 func NewSystemHandler(
 	snapshotService *service.SnapshotService,
 	applyService *service.ApplyService,
+	jobService *service.JobService,
 ) *SystemHandler {
 	return &SystemHandler{
 		snapshotService: snapshotService,
 		applyService:    applyService,
+		jobService:      jobService,
 	}
 }
 
 // CreateSnapshot handles POST /sys/snapshot
 func (h *SystemHandler) CreateSnapshot(c *gin.Context) {
-	snapshot, err := h.snapshotService.Create()
+	var req types.SnapshotRequest
+	// The body is optional; an empty request captures the tracked keys
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			badRequest(c, err.Error())
+			return
+		}
+	}
+
+	snapshot, err := h.snapshotService.Create(&service.SnapshotOptions{
+		Full:  req.Full,
+		Pin:   req.Pin,
+		Label: req.Label,
+		Note:  req.Note,
+		Provenance: &types.SnapshotProvenance{
+			Reason:   types.SnapshotReasonManual,
+			ClientIP: clientIP(c),
+		},
+	})
 	if err != nil {
+		if errors.Is(err, types.ErrValidationFailed) {
+			badRequest(c, err.Error())
+			return
+		}
 		internalError(c, err.Error())
 		return
 	}
@@ -36,6 +66,8 @@ func (h *SystemHandler) CreateSnapshot(c *gin.Context) {
 	success(c, gin.H{
 		"snapshot_id":   snapshot.ID,
 		"current_state": snapshot.State,
+		"pinned":        snapshot.Pinned,
+		"label":         snapshot.Label,
 	})
 }
 
@@ -60,9 +92,124 @@ func (h *SystemHandler) GetSnapshot(c *gin.Context) {
 	success(c, snapshot)
 }
 
-// ListSnapshots handles GET /sys/snapshots
+// DeleteSnapshot handles DELETE /sys/snapshot/:id
+func (h *SystemHandler) DeleteSnapshot(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.snapshotService.Delete(id); err != nil {
+		h.snapshotError(c, err)
+		return
+	}
+
+	success(c, gin.H{
+		"snapshot_id": id,
+		"deleted":     true,
+	})
+}
+
+// DiffSnapshot handles GET /sys/snapshot/:id/diff?against=<id|current>
+func (h *SystemHandler) DiffSnapshot(c *gin.Context) {
+	diff, err := h.snapshotService.Diff(c.Param("id"), c.DefaultQuery("against", types.SnapshotCurrent))
+	if err != nil {
+		h.snapshotError(c, err)
+		return
+	}
+
+	success(c, diff)
+}
+
+// ExportSnapshot handles GET /sys/snapshot/:id/export, returning a tar.gz archive
+func (h *SystemHandler) ExportSnapshot(c *gin.Context) {
+	id := c.Param("id")
+	var archive bytes.Buffer
+	if err := h.snapshotService.Export(id, &archive); err != nil {
+		h.snapshotError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="nettune-snapshot-%s.tar.gz"`, id))
+	c.Data(http.StatusOK, "application/gzip", archive.Bytes())
+}
+
+// ImportSnapshot handles POST /sys/snapshot/import. The body is an archive from
+// ExportSnapshot; ?label=, ?note= and ?pin=true annotate the imported snapshot.
+func (h *SystemHandler) ImportSnapshot(c *gin.Context) {
+	pin, err := strconv.ParseBool(c.DefaultQuery("pin", "false"))
+	if err != nil {
+		badRequest(c, "pin must be true or false")
+		return
+	}
+
+	snapshot, err := h.snapshotService.Import(c.Request.Body, &service.SnapshotOptions{
+		Pin:        pin,
+		Label:      c.Query("label"),
+		Note:       c.Query("note"),
+		Provenance: &types.SnapshotProvenance{ClientIP: clientIP(c)},
+	})
+	if err != nil {
+		h.snapshotError(c, err)
+		return
+	}
+
+	success(c, snapshot.ToMeta())
+}
+
+// PinSnapshot handles PUT /sys/snapshot/:id/pin
+func (h *SystemHandler) PinSnapshot(c *gin.Context) {
+	h.setPinned(c, true)
+}
+
+// UnpinSnapshot handles DELETE /sys/snapshot/:id/pin
+func (h *SystemHandler) UnpinSnapshot(c *gin.Context) {
+	h.setPinned(c, false)
+}
+
+func (h *SystemHandler) setPinned(c *gin.Context, pinned bool) {
+	meta, err := h.snapshotService.SetPinned(c.Param("id"), pinned)
+	if err != nil {
+		h.snapshotError(c, err)
+		return
+	}
+
+	success(c, meta)
+}
+
+// snapshotError maps snapshot service errors to responses
+func (h *SystemHandler) snapshotError(c *gin.Context, err error) {
+	if errors.Is(err, types.ErrSnapshotNotFound) {
+		notFound(c, "snapshot not found")
+		return
+	}
+	if errors.Is(err, types.ErrSnapshotProtected) {
+		errorResponse(c, 409, types.ErrCodeSnapshotProtected, err.Error())
+		return
+	}
+	if errors.Is(err, types.ErrValidationFailed) {
+		badRequest(c, err.Error())
+		return
+	}
+	internalError(c, err.Error())
+}
+
+// ListSnapshots handles GET /sys/snapshots, optionally filtered by
+// ?label=, ?profile=, ?reason=, ?client_ip=, ?q= and ?pinned=true
 func (h *SystemHandler) ListSnapshots(c *gin.Context) {
-	snapshots, err := h.snapshotService.List()
+	filter := &types.SnapshotFilter{
+		Label:     c.Query("label"),
+		ProfileID: c.Query("profile"),
+		Reason:    c.Query("reason"),
+		ClientIP:  c.Query("client_ip"),
+		Query:     c.Query("q"),
+	}
+	if pinned := c.Query("pinned"); pinned != "" {
+		value, err := strconv.ParseBool(pinned)
+		if err != nil {
+			badRequest(c, "invalid pinned parameter")
+			return
+		}
+		filter.Pinned = value
+	}
+
+	snapshots, err := h.snapshotService.ListMatching(filter)
 	if err != nil {
 		internalError(c, err.Error())
 		return
@@ -87,16 +234,107 @@ func (h *SystemHandler) Apply(c *gin.Context) {
 		return
 	}
 
-	result, err := h.applyService.Apply(&req)
+	// Record the address the client reached us on, so the apply can tell
+	// which interface carries this connection
+	if addr, ok := c.Request.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+			req.Origin = host
+		}
+	}
+	req.ClientIP = clientIP(c)
+
+	job, err := h.jobService.SubmitApply(&req)
 	if err != nil {
 		if errors.Is(err, types.ErrProfileNotFound) {
 			notFound(c, "profile not found")
 			return
 		}
 		if errors.Is(err, types.ErrApplyInProgress) {
+			if running := h.jobService.Running(); running != "" {
+				errorResponseWithDetails(c, 409, types.ErrCodeApplyInProgress, "another apply operation is in progress",
+					fmt.Sprintf("running job: %s", running))
+				return
+			}
 			errorResponse(c, 409, types.ErrCodeApplyInProgress, "another apply operation is in progress")
 			return
 		}
+		if errors.Is(err, types.ErrConfirmPending) {
+			errorResponse(c, 409, types.ErrCodeConfirmPending, "a previous apply is awaiting confirmation; confirm or roll it back first")
+			return
+		}
+		if errors.Is(err, types.ErrRecoveryPending) {
+			errorResponse(c, 409, types.ErrCodeRecoveryPending, "an interrupted apply was found at startup; roll back to its snapshot first")
+			return
+		}
+		if errors.Is(err, types.ErrValidationFailed) {
+			badRequest(c, err.Error())
+			return
+		}
+		internalError(c, err.Error())
+		return
+	}
+
+	if req.Async {
+		c.JSON(202, gin.H{"success": true, "data": job})
+		return
+	}
+
+	job, err = h.jobService.Wait(job.ID)
+	if err != nil {
+		internalError(c, err.Error())
+		return
+	}
+	if job.Result == nil {
+		internalError(c, job.Error)
+		return
+	}
+
+	success(c, job.Result)
+}
+
+// GetJob handles GET /sys/jobs/:id
+func (h *SystemHandler) GetJob(c *gin.Context) {
+	job, err := h.jobService.Get(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, types.ErrJobNotFound) {
+			errorResponse(c, 404, types.ErrCodeJobNotFound, "job not found")
+			return
+		}
+		internalError(c, err.Error())
+		return
+	}
+
+	success(c, job)
+}
+
+// ListJobs handles GET /sys/jobs
+func (h *SystemHandler) ListJobs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 0 {
+		badRequest(c, "invalid limit parameter")
+		return
+	}
+
+	success(c, gin.H{"jobs": h.jobService.List(limit)})
+}
+
+// Confirm handles POST /sys/confirm
+func (h *SystemHandler) Confirm(c *gin.Context) {
+	var req types.ConfirmRequest
+	// The body is optional; an empty request confirms whatever is pending
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			badRequest(c, err.Error())
+			return
+		}
+	}
+
+	result, err := h.applyService.Confirm(req.SnapshotID)
+	if err != nil {
+		if errors.Is(err, types.ErrNoPendingRollback) {
+			errorResponse(c, 404, types.ErrCodeNoPendingRollback, err.Error())
+			return
+		}
 		internalError(c, err.Error())
 		return
 	}
@@ -112,10 +350,19 @@ func (h *SystemHandler) Rollback(c *gin.Context) {
 		return
 	}
 
-	var err error
 	var snapshotID string
-
-	if req.RollbackLast {
+	if req.RollbackBaseline || req.SnapshotID == types.SnapshotBaseline {
+		snapshot, getErr := h.snapshotService.GetBaseline()
+		if getErr != nil {
+			if errors.Is(getErr, types.ErrSnapshotNotFound) {
+				notFound(c, "no baseline snapshot on this host")
+				return
+			}
+			internalError(c, getErr.Error())
+			return
+		}
+		snapshotID = snapshot.ID
+	} else if req.RollbackLast {
 		snapshot, getErr := h.snapshotService.GetLatest()
 		if getErr != nil {
 			if errors.Is(getErr, types.ErrSnapshotNotFound) {
@@ -126,20 +373,22 @@ func (h *SystemHandler) Rollback(c *gin.Context) {
 			return
 		}
 		snapshotID = snapshot.ID
-		err = h.applyService.Rollback(snapshotID)
 	} else if req.SnapshotID != "" {
 		snapshotID = req.SnapshotID
-		err = h.applyService.Rollback(snapshotID)
 	} else {
-		badRequest(c, "either snapshot_id or rollback_last is required")
+		badRequest(c, "one of snapshot_id, rollback_last or rollback_baseline is required")
 		return
 	}
 
-	if err != nil {
+	if err := h.applyService.RollbackMapped(snapshotID, req.InterfaceMap); err != nil {
 		if errors.Is(err, types.ErrSnapshotNotFound) {
 			notFound(c, "snapshot not found")
 			return
 		}
+		if errors.Is(err, types.ErrValidationFailed) {
+			badRequest(c, err.Error())
+			return
+		}
 		if errors.Is(err, types.ErrApplyInProgress) {
 			errorResponse(c, 409, types.ErrCodeApplyInProgress, "another operation is in progress")
 			return
@@ -169,6 +418,16 @@ func (h *SystemHandler) Status(c *gin.Context) {
 	success(c, status)
 }
 
+// clientIP returns the peer address of a request for snapshot provenance.
+// Forwarding headers are not trusted.
+func clientIP(c *gin.Context) string {
+	return c.RemoteIP()
+}
+
 func errorResponse(c *gin.Context, statusCode int, code, message string) {
 	c.JSON(statusCode, gin.H{"success": false, "error": gin.H{"code": code, "message": message}})
 }
+
+func errorResponseWithDetails(c *gin.Context, statusCode int, code, message, details string) {
+	c.JSON(statusCode, gin.H{"success": false, "error": gin.H{"code": code, "message": message, "details": details}})
+}
@@ -26,6 +26,7 @@ type Server struct {
 	snapshotService *service.SnapshotService
 	historyService  *service.HistoryService
 	applyService    *service.ApplyService
+	jobService      *service.JobService
 	probeService    *service.ProbeService
 }
 
@@ -36,6 +37,15 @@ func NewServer(cfg *config.ServerConfig, logger *zap.Logger) (*Server, error) {
 
 	// Create system adapter
 	systemAdapter := adapter.NewSystemAdapter(logger)
+	if cfg.Simulate {
+		fake, err := adapter.NewFakeSystemAdapter(cfg.GetSimulateRootDir(), logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create simulated system: %w", err)
+		}
+		systemAdapter = fake
+		logger.Warn("simulate mode: changes are applied to an emulated host, not this system",
+			zap.String("root", cfg.GetSimulateRootDir()))
+	}
 
 	// Create services
 	profileService, err := service.NewProfileService(cfg.GetProfilesDir(), logger)
@@ -53,14 +63,39 @@ func NewServer(cfg *config.ServerConfig, logger *zap.Logger) (*Server, error) {
 		return nil, fmt.Errorf("failed to create history service: %w", err)
 	}
 
+	snapshotService.SetRetention(service.SnapshotRetention{
+		MaxCount:    cfg.SnapshotMaxCount,
+		MaxAge:      cfg.SnapshotMaxAge,
+		KeepApplies: cfg.SnapshotKeepApplies,
+	}, historyService)
+
 	applyService := service.NewApplyService(
 		profileService,
 		snapshotService,
 		historyService,
 		systemAdapter,
+		cfg.StateDir,
 		logger,
 	)
 
+	// Recover from an apply that was cut short by a crash
+	if err := applyService.RecoverInterruptedApply(cfg.AutoRecover); err != nil {
+		logger.Error("failed to recover interrupted apply", zap.Error(err))
+	}
+
+	// Re-arm an auto-rollback that was pending when the server last stopped
+	if err := applyService.ResumePendingRollback(); err != nil {
+		logger.Error("failed to resume pending auto-rollback", zap.Error(err))
+	}
+
+	// Record the pristine configuration the first time the server runs on this
+	// host, once recovery and auto-rollback hold the snapshots they need
+	if _, err := snapshotService.EnsureBaseline(); err != nil {
+		logger.Error("failed to record baseline snapshot", zap.Error(err))
+	}
+
+	jobService := service.NewJobService(applyService, logger)
+
 	probeService := service.NewProbeService(systemAdapter, logger)
 
 	s := &Server{
@@ -71,6 +106,7 @@ func NewServer(cfg *config.ServerConfig, logger *zap.Logger) (*Server, error) {
 		snapshotService: snapshotService,
 		historyService:  historyService,
 		applyService:    applyService,
+		jobService:      jobService,
 		probeService:    probeService,
 	}
 
@@ -103,7 +139,7 @@ func (s *Server) setupRouter() {
 	// Create handlers
 	probeHandler := handlers.NewProbeHandler(s.probeService)
 	profileHandler := handlers.NewProfileHandler(s.profileService)
-	systemHandler := handlers.NewSystemHandler(s.snapshotService, s.applyService)
+	systemHandler := handlers.NewSystemHandler(s.snapshotService, s.applyService, s.jobService)
 
 	// Probe endpoints
 	probe := authorized.Group("/probe")
@@ -127,8 +163,17 @@ func (s *Server) setupRouter() {
 	{
 		sys.POST("/snapshot", systemHandler.CreateSnapshot)
 		sys.GET("/snapshot/:id", systemHandler.GetSnapshot)
+		sys.DELETE("/snapshot/:id", systemHandler.DeleteSnapshot)
+		sys.GET("/snapshot/:id/diff", systemHandler.DiffSnapshot)
+		sys.GET("/snapshot/:id/export", systemHandler.ExportSnapshot)
+		sys.POST("/snapshot/import", systemHandler.ImportSnapshot)
+		sys.PUT("/snapshot/:id/pin", systemHandler.PinSnapshot)
+		sys.DELETE("/snapshot/:id/pin", systemHandler.UnpinSnapshot)
 		sys.GET("/snapshots", systemHandler.ListSnapshots)
 		sys.POST("/apply", systemHandler.Apply)
+		sys.GET("/jobs", systemHandler.ListJobs)
+		sys.GET("/jobs/:id", systemHandler.GetJob)
+		sys.POST("/confirm", systemHandler.Confirm)
 		sys.POST("/rollback", systemHandler.Rollback)
 		sys.GET("/status", systemHandler.Status)
 	}
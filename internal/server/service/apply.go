@@ -3,24 +3,33 @@ package service
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/jtsang4/nettune/internal/server/adapter"
 	"github.com/jtsang4/nettune/internal/shared/types"
+	"github.com/jtsang4/nettune/internal/shared/utils"
 	"go.uber.org/zap"
 )
 
 // ApplyService handles profile application and rollback
 type ApplyService struct {
-	profileService  *ProfileService
-	snapshotService *SnapshotService
-	historyService  *HistoryService
-	adapter         *adapter.SystemAdapter
-	mu              sync.Mutex
-	applyLock       bool
-	logger          *zap.Logger
+	profileService   *ProfileService
+	snapshotService  *SnapshotService
+	historyService   *HistoryService
+	adapter          *adapter.SystemAdapter
+	stateDir         string
+	mu               sync.Mutex
+	applyLock        bool
+	pending          *types.PendingRollback
+	pendingTimer     *time.Timer
+	lastAutoRollback *types.AutoRollbackInfo
+	recovery         *types.RecoveryInfo
+	logger           *zap.Logger
 }
 
 // NewApplyService creates a new ApplyService
@@ -29,6 +38,7 @@ func NewApplyService(
 	snapshotService *SnapshotService,
 	historyService *HistoryService,
 	adapter *adapter.SystemAdapter,
+	stateDir string,
 	logger *zap.Logger,
 ) *ApplyService {
 	return &ApplyService{
@@ -36,25 +46,59 @@ func NewApplyService(
 		snapshotService: snapshotService,
 		historyService:  historyService,
 		adapter:         adapter,
+		stateDir:        stateDir,
 		logger:          logger,
 	}
 }
 
 // Apply applies a profile
 func (s *ApplyService) Apply(req *types.ApplyRequest) (*types.ApplyResult, error) {
+	if err := s.acquireApplyLock(); err != nil {
+		return nil, err
+	}
+	defer s.releaseApplyLock()
+
+	profile, err := s.prepareApply(req)
+	if err != nil {
+		return nil, err
+	}
+	return s.applyLocked(req, profile, nil)
+}
+
+// acquireApplyLock reserves the system for one apply or rollback at a time
+func (s *ApplyService) acquireApplyLock() error {
 	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.applyLock {
-		s.mu.Unlock()
-		return nil, types.ErrApplyInProgress
+		return types.ErrApplyInProgress
 	}
 	s.applyLock = true
+	return nil
+}
+
+// releaseApplyLock frees the lock taken by acquireApplyLock
+func (s *ApplyService) releaseApplyLock() {
+	s.mu.Lock()
+	s.applyLock = false
 	s.mu.Unlock()
+}
 
-	defer func() {
-		s.mu.Lock()
-		s.applyLock = false
-		s.mu.Unlock()
-	}()
+// prepareApply checks that the request may run and loads its profile (caller must hold lock)
+func (s *ApplyService) prepareApply(req *types.ApplyRequest) (*types.Profile, error) {
+	// Refuse to stack a new commit on top of one that may still be reverted
+	if req.Mode == "commit" && s.GetPendingRollback() != nil {
+		return nil, types.ErrConfirmPending
+	}
+
+	// The host may still be half-configured from an apply that crashed
+	if req.Mode == "commit" && s.recoveryPending() {
+		return nil, types.ErrRecoveryPending
+	}
+
+	if err := ValidateSnapshotAnnotations(req.SnapshotLabel, req.SnapshotNote); err != nil {
+		return nil, err
+	}
 
 	// Get profile
 	profile, err := s.profileService.Get(req.ProfileID)
@@ -67,8 +111,21 @@ func (s *ApplyService) Apply(req *types.ApplyRequest) (*types.ApplyResult, error
 		return nil, err
 	}
 
-	// Get current state for plan generation
-	currentState, err := s.snapshotService.GetCurrentState()
+	return profile, nil
+}
+
+// applyLocked plans and, for commits, applies a prepared profile (caller must hold lock).
+// progress, if set, is called as each step starts.
+func (s *ApplyService) applyLocked(req *types.ApplyRequest, profile *types.Profile, progress func(step string)) (*types.ApplyResult, error) {
+	report := func(step string) {
+		if progress != nil {
+			progress(step)
+		}
+	}
+
+	// Get current state for plan generation, including every key the profile touches
+	profileKeys := profileSysctlKeys(profile)
+	currentState, err := s.snapshotService.GetCurrentState(profileKeys...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get current state: %w", err)
 	}
@@ -81,52 +138,119 @@ func (s *ApplyService) Apply(req *types.ApplyRequest) (*types.ApplyResult, error
 		ProfileID: req.ProfileID,
 		Plan:      plan,
 	}
+	for _, conflict := range plan.SysctlConflicts {
+		result.Warnings = append(result.Warnings, conflictWarning(conflict))
+	}
+	blocking, notices := preflightProblems("sysctl", plan.Preflight)
+	result.Warnings = append(result.Warnings, notices...)
+	moduleBlocking, _ := preflightProblems("kernel module", plan.ModulePreflight)
+	blocking = append(blocking, moduleBlocking...)
+	if plan.QdiscError != "" {
+		blocking = append(blocking, "qdisc: "+plan.QdiscError)
+	}
+	if plan.LinkError != "" {
+		blocking = append(blocking, "link: "+plan.LinkError)
+	}
+	linkBlocking, _ := preflightProblems("link setting", plan.LinkPreflight)
+	blocking = append(blocking, linkBlocking...)
+	if problem := s.originMTUProblem(req, plan); problem != "" {
+		blocking = append(blocking, problem)
+	}
+	routeBlocking, _ := preflightProblems("route", plan.RoutePreflight)
+	blocking = append(blocking, routeBlocking...)
+	if plan.SteeringError != "" {
+		blocking = append(blocking, "steering: "+plan.SteeringError)
+	}
+	result.Warnings = append(result.Warnings, s.steeringWarnings(profile.Steering)...)
 
 	// For dry_run, just return the plan
 	if req.Mode == "dry_run" {
+		result.Warnings = append(result.Warnings, blocking...)
 		result.Success = true
 		return result, nil
 	}
 
+	// Keys that cannot be written would fail mid-apply and force a rollback
+	if len(blocking) > 0 {
+		result.Errors = append(blocking, "commit aborted by preflight; no changes were made")
+		result.Success = false
+		return result, nil
+	}
+
 	// For commit mode, create snapshot first
-	snapshot, err := s.snapshotService.Create()
+	report(applyStepSnapshot)
+	snapshot, err := s.snapshotService.Create(&SnapshotOptions{
+		SysctlKeys: profileKeys,
+		Hold:       snapshotHoldApply,
+		Label:      req.SnapshotLabel,
+		Note:       req.SnapshotNote,
+		Provenance: &types.SnapshotProvenance{
+			Reason:    types.SnapshotReasonApply,
+			ProfileID: profile.ID,
+			ClientIP:  req.ClientIP,
+		},
+		Scope: planScope(plan),
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create snapshot: %w", err)
 	}
+	// An armed auto-rollback or an interrupted apply takes over the hold
+	defer s.snapshotService.release(snapshot.ID, snapshotHoldApply)
 	result.SnapshotID = snapshot.ID
 
+	// Record the intent before touching the system so a crash can be recovered
+	journal := &types.ApplyJournal{
+		ProfileID:      profile.ID,
+		SnapshotID:     snapshot.ID,
+		StartedAt:      time.Now(),
+		CompletedSteps: []string{},
+	}
+	if err := s.saveApplyJournal(journal); err != nil {
+		return nil, err
+	}
+
 	// Apply changes
-	if err := s.applyChanges(profile); err != nil {
+	err = s.applyChanges(profile, snapshot.ID, func(step string) error {
+		report(step)
+		return s.advanceApplyJournal(journal, step)
+	})
+	if err != nil {
 		s.logger.Error("failed to apply changes, rolling back",
 			zap.String("profile", profile.ID),
 			zap.Error(err))
 
 		// Rollback on failure (use internal method since we already hold the lock)
-		if rollbackErr := s.rollbackInternal(snapshot.ID); rollbackErr != nil {
+		if rollbackErr := s.rollbackInternal(snapshot.ID, nil); rollbackErr != nil {
 			s.logger.Error("rollback failed", zap.Error(rollbackErr))
 			result.Errors = append(result.Errors, fmt.Sprintf("apply failed: %v; rollback also failed: %v", err, rollbackErr))
 		} else {
 			result.Errors = append(result.Errors, fmt.Sprintf("apply failed and rolled back: %v", err))
 		}
+		s.removeApplyJournal()
 		result.Success = false
 		return result, nil
 	}
 
 	// Verify changes
+	report(applyStepVerification)
+	if err := s.advanceApplyJournal(journal, applyStepVerification); err != nil {
+		s.logger.Warn("failed to update apply journal", zap.Error(err))
+	}
 	verification := s.verifyChanges(profile)
 	result.Verification = verification
 
-	if !verification.SysctlOK || !verification.QdiscOK {
+	if !verification.SysctlOK || !verification.QdiscOK || !verification.LinkOK || !verification.SteeringOK || !verification.RouteOK {
 		s.logger.Error("verification failed, rolling back",
 			zap.String("profile", profile.ID))
 
 		// Use internal method since we already hold the lock
-		if rollbackErr := s.rollbackInternal(snapshot.ID); rollbackErr != nil {
+		if rollbackErr := s.rollbackInternal(snapshot.ID, nil); rollbackErr != nil {
 			s.logger.Error("rollback failed", zap.Error(rollbackErr))
 			result.Errors = append(result.Errors, fmt.Sprintf("verification failed; rollback also failed: %v", rollbackErr))
 		} else {
 			result.Errors = append(result.Errors, "verification failed; rolled back")
 		}
+		s.removeApplyJournal()
 		result.Success = false
 		return result, nil
 	}
@@ -136,55 +260,109 @@ func (s *ApplyService) Apply(req *types.ApplyRequest) (*types.ApplyResult, error
 
 	// Record in history
 	if s.historyService != nil {
-		s.historyService.RecordApply(req.ProfileID, snapshot.ID, true)
+		s.historyService.RecordApply(req.ProfileID, snapshot.ID, true, snapshot.Scope)
 	}
 
 	s.logger.Info("applied profile successfully",
 		zap.String("profile", profile.ID),
 		zap.String("snapshot", snapshot.ID))
 
+	// Arm the dead-man's switch: revert unless the caller confirms in time
+	if req.AutoRollbackSeconds > 0 {
+		pending := &types.PendingRollback{
+			ProfileID:  profile.ID,
+			SnapshotID: snapshot.ID,
+			AppliedAt:  result.AppliedAt,
+			Deadline:   result.AppliedAt.Add(time.Duration(req.AutoRollbackSeconds) * time.Second),
+		}
+		if err := s.armPendingRollback(pending); err != nil {
+			s.logger.Error("failed to persist pending rollback", zap.Error(err))
+			result.Errors = append(result.Errors, fmt.Sprintf("auto-rollback armed in memory only: %v", err))
+		}
+		result.Pending = pending
+	}
+
+	// Cleared only after the auto-rollback is armed, so a crash never leaves the host unprotected
+	s.removeApplyJournal()
+
 	return result, nil
 }
 
 // Rollback restores a previous snapshot (acquires lock)
 func (s *ApplyService) Rollback(snapshotID string) error {
-	s.mu.Lock()
-	if s.applyLock {
-		s.mu.Unlock()
-		return types.ErrApplyInProgress
+	return s.RollbackMapped(snapshotID, nil)
+}
+
+// RollbackMapped restores a snapshot with its interfaces renamed or skipped
+// by ifaceMap (acquires lock). A snapshot that does not fit this host is
+// refused with ErrValidationFailed before anything changes.
+func (s *ApplyService) RollbackMapped(snapshotID string, ifaceMap map[string]string) error {
+	if err := s.acquireApplyLock(); err != nil {
+		return err
 	}
-	s.applyLock = true
-	s.mu.Unlock()
+	defer s.releaseApplyLock()
 
-	defer func() {
-		s.mu.Lock()
-		s.applyLock = false
-		s.mu.Unlock()
-	}()
+	if _, err := s.hostSnapshot(snapshotID, ifaceMap); err != nil {
+		return err
+	}
+
+	// An explicit rollback supersedes any pending auto-rollback
+	s.disarmPendingRollback()
+
+	if err := s.rollbackInternal(snapshotID, ifaceMap); err != nil {
+		return err
+	}
 
-	return s.rollbackInternal(snapshotID)
+	// A successful manual rollback also settles an interrupted apply
+	s.resolveRecovery()
+	return nil
+}
+
+// rollbackInternal performs the rollback without acquiring lock (caller must
+// hold lock); ifaceMap is nil except for explicit rollbacks
+func (s *ApplyService) rollbackInternal(snapshotID string, ifaceMap map[string]string) error {
+	recorded, err := s.restoreSnapshot(snapshotID, ifaceMap)
+	if recorded != nil && s.historyService != nil {
+		s.historyService.RecordRollback(snapshotID, err == nil, recorded)
+	}
+	return err
 }
 
-// rollbackInternal performs the rollback without acquiring lock (caller must hold lock)
-func (s *ApplyService) rollbackInternal(snapshotID string) error {
-	snapshot, err := s.snapshotService.Get(snapshotID)
+// restoreSnapshot restores a snapshot and returns the scope it restored, or
+// nil when it failed before changing anything (caller must hold lock)
+func (s *ApplyService) restoreSnapshot(snapshotID string, ifaceMap map[string]string) (*types.ChangeScope, error) {
+	snapshot, err := s.hostSnapshot(snapshotID, ifaceMap)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	// Sysctl keys, link settings, steering and routes are restored only where
+	// nettune changed them since the snapshot
+	scope, err := s.rollbackScope(snapshot)
+	if err != nil {
+		return nil, err
 	}
 
 	var rollbackErrors []string
 
+	// History records only the sysctl keys the rollback wrote, which keeps the
+	// entry small when a full snapshot is restored
+	recorded := *scope
+	recorded.Sysctl = nil
+
 	// Restore sysctl values
-	if snapshot.State.Sysctl != nil {
-		if err := s.adapter.Sysctl.SetMultiple(snapshot.State.Sysctl); err != nil {
+	if values := scopedSysctl(snapshot.State.Sysctl, scope.Sysctl); len(values) > 0 {
+		written, err := s.restoreSysctl(values)
+		if err != nil {
 			s.logger.Error("failed to restore sysctl", zap.Error(err))
 			rollbackErrors = append(rollbackErrors, fmt.Sprintf("restore sysctl failed: %v", err))
+			written = sortedKeys(values)
 		}
+		recorded.Sysctl = written
 	}
 
 	// Restore backed up files
 	for path, content := range snapshot.Backups {
-		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		if err := utils.AtomicWriteFile(s.adapter.Path(path), []byte(content), backupFileMode(path)); err != nil {
 			s.logger.Error("failed to restore file",
 				zap.String("path", path),
 				zap.Error(err))
@@ -192,10 +370,13 @@ func (s *ApplyService) rollbackInternal(snapshotID string) error {
 		}
 	}
 
+	// Remove managed files that did not exist when the snapshot was taken
+	rollbackErrors = append(rollbackErrors, s.removeTombstones(snapshot)...)
+
 	// Reload sysctl from restored file
-	sysctlFile := "/etc/sysctl.d/99-nettune.conf"
+	sysctlFile := adapter.NettuneSysctlFilePath
 	if _, ok := snapshot.Backups[sysctlFile]; ok {
-		if err := s.adapter.Sysctl.LoadFromFile(sysctlFile); err != nil {
+		if err := s.adapter.Sysctl.LoadFromFile(s.adapter.Path(sysctlFile)); err != nil {
 			s.logger.Error("failed to reload sysctl from restored file",
 				zap.String("path", sysctlFile),
 				zap.Error(err))
@@ -203,10 +384,35 @@ func (s *ApplyService) rollbackInternal(snapshotID string) error {
 		}
 	}
 
+	// Align the persistence services with the snapshot
+	rollbackErrors = append(rollbackErrors, s.restoreServices(snapshot)...)
+
+	// Restore link settings before qdiscs, since ring changes may reset the device queues
+	for iface, settings := range scopedLinkSettings(snapshot.State.Link, scope.Link) {
+		if err := s.restoreLink(iface, settings); err != nil {
+			s.logger.Error("failed to restore link settings",
+				zap.String("interface", iface),
+				zap.Error(err))
+			rollbackErrors = append(rollbackErrors, fmt.Sprintf("restore link settings for %s failed: %v", iface, err))
+		}
+	}
+
+	// Restore queue steering and IRQ affinity
+	if err := s.restoreSteering(snapshot.State.Steering, scope.Steering); err != nil {
+		s.logger.Error("failed to restore steering", zap.Error(err))
+		rollbackErrors = append(rollbackErrors, fmt.Sprintf("restore steering failed: %v", err))
+	}
+
+	// Restore route attributes
+	if err := s.restoreRoutes(snapshot.State.Routes, scope.Routes); err != nil {
+		s.logger.Error("failed to restore route attributes", zap.Error(err))
+		rollbackErrors = append(rollbackErrors, fmt.Sprintf("restore route attributes failed: %v", err))
+	}
+
 	// Restore qdisc
 	for iface, info := range snapshot.State.Qdisc {
 		if info != nil {
-			if err := s.adapter.Qdisc.Set(iface, info.Type, nil); err != nil {
+			if err := s.restoreQdisc(iface, info); err != nil {
 				s.logger.Error("failed to restore qdisc",
 					zap.String("interface", iface),
 					zap.Error(err))
@@ -215,19 +421,166 @@ func (s *ApplyService) rollbackInternal(snapshotID string) error {
 		}
 	}
 
-	if s.historyService != nil {
-		s.historyService.RecordRollback(snapshotID, len(rollbackErrors) == 0)
-	}
-
 	if len(rollbackErrors) > 0 {
 		s.logger.Error("rollback completed with errors",
 			zap.String("snapshot", snapshotID),
 			zap.Strings("errors", rollbackErrors))
-		return fmt.Errorf("%w: %s", types.ErrRollbackFailed, strings.Join(rollbackErrors, "; "))
+		return &recorded, fmt.Errorf("%w: %s", types.ErrRollbackFailed, strings.Join(rollbackErrors, "; "))
 	}
 
 	s.logger.Info("rolled back to snapshot", zap.String("snapshot", snapshotID))
-	return nil
+	return &recorded, nil
+}
+
+// scopedSysctl returns the saved sysctl values of keys
+func scopedSysctl(saved map[string]string, keys []string) map[string]string {
+	scoped := make(map[string]string)
+	for _, key := range keys {
+		if value, ok := saved[key]; ok {
+			scoped[key] = value
+		}
+	}
+	return scoped
+}
+
+// restoreSysctl writes back every captured sysctl value that differs from the
+// live value and returns the sorted keys it wrote. Keys that no longer exist
+// (e.g. a removed interface) are skipped.
+func (s *ApplyService) restoreSysctl(values map[string]string) ([]string, error) {
+	current, err := s.adapter.Sysctl.GetMultiple(sortedKeys(values))
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]string)
+	for key, value := range values {
+		live, ok := current[key]
+		if !ok {
+			s.logger.Warn("sysctl no longer exists, skipping restore", zap.String("key", key))
+			continue
+		}
+		if normalizeSysctlValue(live) != normalizeSysctlValue(value) {
+			changed[key] = value
+		}
+	}
+
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	if err := s.adapter.Sysctl.SetMultiple(changed); err != nil {
+		return nil, err
+	}
+	return sortedKeys(changed), nil
+}
+
+// restoreQdisc brings the root qdisc of an interface back to the snapshot state
+func (s *ApplyService) restoreQdisc(iface string, info *types.QdiscInfo) error {
+	current, err := s.adapter.Qdisc.Get(iface)
+	if err == nil && current.Type == info.Type && current.Handle == info.Handle &&
+		reflect.DeepEqual(current.Params, info.Params) {
+		return nil
+	}
+
+	// Handle 0 means the kernel attached the qdisc itself; deleting ours lets it
+	// reattach the default (mq, pfifo_fast, noqueue, ...) based on default_qdisc
+	if info.Handle == "0" {
+		if err == nil && current.Handle == "0" {
+			return nil
+		}
+		return s.adapter.Qdisc.Delete(iface)
+	}
+
+	return s.adapter.Qdisc.Set(iface, info.Type, adapter.RestorableParams(info.Type, info.Params))
+}
+
+// backupFileMode returns the mode a managed file is restored with. Setup
+// scripts are executable, as ensureService writes them.
+func backupFileMode(path string) os.FileMode {
+	switch path {
+	case adapter.NettuneQdiscScriptPath, adapter.NettuneLinkScriptPath, adapter.NettuneRouteScriptPath:
+		return 0755
+	}
+	return 0644
+}
+
+// removeTombstones deletes managed files recorded as absent in the snapshot.
+// Unit files are stopped and disabled through systemd before removal.
+func (s *ApplyService) removeTombstones(snapshot *types.Snapshot) []string {
+	var errs []string
+
+	for _, path := range snapshot.Tombstones {
+		var err error
+		if filepath.Dir(path) == adapter.SystemdUnitDir {
+			unit := filepath.Base(path)
+			if s.adapter.Systemd.UnitExists(unit) {
+				err = s.adapter.Systemd.RemoveUnit(unit)
+			}
+		} else if rmErr := os.Remove(s.adapter.Path(path)); rmErr != nil && !os.IsNotExist(rmErr) {
+			err = rmErr
+		}
+
+		if err != nil {
+			s.logger.Error("failed to remove file created after snapshot",
+				zap.String("path", path),
+				zap.Error(err))
+			errs = append(errs, fmt.Sprintf("remove %s failed: %v", path, err))
+			continue
+		}
+		s.logger.Debug("removed file created after snapshot", zap.String("path", path))
+	}
+
+	return errs
+}
+
+// restoreServices aligns the qdisc, link and route persistence services with the
+// snapshot. A service that did not exist yet is removed by removeTombstones.
+func (s *ApplyService) restoreServices(snapshot *types.Snapshot) []string {
+	var errs []string
+	reloaded := false
+
+	for _, unit := range []string{adapter.NettuneQdiscServiceName, adapter.NettuneLinkServiceName, adapter.NettuneRouteServiceName} {
+		unitPath := adapter.SystemdUnitDir + "/" + unit
+		if snapshot.HasTombstone(unitPath) {
+			continue
+		}
+
+		// Unit file content was restored with the other backups
+		if _, ok := snapshot.Backups[unitPath]; ok && !reloaded {
+			reloaded = true
+			if err := s.adapter.Systemd.DaemonReload(); err != nil {
+				errs = append(errs, fmt.Sprintf("reload systemd failed: %v", err))
+			}
+		}
+
+		if !snapshot.State.SystemdUnits[unit] {
+			if active, _ := s.adapter.Systemd.IsActive(unit); active {
+				if err := s.adapter.Systemd.Stop(unit); err != nil {
+					errs = append(errs, fmt.Sprintf("stop %s failed: %v", unit, err))
+				}
+			}
+			continue
+		}
+
+		// Units the snapshot ran are enabled and started, e.g. on a host that
+		// only has them from an imported snapshot
+		if !s.adapter.Systemd.UnitExists(unit) {
+			s.logger.Warn("snapshot ran a unit it has no file for, not starting it",
+				zap.String("unit", unit))
+			continue
+		}
+		if enabled, _ := s.adapter.Systemd.IsEnabled(unit); !enabled {
+			if err := s.adapter.Systemd.Enable(unit); err != nil {
+				errs = append(errs, fmt.Sprintf("enable %s failed: %v", unit, err))
+			}
+		}
+		if active, _ := s.adapter.Systemd.IsActive(unit); !active {
+			if err := s.adapter.Systemd.Start(unit); err != nil {
+				errs = append(errs, fmt.Sprintf("start %s failed: %v", unit, err))
+			}
+		}
+	}
+
+	return errs
 }
 
 // RollbackLast rolls back to the most recent snapshot
@@ -259,21 +612,34 @@ func (s *ApplyService) GetStatus() (*types.SystemStatus, error) {
 	if len(snapshots) > 0 {
 		status.LatestSnapshotID = snapshots[0].ID
 	}
+	status.BaselineSnapshotID = s.snapshotService.BaselineID()
 
 	// Get last apply info from history
 	if s.historyService != nil {
 		status.LastApply = s.historyService.GetLastApply()
 	}
 
+	status.PendingRollback = s.GetPendingRollback()
+	status.LastAutoRollback = s.GetLastAutoRollback()
+	status.Recovery = s.GetRecovery()
+
+	// Persisted nettune settings that will not survive a reboot
+	persisted, err := s.adapter.Sysctl.ReadManagedFile(s.adapter.Path(adapter.NettuneSysctlFilePath))
+	if err != nil {
+		s.logger.Warn("failed to read persisted sysctl settings", zap.Error(err))
+	}
+	status.SysctlConflicts = s.sysctlConflicts(entryValues(persisted))
+
 	return status, nil
 }
 
 // generatePlan generates an apply plan based on profile and current state
 func (s *ApplyService) generatePlan(profile *types.Profile, currentState *types.SystemState) *types.ApplyPlan {
 	plan := &types.ApplyPlan{
-		SysctlChanges:  make(map[string]*types.Change),
-		QdiscChanges:   make(map[string]*types.Change),
-		SystemdChanges: make(map[string]*types.Change),
+		SysctlChanges:      make(map[string]*types.Change),
+		PersistenceChanges: make(map[string]*types.Change),
+		QdiscChanges:       make(map[string]*types.Change),
+		SystemdChanges:     make(map[string]*types.Change),
 	}
 
 	// Sysctl changes
@@ -291,32 +657,96 @@ func (s *ApplyService) generatePlan(profile *types.Profile, currentState *types.
 		}
 	}
 
+	// Persistence changes to the nettune sysctl drop-in
+	if profile.Sysctl != nil {
+		persisted, err := s.adapter.Sysctl.ReadManagedFile(s.adapter.Path(adapter.NettuneSysctlFilePath))
+		if err != nil {
+			s.logger.Warn("failed to read persisted sysctl settings", zap.Error(err))
+		}
+		profileValues := make(map[string]string)
+		for key, newValue := range profile.Sysctl {
+			newValueStr := formatSysctlValue(newValue)
+			profileValues[key] = newValueStr
+			entry, ok := persisted[key]
+			if !ok {
+				plan.PersistenceChanges[key] = &types.Change{From: nil, To: newValueStr}
+			} else if normalizeSysctlValue(entry.Value) != normalizeSysctlValue(newValueStr) {
+				plan.PersistenceChanges[key] = &types.Change{From: entry.Value, To: newValueStr}
+			}
+		}
+
+		// Keys of the resulting drop-in that a later configuration file overrides at boot
+		plan.SysctlConflicts = s.sysctlConflicts(entryValues(mergeSysctlEntries(persisted, profileValues, profile.ID, "")))
+
+		// Probe every key so typos and unsupported keys show up before commit
+		initNetNS := s.adapter.Sysctl.InInitNetNamespace()
+		plan.Preflight = make(map[string]*types.SysctlPreflight)
+		for key := range profile.Sysctl {
+			plan.Preflight[key] = s.adapter.Sysctl.Probe(key, initNetNS)
+		}
+	}
+
+	// Kernel modules that must be loaded now and at boot
+	if modules, loaded := s.profileModules(profile); len(modules) > 0 {
+		persisted, err := s.adapter.Modules.ReadModulesLoadFile(s.adapter.Path(adapter.NettuneModulesLoadPath))
+		if err != nil {
+			s.logger.Warn("failed to read persisted kernel modules", zap.Error(err))
+		}
+		plan.ModuleChanges = moduleChanges(modules, loaded, persisted)
+
+		plan.ModulePreflight = make(map[string]*types.SysctlPreflight)
+		for _, module := range modules {
+			check := &types.SysctlPreflight{Status: types.PreflightOK}
+			if !loaded[module] {
+				if err := s.adapter.Modules.Available(module); err != nil {
+					check = &types.SysctlPreflight{Status: types.PreflightMissing, Detail: err.Error()}
+				}
+			}
+			plan.ModulePreflight[module] = check
+		}
+	}
+
 	// Qdisc changes
 	if profile.Qdisc != nil {
-		var interfaces []string
-		if profile.Qdisc.Interfaces == "default-route" {
-			if iface, err := s.adapter.Qdisc.GetDefaultRouteInterface(); err == nil {
-				interfaces = []string{iface}
-			}
-		} else {
-			interfaces, _ = s.adapter.Qdisc.ListInterfaces()
+		targets, err := s.qdiscTargets(profile.Qdisc)
+		if err != nil {
+			plan.QdiscError = err.Error()
+		}
+		if profile.Qdisc.Interfaces == qdiscInterfacesDefaultRoute {
+			plan.DefaultRoutes, _ = s.adapter.Qdisc.GetDefaultRoutes()
 		}
 
-		for _, iface := range interfaces {
-			currentQdisc := currentState.Qdisc[iface]
-			currentType := ""
-			if currentQdisc != nil {
-				currentType = currentQdisc.Type
+		for _, target := range targets {
+			plan.QdiscTargets = append(plan.QdiscTargets, target.Interface)
+			currentQdisc := currentState.Qdisc[target.Interface]
+			if currentQdisc == nil {
+				currentQdisc = &types.QdiscInfo{}
 			}
-			if currentType != profile.Qdisc.Type {
-				plan.QdiscChanges[iface] = &types.Change{
-					From: currentType,
-					To:   profile.Qdisc.Type,
+			if currentQdisc.Type != target.Type ||
+				len(adapter.QdiscParamsDiff(target.Type, target.Params, currentQdisc.Params)) > 0 {
+				plan.QdiscChanges[target.Interface] = &types.Change{
+					From: qdiscSummary(currentQdisc, target),
+					To:   qdiscSummary(&types.QdiscInfo{Type: target.Type, Params: target.Params}, target),
 				}
 			}
 		}
 	}
 
+	// Link changes
+	if profile.Link != nil {
+		s.planLinkChanges(plan, profile.Link, currentState)
+	}
+
+	// Steering changes
+	if profile.Steering != nil {
+		s.planSteeringChanges(plan, profile.Steering, currentState)
+	}
+
+	// Route changes
+	if profile.Routes != nil {
+		s.planRouteChanges(plan, profile.Routes)
+	}
+
 	// Systemd changes
 	if profile.Systemd != nil && profile.Systemd.EnsureQdiscService {
 		unitActive := currentState.SystemdUnits[adapter.NettuneQdiscServiceName]
@@ -327,21 +757,53 @@ func (s *ApplyService) generatePlan(profile *types.Profile, currentState *types.
 			}
 		}
 	}
+	if profile.Link != nil && !currentState.SystemdUnits[adapter.NettuneLinkServiceName] {
+		plan.SystemdChanges[adapter.NettuneLinkServiceName] = &types.Change{
+			From: "inactive",
+			To:   "active",
+		}
+	}
+	if profile.Routes != nil && !currentState.SystemdUnits[adapter.NettuneRouteServiceName] {
+		plan.SystemdChanges[adapter.NettuneRouteServiceName] = &types.Change{
+			From: "inactive",
+			To:   "active",
+		}
+	}
 
 	return plan
 }
 
-// applyChanges applies the profile changes
-func (s *ApplyService) applyChanges(profile *types.Profile) error {
+// applyChanges applies the profile changes, calling step before each stage.
+// applyID identifies the apply in the provenance comments of the sysctl drop-in.
+func (s *ApplyService) applyChanges(profile *types.Profile, applyID string, step func(name string) error) error {
+	// Load kernel modules first so values like tcp_congestion_control=bbr are accepted
+	if modules, loaded := s.profileModules(profile); len(modules) > 0 {
+		if err := step(applyStepModules); err != nil {
+			return err
+		}
+		if err := s.ensureModules(modules, loaded); err != nil {
+			return err
+		}
+	}
+
 	// Apply sysctl changes
 	if profile.Sysctl != nil {
+		if err := step(applyStepSysctl); err != nil {
+			return err
+		}
+
 		sysctlValues := make(map[string]string)
 		for key, value := range profile.Sysctl {
 			sysctlValues[key] = formatSysctlValue(value)
 		}
 
-		// Write to persistent file
-		if err := s.adapter.Sysctl.WriteToFile("/etc/sysctl.d/99-nettune.conf", sysctlValues); err != nil {
+		// Merge into the persistent file so keys from earlier applies stay persisted
+		persisted, err := s.adapter.Sysctl.ReadManagedFile(s.adapter.Path(adapter.NettuneSysctlFilePath))
+		if err != nil {
+			return err
+		}
+		entries := mergeSysctlEntries(persisted, sysctlValues, profile.ID, applyID)
+		if err := s.adapter.Sysctl.WriteManagedFile(s.adapter.Path(adapter.NettuneSysctlFilePath), entries); err != nil {
 			return fmt.Errorf("failed to write sysctl file: %w", err)
 		}
 
@@ -351,39 +813,88 @@ func (s *ApplyService) applyChanges(profile *types.Profile) error {
 		}
 	}
 
+	// Apply link settings before the qdisc, since ring changes may reset the device queues
+	if profile.Link != nil {
+		if err := step(applyStepLink); err != nil {
+			return err
+		}
+
+		targets, err := s.linkTargets(profile.Link)
+		if err != nil {
+			return err
+		}
+		if err := s.applyLink(targets); err != nil {
+			return err
+		}
+
+		// Link settings are always persisted, like sysctls
+		if err := s.ensureLinkService(targets); err != nil {
+			s.logger.Warn("failed to setup link service", zap.Error(err))
+		}
+	}
+
+	// Apply steering after link settings, since ring and channel changes recreate the queues
+	if profile.Steering != nil {
+		if err := step(applyStepSteering); err != nil {
+			return err
+		}
+		if err := s.applySteering(profile.Steering); err != nil {
+			return err
+		}
+	}
+
+	// Apply route attributes
+	if profile.Routes != nil {
+		if err := step(applyStepRoute); err != nil {
+			return err
+		}
+
+		targets, err := routeTargets(profile.Routes)
+		if err != nil {
+			return err
+		}
+		if err := s.applyRoutes(targets); err != nil {
+			return err
+		}
+
+		// Route attributes are always persisted, like link settings
+		if err := s.ensureRouteService(targets); err != nil {
+			s.logger.Warn("failed to setup route service", zap.Error(err))
+		}
+	}
+
 	// Apply qdisc changes
 	if profile.Qdisc != nil {
-		// Validate qdisc parameters before applying
-		if profile.Qdisc.Params != nil {
-			if err := s.adapter.Qdisc.ValidateQdiscParams(profile.Qdisc.Type, profile.Qdisc.Params); err != nil {
-				return fmt.Errorf("qdisc validation failed: %w", err)
-			}
+		if err := step(applyStepQdisc); err != nil {
+			return err
 		}
 
-		var interfaces []string
-		if profile.Qdisc.Interfaces == "default-route" {
-			iface, err := s.adapter.Qdisc.GetDefaultRouteInterface()
-			if err != nil {
-				return fmt.Errorf("failed to get default route interface: %w", err)
-			}
-			interfaces = []string{iface}
-		} else {
-			var err error
-			interfaces, err = s.adapter.Qdisc.ListInterfaces()
-			if err != nil {
-				return fmt.Errorf("failed to list interfaces: %w", err)
+		targets, err := s.qdiscTargets(profile.Qdisc)
+		if err != nil {
+			return err
+		}
+
+		// Validate qdisc parameters before applying
+		for _, target := range targets {
+			if target.Params != nil {
+				if err := s.adapter.Qdisc.ValidateQdiscParams(target.Type, target.Params); err != nil {
+					return fmt.Errorf("qdisc validation failed for %s: %w", target.Interface, err)
+				}
 			}
 		}
 
-		for _, iface := range interfaces {
-			if err := s.adapter.Qdisc.Set(iface, profile.Qdisc.Type, profile.Qdisc.Params); err != nil {
-				return fmt.Errorf("failed to set qdisc for %s: %w", iface, err)
+		for _, target := range targets {
+			if err := s.adapter.Qdisc.Set(target.Interface, target.Type, target.Params); err != nil {
+				return fmt.Errorf("failed to set qdisc for %s: %w", target.Interface, err)
 			}
 		}
 
 		// Setup systemd service for persistence if requested
 		if profile.Systemd != nil && profile.Systemd.EnsureQdiscService {
-			if err := s.ensureQdiscService(profile.Qdisc.Type, interfaces); err != nil {
+			if err := step(applyStepSystemd); err != nil {
+				return err
+			}
+			if err := s.ensureQdiscService(targets); err != nil {
 				s.logger.Warn("failed to setup qdisc service", zap.Error(err))
 			}
 		}
@@ -392,12 +903,186 @@ func (s *ApplyService) applyChanges(profile *types.Profile) error {
 	return nil
 }
 
+// profileModules returns the kernel modules a profile needs and the modules loaded now
+func (s *ApplyService) profileModules(profile *types.Profile) ([]string, map[string]bool) {
+	loaded, err := s.adapter.Modules.Loaded()
+	if err != nil {
+		s.logger.Warn("failed to list loaded kernel modules", zap.Error(err))
+		loaded = make(map[string]bool)
+	}
+	return requiredModules(profile, s.adapter.SysInfo.AvailableCCs(), loaded), loaded
+}
+
+// requiredModules returns the profile's explicit modules plus the modules of its
+// congestion controls, from sysctl and route congctl, unless an algorithm is built
+// into the kernel. An algorithm that is available but listed in loaded comes from
+// a module that must be persisted.
+func requiredModules(profile *types.Profile, availableCCs []string, loaded map[string]bool) []string {
+	set := make(map[string]bool)
+	for _, module := range profile.KernelModules {
+		set[module] = true
+	}
+
+	var ccs []string
+	if value, ok := profile.Sysctl["net.ipv4.tcp_congestion_control"]; ok {
+		ccs = append(ccs, formatSysctlValue(value))
+	}
+	if profile.Routes != nil {
+		if profile.Routes.Default != nil && profile.Routes.Default.CongCtl != "" {
+			ccs = append(ccs, profile.Routes.Default.CongCtl)
+		}
+		for _, prefix := range sortedKeys(profile.Routes.Prefixes) {
+			if attrs := profile.Routes.Prefixes[prefix]; attrs != nil && attrs.CongCtl != "" {
+				ccs = append(ccs, attrs.CongCtl)
+			}
+		}
+	}
+
+	for _, cc := range ccs {
+		module := adapter.CongestionControlModule(cc)
+		available := false
+		for _, name := range availableCCs {
+			if name == cc {
+				available = true
+				break
+			}
+		}
+		if !available || loaded[module] {
+			set[module] = true
+		}
+	}
+
+	modules := make([]string, 0, len(set))
+	for module := range set {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+// moduleChanges describes how each module's state changes, omitting modules
+// that are already loaded and persisted
+func moduleChanges(modules []string, loaded map[string]bool, persisted []string) map[string]*types.Change {
+	isPersisted := make(map[string]bool, len(persisted))
+	for _, module := range persisted {
+		isPersisted[module] = true
+	}
+
+	changes := make(map[string]*types.Change)
+	for _, module := range modules {
+		from := types.ModuleNotLoaded
+		if loaded[module] {
+			from = types.ModuleLoaded
+			if isPersisted[module] {
+				continue
+			}
+		}
+		changes[module] = &types.Change{From: from, To: types.ModulePersisted}
+	}
+	return changes
+}
+
+// ensureModules loads missing modules and adds all of them to the nettune
+// modules-load.d entry, keeping modules persisted by earlier applies
+func (s *ApplyService) ensureModules(modules []string, loaded map[string]bool) error {
+	for _, module := range modules {
+		if loaded[module] {
+			continue
+		}
+		if err := s.adapter.Modules.Load(module); err != nil {
+			return err
+		}
+	}
+
+	persisted, err := s.adapter.Modules.ReadModulesLoadFile(s.adapter.Path(adapter.NettuneModulesLoadPath))
+	if err != nil {
+		return err
+	}
+	merged := mergeModules(persisted, modules)
+	if len(merged) == len(persisted) {
+		return nil
+	}
+	if err := s.adapter.Modules.WriteModulesLoadFile(s.adapter.Path(adapter.NettuneModulesLoadPath), merged); err != nil {
+		return fmt.Errorf("failed to write modules-load file: %w", err)
+	}
+	return nil
+}
+
+// mergeModules returns the sorted union of persisted and required modules
+func mergeModules(persisted, modules []string) []string {
+	set := make(map[string]bool, len(persisted)+len(modules))
+	for _, module := range persisted {
+		set[module] = true
+	}
+	for _, module := range modules {
+		set[module] = true
+	}
+
+	merged := make([]string, 0, len(set))
+	for module := range set {
+		merged = append(merged, module)
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// mergeSysctlEntries overlays a profile's values onto the persisted drop-in entries.
+// Keys set by earlier applies are kept so narrower profiles do not drop their persistence.
+func mergeSysctlEntries(persisted map[string]*adapter.SysctlFileEntry, values map[string]string, profileID, applyID string) map[string]*adapter.SysctlFileEntry {
+	merged := make(map[string]*adapter.SysctlFileEntry, len(persisted)+len(values))
+	for key, entry := range persisted {
+		merged[key] = entry
+	}
+	for key, value := range values {
+		merged[key] = &adapter.SysctlFileEntry{
+			Value:     value,
+			ProfileID: profileID,
+			ApplyID:   applyID,
+		}
+	}
+	return merged
+}
+
+// preflightProblems splits failed probes of the given kind ("sysctl" or "kernel module")
+// into ones that block a commit and ones that only deserve a warning, in key order
+func preflightProblems(kind string, preflight map[string]*types.SysctlPreflight) (blocking, notices []string) {
+	keys := make([]string, 0, len(preflight))
+	for key := range preflight {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		check := preflight[key]
+		message := fmt.Sprintf("%s %s is %s: %s", kind, key, strings.ReplaceAll(check.Status, "_", "-"), check.Detail)
+		switch check.Status {
+		case types.PreflightMissing, types.PreflightReadOnly:
+			blocking = append(blocking, message)
+		case types.PreflightNamespaced:
+			notices = append(notices, message)
+		}
+	}
+	return blocking, notices
+}
+
+// entryValues returns the values of drop-in entries keyed by sysctl key
+func entryValues(entries map[string]*adapter.SysctlFileEntry) map[string]string {
+	values := make(map[string]string, len(entries))
+	for key, entry := range entries {
+		values[key] = entry.Value
+	}
+	return values
+}
+
 // verifyChanges verifies that the changes were applied correctly
 func (s *ApplyService) verifyChanges(profile *types.Profile) *types.VerificationResult {
 	result := &types.VerificationResult{
-		SysctlOK:  true,
-		QdiscOK:   true,
-		SystemdOK: true,
+		SysctlOK:   true,
+		QdiscOK:    true,
+		LinkOK:     true,
+		SteeringOK: true,
+		RouteOK:    true,
+		SystemdOK:  true,
 	}
 
 	// Verify sysctl
@@ -421,73 +1106,126 @@ func (s *ApplyService) verifyChanges(profile *types.Profile) *types.Verification
 
 	// Verify qdisc
 	if profile.Qdisc != nil {
-		var interfaces []string
-		if profile.Qdisc.Interfaces == "default-route" {
-			if iface, err := s.adapter.Qdisc.GetDefaultRouteInterface(); err == nil {
-				interfaces = []string{iface}
-			}
-		} else {
-			interfaces, _ = s.adapter.Qdisc.ListInterfaces()
+		targets, err := s.qdiscTargets(profile.Qdisc)
+		if err != nil {
+			result.QdiscOK = false
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to resolve qdisc interfaces: %v", err))
 		}
 
-		for _, iface := range interfaces {
-			info, err := s.adapter.Qdisc.Get(iface)
+		for _, target := range targets {
+			info, err := s.adapter.Qdisc.Get(target.Interface)
 			if err != nil {
 				result.QdiscOK = false
-				result.Errors = append(result.Errors, fmt.Sprintf("failed to read qdisc for %s: %v", iface, err))
+				result.Errors = append(result.Errors, fmt.Sprintf("failed to read qdisc for %s: %v", target.Interface, err))
 				continue
 			}
 
-			if info.Type != profile.Qdisc.Type {
+			if info.Type != target.Type {
+				result.QdiscOK = false
+				result.Errors = append(result.Errors, fmt.Sprintf("qdisc for %s: expected %s, got %s", target.Interface, target.Type, info.Type))
+			} else if diff := adapter.QdiscParamsDiff(target.Type, target.Params, info.Params); len(diff) > 0 {
 				result.QdiscOK = false
-				result.Errors = append(result.Errors, fmt.Sprintf("qdisc for %s: expected %s, got %s", iface, profile.Qdisc.Type, info.Type))
+				result.Errors = append(result.Errors, fmt.Sprintf("qdisc for %s: expected %s, got %s (%s differ)",
+					target.Interface, qdiscSummary(&types.QdiscInfo{Type: target.Type, Params: target.Params}, target),
+					qdiscSummary(info, target), strings.Join(diff, ", ")))
 			}
 		}
 	}
 
+	// Verify link settings
+	if profile.Link != nil {
+		s.verifyLink(profile.Link, result)
+	}
+
+	// Verify steering
+	if profile.Steering != nil {
+		s.verifySteering(profile.Steering, result)
+	}
+
+	// Verify route attributes
+	if profile.Routes != nil {
+		s.verifyRoutes(profile.Routes, result)
+	}
+
 	// Verify systemd
+	var units []string
 	if profile.Systemd != nil && profile.Systemd.EnsureQdiscService {
-		active, _ := s.adapter.Systemd.IsActive(adapter.NettuneQdiscServiceName)
-		enabled, _ := s.adapter.Systemd.IsEnabled(adapter.NettuneQdiscServiceName)
+		units = append(units, adapter.NettuneQdiscServiceName)
+	}
+	if profile.Link != nil {
+		units = append(units, adapter.NettuneLinkServiceName)
+	}
+	if profile.Routes != nil {
+		units = append(units, adapter.NettuneRouteServiceName)
+	}
+	for _, unit := range units {
+		active, _ := s.adapter.Systemd.IsActive(unit)
+		enabled, _ := s.adapter.Systemd.IsEnabled(unit)
 		if !active || !enabled {
 			result.SystemdOK = false
-			result.Errors = append(result.Errors, fmt.Sprintf("service %s is not active or enabled", adapter.NettuneQdiscServiceName))
+			result.Errors = append(result.Errors, fmt.Sprintf("service %s is not active or enabled", unit))
 		}
 	}
 
 	return result
 }
 
-// ensureQdiscService creates and enables the qdisc persistence service
-func (s *ApplyService) ensureQdiscService(qdiscType string, interfaces []string) error {
-	// Create setup script
-	iface := ""
-	if len(interfaces) > 0 {
-		iface = interfaces[0]
+// ensureQdiscService creates and enables the qdisc persistence service, which
+// reproduces the qdisc and its params on every interface it was applied to
+func (s *ApplyService) ensureQdiscService(targets []adapter.QdiscTarget) error {
+	return s.ensureService(adapter.NettuneQdiscServiceName,
+		adapter.NettuneQdiscScriptPath, adapter.GenerateQdiscSetupScript(targets),
+		adapter.GenerateQdiscServiceUnit())
+}
+
+// readSetupScript returns the content of a managed setup script; a missing
+// script is empty
+func (s *ApplyService) readSetupScript(scriptPath string) (string, error) {
+	content, err := os.ReadFile(s.adapter.Path(scriptPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read %s: %w", scriptPath, err)
 	}
-	script := adapter.GenerateQdiscSetupScript(qdiscType, iface)
-	if err := os.WriteFile(adapter.NettuneQdiscScriptPath, []byte(script), 0755); err != nil {
-		return fmt.Errorf("failed to write qdisc script: %w", err)
+	return string(content), nil
+}
+
+// ensureService writes a setup script and the unit that runs it, then enables
+// and starts the unit
+func (s *ApplyService) ensureService(name, scriptPath, script, unit string) error {
+	// Create setup script
+	if err := os.WriteFile(s.adapter.Path(scriptPath), []byte(script), 0755); err != nil {
+		return fmt.Errorf("failed to write %s: %w", scriptPath, err)
 	}
 
 	// Create systemd unit
-	unit := adapter.GenerateQdiscServiceUnit()
-	if err := s.adapter.Systemd.CreateUnit(adapter.NettuneQdiscServiceName, unit); err != nil {
+	if err := s.adapter.Systemd.CreateUnit(name, unit); err != nil {
 		return fmt.Errorf("failed to create systemd unit: %w", err)
 	}
 
 	// Enable and start
-	if err := s.adapter.Systemd.Enable(adapter.NettuneQdiscServiceName); err != nil {
+	if err := s.adapter.Systemd.Enable(name); err != nil {
 		return fmt.Errorf("failed to enable service: %w", err)
 	}
 
-	if err := s.adapter.Systemd.Start(adapter.NettuneQdiscServiceName); err != nil {
+	if err := s.adapter.Systemd.Start(name); err != nil {
 		return fmt.Errorf("failed to start service: %w", err)
 	}
 
 	return nil
 }
 
+// profileSysctlKeys returns the sorted sysctl keys set by a profile
+func profileSysctlKeys(profile *types.Profile) []string {
+	keys := make([]string, 0, len(profile.Sysctl))
+	for key := range profile.Sysctl {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // formatSysctlValue formats a sysctl value to string, handling numeric types to avoid scientific notation
 func formatSysctlValue(value interface{}) string {
 	switch v := value.(type) {
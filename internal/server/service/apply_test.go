@@ -0,0 +1,794 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jtsang4/nettune/internal/server/adapter"
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"go.uber.org/zap"
+)
+
+// newFakeApplyService wires the apply service to an emulated host in a temp dir
+func newFakeApplyService(t *testing.T) (*ApplyService, *adapter.SystemAdapter) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	logger := zap.NewNop()
+
+	sys, err := adapter.NewFakeSystemAdapter(filepath.Join(tmpDir, "root"), logger)
+	if err != nil {
+		t.Fatalf("NewFakeSystemAdapter failed: %v", err)
+	}
+	profiles, err := NewProfileService(filepath.Join(tmpDir, "profiles"), logger)
+	if err != nil {
+		t.Fatalf("NewProfileService failed: %v", err)
+	}
+	snapshots, err := NewSnapshotService(filepath.Join(tmpDir, "snapshots"), sys, logger)
+	if err != nil {
+		t.Fatalf("NewSnapshotService failed: %v", err)
+	}
+	history, err := NewHistoryService(filepath.Join(tmpDir, "history"), logger)
+	if err != nil {
+		t.Fatalf("NewHistoryService failed: %v", err)
+	}
+
+	return NewApplyService(profiles, snapshots, history, sys, tmpDir, logger), sys
+}
+
+// failingQdisc rejects every qdisc change
+type failingQdisc struct {
+	adapter.QdiscAdapter
+}
+
+func (q failingQdisc) Set(iface, qdiscType string, params map[string]interface{}) error {
+	return errors.New("qdisc kind is unknown")
+}
+
+func mustSysctl(t *testing.T, sys *adapter.SystemAdapter, key string) string {
+	t.Helper()
+	value, err := sys.Sysctl.Get(key)
+	if err != nil {
+		t.Fatalf("Sysctl.Get(%s) failed: %v", key, err)
+	}
+	return value
+}
+
+func TestApplyCommitAndRollbackOnFakeHost(t *testing.T) {
+	svc, sys := newFakeApplyService(t)
+
+	result, err := svc.Apply(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "commit"})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !result.Success {
+		t.Fatalf("Apply did not succeed: errors=%v warnings=%v", result.Errors, result.Warnings)
+	}
+
+	if got := mustSysctl(t, sys, "net.ipv4.tcp_congestion_control"); got != "bbr" {
+		t.Errorf("tcp_congestion_control = %q, want bbr", got)
+	}
+	if info, _ := sys.Qdisc.Get("eth0"); info == nil || info.Type != "fq" {
+		t.Errorf("eth0 qdisc = %+v, want fq", info)
+	}
+	if info, _ := sys.Qdisc.Get("eth1"); info == nil || info.Type != "fq_codel" {
+		t.Errorf("eth1 is not on the default route and should keep fq_codel, got %+v", info)
+	}
+	if active, _ := sys.Systemd.IsActive(adapter.NettuneQdiscServiceName); !active {
+		t.Error("qdisc service should be active")
+	}
+	modules, _ := sys.Modules.ReadModulesLoadFile(sys.Path(adapter.NettuneModulesLoadPath))
+	if len(modules) != 1 || modules[0] != "tcp_bbr" {
+		t.Errorf("persisted modules = %v, want [tcp_bbr]", modules)
+	}
+	for _, file := range []string{
+		adapter.NettuneSysctlFilePath,
+		adapter.NettuneQdiscScriptPath,
+		adapter.NettuneQdiscUnitPath,
+		adapter.NettuneModulesLoadPath,
+	} {
+		if _, err := os.Stat(sys.Path(file)); err != nil {
+			t.Errorf("managed file %s should exist under the fake root: %v", file, err)
+		}
+	}
+
+	if err := svc.Rollback(result.SnapshotID); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	if got := mustSysctl(t, sys, "net.ipv4.tcp_congestion_control"); got != "cubic" {
+		t.Errorf("tcp_congestion_control after rollback = %q, want cubic", got)
+	}
+	if got := mustSysctl(t, sys, "net.core.default_qdisc"); got != "fq_codel" {
+		t.Errorf("default_qdisc after rollback = %q, want fq_codel", got)
+	}
+	if info, _ := sys.Qdisc.Get("eth0"); info == nil || info.Type != "fq_codel" || info.Handle != "0" {
+		t.Errorf("eth0 qdisc after rollback = %+v, want default fq_codel", info)
+	}
+	if sys.Systemd.UnitExists(adapter.NettuneQdiscServiceName) {
+		t.Error("qdisc service created by the apply should be removed")
+	}
+	for _, file := range adapter.ManagedFiles() {
+		if _, err := os.Stat(sys.Path(file)); !os.IsNotExist(err) {
+			t.Errorf("managed file %s created by the apply should be removed", file)
+		}
+	}
+}
+
+func TestApplyRollsBackFailedQdiscOnFakeHost(t *testing.T) {
+	svc, sys := newFakeApplyService(t)
+	sys.Qdisc = failingQdisc{sys.Qdisc}
+
+	result, err := svc.Apply(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "commit"})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if result.Success {
+		t.Fatal("Apply should fail when the qdisc cannot be set")
+	}
+	if got := mustSysctl(t, sys, "net.ipv4.tcp_congestion_control"); got != "cubic" {
+		t.Errorf("tcp_congestion_control = %q, want the value restored to cubic", got)
+	}
+	if _, err := os.Stat(sys.Path(adapter.NettuneSysctlFilePath)); !os.IsNotExist(err) {
+		t.Error("sysctl drop-in written by the failed apply should be removed")
+	}
+}
+
+// paramlessQdisc sets qdiscs without their params
+type paramlessQdisc struct {
+	adapter.QdiscAdapter
+}
+
+func (q paramlessQdisc) Set(iface, qdiscType string, params map[string]interface{}) error {
+	return q.QdiscAdapter.Set(iface, qdiscType, nil)
+}
+
+func TestApplyQdiscParamsOnlyChange(t *testing.T) {
+	svc, sys := newFakeApplyService(t)
+
+	result, err := svc.Apply(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "commit"})
+	if err != nil || !result.Success {
+		t.Fatalf("Apply failed: %v %v", err, result)
+	}
+
+	profile := &types.Profile{
+		ID:        "fq-capped",
+		Name:      "FQ capped",
+		RiskLevel: "low",
+		Qdisc: &types.QdiscConfig{
+			Type:       "fq",
+			Interfaces: "eth0",
+			Params:     map[string]interface{}{"maxrate": "1gbit"},
+		},
+	}
+	if err := svc.profileService.Save(profile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	dryRun, err := svc.Apply(&types.ApplyRequest{ProfileID: "fq-capped", Mode: "dry_run"})
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if change := dryRun.Plan.QdiscChanges["eth0"]; change == nil || change.From != "fq" || change.To != "fq maxrate 1gbit" {
+		t.Errorf("eth0 qdisc change = %+v, want fq -> fq maxrate 1gbit", change)
+	}
+
+	// Params that do not take effect fail verification
+	sys.Qdisc = paramlessQdisc{sys.Qdisc}
+	result, err = svc.Apply(&types.ApplyRequest{ProfileID: "fq-capped", Mode: "commit"})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if result.Success || result.Verification == nil || result.Verification.QdiscOK {
+		t.Errorf("Apply should fail verification when maxrate is not set, got %+v", result.Verification)
+	}
+
+	sys.Qdisc = sys.Qdisc.(paramlessQdisc).QdiscAdapter
+	result, err = svc.Apply(&types.ApplyRequest{ProfileID: "fq-capped", Mode: "commit"})
+	if err != nil || !result.Success {
+		t.Fatalf("Apply failed: %v %v", err, result)
+	}
+	dryRun, err = svc.Apply(&types.ApplyRequest{ProfileID: "fq-capped", Mode: "dry_run"})
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if change := dryRun.Plan.QdiscChanges["eth0"]; change != nil {
+		t.Errorf("eth0 qdisc change = %+v after the commit, want none", change)
+	}
+}
+
+func TestApplyLinkSettingsOnFakeHost(t *testing.T) {
+	svc, sys := newFakeApplyService(t)
+
+	profile := &types.Profile{
+		ID:        "nic-tuned",
+		Name:      "NIC tuned",
+		RiskLevel: "medium",
+		Link: &types.LinkConfig{
+			Interfaces: "eth*",
+			LinkSettings: types.LinkSettings{
+				Offloads: map[string]bool{"gro": false, "lro": true},
+				Rings:    map[string]int{"rx": 4096, "tx": 4096},
+				Coalesce: map[string]interface{}{"adaptive-rx": true, "rx-usecs": float64(50)},
+			},
+			PerInterface: map[string]*types.LinkSettings{
+				"eth1": {Rings: map[string]int{"rx": 1024}},
+			},
+		},
+	}
+	if err := svc.profileService.Save(profile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	dryRun, err := svc.Apply(&types.ApplyRequest{ProfileID: "nic-tuned", Mode: "dry_run"})
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if change := dryRun.Plan.LinkChanges["eth0/offloads/generic-receive-offload"]; change == nil || change.From != true || change.To != false {
+		t.Errorf("eth0 gro change = %+v, want true -> false", change)
+	}
+	if change := dryRun.Plan.LinkChanges["eth1/rings/rx"]; change == nil || change.To != 1024 {
+		t.Errorf("eth1 rx ring change = %+v, want the per-interface size", change)
+	}
+	if _, ok := dryRun.Plan.LinkChanges["eth1/offloads/generic-receive-offload"]; ok {
+		t.Error("eth1 override replaces the shared settings and should not change gro")
+	}
+
+	result, err := svc.Apply(&types.ApplyRequest{ProfileID: "nic-tuned", Mode: "commit"})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !result.Success {
+		t.Fatalf("Apply did not succeed: errors=%v warnings=%v", result.Errors, result.Warnings)
+	}
+
+	eth0, _ := sys.Link.Get("eth0")
+	if eth0.Offloads["generic-receive-offload"] || !eth0.Offloads["large-receive-offload"] ||
+		eth0.Rings["rx"] != 4096 || eth0.Coalesce["adaptive-rx"] != true || eth0.Coalesce["rx-usecs"] != 50 {
+		t.Errorf("eth0 link settings = %+v", eth0)
+	}
+	if eth1, _ := sys.Link.Get("eth1"); eth1.Rings["rx"] != 1024 || !eth1.Offloads["generic-receive-offload"] {
+		t.Errorf("eth1 link settings = %+v", eth1)
+	}
+	if active, _ := sys.Systemd.IsActive(adapter.NettuneLinkServiceName); !active {
+		t.Error("link service should be active")
+	}
+	script, err := os.ReadFile(sys.Path(adapter.NettuneLinkScriptPath))
+	if err != nil {
+		t.Fatalf("link script not written: %v", err)
+	}
+	if !strings.Contains(string(script), "set_link 'eth1' '-G' 'eth1' 'rx' '1024'") {
+		t.Errorf("link script does not set the eth1 ring:\n%s", script)
+	}
+
+	if err := svc.Rollback(result.SnapshotID); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	eth0, _ = sys.Link.Get("eth0")
+	if !eth0.Offloads["generic-receive-offload"] || eth0.Offloads["large-receive-offload"] ||
+		eth0.Rings["rx"] != 256 || eth0.Coalesce["adaptive-rx"] != false || eth0.Coalesce["rx-usecs"] != 3 {
+		t.Errorf("eth0 link settings after rollback = %+v", eth0)
+	}
+	if sys.Systemd.UnitExists(adapter.NettuneLinkServiceName) {
+		t.Error("link service created by the apply should be removed")
+	}
+}
+
+func TestLinkServiceKeepsEarlierProfiles(t *testing.T) {
+	svc, sys := newFakeApplyService(t)
+
+	for _, profile := range []*types.Profile{
+		{ID: "nic-eth0", Name: "NIC eth0", RiskLevel: "low", Link: &types.LinkConfig{
+			Interfaces:   "eth0",
+			LinkSettings: types.LinkSettings{Offloads: map[string]bool{"gro": false}, Rings: map[string]int{"rx": 512}},
+		}},
+		{ID: "nic-rings", Name: "NIC rings", RiskLevel: "low", Link: &types.LinkConfig{
+			Interfaces:   "eth*",
+			LinkSettings: types.LinkSettings{Rings: map[string]int{"rx": 1024}},
+		}},
+	} {
+		if err := svc.profileService.Save(profile); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		result, err := svc.Apply(&types.ApplyRequest{ProfileID: profile.ID, Mode: "commit"})
+		if err != nil || !result.Success {
+			t.Fatalf("Apply %s failed: %v %v", profile.ID, err, result)
+		}
+	}
+
+	script, err := os.ReadFile(sys.Path(adapter.NettuneLinkScriptPath))
+	if err != nil {
+		t.Fatalf("link script not written: %v", err)
+	}
+	targets, err := adapter.ParseLinkSetupScript(string(script))
+	if err != nil {
+		t.Fatalf("ParseLinkSetupScript failed: %v", err)
+	}
+	persisted := make(map[string]*types.LinkSettings)
+	for _, target := range targets {
+		persisted[target.Interface] = target.Settings
+	}
+	if eth0 := persisted["eth0"]; eth0 == nil || len(eth0.Offloads) != 1 || eth0.Offloads["gro"] || eth0.Rings["rx"] != 1024 {
+		t.Errorf("eth0 persisted = %+v, want gro kept off and the later rx ring", eth0)
+	}
+	if eth1 := persisted["eth1"]; eth1 == nil || eth1.Rings["rx"] != 1024 {
+		t.Errorf("eth1 persisted = %+v, want the rx ring", eth1)
+	}
+}
+
+func TestRollbackRestoresOnlyChangedLinkSettings(t *testing.T) {
+	svc, sys := newFakeApplyService(t)
+
+	mtu := 9000
+	profile := &types.Profile{
+		ID:        "jumbo-eth0",
+		Name:      "Jumbo eth0",
+		RiskLevel: "medium",
+		Link:      &types.LinkConfig{Interfaces: "eth0", LinkSettings: types.LinkSettings{MTU: &mtu}},
+	}
+	if err := svc.profileService.Save(profile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	before, err := svc.snapshotService.Create(&SnapshotOptions{})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	result, err := svc.Apply(&types.ApplyRequest{ProfileID: "jumbo-eth0", Mode: "commit"})
+	if err != nil || !result.Success {
+		t.Fatalf("Apply failed: %v %v", err, result)
+	}
+	if snapshot, _ := svc.snapshotService.Get(result.SnapshotID); snapshot.Scope == nil ||
+		len(snapshot.Scope.Link) != 1 || snapshot.Scope.Link[0] != "eth0/mtu" {
+		t.Errorf("apply snapshot scope = %+v, want eth0/mtu", snapshot.Scope)
+	}
+
+	// Another tool changes settings nettune never touched
+	drift := 1400
+	if err := sys.Link.Set("eth1", &types.LinkSettings{MTU: &drift}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sys.Link.Set("eth0", &types.LinkSettings{Offloads: map[string]bool{"gro": false}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A manual snapshot records no scope; the apply since it does
+	if err := svc.Rollback(before.ID); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	eth0, _ := sys.Link.Get("eth0")
+	if *eth0.MTU != 1500 || eth0.Offloads["generic-receive-offload"] {
+		t.Errorf("eth0 after rollback = mtu %d gro %v, want the MTU restored and gro left off", *eth0.MTU, eth0.Offloads["generic-receive-offload"])
+	}
+	if eth1, _ := sys.Link.Get("eth1"); *eth1.MTU != 1400 {
+		t.Errorf("eth1 mtu = %d, the rollback should leave it alone", *eth1.MTU)
+	}
+
+	// Rolling back a sysctl-only profile touches no link settings at all
+	result, err = svc.Apply(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "commit"})
+	if err != nil || !result.Success {
+		t.Fatalf("Apply failed: %v %v", err, result)
+	}
+	if err := sys.Link.Set("eth0", &types.LinkSettings{MTU: &drift}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Rollback(result.SnapshotID); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if eth0, _ := sys.Link.Get("eth0"); *eth0.MTU != 1400 {
+		t.Errorf("eth0 mtu = %d after rolling back a sysctl-only profile, want 1400", *eth0.MTU)
+	}
+}
+
+func TestApplyBlocksUnsupportedLinkSetting(t *testing.T) {
+	svc, sys := newFakeApplyService(t)
+
+	profile := &types.Profile{
+		ID:        "nic-bad",
+		Name:      "NIC bad",
+		RiskLevel: "low",
+		Link: &types.LinkConfig{
+			Interfaces:   "eth0",
+			LinkSettings: types.LinkSettings{Rings: map[string]int{"rx-jumbo": 512}},
+		},
+	}
+	if err := svc.profileService.Save(profile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	result, err := svc.Apply(&types.ApplyRequest{ProfileID: "nic-bad", Mode: "commit"})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if result.Success || result.SnapshotID != "" {
+		t.Fatalf("commit should be refused by preflight, got %+v", result)
+	}
+	if check := result.Plan.LinkPreflight["eth0/rings/rx-jumbo"]; check == nil || check.Status != types.PreflightMissing {
+		t.Errorf("preflight = %+v, want missing", check)
+	}
+	if sys.Systemd.UnitExists(adapter.NettuneLinkServiceName) {
+		t.Error("no link service should be created")
+	}
+}
+
+func TestApplySteeringOnFakeHost(t *testing.T) {
+	svc, sys := newFakeApplyService(t)
+
+	flows := 4096
+	profile := &types.Profile{
+		ID:        "steered",
+		Name:      "Steered",
+		RiskLevel: "medium",
+		Steering: &types.SteeringConfig{
+			Interfaces: "eth*",
+			SteeringSettings: types.SteeringSettings{
+				RPSCPUs:     "e",
+				RPSFlowCnt:  &flows,
+				XPSCPUs:     "spread",
+				IRQAffinity: "all",
+			},
+			PerInterface: map[string]*types.SteeringSettings{
+				"eth1": {IRQAffinity: "1"},
+			},
+		},
+	}
+	if err := svc.profileService.Save(profile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	read := func(path string) string {
+		data, err := os.ReadFile(sys.Path(path))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		return strings.TrimSpace(string(data))
+	}
+
+	dryRun, err := svc.Apply(&types.ApplyRequest{ProfileID: "steered", Mode: "dry_run"})
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if change := dryRun.Plan.SteeringChanges[adapter.QueuePath("eth0", "rx-1", "rps_cpus")]; change == nil || change.To != "e" {
+		t.Errorf("eth0 rx-1 rps_cpus change = %+v, want e", change)
+	}
+	if _, ok := dryRun.Plan.SteeringChanges[adapter.IRQAffinityPath(24)]; ok {
+		t.Error("irq 24 already uses every CPU and should not change")
+	}
+
+	result, err := svc.Apply(&types.ApplyRequest{ProfileID: "steered", Mode: "commit"})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !result.Success {
+		t.Fatalf("Apply did not succeed: errors=%v warnings=%v", result.Errors, result.Warnings)
+	}
+
+	want := map[string]string{
+		adapter.QueuePath("eth0", "rx-0", "rps_cpus"):     "e",
+		adapter.QueuePath("eth0", "rx-0", "rps_flow_cnt"): "4096",
+		adapter.QueuePath("eth0", "tx-0", "xps_cpus"):     "1",
+		adapter.QueuePath("eth0", "tx-1", "xps_cpus"):     "2",
+		adapter.IRQAffinityPath(24):                       "f",
+		adapter.IRQAffinityPath(27):                       "1",
+	}
+	for path, value := range want {
+		if got := read(path); got != value {
+			t.Errorf("%s = %q, want %q", path, got, value)
+		}
+	}
+
+	// irqbalance moves an IRQ the apply left alone
+	if err := sys.Steering.Set(map[string]string{adapter.IRQAffinityPath(24): "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Rollback(result.SnapshotID); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	restored := map[string]string{
+		adapter.QueuePath("eth0", "rx-0", "rps_cpus"):     "0",
+		adapter.QueuePath("eth0", "rx-0", "rps_flow_cnt"): "0",
+		adapter.QueuePath("eth0", "tx-1", "xps_cpus"):     "0",
+		adapter.IRQAffinityPath(27):                       "f",
+		adapter.IRQAffinityPath(24):                       "2",
+	}
+	for path, value := range restored {
+		if got := read(path); got != value {
+			t.Errorf("after rollback %s = %q, want %q", path, got, value)
+		}
+	}
+}
+
+func TestApplyBlocksOfflineSteeringCPU(t *testing.T) {
+	svc, sys := newFakeApplyService(t)
+
+	profile := &types.Profile{
+		ID:        "steer-bad",
+		Name:      "Steer bad",
+		RiskLevel: "low",
+		Steering: &types.SteeringConfig{
+			Interfaces:       "eth0",
+			SteeringSettings: types.SteeringSettings{RPSCPUs: "1f"},
+		},
+	}
+	if err := svc.profileService.Save(profile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	result, err := svc.Apply(&types.ApplyRequest{ProfileID: "steer-bad", Mode: "commit"})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if result.Success || result.SnapshotID != "" {
+		t.Fatalf("commit should be refused by preflight, got %+v", result)
+	}
+	if !strings.Contains(result.Plan.SteeringError, "online CPUs are 0-3") {
+		t.Errorf("SteeringError = %q, want the online CPUs named", result.Plan.SteeringError)
+	}
+	data, _ := os.ReadFile(sys.Path(adapter.QueuePath("eth0", "rx-0", "rps_cpus")))
+	if strings.TrimSpace(string(data)) != "0" {
+		t.Errorf("rps_cpus = %q, should be unchanged", data)
+	}
+}
+
+func TestApplyMTUOnAPIInterfaceNeedsAutoRollback(t *testing.T) {
+	svc, sys := newFakeApplyService(t)
+
+	mtu, qlen := 9000, 500
+	profile := &types.Profile{
+		ID:        "jumbo",
+		Name:      "Jumbo",
+		RiskLevel: "medium",
+		Link: &types.LinkConfig{
+			Interfaces:   "eth0",
+			LinkSettings: types.LinkSettings{MTU: &mtu, TxQueueLen: &qlen},
+		},
+	}
+	if err := svc.profileService.Save(profile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// 192.0.2.10 is on eth0 of the emulated host
+	result, err := svc.Apply(&types.ApplyRequest{ProfileID: "jumbo", Mode: "commit", Origin: "192.0.2.10"})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if result.Success || result.SnapshotID != "" {
+		t.Fatalf("commit should be refused without auto-rollback, got %+v", result)
+	}
+	if change := result.Plan.LinkChanges["eth0/mtu"]; change == nil || change.From != 1500 || change.To != 9000 {
+		t.Errorf("mtu change = %+v, want 1500 -> 9000", change)
+	}
+	if link, _ := sys.Link.Get("eth0"); *link.MTU != 1500 {
+		t.Errorf("mtu = %d, should be unchanged", *link.MTU)
+	}
+
+	// A client on another interface is not cut off by the change
+	result, err = svc.Apply(&types.ApplyRequest{ProfileID: "jumbo", Mode: "commit", Origin: "198.51.100.10"})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !result.Success {
+		t.Fatalf("Apply did not succeed: errors=%v warnings=%v", result.Errors, result.Warnings)
+	}
+	link, _ := sys.Link.Get("eth0")
+	if *link.MTU != 9000 || *link.TxQueueLen != 500 {
+		t.Errorf("link settings = mtu %d txqueuelen %d, want 9000 and 500", *link.MTU, *link.TxQueueLen)
+	}
+
+	if err := svc.Rollback(result.SnapshotID); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	link, _ = sys.Link.Get("eth0")
+	if *link.MTU != 1500 || *link.TxQueueLen != 1000 {
+		t.Errorf("after rollback mtu %d txqueuelen %d, want 1500 and 1000", *link.MTU, *link.TxQueueLen)
+	}
+
+	// With auto-rollback armed the change is allowed
+	result, err = svc.Apply(&types.ApplyRequest{ProfileID: "jumbo", Mode: "commit", Origin: "192.0.2.10", AutoRollbackSeconds: 60})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !result.Success || result.Pending == nil {
+		t.Fatalf("commit with auto-rollback should succeed, got errors=%v", result.Errors)
+	}
+	if _, err := svc.Confirm(result.SnapshotID); err != nil {
+		t.Fatalf("Confirm failed: %v", err)
+	}
+}
+
+func TestApplyRouteAttrsOnFakeHost(t *testing.T) {
+	svc, sys := newFakeApplyService(t)
+
+	cwnd, rwnd := 10, 20
+	profile := &types.Profile{
+		ID:        "fast-start",
+		Name:      "Fast start",
+		RiskLevel: "medium",
+		Routes: &types.RouteConfig{
+			Default: &types.RouteAttrs{InitCwnd: &cwnd, CongCtl: "bbr"},
+			Prefixes: map[string]*types.RouteAttrs{
+				"10.0.0.0/8": {InitRwnd: &rwnd},
+			},
+		},
+	}
+	if err := svc.profileService.Save(profile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	v4Default := "inet default via 192.0.2.1 dev eth0 proto dhcp src 192.0.2.10 metric 100"
+	dryRun, err := svc.Apply(&types.ApplyRequest{ProfileID: "fast-start", Mode: "dry_run"})
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if change := dryRun.Plan.RouteChanges[v4Default+"/initcwnd"]; change == nil || change.From != nil || change.To != 10 {
+		t.Errorf("initcwnd change = %+v, want unset -> 10", change)
+	}
+	if len(dryRun.Plan.RouteTargets) != 3 {
+		t.Errorf("RouteTargets = %v, want both default routes and the prefix", dryRun.Plan.RouteTargets)
+	}
+	if dryRun.Plan.ModuleChanges["tcp_bbr"] == nil {
+		t.Error("the congctl module should be loaded")
+	}
+
+	result, err := svc.Apply(&types.ApplyRequest{ProfileID: "fast-start", Mode: "commit"})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !result.Success {
+		t.Fatalf("Apply did not succeed: errors=%v warnings=%v", result.Errors, result.Warnings)
+	}
+
+	routes, _ := sys.Route.Find("inet6", "default")
+	if len(routes) != 1 || *routes[0].Attrs.InitCwnd != 10 || routes[0].Attrs.CongCtl != "bbr" {
+		t.Errorf("IPv6 default route = %+v", routes)
+	}
+	routes, _ = sys.Route.Find("inet", "10.0.0.0/8")
+	if len(routes) != 1 || *routes[0].Attrs.InitRwnd != 20 || routes[0].Attrs.InitCwnd != nil {
+		t.Errorf("10.0.0.0/8 route = %+v", routes)
+	}
+	if active, _ := sys.Systemd.IsActive(adapter.NettuneRouteServiceName); !active {
+		t.Error("route service should be active")
+	}
+	script, err := os.ReadFile(sys.Path(adapter.NettuneRouteScriptPath))
+	if err != nil {
+		t.Fatalf("route script not written: %v", err)
+	}
+	if !strings.Contains(string(script), "set_route 'inet' '10.0.0.0/8' 'initrwnd' '20'") {
+		t.Errorf("route script does not set the prefix:\n%s", script)
+	}
+
+	// Another tool tunes a route the profile does not target
+	local, _ := sys.Route.Find("inet", "192.0.2.0/24")
+	if len(local) != 1 {
+		t.Fatalf("192.0.2.0/24 routes = %+v", local)
+	}
+	local[0].Attrs.InitCwnd = &rwnd
+	if err := sys.Route.Set(local[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Rollback(result.SnapshotID); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	all, _ := sys.Route.GetAll()
+	for _, route := range all {
+		if route.Key() == local[0].Key() {
+			if route.Attrs.InitCwnd == nil || *route.Attrs.InitCwnd != 20 {
+				t.Errorf("rollback changed the untargeted route %s to %+v", route.Key(), route.Attrs)
+			}
+			continue
+		}
+		if !route.Attrs.IsEmpty() {
+			t.Errorf("route %s keeps attributes %+v after rollback", route.Key(), route.Attrs)
+		}
+	}
+	if sys.Systemd.UnitExists(adapter.NettuneRouteServiceName) {
+		t.Error("route service created by the apply should be removed")
+	}
+}
+
+func TestRouteServiceKeepsEarlierProfiles(t *testing.T) {
+	svc, sys := newFakeApplyService(t)
+
+	cwnd, rwnd, wider := 10, 20, 40
+	for _, profile := range []*types.Profile{
+		{ID: "routes-a", Name: "Routes A", RiskLevel: "low", Routes: &types.RouteConfig{
+			Prefixes: map[string]*types.RouteAttrs{"10.0.0.0/8": {InitCwnd: &cwnd, InitRwnd: &rwnd}},
+		}},
+		{ID: "routes-b", Name: "Routes B", RiskLevel: "low", Routes: &types.RouteConfig{
+			Prefixes: map[string]*types.RouteAttrs{
+				"10.0.0.0/8":   {InitRwnd: &wider},
+				"192.0.2.0/24": {InitCwnd: &cwnd},
+			},
+		}},
+	} {
+		if err := svc.profileService.Save(profile); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		result, err := svc.Apply(&types.ApplyRequest{ProfileID: profile.ID, Mode: "commit"})
+		if err != nil || !result.Success {
+			t.Fatalf("Apply %s failed: %v %v", profile.ID, err, result)
+		}
+	}
+
+	script, err := os.ReadFile(sys.Path(adapter.NettuneRouteScriptPath))
+	if err != nil {
+		t.Fatalf("route script not written: %v", err)
+	}
+	targets, err := adapter.ParseRouteSetupScript(string(script))
+	if err != nil {
+		t.Fatalf("ParseRouteSetupScript failed: %v", err)
+	}
+	persisted := make(map[string]*types.RouteAttrs)
+	for _, target := range targets {
+		persisted[target.Family+" "+target.Dest] = target.Attrs
+	}
+	if attrs := persisted["inet 10.0.0.0/8"]; attrs == nil || attrs.InitCwnd == nil || *attrs.InitCwnd != 10 ||
+		attrs.InitRwnd == nil || *attrs.InitRwnd != 40 {
+		t.Errorf("10.0.0.0/8 persisted = %+v, want initcwnd kept at 10 and the later initrwnd 40", attrs)
+	}
+	if attrs := persisted["inet 192.0.2.0/24"]; attrs == nil || attrs.InitCwnd == nil || *attrs.InitCwnd != 10 {
+		t.Errorf("192.0.2.0/24 persisted = %+v, want initcwnd 10", attrs)
+	}
+}
+
+func TestApplyBlocksMissingRoutePrefix(t *testing.T) {
+	svc, _ := newFakeApplyService(t)
+
+	cwnd := 10
+	profile := &types.Profile{
+		ID:        "route-bad",
+		Name:      "Route bad",
+		RiskLevel: "low",
+		Routes: &types.RouteConfig{
+			Prefixes: map[string]*types.RouteAttrs{"172.16.0.0/12": {InitCwnd: &cwnd}},
+		},
+	}
+	if err := svc.profileService.Save(profile); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	result, err := svc.Apply(&types.ApplyRequest{ProfileID: "route-bad", Mode: "commit"})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if result.Success || result.SnapshotID != "" {
+		t.Fatalf("commit should be refused by preflight, got %+v", result)
+	}
+	if check := result.Plan.RoutePreflight["inet 172.16.0.0/12"]; check == nil || check.Status != types.PreflightMissing {
+		t.Errorf("preflight = %+v, want missing", check)
+	}
+}
+
+func TestApplyHoldsSnapshotUntilConfirmed(t *testing.T) {
+	svc, _ := newFakeApplyService(t)
+
+	result, err := svc.Apply(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "commit", AutoRollbackSeconds: 60})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !result.Success || result.Pending == nil {
+		t.Fatalf("commit with auto-rollback should succeed, got errors=%v", result.Errors)
+	}
+
+	err = svc.snapshotService.Delete(result.SnapshotID)
+	if !errors.Is(err, types.ErrSnapshotProtected) || !strings.Contains(err.Error(), snapshotHoldPendingRollback) {
+		t.Errorf("Delete of the pending snapshot error = %v, want ErrSnapshotProtected", err)
+	}
+	snapshots, _ := svc.snapshotService.List()
+	if len(snapshots) != 1 || snapshots[0].HeldBy != snapshotHoldPendingRollback {
+		t.Errorf("snapshots = %+v, want the pending one held", snapshots)
+	}
+
+	if _, err := svc.Confirm(result.SnapshotID); err != nil {
+		t.Fatalf("Confirm failed: %v", err)
+	}
+	if err := svc.snapshotService.Delete(result.SnapshotID); err != nil {
+		t.Errorf("Delete after confirm failed: %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"github.com/jtsang4/nettune/internal/shared/utils"
+	"go.uber.org/zap"
+)
+
+// pendingRollbackFile is the state file that keeps an armed auto-rollback across restarts
+const pendingRollbackFile = "pending_rollback.json"
+
+// autoRollbackRetryDelay is how long an expired auto-rollback waits when another operation holds the lock
+const autoRollbackRetryDelay = time.Second
+
+// GetPendingRollback returns the apply currently awaiting confirmation, if any
+func (s *ApplyService) GetPendingRollback() *types.PendingRollback {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending == nil {
+		return nil
+	}
+	pending := *s.pending
+	return &pending
+}
+
+// Confirm keeps the pending apply and disarms its auto-rollback.
+// If snapshotID is set it must match the pending apply.
+func (s *ApplyService) Confirm(snapshotID string) (*types.ConfirmResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending == nil {
+		return nil, types.ErrNoPendingRollback
+	}
+	if snapshotID != "" && snapshotID != s.pending.SnapshotID {
+		return nil, fmt.Errorf("%w: pending apply uses snapshot %s", types.ErrNoPendingRollback, s.pending.SnapshotID)
+	}
+
+	pending := s.pending
+	s.clearPendingLocked()
+
+	if s.historyService != nil {
+		s.historyService.RecordConfirm(pending.ProfileID, pending.SnapshotID)
+	}
+
+	s.logger.Info("confirmed apply, auto-rollback disarmed",
+		zap.String("profile", pending.ProfileID),
+		zap.String("snapshot", pending.SnapshotID))
+
+	return &types.ConfirmResult{
+		ProfileID:   pending.ProfileID,
+		SnapshotID:  pending.SnapshotID,
+		ConfirmedAt: time.Now(),
+	}, nil
+}
+
+// ResumePendingRollback re-arms an auto-rollback persisted by a previous run.
+// A deadline that passed while the server was down triggers the rollback immediately.
+func (s *ApplyService) ResumePendingRollback() error {
+	data, err := os.ReadFile(s.pendingRollbackPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read pending rollback: %w", err)
+	}
+
+	var pending types.PendingRollback
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return fmt.Errorf("failed to parse pending rollback: %w", err)
+	}
+
+	s.mu.Lock()
+	s.pending = &pending
+	s.mu.Unlock()
+	s.snapshotService.hold(pending.SnapshotID, snapshotHoldPendingRollback)
+
+	remaining := time.Until(pending.Deadline)
+	if remaining <= 0 {
+		s.logger.Warn("auto-rollback deadline passed while server was down, rolling back",
+			zap.String("profile", pending.ProfileID),
+			zap.String("snapshot", pending.SnapshotID))
+		s.expirePendingRollback(pending.SnapshotID)
+		return nil
+	}
+
+	s.mu.Lock()
+	s.pendingTimer = time.AfterFunc(remaining, func() {
+		s.expirePendingRollback(pending.SnapshotID)
+	})
+	s.mu.Unlock()
+
+	s.logger.Info("resumed pending auto-rollback",
+		zap.String("profile", pending.ProfileID),
+		zap.String("snapshot", pending.SnapshotID),
+		zap.Time("deadline", pending.Deadline))
+	return nil
+}
+
+// armPendingRollback records the pending apply and starts its timer
+func (s *ApplyService) armPendingRollback(pending *types.PendingRollback) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pendingTimer != nil {
+		s.pendingTimer.Stop()
+	}
+
+	s.pending = pending
+	snapshotID := pending.SnapshotID
+	s.snapshotService.hold(snapshotID, snapshotHoldPendingRollback)
+	s.pendingTimer = time.AfterFunc(time.Until(pending.Deadline), func() {
+		s.expirePendingRollback(snapshotID)
+	})
+
+	s.logger.Info("armed auto-rollback",
+		zap.String("profile", pending.ProfileID),
+		zap.String("snapshot", pending.SnapshotID),
+		zap.Time("deadline", pending.Deadline))
+
+	return s.savePendingRollback(pending)
+}
+
+// disarmPendingRollback drops any pending auto-rollback without recording a confirmation
+func (s *ApplyService) disarmPendingRollback() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending != nil {
+		s.logger.Info("disarmed auto-rollback", zap.String("snapshot", s.pending.SnapshotID))
+	}
+	s.clearPendingLocked()
+}
+
+// expirePendingRollback rolls back to the pending snapshot once its deadline passes
+func (s *ApplyService) expirePendingRollback(snapshotID string) {
+	s.mu.Lock()
+	if s.pending == nil || s.pending.SnapshotID != snapshotID {
+		// Confirmed or superseded in the meantime
+		s.mu.Unlock()
+		return
+	}
+	if s.applyLock {
+		// Another operation is running; try again shortly
+		s.pendingTimer = time.AfterFunc(autoRollbackRetryDelay, func() {
+			s.expirePendingRollback(snapshotID)
+		})
+		s.mu.Unlock()
+		return
+	}
+	s.applyLock = true
+	pending := s.pending
+	// Nothing can confirm the apply any more, but the persisted state and the
+	// snapshot hold stay until the rollback returns, so a restart in between
+	// rolls back again
+	if s.pendingTimer != nil {
+		s.pendingTimer.Stop()
+		s.pendingTimer = nil
+	}
+	s.pending = nil
+	s.mu.Unlock()
+
+	s.logger.Warn("apply was not confirmed in time, rolling back",
+		zap.String("profile", pending.ProfileID),
+		zap.String("snapshot", pending.SnapshotID))
+
+	result := &types.AutoRollbackInfo{
+		ProfileID:  pending.ProfileID,
+		SnapshotID: pending.SnapshotID,
+	}
+	restored, err := s.restoreSnapshot(pending.SnapshotID, nil)
+	if err != nil {
+		s.logger.Error("auto-rollback failed",
+			zap.String("snapshot", pending.SnapshotID),
+			zap.Error(err))
+		result.Error = err.Error()
+	}
+	result.RolledBackAt = time.Now()
+	// The history entry is what reports the outcome after a restart
+	if s.historyService != nil {
+		s.historyService.RecordAutoRollback(result, restored)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastAutoRollback = result
+	s.snapshotService.release(pending.SnapshotID, snapshotHoldPendingRollback)
+	s.removePendingRollbackFile()
+	s.applyLock = false
+}
+
+// GetLastAutoRollback returns the outcome of the last auto-rollback, if any,
+// including one recorded in history before a restart
+func (s *ApplyService) GetLastAutoRollback() *types.AutoRollbackInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastAutoRollback == nil {
+		if s.historyService != nil {
+			return s.historyService.GetLastAutoRollback()
+		}
+		return nil
+	}
+	info := *s.lastAutoRollback
+	return &info
+}
+
+// clearPendingLocked stops the timer and removes the persisted state (caller must hold s.mu)
+func (s *ApplyService) clearPendingLocked() {
+	if s.pendingTimer != nil {
+		s.pendingTimer.Stop()
+		s.pendingTimer = nil
+	}
+	if s.pending != nil {
+		s.snapshotService.release(s.pending.SnapshotID, snapshotHoldPendingRollback)
+	}
+	s.pending = nil
+	s.removePendingRollbackFile()
+}
+
+// removePendingRollbackFile removes the persisted pending apply
+func (s *ApplyService) removePendingRollbackFile() {
+	if err := os.Remove(s.pendingRollbackPath()); err != nil && !os.IsNotExist(err) {
+		s.logger.Warn("failed to remove pending rollback file", zap.Error(err))
+	}
+}
+
+// savePendingRollback persists the pending apply so it survives a restart
+func (s *ApplyService) savePendingRollback(pending *types.PendingRollback) error {
+	data, err := json.MarshalIndent(pending, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal pending rollback: %w", err)
+	}
+
+	if err := utils.AtomicWriteFile(s.pendingRollbackPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write pending rollback: %w", err)
+	}
+	return nil
+}
+
+// pendingRollbackPath returns the path of the pending rollback state file
+func (s *ApplyService) pendingRollbackPath() string {
+	return filepath.Join(s.stateDir, pendingRollbackFile)
+}
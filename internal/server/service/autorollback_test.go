@@ -0,0 +1,193 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jtsang4/nettune/internal/server/adapter"
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"go.uber.org/zap"
+)
+
+func TestConfirm_NothingPending(t *testing.T) {
+	svc, _ := newFakeApplyService(t)
+
+	_, err := svc.Confirm("")
+	if !errors.Is(err, types.ErrNoPendingRollback) {
+		t.Errorf("Confirm() error = %v, want ErrNoPendingRollback", err)
+	}
+}
+
+func TestConfirm_DisarmsPendingRollback(t *testing.T) {
+	svc, _ := newFakeApplyService(t)
+	tmpDir := svc.stateDir
+
+	pending := &types.PendingRollback{
+		ProfileID:  "bbr-fq-default",
+		SnapshotID: "snapshot-123",
+		AppliedAt:  time.Now(),
+		Deadline:   time.Now().Add(time.Hour),
+	}
+	if err := svc.armPendingRollback(pending); err != nil {
+		t.Fatalf("armPendingRollback failed: %v", err)
+	}
+
+	statePath := filepath.Join(tmpDir, pendingRollbackFile)
+	if _, err := os.Stat(statePath); err != nil {
+		t.Fatalf("pending rollback should be persisted: %v", err)
+	}
+
+	if got := svc.GetPendingRollback(); got == nil || got.SnapshotID != "snapshot-123" {
+		t.Fatalf("GetPendingRollback() = %+v, want snapshot-123", got)
+	}
+
+	// A mismatched snapshot ID must not disarm the switch
+	if _, err := svc.Confirm("other-snapshot"); !errors.Is(err, types.ErrNoPendingRollback) {
+		t.Errorf("Confirm(other) error = %v, want ErrNoPendingRollback", err)
+	}
+	if svc.GetPendingRollback() == nil {
+		t.Fatal("pending rollback should survive a mismatched confirm")
+	}
+
+	result, err := svc.Confirm("snapshot-123")
+	if err != nil {
+		t.Fatalf("Confirm failed: %v", err)
+	}
+	if result.ProfileID != "bbr-fq-default" {
+		t.Errorf("ProfileID = %s, want bbr-fq-default", result.ProfileID)
+	}
+
+	if svc.GetPendingRollback() != nil {
+		t.Error("pending rollback should be cleared after confirm")
+	}
+	if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+		t.Error("pending rollback file should be removed after confirm")
+	}
+
+	entries, err := svc.historyService.GetRecentEntries(1)
+	if err != nil {
+		t.Fatalf("GetRecentEntries failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Action != "confirm" {
+		t.Errorf("expected a confirm history entry, got %+v", entries)
+	}
+}
+
+func TestResumePendingRollback(t *testing.T) {
+	svc, _ := newFakeApplyService(t)
+	tmpDir := svc.stateDir
+
+	pending := &types.PendingRollback{
+		ProfileID:  "bbr-fq-default",
+		SnapshotID: "snapshot-456",
+		AppliedAt:  time.Now(),
+		Deadline:   time.Now().Add(time.Hour),
+	}
+	if err := svc.savePendingRollback(pending); err != nil {
+		t.Fatalf("savePendingRollback failed: %v", err)
+	}
+
+	// A fresh service simulates a server restart
+	restarted := NewApplyService(nil, nil, nil, nil, tmpDir, zap.NewNop())
+	if err := restarted.ResumePendingRollback(); err != nil {
+		t.Fatalf("ResumePendingRollback failed: %v", err)
+	}
+	defer restarted.disarmPendingRollback()
+
+	got := restarted.GetPendingRollback()
+	if got == nil {
+		t.Fatal("pending rollback should be restored after restart")
+	}
+	if got.SnapshotID != "snapshot-456" {
+		t.Errorf("SnapshotID = %s, want snapshot-456", got.SnapshotID)
+	}
+	if !got.Deadline.Equal(pending.Deadline) {
+		t.Errorf("Deadline = %v, want %v", got.Deadline, pending.Deadline)
+	}
+}
+
+func TestResumePendingRollback_NoState(t *testing.T) {
+	svc, _ := newFakeApplyService(t)
+
+	if err := svc.ResumePendingRollback(); err != nil {
+		t.Fatalf("ResumePendingRollback failed: %v", err)
+	}
+	if svc.GetPendingRollback() != nil {
+		t.Error("no pending rollback expected without state file")
+	}
+}
+
+// deleteHookQdisc calls hook before removing a root qdisc
+type deleteHookQdisc struct {
+	adapter.QdiscAdapter
+	hook func() error
+}
+
+func (q deleteHookQdisc) Delete(iface string) error {
+	if err := q.hook(); err != nil {
+		return err
+	}
+	return q.QdiscAdapter.Delete(iface)
+}
+
+func TestExpirePendingRollback_KeepsStateUntilDone(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		svc, sys := newFakeApplyService(t)
+		statePath := filepath.Join(svc.stateDir, pendingRollbackFile)
+
+		result, err := svc.Apply(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "commit", AutoRollbackSeconds: 60})
+		if err != nil || !result.Success || result.Pending == nil {
+			t.Fatalf("Apply failed: %v %v", err, result)
+		}
+
+		persisted := false
+		sys.Qdisc = deleteHookQdisc{sys.Qdisc, func() error {
+			_, err := os.Stat(statePath)
+			persisted = err == nil
+			if fail {
+				return errors.New("device busy")
+			}
+			return nil
+		}}
+		svc.expirePendingRollback(result.SnapshotID)
+
+		if !persisted {
+			t.Errorf("fail=%v: pending rollback should stay persisted while the rollback runs", fail)
+		}
+		if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+			t.Errorf("fail=%v: pending rollback file should be removed once the rollback returns", fail)
+		}
+		if err := svc.snapshotService.Delete(result.SnapshotID); err != nil {
+			t.Errorf("fail=%v: snapshot should be released after the rollback: %v", fail, err)
+		}
+
+		status, err := svc.GetStatus()
+		if err != nil {
+			t.Fatalf("GetStatus failed: %v", err)
+		}
+		last := status.LastAutoRollback
+		if last == nil || last.SnapshotID != result.SnapshotID || (last.Error != "") != fail {
+			t.Errorf("fail=%v: last_auto_rollback = %+v", fail, last)
+		}
+		if status.PendingRollback != nil {
+			t.Errorf("fail=%v: pending rollback = %+v, want none", fail, status.PendingRollback)
+		}
+
+		// After a restart the outcome comes from history
+		history, err := NewHistoryService(svc.historyService.historyDir, zap.NewNop())
+		if err != nil {
+			t.Fatalf("NewHistoryService failed: %v", err)
+		}
+		restarted := NewApplyService(svc.profileService, svc.snapshotService, history, sys, svc.stateDir, zap.NewNop())
+		if got := restarted.GetLastAutoRollback(); got == nil || got.SnapshotID != last.SnapshotID || got.Error != last.Error || !got.RolledBackAt.Equal(last.RolledBackAt) {
+			t.Errorf("fail=%v: last_auto_rollback after restart = %+v, want %+v", fail, got, last)
+		}
+		entries, err := history.GetRecentEntries(1)
+		if err != nil || len(entries) != 1 || entries[0].Action != "rollback" || entries[0].Details["auto"] != true {
+			t.Errorf("fail=%v: last history entry = %+v, %v, want a rollback marked auto", fail, entries, err)
+		}
+	}
+}
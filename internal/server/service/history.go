@@ -14,22 +14,28 @@ import (
 	"go.uber.org/zap"
 )
 
+// maxHistoryEntrySize bounds one journal line; entries carry the scope of an
+// apply or rollback, which lists every setting it changed
+const maxHistoryEntrySize = 16 * 1024 * 1024
+
 // HistoryService manages operation history and audit logs
 type HistoryService struct {
-	historyDir string
-	mu         sync.Mutex
-	logger     *zap.Logger
-	lastApply  *types.LastApplyInfo
+	historyDir       string
+	mu               sync.Mutex
+	logger           *zap.Logger
+	lastApply        *types.LastApplyInfo
+	lastAutoRollback *types.AutoRollbackInfo
 }
 
 // HistoryEntry represents a single history entry
 type HistoryEntry struct {
 	Timestamp  time.Time              `json:"timestamp"`
-	Action     string                 `json:"action"` // "apply", "rollback", "snapshot"
+	Action     string                 `json:"action"` // "apply", "confirm", "rollback", "recovery", "snapshot", "snapshot_delete"
 	ProfileID  string                 `json:"profile_id,omitempty"`
 	SnapshotID string                 `json:"snapshot_id,omitempty"`
 	Success    bool                   `json:"success"`
 	Details    map[string]interface{} `json:"details,omitempty"`
+	Scope      *types.ChangeScope     `json:"scope,omitempty"` // what an apply or rollback changed
 }
 
 // NewHistoryService creates a new HistoryService
@@ -44,20 +50,21 @@ func NewHistoryService(historyDir string, logger *zap.Logger) (*HistoryService,
 		return nil, fmt.Errorf("failed to create history directory: %w", err)
 	}
 
-	// Load last apply info
-	s.loadLastApply()
+	// Load last apply and auto-rollback info
+	s.loadLast()
 
 	return s, nil
 }
 
-// RecordApply records a profile apply operation
-func (s *HistoryService) RecordApply(profileID, snapshotID string, success bool) {
+// RecordApply records a profile apply operation and what it changed
+func (s *HistoryService) RecordApply(profileID, snapshotID string, success bool, scope *types.ChangeScope) {
 	entry := &HistoryEntry{
 		Timestamp:  time.Now(),
 		Action:     "apply",
 		ProfileID:  profileID,
 		SnapshotID: snapshotID,
 		Success:    success,
+		Scope:      scope,
 	}
 
 	if err := s.appendEntry(entry); err != nil {
@@ -75,13 +82,29 @@ func (s *HistoryService) RecordApply(profileID, snapshotID string, success bool)
 	}
 }
 
-// RecordRollback records a rollback operation
-func (s *HistoryService) RecordRollback(snapshotID string, success bool) {
+// RecordConfirm records the confirmation of an apply that had auto-rollback armed
+func (s *HistoryService) RecordConfirm(profileID, snapshotID string) {
+	entry := &HistoryEntry{
+		Timestamp:  time.Now(),
+		Action:     "confirm",
+		ProfileID:  profileID,
+		SnapshotID: snapshotID,
+		Success:    true,
+	}
+
+	if err := s.appendEntry(entry); err != nil {
+		s.logger.Error("failed to record confirm", zap.Error(err))
+	}
+}
+
+// RecordRollback records a rollback operation and what it restored
+func (s *HistoryService) RecordRollback(snapshotID string, success bool, scope *types.ChangeScope) {
 	entry := &HistoryEntry{
 		Timestamp:  time.Now(),
 		Action:     "rollback",
 		SnapshotID: snapshotID,
 		Success:    success,
+		Scope:      scope,
 	}
 
 	if err := s.appendEntry(entry); err != nil {
@@ -89,6 +112,61 @@ func (s *HistoryService) RecordRollback(snapshotID string, success bool) {
 	}
 }
 
+// RecordAutoRollback records the rollback of an apply that was not confirmed
+// in time, marked auto; scope is nil when nothing was restored
+func (s *HistoryService) RecordAutoRollback(info *types.AutoRollbackInfo, scope *types.ChangeScope) {
+	details := map[string]interface{}{"auto": true}
+	if info.Error != "" {
+		details["error"] = info.Error
+	}
+
+	entry := &HistoryEntry{
+		Timestamp:  info.RolledBackAt,
+		Action:     "rollback",
+		ProfileID:  info.ProfileID,
+		SnapshotID: info.SnapshotID,
+		Success:    info.Error == "",
+		Details:    details,
+		Scope:      scope,
+	}
+
+	if err := s.appendEntry(entry); err != nil {
+		s.logger.Error("failed to record auto-rollback", zap.Error(err))
+	}
+
+	s.mu.Lock()
+	last := *info
+	s.lastAutoRollback = &last
+	s.mu.Unlock()
+}
+
+// RecordRecovery records the handling of an apply interrupted by a crash
+func (s *HistoryService) RecordRecovery(info *types.RecoveryInfo) {
+	details := map[string]interface{}{
+		"completed_steps": info.CompletedSteps,
+		"rolled_back":     info.RolledBack,
+	}
+	if info.InterruptedStep != "" {
+		details["interrupted_step"] = info.InterruptedStep
+	}
+	if info.Error != "" {
+		details["error"] = info.Error
+	}
+
+	entry := &HistoryEntry{
+		Timestamp:  time.Now(),
+		Action:     "recovery",
+		ProfileID:  info.ProfileID,
+		SnapshotID: info.SnapshotID,
+		Success:    info.RolledBack,
+		Details:    details,
+	}
+
+	if err := s.appendEntry(entry); err != nil {
+		s.logger.Error("failed to record recovery", zap.Error(err))
+	}
+}
+
 // RecordSnapshot records a snapshot creation
 func (s *HistoryService) RecordSnapshot(snapshotID string) {
 	entry := &HistoryEntry{
@@ -103,6 +181,78 @@ func (s *HistoryService) RecordSnapshot(snapshotID string) {
 	}
 }
 
+// RecordSnapshotDelete records the removal of a snapshot, by request or by retention
+func (s *HistoryService) RecordSnapshotDelete(snapshotID, reason string) {
+	entry := &HistoryEntry{
+		Timestamp:  time.Now(),
+		Action:     "snapshot_delete",
+		SnapshotID: snapshotID,
+		Success:    true,
+		Details:    map[string]interface{}{"reason": reason},
+	}
+
+	if err := s.appendEntry(entry); err != nil {
+		s.logger.Error("failed to record snapshot deletion", zap.Error(err))
+	}
+}
+
+// RecentApplySnapshots returns the snapshots of the last n successful applies, newest first
+func (s *HistoryService) RecentApplySnapshots(n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	entries, err := s.GetRecentEntries(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if entry.Action == "apply" && entry.Success && entry.SnapshotID != "" {
+			ids = append(ids, entry.SnapshotID)
+			if len(ids) == n {
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+// FirstChangeAt returns when nettune first changed the host (the oldest apply,
+// rollback or recovery entry), or the zero time when it never did
+func (s *HistoryService) FirstChangeAt() (time.Time, error) {
+	entries, err := s.GetRecentEntries(0)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var first time.Time
+	for _, entry := range entries {
+		switch entry.Action {
+		case "apply", "rollback", "recovery":
+			first = entry.Timestamp
+		}
+	}
+	return first, nil
+}
+
+// ChangesSince returns what the applies and rollbacks after t changed
+func (s *HistoryService) ChangesSince(t time.Time) (*types.ChangeScope, error) {
+	entries, err := s.GetRecentEntries(0)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := &types.ChangeScope{}
+	for _, entry := range entries {
+		if (entry.Action == "apply" || entry.Action == "rollback") && entry.Timestamp.After(t) {
+			scope.Merge(entry.Scope)
+		}
+	}
+	return scope, nil
+}
+
 // GetLastApply returns the last apply info
 func (s *HistoryService) GetLastApply() *types.LastApplyInfo {
 	s.mu.Lock()
@@ -110,6 +260,18 @@ func (s *HistoryService) GetLastApply() *types.LastApplyInfo {
 	return s.lastApply
 }
 
+// GetLastAutoRollback returns the outcome of the last auto-rollback, if any
+func (s *HistoryService) GetLastAutoRollback() *types.AutoRollbackInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastAutoRollback == nil {
+		return nil
+	}
+	info := *s.lastAutoRollback
+	return &info
+}
+
 // GetRecentEntries returns recent history entries
 func (s *HistoryService) GetRecentEntries(limit int) ([]*HistoryEntry, error) {
 	journalPath := s.getJournalPath()
@@ -124,6 +286,7 @@ func (s *HistoryService) GetRecentEntries(limit int) ([]*HistoryEntry, error) {
 
 	var entries []*HistoryEntry
 	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxHistoryEntrySize)
 	for scanner.Scan() {
 		var entry HistoryEntry
 		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
@@ -131,6 +294,9 @@ func (s *HistoryService) GetRecentEntries(limit int) ([]*HistoryEntry, error) {
 		}
 		entries = append(entries, &entry)
 	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
 
 	// Return last N entries
 	if limit > 0 && len(entries) > limit {
@@ -171,21 +337,30 @@ func (s *HistoryService) getJournalPath() string {
 	return filepath.Join(s.historyDir, "journal.jsonl")
 }
 
-// loadLastApply loads the last apply info from history
-func (s *HistoryService) loadLastApply() {
+// loadLast loads the last apply and auto-rollback info from history
+func (s *HistoryService) loadLast() {
 	entries, err := s.GetRecentEntries(100)
 	if err != nil {
 		return
 	}
 
 	for _, entry := range entries {
-		if entry.Action == "apply" && entry.Success {
+		if s.lastApply == nil && entry.Action == "apply" && entry.Success {
 			s.lastApply = &types.LastApplyInfo{
 				ProfileID: entry.ProfileID,
 				AppliedAt: entry.Timestamp,
 				Success:   entry.Success,
 			}
-			return
+		}
+		if s.lastAutoRollback == nil && entry.Action == "rollback" && entry.Details["auto"] == true {
+			s.lastAutoRollback = &types.AutoRollbackInfo{
+				ProfileID:    entry.ProfileID,
+				SnapshotID:   entry.SnapshotID,
+				RolledBackAt: entry.Timestamp,
+			}
+			if msg, ok := entry.Details["error"].(string); ok {
+				s.lastAutoRollback.Error = msg
+			}
 		}
 	}
 }
@@ -1,11 +1,14 @@
 package service
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 
+	"github.com/jtsang4/nettune/internal/shared/types"
 	"go.uber.org/zap"
 )
 
@@ -38,7 +41,7 @@ func TestHistoryService_RecordApply(t *testing.T) {
 	}
 
 	// Record a successful apply
-	svc.RecordApply("bbr-fq-default", "snapshot-123", true)
+	svc.RecordApply("bbr-fq-default", "snapshot-123", true, nil)
 
 	// Check last apply info
 	lastApply := svc.GetLastApply()
@@ -69,7 +72,7 @@ func TestHistoryService_RecordApply_Failure(t *testing.T) {
 	}
 
 	// Record a failed apply
-	svc.RecordApply("bad-profile", "snapshot-123", false)
+	svc.RecordApply("bad-profile", "snapshot-123", false, nil)
 
 	// Last apply should still be nil (failed applies don't update it)
 	lastApply := svc.GetLastApply()
@@ -87,7 +90,7 @@ func TestHistoryService_RecordRollback(t *testing.T) {
 		t.Fatalf("NewHistoryService failed: %v", err)
 	}
 
-	svc.RecordRollback("snapshot-123", true)
+	svc.RecordRollback("snapshot-123", true, nil)
 
 	// Verify entry was recorded
 	entries, err := svc.GetRecentEntries(10)
@@ -143,7 +146,7 @@ func TestHistoryService_GetRecentEntries(t *testing.T) {
 
 	// Record multiple entries
 	for i := 0; i < 5; i++ {
-		svc.RecordApply("profile-"+string(rune('a'+i)), "snapshot-"+string(rune('0'+i)), true)
+		svc.RecordApply("profile-"+string(rune('a'+i)), "snapshot-"+string(rune('0'+i)), true, nil)
 		time.Sleep(10 * time.Millisecond) // Ensure different timestamps
 	}
 
@@ -210,7 +213,7 @@ func TestHistoryService_LoadLastApply(t *testing.T) {
 		t.Fatalf("NewHistoryService failed: %v", err)
 	}
 
-	svc1.RecordApply("test-profile", "snapshot-abc", true)
+	svc1.RecordApply("test-profile", "snapshot-abc", true, nil)
 
 	// Create new service instance - should load last apply from history
 	svc2, err := NewHistoryService(tmpDir, logger)
@@ -261,3 +264,30 @@ func TestHistoryEntry(t *testing.T) {
 		t.Error("ProfileID should be 'test-profile'")
 	}
 }
+
+func TestHistoryService_LargeScope(t *testing.T) {
+	svc, err := NewHistoryService(t.TempDir(), zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewHistoryService failed: %v", err)
+	}
+
+	// A rollback to a full snapshot can list thousands of sysctl keys
+	scope := &types.ChangeScope{}
+	for i := 0; i < 5000; i++ {
+		scope.Sysctl = append(scope.Sysctl, fmt.Sprintf("net.ipv4.conf.veth%d.rp_filter", i))
+	}
+	svc.RecordRollback("imported", true, scope)
+	svc.RecordApply("bbr-fq-default", "later", true, &types.ChangeScope{Sysctl: []string{"net.ipv4.tcp_congestion_control"}})
+
+	entries, err := svc.GetRecentEntries(0)
+	if err != nil {
+		t.Fatalf("GetRecentEntries failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].SnapshotID != "later" {
+		t.Fatalf("entries = %d, want the apply after the large rollback too", len(entries))
+	}
+	since, err := svc.ChangesSince(time.Time{})
+	if err != nil || !slices.Contains(since.Sysctl, "net.ipv4.tcp_congestion_control") {
+		t.Errorf("ChangesSince() = %v, %v, want the later apply included", since, err)
+	}
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jtsang4/nettune/internal/server/adapter"
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"go.uber.org/zap"
+)
+
+// Sysctl subtrees with one directory per interface, e.g. net.ipv4.conf.eth0.rp_filter
+var perInterfaceSysctlPrefixes = []string{
+	"net.ipv4.conf.",
+	"net.ipv6.conf.",
+	"net.ipv4.neigh.",
+	"net.ipv6.neigh.",
+}
+
+// Setup script calls whose first argument is an interface
+var interfaceScriptCalls = []string{"set_qdisc", "set_link", "set_ip_link"}
+
+// hostSnapshot returns a snapshot ready to be restored on this host. Imported
+// snapshots and rollbacks with an interface map have their interfaces checked
+// against the host and renamed or dropped before anything is changed.
+func (s *ApplyService) hostSnapshot(snapshotID string, ifaceMap map[string]string) (*types.Snapshot, error) {
+	snapshot, err := s.snapshotService.Get(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if !snapshot.Imported() && len(ifaceMap) == 0 {
+		return snapshot, nil
+	}
+
+	local, err := s.adapter.Qdisc.ListInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkInterfaceMap(snapshotInterfaces(snapshot.State), local, ifaceMap); err != nil {
+		return nil, err
+	}
+
+	mapped := mapSnapshotInterfaces(snapshot, ifaceMap)
+	if snapshot.Imported() {
+		// Routes of another host differ in gateways and sources, so they are
+		// matched to the local routes to the same destination through the same device
+		mapped.State.Routes = s.localRoutes(mapped.State.Routes)
+	}
+	return mapped, nil
+}
+
+// snapshotInterfaces returns the interfaces whose qdisc, link settings or
+// queue steering a snapshot records, sorted
+func snapshotInterfaces(state *types.SystemState) []string {
+	seen := make(map[string]bool)
+	if state != nil {
+		for iface := range state.Qdisc {
+			seen[iface] = true
+		}
+		for iface := range state.Link {
+			seen[iface] = true
+		}
+		for path := range state.Steering {
+			if iface, ok := adapter.QueuePathInterface(path); ok {
+				seen[iface] = true
+			}
+		}
+	}
+	return sortedKeys(seen)
+}
+
+// checkInterfaceMap makes sure every interface of a snapshot is mapped, skipped
+// or present on this host, and that the map only names snapshot interfaces and
+// distinct local ones
+func checkInterfaceMap(snapshotIfaces, localIfaces []string, ifaceMap map[string]string) error {
+	inSnapshot := make(map[string]bool)
+	for _, iface := range snapshotIfaces {
+		inSnapshot[iface] = true
+	}
+	local := make(map[string]bool)
+	for _, iface := range localIfaces {
+		local[iface] = true
+	}
+
+	targets := make(map[string]string)
+	for _, from := range sortedKeys(ifaceMap) {
+		to := ifaceMap[from]
+		if !inSnapshot[from] {
+			return fmt.Errorf("%w: interface_map names %s, which the snapshot does not record", types.ErrValidationFailed, from)
+		}
+		if to == "" {
+			continue
+		}
+		if !local[to] {
+			return fmt.Errorf("%w: interface_map maps %s to %s, which is not up on this host", types.ErrValidationFailed, from, to)
+		}
+		if other, ok := targets[to]; ok {
+			return fmt.Errorf("%w: interface_map maps both %s and %s to %s", types.ErrValidationFailed, other, from, to)
+		}
+		targets[to] = from
+	}
+
+	var missing []string
+	for _, iface := range snapshotIfaces {
+		if _, ok := ifaceMap[iface]; !ok && !local[iface] {
+			missing = append(missing, iface)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: snapshot interfaces %s are not up on this host; map them to local interfaces or skip them with an empty name in interface_map",
+			types.ErrValidationFailed, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// mapSnapshotInterfaces returns a copy of a snapshot with its interfaces renamed
+// by ifaceMap; interfaces mapped to "" are dropped. Per-interface sysctl keys,
+// queue steering, route devices, the rollback scope, the sysctl drop-in and the
+// qdisc and link setup scripts follow. IRQ affinity of an imported snapshot is
+// dropped, since IRQ numbers belong to the host that exported it.
+func mapSnapshotInterfaces(snapshot *types.Snapshot, ifaceMap map[string]string) *types.Snapshot {
+	mapped := *snapshot
+	state := *snapshot.State
+	mapped.State = &state
+
+	rename := func(iface string) (string, bool) {
+		to, ok := ifaceMap[iface]
+		if !ok {
+			return iface, true
+		}
+		return to, to != ""
+	}
+
+	state.Sysctl = make(map[string]string, len(snapshot.State.Sysctl))
+	for key, value := range snapshot.State.Sysctl {
+		if key, ok := mapSysctlKey(key, rename); ok {
+			state.Sysctl[key] = value
+		}
+	}
+
+	if snapshot.State.Qdisc != nil {
+		state.Qdisc = make(map[string]*types.QdiscInfo, len(snapshot.State.Qdisc))
+		for iface, info := range snapshot.State.Qdisc {
+			if to, ok := rename(iface); ok {
+				state.Qdisc[to] = info
+			}
+		}
+	}
+
+	if snapshot.State.Link != nil {
+		state.Link = make(map[string]*types.LinkSettings, len(snapshot.State.Link))
+		for iface, settings := range snapshot.State.Link {
+			if to, ok := rename(iface); ok {
+				state.Link[to] = settings
+			}
+		}
+	}
+
+	if snapshot.State.Steering != nil {
+		state.Steering = make(map[string]string, len(snapshot.State.Steering))
+		for path, value := range snapshot.State.Steering {
+			if path, ok := mapSteeringPath(path, snapshot.Imported(), rename); ok {
+				state.Steering[path] = value
+			}
+		}
+	}
+
+	if snapshot.State.Routes != nil {
+		state.Routes = make(map[string]*types.RouteAttrs, len(snapshot.State.Routes))
+		for key, attrs := range snapshot.State.Routes {
+			if key, ok := mapRouteKey(key, rename); ok {
+				state.Routes[key] = attrs
+			}
+		}
+	}
+
+	if snapshot.Scope != nil {
+		scope := &types.ChangeScope{}
+		for _, key := range snapshot.Scope.Sysctl {
+			if key, ok := mapSysctlKey(key, rename); ok {
+				scope.Sysctl = append(scope.Sysctl, key)
+			}
+		}
+		for _, key := range snapshot.Scope.Link {
+			iface, name, _ := strings.Cut(key, "/")
+			if to, ok := rename(iface); ok {
+				scope.Link = append(scope.Link, to+"/"+name)
+			}
+		}
+		for _, path := range snapshot.Scope.Steering {
+			if path, ok := mapSteeringPath(path, snapshot.Imported(), rename); ok {
+				scope.Steering = append(scope.Steering, path)
+			}
+		}
+		for _, key := range snapshot.Scope.Routes {
+			if key, ok := mapRouteKey(key, rename); ok {
+				scope.Routes = append(scope.Routes, key)
+			}
+		}
+		mapped.Scope = scope
+	}
+
+	mapped.Backups = make(map[string]string, len(snapshot.Backups))
+	for path, content := range snapshot.Backups {
+		switch path {
+		case adapter.NettuneSysctlFilePath:
+			content = mapSysctlFile(content, rename)
+		case adapter.NettuneQdiscScriptPath, adapter.NettuneLinkScriptPath:
+			content = mapSetupScript(content, rename)
+		}
+		mapped.Backups[path] = content
+	}
+	return &mapped
+}
+
+// mapSysctlKey renames the interface of a per-interface sysctl key. Interfaces
+// are written with "/" for ".", e.g. net.ipv4.conf.eth0/100.rp_filter.
+func mapSysctlKey(key string, rename func(string) (string, bool)) (string, bool) {
+	for _, prefix := range perInterfaceSysctlPrefixes {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		name, param, ok := strings.Cut(rest, ".")
+		if !ok {
+			return key, true
+		}
+		to, keep := rename(strings.ReplaceAll(name, "/", "."))
+		return prefix + strings.ReplaceAll(to, ".", "/") + "." + param, keep
+	}
+	return key, true
+}
+
+// mapSteeringPath renames the interface of a queue steering path. IRQ affinity
+// paths are kept, except in imported snapshots.
+func mapSteeringPath(path string, imported bool, rename func(string) (string, bool)) (string, bool) {
+	iface, ok := adapter.QueuePathInterface(path)
+	if !ok {
+		return path, !imported
+	}
+	to, keep := rename(iface)
+	return strings.Replace(path, "/"+iface+"/", "/"+to+"/", 1), keep
+}
+
+// mapRouteKey renames the device of a "family spec" route key
+func mapRouteKey(key string, rename func(string) (string, bool)) (string, bool) {
+	fields := strings.Fields(key)
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] != "dev" {
+			continue
+		}
+		to, keep := rename(fields[i+1])
+		if !keep {
+			return "", false
+		}
+		fields[i+1] = to
+	}
+	return strings.Join(fields, " "), true
+}
+
+// mapSysctlFile renames the per-interface keys of a sysctl drop-in and drops
+// the lines of skipped interfaces
+func mapSysctlFile(content string, rename func(string) (string, bool)) string {
+	lines := strings.SplitAfter(content, "\n")
+	var out strings.Builder
+	for _, line := range lines {
+		key, value, ok := strings.Cut(line, "=")
+		trimmed := strings.TrimSpace(key)
+		if !ok || trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			out.WriteString(line)
+			continue
+		}
+		mapped, keep := mapSysctlKey(trimmed, rename)
+		if !keep {
+			continue
+		}
+		out.WriteString(strings.Replace(key, trimmed, mapped, 1) + "=" + value)
+	}
+	return out.String()
+}
+
+// mapSetupScript renames the interfaces of the set_qdisc, set_link and
+// set_ip_link calls of a setup script and drops the calls of skipped interfaces.
+// Arguments are single-quoted words, as shellQuoteAll writes them.
+func mapSetupScript(content string, rename func(string) (string, bool)) string {
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(content, "\n") {
+		body, newline := strings.CutSuffix(line, "\n")
+		words := strings.Split(body, " ")
+		if len(words) < 2 || !slices.Contains(interfaceScriptCalls, words[0]) {
+			out.WriteString(line)
+			continue
+		}
+
+		iface := strings.Trim(words[1], "'")
+		to, keep := rename(iface)
+		if !keep {
+			continue
+		}
+		for i, word := range words {
+			if i > 0 && word == "'"+iface+"'" {
+				words[i] = "'" + to + "'"
+			}
+		}
+		out.WriteString(strings.Join(words, " "))
+		if newline {
+			out.WriteString("\n")
+		}
+	}
+	return out.String()
+}
+
+// localRoutes matches the routes of another host to the local routes with the
+// same family, destination and device. Routes without a local match are skipped.
+func (s *ApplyService) localRoutes(saved map[string]*types.RouteAttrs) map[string]*types.RouteAttrs {
+	if saved == nil {
+		return nil
+	}
+
+	local := make(map[string]*types.RouteAttrs)
+	for _, key := range sortedKeys(saved) {
+		want, err := adapter.ParseRouteKey(key)
+		if err != nil {
+			s.logger.Warn("invalid route in snapshot, skipping", zap.String("route", key))
+			continue
+		}
+		routes, err := s.adapter.Route.Find(want.Family, want.Dest())
+		if err != nil {
+			s.logger.Warn("failed to find local routes", zap.String("route", key), zap.Error(err))
+			continue
+		}
+		found := false
+		for _, route := range routes {
+			if want.Dev() == "" || route.Dev() == want.Dev() {
+				local[route.Key()] = saved[key]
+				found = true
+			}
+		}
+		if !found {
+			s.logger.Warn("no local route matches the snapshot route, skipping", zap.String("route", key))
+		}
+	}
+	return local
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jtsang4/nettune/internal/server/adapter"
+	"github.com/jtsang4/nettune/internal/shared/types"
+)
+
+func TestMapSnapshotInterfaces(t *testing.T) {
+	cwnd := 10
+	qdiscScript := adapter.GenerateQdiscSetupScript([]adapter.QdiscTarget{
+		{Interface: "ens3", Type: "fq"},
+		{Interface: "ens4", Type: "fq_codel"},
+	})
+	snapshot := &types.Snapshot{
+		ID:         "s1",
+		Provenance: &types.SnapshotProvenance{Reason: types.SnapshotReasonImport},
+		State: &types.SystemState{
+			Sysctl: map[string]string{
+				"net.ipv4.tcp_congestion_control":  "bbr",
+				"net.ipv4.conf.ens3.rp_filter":     "2",
+				"net.ipv4.conf.ens4/100.rp_filter": "0",
+			},
+			Qdisc: map[string]*types.QdiscInfo{
+				"ens3": {Type: "fq"},
+				"ens4": {Type: "fq_codel"},
+			},
+			Steering: map[string]string{
+				"/sys/class/net/ens3/queues/rx-0/rps_cpus": "3",
+				"/sys/class/net/ens4/queues/rx-0/rps_cpus": "0",
+				"/proc/irq/24/smp_affinity_list":           "0",
+			},
+			Routes: map[string]*types.RouteAttrs{
+				"inet default via 192.0.2.1 dev ens3": {InitCwnd: &cwnd},
+				"inet 10.0.0.0/8 dev ens4":            {InitCwnd: &cwnd},
+			},
+		},
+		Scope: &types.ChangeScope{
+			Sysctl: []string{"net.ipv4.tcp_congestion_control", "net.ipv4.conf.ens3.rp_filter", "net.ipv4.conf.ens4.rp_filter"},
+			Link:   []string{"ens3/mtu", "ens4/mtu"},
+		},
+		Backups: map[string]string{
+			adapter.NettuneSysctlFilePath:  "# Managed by nettune\nnet.ipv4.tcp_congestion_control = bbr\nnet.ipv4.conf.ens3.rp_filter = 2\nnet.ipv4.conf.ens4/100.rp_filter = 0\n",
+			adapter.NettuneQdiscScriptPath: qdiscScript,
+		},
+	}
+
+	// The VLAN ens4.100 is an interface of its own, written ens4/100 in sysctl keys
+	mapped := mapSnapshotInterfaces(snapshot, map[string]string{"ens3": "eth0", "ens4": "", "ens4.100": "eth1.100"})
+
+	wantSysctl := map[string]string{
+		"net.ipv4.tcp_congestion_control":  "bbr",
+		"net.ipv4.conf.eth0.rp_filter":     "2",
+		"net.ipv4.conf.eth1/100.rp_filter": "0",
+	}
+	if !reflect.DeepEqual(mapped.State.Sysctl, wantSysctl) {
+		t.Errorf("Sysctl = %v, want %v", mapped.State.Sysctl, wantSysctl)
+	}
+	if len(mapped.State.Qdisc) != 1 || mapped.State.Qdisc["eth0"] == nil {
+		t.Errorf("Qdisc = %v, want only eth0", mapped.State.Qdisc)
+	}
+	wantSteering := map[string]string{"/sys/class/net/eth0/queues/rx-0/rps_cpus": "3"}
+	if !reflect.DeepEqual(mapped.State.Steering, wantSteering) {
+		t.Errorf("Steering = %v, want %v without the imported IRQ", mapped.State.Steering, wantSteering)
+	}
+	if len(mapped.State.Routes) != 1 || mapped.State.Routes["inet default via 192.0.2.1 dev eth0"] == nil {
+		t.Errorf("Routes = %v", mapped.State.Routes)
+	}
+	wantScope := &types.ChangeScope{
+		Sysctl: []string{"net.ipv4.tcp_congestion_control", "net.ipv4.conf.eth0.rp_filter"},
+		Link:   []string{"eth0/mtu"},
+	}
+	if !reflect.DeepEqual(mapped.Scope, wantScope) {
+		t.Errorf("Scope = %+v, want %+v", mapped.Scope, wantScope)
+	}
+
+	wantFile := "# Managed by nettune\nnet.ipv4.tcp_congestion_control = bbr\nnet.ipv4.conf.eth0.rp_filter = 2\nnet.ipv4.conf.eth1/100.rp_filter = 0\n"
+	if got := mapped.Backups[adapter.NettuneSysctlFilePath]; got != wantFile {
+		t.Errorf("sysctl file = %q, want %q", got, wantFile)
+	}
+	wantScript := adapter.GenerateQdiscSetupScript([]adapter.QdiscTarget{{Interface: "eth0", Type: "fq"}})
+	if got := mapped.Backups[adapter.NettuneQdiscScriptPath]; got != wantScript {
+		t.Errorf("qdisc script = %q, want %q", got, wantScript)
+	}
+
+	if snapshot.State.Qdisc["ens3"] == nil || !strings.Contains(snapshot.Backups[adapter.NettuneQdiscScriptPath], "'ens4'") {
+		t.Error("mapping should not modify the original snapshot")
+	}
+}
+
+func TestCheckInterfaceMap(t *testing.T) {
+	snapshotIfaces := []string{"ens3", "ens4"}
+	local := []string{"eth0", "eth1"}
+
+	tests := []struct {
+		name     string
+		ifaceMap map[string]string
+		wantErr  string
+	}{
+		{"mapped and skipped", map[string]string{"ens3": "eth0", "ens4": ""}, ""},
+		{"both mapped", map[string]string{"ens3": "eth1", "ens4": "eth0"}, ""},
+		{"unmapped", map[string]string{"ens3": "eth0"}, "ens4 are not up"},
+		{"no map", nil, "ens3, ens4 are not up"},
+		{"unknown source", map[string]string{"ens3": "eth0", "ens4": "", "ens5": "eth1"}, "ens5, which the snapshot does not record"},
+		{"missing target", map[string]string{"ens3": "eth2", "ens4": ""}, "eth2, which is not up"},
+		{"shared target", map[string]string{"ens3": "eth0", "ens4": "eth0"}, "both ens3 and ens4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkInterfaceMap(snapshotIfaces, local, tt.ifaceMap)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkInterfaceMap() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, types.ErrValidationFailed) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkInterfaceMap() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := checkInterfaceMap([]string{"eth0"}, local, nil); err != nil {
+		t.Errorf("interfaces present on the host need no map: %v", err)
+	}
+}
+
+func TestRollbackImportedSnapshotWithInterfaceMap(t *testing.T) {
+	svc, sys := newFakeApplyService(t)
+	result, err := svc.Apply(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "commit"})
+	if err != nil || !result.Success {
+		t.Fatalf("Apply failed: %v %v", err, result)
+	}
+	after, err := svc.snapshotService.Create(&SnapshotOptions{})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// Pretend the snapshot came from a host whose NICs are ens3 and ens4
+	foreign := mapSnapshotInterfaces(after, map[string]string{"eth0": "ens3", "eth1": "ens4"})
+	foreign.ID = newSnapshotID(time.Now().Add(time.Second))
+	foreign.Provenance = &types.SnapshotProvenance{Reason: types.SnapshotReasonImport, ImportedFrom: after.ID}
+	if err := os.MkdirAll(filepath.Join(svc.snapshotService.snapshotsDir, foreign.ID), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.snapshotService.saveSnapshot(foreign); err != nil {
+		t.Fatalf("saveSnapshot failed: %v", err)
+	}
+
+	if err := svc.Rollback(result.SnapshotID); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if got := mustSysctl(t, sys, "net.ipv4.tcp_congestion_control"); got != "cubic" {
+		t.Fatalf("tcp_congestion_control = %s after rolling back the apply", got)
+	}
+
+	err = svc.RollbackMapped(foreign.ID, nil)
+	if !errors.Is(err, types.ErrValidationFailed) || !strings.Contains(err.Error(), "interface_map") {
+		t.Fatalf("RollbackMapped() without a map error = %v, want ErrValidationFailed", err)
+	}
+	if got := mustSysctl(t, sys, "net.ipv4.tcp_congestion_control"); got != "cubic" {
+		t.Errorf("a rejected rollback changed tcp_congestion_control to %s", got)
+	}
+
+	if err := svc.RollbackMapped(foreign.ID, map[string]string{"ens3": "eth0", "ens4": ""}); err != nil {
+		t.Fatalf("RollbackMapped failed: %v", err)
+	}
+	if got := mustSysctl(t, sys, "net.ipv4.tcp_congestion_control"); got != "bbr" {
+		t.Errorf("tcp_congestion_control = %s, want bbr", got)
+	}
+	if info, _ := sys.Qdisc.Get("eth0"); info == nil || info.Type != "fq" {
+		t.Errorf("eth0 qdisc = %+v, want fq", info)
+	}
+	if info, _ := sys.Qdisc.Get("eth1"); info == nil || info.Type != "fq_codel" {
+		t.Errorf("the skipped eth1 qdisc = %+v, want fq_codel", info)
+	}
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"github.com/jtsang4/nettune/internal/shared/utils"
+	"go.uber.org/zap"
+)
+
+// maxRecentJobs bounds how many jobs are kept in memory
+const maxRecentJobs = 50
+
+// JobService runs applies in the background and tracks their progress
+type JobService struct {
+	applyService *ApplyService
+	mu           sync.Mutex
+	jobs         map[string]*jobEntry
+	order        []string // job IDs, oldest first
+	running      string
+	logger       *zap.Logger
+}
+
+// jobEntry pairs a job with a channel closed when it finishes
+type jobEntry struct {
+	job  *types.Job
+	done chan struct{}
+}
+
+// NewJobService creates a new JobService
+func NewJobService(applyService *ApplyService, logger *zap.Logger) *JobService {
+	return &JobService{
+		applyService: applyService,
+		jobs:         make(map[string]*jobEntry),
+		logger:       logger,
+	}
+}
+
+// SubmitApply checks the request, reserves the apply lock and starts the apply
+// in the background. Errors that prevent the apply from starting are returned directly.
+func (s *JobService) SubmitApply(req *types.ApplyRequest) (*types.Job, error) {
+	if err := s.applyService.acquireApplyLock(); err != nil {
+		return nil, err
+	}
+
+	profile, err := s.applyService.prepareApply(req)
+	if err != nil {
+		s.applyService.releaseApplyLock()
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &types.Job{
+		ID:        fmt.Sprintf("job_%s_%s", now.UTC().Format("2006-01-02T15-04-05Z"), utils.HashString(fmt.Sprintf("%d", now.UnixNano()))[:8]),
+		ProfileID: req.ProfileID,
+		Mode:      req.Mode,
+		Status:    types.JobStatusRunning,
+		CreatedAt: now,
+	}
+	for _, name := range applySteps {
+		job.Steps = append(job.Steps, &types.JobStep{Name: name, Status: types.JobStepPending})
+	}
+
+	entry := &jobEntry{job: job, done: make(chan struct{})}
+
+	s.mu.Lock()
+	s.addLocked(entry)
+	s.running = job.ID
+	submitted := copyJob(job)
+	s.mu.Unlock()
+
+	s.logger.Info("started apply job",
+		zap.String("job", job.ID),
+		zap.String("profile", req.ProfileID),
+		zap.String("mode", req.Mode))
+
+	go s.run(entry, req, profile)
+	return submitted, nil
+}
+
+// Get returns a job by ID
+func (s *JobService) Get(id string) (*types.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.jobs[id]
+	if !ok {
+		return nil, types.ErrJobNotFound
+	}
+	return copyJob(entry.job), nil
+}
+
+// List returns recent jobs, newest first. A limit of 0 returns all kept jobs.
+func (s *JobService) List(limit int) []*types.Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]*types.Job, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		if limit > 0 && len(jobs) >= limit {
+			break
+		}
+		jobs = append(jobs, copyJob(s.jobs[s.order[i]].job))
+	}
+	return jobs
+}
+
+// Running returns the ID of the job currently holding the apply lock, if any
+func (s *JobService) Running() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// Wait blocks until the job finishes and returns its final state
+func (s *JobService) Wait(id string) (*types.Job, error) {
+	s.mu.Lock()
+	entry, ok := s.jobs[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, types.ErrJobNotFound
+	}
+
+	<-entry.done
+	return s.Get(id)
+}
+
+// run executes the apply and records its outcome (runs in its own goroutine)
+func (s *JobService) run(entry *jobEntry, req *types.ApplyRequest, profile *types.Profile) {
+	defer close(entry.done)
+	defer s.applyService.releaseApplyLock()
+
+	result, err := s.applyService.applyLocked(req, profile, func(step string) {
+		s.startStep(entry.job, step)
+	})
+	s.finish(entry.job, result, err)
+}
+
+// startStep marks the running step done and the named step running
+func (s *JobService) startStep(job *types.Job, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, step := range job.Steps {
+		if step.Status == types.JobStepRunning {
+			step.Status = types.JobStepDone
+			step.FinishedAt = &now
+		}
+		if step.Name == name {
+			step.Status = types.JobStepRunning
+			step.StartedAt = &now
+		}
+	}
+}
+
+// finish records the result of a job and settles the state of its steps
+func (s *JobService) finish(job *types.Job, result *types.ApplyResult, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	failed := err != nil || result == nil || !result.Success
+
+	for _, step := range job.Steps {
+		switch step.Status {
+		case types.JobStepRunning:
+			step.Status = types.JobStepDone
+			if failed {
+				step.Status = types.JobStepFailed
+			}
+			step.FinishedAt = &now
+		case types.JobStepPending:
+			step.Status = types.JobStepSkipped
+		}
+	}
+
+	if result != nil {
+		result.JobID = job.ID
+	}
+	job.Result = result
+	job.FinishedAt = &now
+	job.Status = types.JobStatusSucceeded
+	if failed {
+		job.Status = types.JobStatusFailed
+	}
+	if err != nil {
+		job.Error = err.Error()
+	}
+
+	if s.running == job.ID {
+		s.running = ""
+	}
+
+	s.logger.Info("finished apply job",
+		zap.String("job", job.ID),
+		zap.String("status", job.Status))
+}
+
+// addLocked stores a job and evicts the oldest finished ones (caller must hold s.mu)
+func (s *JobService) addLocked(entry *jobEntry) {
+	s.jobs[entry.job.ID] = entry
+	s.order = append(s.order, entry.job.ID)
+
+	for len(s.order) > maxRecentJobs {
+		oldest := s.jobs[s.order[0]]
+		if !oldest.job.Done() {
+			break
+		}
+		delete(s.jobs, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// copyJob returns a copy that is safe to hand out while the job keeps running
+func copyJob(job *types.Job) *types.Job {
+	c := *job
+	c.Steps = make([]*types.JobStep, len(job.Steps))
+	for i, step := range job.Steps {
+		stepCopy := *step
+		c.Steps[i] = &stepCopy
+	}
+	return &c
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"go.uber.org/zap"
+)
+
+func newTestJob(id string) *types.Job {
+	job := &types.Job{ID: id, Status: types.JobStatusRunning, CreatedAt: time.Now()}
+	for _, name := range applySteps {
+		job.Steps = append(job.Steps, &types.JobStep{Name: name, Status: types.JobStepPending})
+	}
+	return job
+}
+
+func TestJobService_StepProgress(t *testing.T) {
+	svc := NewJobService(nil, zap.NewNop())
+	job := newTestJob("job-1")
+	svc.addLocked(&jobEntry{job: job, done: make(chan struct{})})
+
+	svc.startStep(job, applyStepSnapshot)
+	svc.startStep(job, applyStepSysctl)
+	svc.startStep(job, applyStepVerification)
+	svc.finish(job, &types.ApplyResult{Success: false}, nil)
+
+	want := map[string]string{
+		applyStepSnapshot:     types.JobStepDone,
+		applyStepModules:      types.JobStepSkipped,
+		applyStepSysctl:       types.JobStepDone,
+		applyStepLink:         types.JobStepSkipped,
+		applyStepSteering:     types.JobStepSkipped,
+		applyStepRoute:        types.JobStepSkipped,
+		applyStepQdisc:        types.JobStepSkipped,
+		applyStepSystemd:      types.JobStepSkipped,
+		applyStepVerification: types.JobStepFailed,
+	}
+
+	got, err := svc.Get("job-1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	for _, step := range got.Steps {
+		if step.Status != want[step.Name] {
+			t.Errorf("step %s = %s, want %s", step.Name, step.Status, want[step.Name])
+		}
+	}
+	if got.Status != types.JobStatusFailed {
+		t.Errorf("Status = %s, want %s", got.Status, types.JobStatusFailed)
+	}
+	if got.Result == nil || got.Result.JobID != "job-1" {
+		t.Errorf("Result = %+v, want job ID job-1", got.Result)
+	}
+}
+
+func TestJobService_ListAndEviction(t *testing.T) {
+	svc := NewJobService(nil, zap.NewNop())
+
+	for i := 0; i < maxRecentJobs+5; i++ {
+		job := newTestJob(fmt.Sprintf("job-%d", i))
+		job.Status = types.JobStatusSucceeded
+		svc.addLocked(&jobEntry{job: job, done: make(chan struct{})})
+	}
+
+	jobs := svc.List(0)
+	if len(jobs) != maxRecentJobs {
+		t.Fatalf("List(0) returned %d jobs, want %d", len(jobs), maxRecentJobs)
+	}
+	if jobs[0].ID != fmt.Sprintf("job-%d", maxRecentJobs+4) {
+		t.Errorf("newest job = %s, want job-%d", jobs[0].ID, maxRecentJobs+4)
+	}
+	if len(svc.List(3)) != 3 {
+		t.Error("List(3) should return 3 jobs")
+	}
+	if _, err := svc.Get("job-0"); !errors.Is(err, types.ErrJobNotFound) {
+		t.Errorf("Get(job-0) error = %v, want ErrJobNotFound", err)
+	}
+}
+
+func TestJobService_SubmitApply_Refused(t *testing.T) {
+	applySvc, _ := newFakeApplyService(t)
+	svc := NewJobService(applySvc, zap.NewNop())
+
+	if err := applySvc.acquireApplyLock(); err != nil {
+		t.Fatalf("acquireApplyLock failed: %v", err)
+	}
+	if _, err := svc.SubmitApply(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "commit"}); !errors.Is(err, types.ErrApplyInProgress) {
+		t.Errorf("SubmitApply() error = %v, want ErrApplyInProgress", err)
+	}
+	applySvc.releaseApplyLock()
+
+	// A refused request must not keep the lock
+	applySvc.recovery = &types.RecoveryInfo{SnapshotID: "snapshot-123"}
+	if _, err := svc.SubmitApply(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "commit"}); !errors.Is(err, types.ErrRecoveryPending) {
+		t.Errorf("SubmitApply() error = %v, want ErrRecoveryPending", err)
+	}
+	if err := applySvc.acquireApplyLock(); err != nil {
+		t.Errorf("apply lock should be released after a refused submit: %v", err)
+	}
+	if len(svc.List(0)) != 0 {
+		t.Error("refused submits should not create jobs")
+	}
+}
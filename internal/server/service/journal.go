@@ -0,0 +1,200 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"github.com/jtsang4/nettune/internal/shared/utils"
+	"go.uber.org/zap"
+)
+
+// applyJournalFile is the write-ahead record of a commit in progress
+const applyJournalFile = "apply_journal.json"
+
+// Steps of a commit, reported as job progress. Every step after the snapshot is
+// recorded in the apply journal before it starts.
+const (
+	applyStepSnapshot     = "snapshot"
+	applyStepModules      = "modules"
+	applyStepSysctl       = "sysctl"
+	applyStepLink         = "link"
+	applyStepSteering     = "steering"
+	applyStepRoute        = "route"
+	applyStepQdisc        = "qdisc"
+	applyStepSystemd      = "systemd"
+	applyStepVerification = "verification"
+)
+
+// applySteps lists the steps of a commit in the order they run
+var applySteps = []string{
+	applyStepSnapshot,
+	applyStepModules,
+	applyStepSysctl,
+	applyStepLink,
+	applyStepSteering,
+	applyStepRoute,
+	applyStepQdisc,
+	applyStepSystemd,
+	applyStepVerification,
+}
+
+// GetRecovery returns the interrupted apply found at startup, if any
+func (s *ApplyService) GetRecovery() *types.RecoveryInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.recovery == nil {
+		return nil
+	}
+	recovery := *s.recovery
+	return &recovery
+}
+
+// RecoverInterruptedApply looks for an apply journal left behind by a crashed run.
+// With autoRollback the host is rolled back to the recorded snapshot; otherwise the
+// journal is kept and commits are refused until the operator rolls back.
+func (s *ApplyService) RecoverInterruptedApply(autoRollback bool) error {
+	journal, err := s.loadApplyJournal()
+	if err != nil {
+		return err
+	}
+	if journal == nil {
+		return nil
+	}
+
+	info := &types.RecoveryInfo{
+		ProfileID:       journal.ProfileID,
+		SnapshotID:      journal.SnapshotID,
+		StartedAt:       journal.StartedAt,
+		CompletedSteps:  journal.CompletedSteps,
+		InterruptedStep: journal.CurrentStep,
+		DetectedAt:      time.Now(),
+	}
+
+	s.logger.Warn("found interrupted apply",
+		zap.String("profile", journal.ProfileID),
+		zap.String("snapshot", journal.SnapshotID),
+		zap.Strings("completed_steps", journal.CompletedSteps),
+		zap.String("interrupted_step", journal.CurrentStep))
+
+	s.mu.Lock()
+	s.recovery = info
+	s.mu.Unlock()
+	s.snapshotService.hold(journal.SnapshotID, snapshotHoldRecovery)
+
+	if !autoRollback {
+		s.logger.Warn("automatic recovery disabled, roll back to the recorded snapshot manually",
+			zap.String("snapshot", journal.SnapshotID))
+		if s.historyService != nil {
+			s.historyService.RecordRecovery(s.GetRecovery())
+		}
+		return nil
+	}
+
+	if err := s.acquireApplyLock(); err != nil {
+		return err
+	}
+	rollbackErr := s.rollbackInternal(journal.SnapshotID, nil)
+	s.releaseApplyLock()
+
+	if rollbackErr != nil {
+		s.mu.Lock()
+		s.recovery.Error = rollbackErr.Error()
+		s.mu.Unlock()
+	} else {
+		s.resolveRecovery()
+	}
+
+	if s.historyService != nil {
+		s.historyService.RecordRecovery(s.GetRecovery())
+	}
+
+	if rollbackErr != nil {
+		return fmt.Errorf("failed to roll back interrupted apply: %w", rollbackErr)
+	}
+
+	s.logger.Info("rolled back interrupted apply", zap.String("snapshot", journal.SnapshotID))
+	return nil
+}
+
+// recoveryPending reports whether an interrupted apply still needs a rollback
+func (s *ApplyService) recoveryPending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recovery != nil && !s.recovery.RolledBack
+}
+
+// resolveRecovery marks an interrupted apply as rolled back and drops its journal
+func (s *ApplyService) resolveRecovery() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.recovery == nil || s.recovery.RolledBack {
+		return
+	}
+
+	now := time.Now()
+	s.recovery.RolledBack = true
+	s.recovery.RolledBackAt = &now
+	s.recovery.Error = ""
+	s.snapshotService.release(s.recovery.SnapshotID, snapshotHoldRecovery)
+
+	// The interrupted commit may have armed an auto-rollback just before the crash
+	s.clearPendingLocked()
+	s.removeApplyJournal()
+}
+
+// advanceApplyJournal marks the current step done and records the next one
+func (s *ApplyService) advanceApplyJournal(journal *types.ApplyJournal, step string) error {
+	if journal.CurrentStep != "" {
+		journal.CompletedSteps = append(journal.CompletedSteps, journal.CurrentStep)
+	}
+	journal.CurrentStep = step
+	return s.saveApplyJournal(journal)
+}
+
+// saveApplyJournal persists the journal so a crash can be detected on restart
+func (s *ApplyService) saveApplyJournal(journal *types.ApplyJournal) error {
+	data, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal apply journal: %w", err)
+	}
+
+	if err := utils.AtomicWriteFile(s.applyJournalPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write apply journal: %w", err)
+	}
+	return nil
+}
+
+// loadApplyJournal reads the journal, returning nil if no apply was interrupted
+func (s *ApplyService) loadApplyJournal() (*types.ApplyJournal, error) {
+	data, err := os.ReadFile(s.applyJournalPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read apply journal: %w", err)
+	}
+
+	var journal types.ApplyJournal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return nil, fmt.Errorf("failed to parse apply journal: %w", err)
+	}
+	return &journal, nil
+}
+
+// removeApplyJournal deletes the journal once an apply has finished
+func (s *ApplyService) removeApplyJournal() {
+	if err := os.Remove(s.applyJournalPath()); err != nil && !os.IsNotExist(err) {
+		s.logger.Warn("failed to remove apply journal", zap.Error(err))
+	}
+}
+
+// applyJournalPath returns the path of the apply journal
+func (s *ApplyService) applyJournalPath() string {
+	return filepath.Join(s.stateDir, applyJournalFile)
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+)
+
+func TestApplyJournal_RoundTrip(t *testing.T) {
+	svc, _ := newFakeApplyService(t)
+
+	journal, err := svc.loadApplyJournal()
+	if err != nil || journal != nil {
+		t.Fatalf("loadApplyJournal() = %v, %v; want nil, nil", journal, err)
+	}
+
+	journal = &types.ApplyJournal{
+		ProfileID:      "bbr-fq-default",
+		SnapshotID:     "snapshot-123",
+		StartedAt:      time.Now(),
+		CompletedSteps: []string{},
+	}
+	for _, step := range []string{applyStepSysctl, applyStepQdisc} {
+		if err := svc.advanceApplyJournal(journal, step); err != nil {
+			t.Fatalf("advanceApplyJournal(%s) failed: %v", step, err)
+		}
+	}
+
+	loaded, err := svc.loadApplyJournal()
+	if err != nil {
+		t.Fatalf("loadApplyJournal failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.CompletedSteps, []string{applyStepSysctl}) {
+		t.Errorf("CompletedSteps = %v, want [%s]", loaded.CompletedSteps, applyStepSysctl)
+	}
+	if loaded.CurrentStep != applyStepQdisc {
+		t.Errorf("CurrentStep = %s, want %s", loaded.CurrentStep, applyStepQdisc)
+	}
+
+	svc.removeApplyJournal()
+	if journal, _ := svc.loadApplyJournal(); journal != nil {
+		t.Error("journal should be gone after removeApplyJournal")
+	}
+}
+
+func TestRecoverInterruptedApply_NoJournal(t *testing.T) {
+	svc, _ := newFakeApplyService(t)
+
+	if err := svc.RecoverInterruptedApply(true); err != nil {
+		t.Fatalf("RecoverInterruptedApply failed: %v", err)
+	}
+	if svc.GetRecovery() != nil {
+		t.Error("no recovery expected without a journal")
+	}
+}
+
+func TestRecoverInterruptedApply_Manual(t *testing.T) {
+	svc, _ := newFakeApplyService(t)
+	tmpDir := svc.stateDir
+
+	journal := &types.ApplyJournal{
+		ProfileID:      "bbr-fq-default",
+		SnapshotID:     "snapshot-789",
+		StartedAt:      time.Now(),
+		CompletedSteps: []string{applyStepSysctl},
+		CurrentStep:    applyStepQdisc,
+	}
+	if err := svc.saveApplyJournal(journal); err != nil {
+		t.Fatalf("saveApplyJournal failed: %v", err)
+	}
+
+	if err := svc.RecoverInterruptedApply(false); err != nil {
+		t.Fatalf("RecoverInterruptedApply failed: %v", err)
+	}
+
+	recovery := svc.GetRecovery()
+	if recovery == nil {
+		t.Fatal("recovery should be reported")
+	}
+	if recovery.SnapshotID != "snapshot-789" || recovery.InterruptedStep != applyStepQdisc {
+		t.Errorf("recovery = %+v, want snapshot-789 interrupted at %s", recovery, applyStepQdisc)
+	}
+	if recovery.RolledBack {
+		t.Error("recovery should not be rolled back when automatic recovery is disabled")
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, applyJournalFile)); err != nil {
+		t.Errorf("journal should be kept until rolled back: %v", err)
+	}
+
+	_, err := svc.Apply(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "commit"})
+	if !errors.Is(err, types.ErrRecoveryPending) {
+		t.Errorf("Apply() error = %v, want ErrRecoveryPending", err)
+	}
+
+	entries, err := svc.historyService.GetRecentEntries(1)
+	if err != nil {
+		t.Fatalf("GetRecentEntries failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Action != "recovery" {
+		t.Errorf("expected a recovery history entry, got %+v", entries)
+	}
+
+	svc.resolveRecovery()
+	if got := svc.GetRecovery(); got == nil || !got.RolledBack || got.RolledBackAt == nil {
+		t.Errorf("recovery after resolve = %+v, want rolled back", got)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, applyJournalFile)); !os.IsNotExist(err) {
+		t.Error("journal should be removed once resolved")
+	}
+}
@@ -0,0 +1,309 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jtsang4/nettune/internal/server/adapter"
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"go.uber.org/zap"
+)
+
+// linkTargets resolves the interfaces a link config selects on this host
+func (s *ApplyService) linkTargets(cfg *types.LinkConfig) ([]adapter.LinkTarget, error) {
+	candidates, err := s.interfaceCandidates(cfg.Interfaces)
+	if err != nil {
+		return nil, err
+	}
+	return selectLinkTargets(cfg, candidates)
+}
+
+// selectLinkTargets picks the interfaces of cfg from the candidates and assigns
+// each its settings; a per-interface entry replaces the shared settings
+func selectLinkTargets(cfg *types.LinkConfig, candidates []string) ([]adapter.LinkTarget, error) {
+	names, err := selectInterfaces(cfg.Interfaces, cfg.Exclude, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]adapter.LinkTarget, 0, len(names))
+	for _, iface := range names {
+		settings := &cfg.LinkSettings
+		if override, ok := overrideFor(cfg.PerInterface, iface); ok && override != nil {
+			settings = override
+		}
+		if settings.IsEmpty() {
+			continue
+		}
+		targets = append(targets, adapter.LinkTarget{Interface: iface, Settings: settings})
+	}
+	return targets, nil
+}
+
+// linkValues flattens link settings into "mtu", "txqueuelen" and
+// "section/name" -> value, with offloads under the feature names ethtool -k prints
+func linkValues(settings *types.LinkSettings) map[string]interface{} {
+	values := make(map[string]interface{})
+	if settings == nil {
+		return values
+	}
+	if settings.MTU != nil {
+		values["mtu"] = *settings.MTU
+	}
+	if settings.TxQueueLen != nil {
+		values["txqueuelen"] = *settings.TxQueueLen
+	}
+	for name, enabled := range settings.Offloads {
+		values["offloads/"+adapter.OffloadFeatureName(name)] = enabled
+	}
+	for name, size := range settings.Rings {
+		values["rings/"+name] = size
+	}
+	for name, value := range settings.Coalesce {
+		values["coalesce/"+name] = value
+	}
+	return values
+}
+
+// planLinkChanges adds the link targets, changes and preflight of a profile to a plan
+func (s *ApplyService) planLinkChanges(plan *types.ApplyPlan, cfg *types.LinkConfig, currentState *types.SystemState) {
+	targets, err := s.linkTargets(cfg)
+	if err != nil {
+		plan.LinkError = err.Error()
+	}
+
+	plan.LinkChanges = make(map[string]*types.Change)
+	plan.LinkPreflight = make(map[string]*types.SysctlPreflight)
+	for _, target := range targets {
+		plan.LinkTargets = append(plan.LinkTargets, target.Interface)
+
+		current := currentState.Link[target.Interface]
+		if current == nil {
+			if current, err = s.adapter.Link.Get(target.Interface); err != nil {
+				plan.LinkPreflight[target.Interface] = &types.SysctlPreflight{Status: types.PreflightMissing, Detail: err.Error()}
+				continue
+			}
+		}
+
+		live := linkValues(current)
+		for name, value := range linkValues(target.Settings) {
+			key := target.Interface + "/" + name
+			from, ok := live[name]
+			if !ok {
+				plan.LinkPreflight[key] = &types.SysctlPreflight{
+					Status: types.PreflightMissing,
+					Detail: fmt.Sprintf("%s does not support changing it", target.Interface),
+				}
+				continue
+			}
+			plan.LinkPreflight[key] = &types.SysctlPreflight{Status: types.PreflightOK}
+			if adapter.LinkValueString(from) != adapter.LinkValueString(value) {
+				plan.LinkChanges[key] = &types.Change{From: from, To: value}
+			}
+		}
+	}
+}
+
+// originMTUProblem returns why a commit may not go ahead when it changes the
+// MTU of the interface carrying the API connection without auto-rollback, or
+// "" when it may. A wrong MTU can cut the connection needed to confirm or undo it.
+func (s *ApplyService) originMTUProblem(req *types.ApplyRequest, plan *types.ApplyPlan) string {
+	if req.Origin == "" || req.AutoRollbackSeconds > 0 {
+		return ""
+	}
+
+	var changed []string
+	for key := range plan.LinkChanges {
+		if iface, ok := strings.CutSuffix(key, "/mtu"); ok {
+			changed = append(changed, iface)
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+
+	origin, err := s.adapter.Link.AddrInterface(req.Origin)
+	if err != nil {
+		return fmt.Sprintf("mtu: cannot tell which interface carries the API connection (%v); set auto_rollback_seconds to change the MTU", err)
+	}
+	for _, iface := range changed {
+		if iface == origin {
+			return fmt.Sprintf("mtu: %s carries the API connection; set auto_rollback_seconds to change its MTU", iface)
+		}
+	}
+	return ""
+}
+
+// applyLink applies the link settings of every target
+func (s *ApplyService) applyLink(targets []adapter.LinkTarget) error {
+	for _, target := range targets {
+		if err := s.adapter.Link.Set(target.Interface, target.Settings); err != nil {
+			return fmt.Errorf("failed to set link settings for %s: %w", target.Interface, err)
+		}
+	}
+	return nil
+}
+
+// verifyLink checks that every target reports the requested link settings
+func (s *ApplyService) verifyLink(cfg *types.LinkConfig, result *types.VerificationResult) {
+	targets, err := s.linkTargets(cfg)
+	if err != nil {
+		result.LinkOK = false
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to resolve link interfaces: %v", err))
+	}
+
+	for _, target := range targets {
+		current, err := s.adapter.Link.Get(target.Interface)
+		if err != nil {
+			result.LinkOK = false
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to read link settings for %s: %v", target.Interface, err))
+			continue
+		}
+
+		live := linkValues(current)
+		expected := linkValues(target.Settings)
+		for _, name := range sortedKeys(expected) {
+			want := adapter.LinkValueString(expected[name])
+			got, ok := live[name]
+			if !ok || adapter.LinkValueString(got) != want {
+				result.LinkOK = false
+				result.Errors = append(result.Errors, fmt.Sprintf("link %s/%s: expected %s, got %v", target.Interface, name, want, got))
+			}
+		}
+	}
+}
+
+// scopedLinkSettings returns the saved link settings that keys ("iface/name"
+// as in ApplyPlan.LinkChanges) name, per interface
+func scopedLinkSettings(saved map[string]*types.LinkSettings, keys []string) map[string]*types.LinkSettings {
+	scoped := make(map[string]*types.LinkSettings)
+	for _, key := range keys {
+		iface, name, ok := strings.Cut(key, "/")
+		if !ok || saved[iface] == nil {
+			continue
+		}
+		if scoped[iface] == nil {
+			scoped[iface] = &types.LinkSettings{}
+		}
+		copyLinkSetting(scoped[iface], saved[iface], name)
+	}
+	return scoped
+}
+
+// copyLinkSetting copies the setting linkValues calls name from src to dst
+func copyLinkSetting(dst, src *types.LinkSettings, name string) {
+	section, key, _ := strings.Cut(name, "/")
+	switch section {
+	case "mtu":
+		dst.MTU = src.MTU
+	case "txqueuelen":
+		dst.TxQueueLen = src.TxQueueLen
+	case "offloads":
+		if enabled, ok := src.Offloads[key]; ok {
+			if dst.Offloads == nil {
+				dst.Offloads = make(map[string]bool)
+			}
+			dst.Offloads[key] = enabled
+		}
+	case "rings":
+		if size, ok := src.Rings[key]; ok {
+			if dst.Rings == nil {
+				dst.Rings = make(map[string]int)
+			}
+			dst.Rings[key] = size
+		}
+	case "coalesce":
+		if value, ok := src.Coalesce[key]; ok {
+			if dst.Coalesce == nil {
+				dst.Coalesce = make(map[string]interface{})
+			}
+			dst.Coalesce[key] = value
+		}
+	}
+}
+
+// restoreLink brings the link settings of an interface back to the snapshot state.
+// An interface that no longer exists is skipped.
+func (s *ApplyService) restoreLink(iface string, settings *types.LinkSettings) error {
+	current, err := s.adapter.Link.Get(iface)
+	if err != nil {
+		s.logger.Warn("link settings not readable, skipping restore",
+			zap.String("interface", iface),
+			zap.Error(err))
+		return nil
+	}
+
+	changed := adapter.LinkSettingsDiff(current, settings)
+	if changed.IsEmpty() {
+		return nil
+	}
+	return s.adapter.Link.Set(iface, changed)
+}
+
+// ensureLinkService creates and enables the link persistence service, which
+// reapplies at boot the link settings of every target, merged into those
+// earlier applies persisted
+func (s *ApplyService) ensureLinkService(targets []adapter.LinkTarget) error {
+	content, err := s.readSetupScript(adapter.NettuneLinkScriptPath)
+	if err != nil {
+		return err
+	}
+	persisted, err := adapter.ParseLinkSetupScript(content)
+	if err != nil {
+		s.logger.Warn("failed to parse persisted link settings, replacing them", zap.Error(err))
+		persisted = nil
+	}
+
+	return s.ensureService(adapter.NettuneLinkServiceName,
+		adapter.NettuneLinkScriptPath, adapter.GenerateLinkSetupScript(mergeLinkTargets(persisted, targets)),
+		adapter.GenerateLinkServiceUnit())
+}
+
+// mergeLinkTargets merges targets into the persisted ones per interface and
+// setting; the settings of targets take precedence
+func mergeLinkTargets(persisted, targets []adapter.LinkTarget) []adapter.LinkTarget {
+	var merged []adapter.LinkTarget
+	byIface := make(map[string]*types.LinkSettings)
+	for _, target := range append(slices.Clone(persisted), targets...) {
+		settings := byIface[target.Interface]
+		if settings == nil {
+			settings = &types.LinkSettings{}
+			byIface[target.Interface] = settings
+			merged = append(merged, adapter.LinkTarget{Interface: target.Interface, Settings: settings})
+		}
+		mergeLinkSettings(settings, target.Settings)
+	}
+	return merged
+}
+
+// mergeLinkSettings copies every setting src sets onto dst
+func mergeLinkSettings(dst, src *types.LinkSettings) {
+	if src == nil {
+		return
+	}
+	if src.MTU != nil {
+		dst.MTU = src.MTU
+	}
+	if src.TxQueueLen != nil {
+		dst.TxQueueLen = src.TxQueueLen
+	}
+	for name, enabled := range src.Offloads {
+		if dst.Offloads == nil {
+			dst.Offloads = make(map[string]bool)
+		}
+		dst.Offloads[adapter.OffloadFeatureName(name)] = enabled
+	}
+	for name, size := range src.Rings {
+		if dst.Rings == nil {
+			dst.Rings = make(map[string]int)
+		}
+		dst.Rings[name] = size
+	}
+	for name, value := range src.Coalesce {
+		if dst.Coalesce == nil {
+			dst.Coalesce = make(map[string]interface{})
+		}
+		dst.Coalesce[name] = value
+	}
+}
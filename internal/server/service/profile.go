@@ -4,12 +4,16 @@ package service
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/jtsang4/nettune/internal/server/adapter"
 	"github.com/jtsang4/nettune/internal/shared/types"
 	"github.com/jtsang4/nettune/internal/shared/utils"
 	"go.uber.org/zap"
@@ -137,29 +141,114 @@ func (s *ProfileService) Validate(p *types.Profile) error {
 		errors = append(errors, "risk_level must be 'low', 'medium', or 'high'")
 	}
 
-	// Validate sysctl keys
+	// Validate sysctl keys and values of known keys
 	if p.Sysctl != nil {
+		keys := make([]string, 0, len(p.Sysctl))
 		for key := range p.Sysctl {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
 			if !isValidSysctlKey(key) {
 				errors = append(errors, fmt.Sprintf("invalid sysctl key '%s': must be in format like 'net.core.rmem_max' or 'net.ipv4.tcp_rmem'", key))
+				continue
+			}
+			if err := validateSysctlValue(key, p.Sysctl[key]); err != nil {
+				errors = append(errors, err.Error())
 			}
 		}
 	}
 
+	// Validate kernel module names
+	for _, module := range p.KernelModules {
+		if !isValidModuleName(module) {
+			errors = append(errors, fmt.Sprintf("invalid kernel module name '%s': must contain only letters, digits, '_' and '-'", module))
+		}
+	}
+
 	// Validate qdisc config
 	if p.Qdisc != nil {
 		if !isValidQdiscType(p.Qdisc.Type) {
 			errors = append(errors, fmt.Sprintf("invalid qdisc type '%s': must be one of 'fq', 'fq_codel', 'cake', or 'pfifo_fast'", p.Qdisc.Type))
 		}
-		if p.Qdisc.Interfaces != "default-route" && p.Qdisc.Interfaces != "all" {
-			errors = append(errors, "qdisc interfaces must be 'default-route' or 'all'")
-		}
+		errors = append(errors, validateInterfaceSelector("qdisc", p.Qdisc.Interfaces, p.Qdisc.Exclude)...)
 		// Validate qdisc parameters
 		if p.Qdisc.Params != nil && p.Qdisc.Type != "" {
 			if err := validateQdiscParams(p.Qdisc.Type, p.Qdisc.Params); err != nil {
 				errors = append(errors, err.Error())
 			}
 		}
+		// Validate per-interface overrides
+		patterns := make([]string, 0, len(p.Qdisc.PerInterface))
+		for pattern := range p.Qdisc.PerInterface {
+			patterns = append(patterns, pattern)
+		}
+		sort.Strings(patterns)
+		for _, pattern := range patterns {
+			override := p.Qdisc.PerInterface[pattern]
+			if err := validateInterfacePattern(pattern); err != nil {
+				errors = append(errors, fmt.Sprintf("qdisc per_interface: %v", err))
+				continue
+			}
+			if override == nil || !isValidQdiscType(override.Type) {
+				errors = append(errors, fmt.Sprintf("qdisc per_interface '%s': type must be one of 'fq', 'fq_codel', 'cake', or 'pfifo_fast'", pattern))
+				continue
+			}
+			if err := validateQdiscParams(override.Type, override.Params); err != nil {
+				errors = append(errors, fmt.Sprintf("qdisc per_interface '%s': %v", pattern, err))
+			}
+		}
+	}
+
+	// Validate link config
+	if p.Link != nil {
+		errors = append(errors, validateInterfaceSelector("link", p.Link.Interfaces, p.Link.Exclude)...)
+		errors = append(errors, validateLinkSettings("link", &p.Link.LinkSettings)...)
+		if p.Link.LinkSettings.IsEmpty() && len(p.Link.PerInterface) == 0 {
+			errors = append(errors, "link must set mtu, txqueuelen, offloads, rings or coalesce")
+		}
+		for _, pattern := range sortedKeys(p.Link.PerInterface) {
+			if err := validateInterfacePattern(pattern); err != nil {
+				errors = append(errors, fmt.Sprintf("link per_interface: %v", err))
+				continue
+			}
+			errors = append(errors, validateLinkSettings(fmt.Sprintf("link per_interface '%s'", pattern), p.Link.PerInterface[pattern])...)
+		}
+	}
+
+	// Validate steering config
+	if p.Steering != nil {
+		errors = append(errors, validateInterfaceSelector("steering", p.Steering.Interfaces, p.Steering.Exclude)...)
+		errors = append(errors, validateSteeringSettings("steering", &p.Steering.SteeringSettings)...)
+		if p.Steering.SteeringSettings.IsEmpty() && len(p.Steering.PerInterface) == 0 {
+			errors = append(errors, "steering must set rps_cpus, rps_flow_cnt, xps_cpus or irq_affinity")
+		}
+		for _, pattern := range sortedKeys(p.Steering.PerInterface) {
+			if err := validateInterfacePattern(pattern); err != nil {
+				errors = append(errors, fmt.Sprintf("steering per_interface: %v", err))
+				continue
+			}
+			errors = append(errors, validateSteeringSettings(fmt.Sprintf("steering per_interface '%s'", pattern), p.Steering.PerInterface[pattern])...)
+		}
+	}
+
+	// Validate route config
+	if p.Routes != nil {
+		if p.Routes.Default.IsEmpty() && len(p.Routes.Prefixes) == 0 {
+			errors = append(errors, "routes must set default or prefixes")
+		}
+		if p.Routes.Default != nil {
+			errors = append(errors, validateRouteAttrs("routes default", p.Routes.Default)...)
+		}
+		for _, prefix := range sortedKeys(p.Routes.Prefixes) {
+			section := fmt.Sprintf("routes prefix '%s'", prefix)
+			if _, _, err := net.ParseCIDR(prefix); err != nil {
+				errors = append(errors, fmt.Sprintf("%s: must be a CIDR prefix such as 10.0.0.0/8; use 'default' for the default routes", section))
+				continue
+			}
+			errors = append(errors, validateRouteAttrs(section, p.Routes.Prefixes[prefix])...)
+		}
 	}
 
 	if len(errors) > 0 {
@@ -257,6 +346,20 @@ func isValidSysctlKey(key string) bool {
 	return sysctlKeyRegex.MatchString(key)
 }
 
+var interfacePatternRegex = regexp.MustCompile(`^[A-Za-z0-9_.:@*?\[\]!-]{1,15}$`)
+
+var interfaceNameRegex = regexp.MustCompile(`^[A-Za-z0-9_.:@-]{1,15}$`)
+
+func isValidInterfaceName(name string) bool {
+	return name != "." && name != ".." && interfaceNameRegex.MatchString(name)
+}
+
+var moduleNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func isValidModuleName(name string) bool {
+	return moduleNameRegex.MatchString(name)
+}
+
 func isValidQdiscType(qdiscType string) bool {
 	validTypes := map[string]bool{
 		"fq":         true,
@@ -267,6 +370,176 @@ func isValidQdiscType(qdiscType string) bool {
 	return validTypes[qdiscType]
 }
 
+// validateInterfaceSelector checks the interfaces and exclude patterns of a profile section
+func validateInterfaceSelector(section, interfaces string, exclude []string) []string {
+	var errors []string
+	if interfaces != qdiscInterfacesDefaultRoute && interfaces != qdiscInterfacesAll {
+		patterns := qdiscInterfacePatterns(interfaces)
+		if len(patterns) == 0 {
+			errors = append(errors, section+" interfaces must be 'default-route', 'all', or a comma-separated list of interface names and glob patterns")
+		}
+		for _, pattern := range patterns {
+			if err := validateInterfacePattern(pattern); err != nil {
+				errors = append(errors, err.Error())
+			}
+		}
+	}
+	for _, pattern := range exclude {
+		if err := validateInterfacePattern(pattern); err != nil {
+			errors = append(errors, fmt.Sprintf("%s exclude: %v", section, err))
+		}
+	}
+	return errors
+}
+
+// Bounds of an interface MTU: the IPv4 minimum and the largest the kernel takes
+const (
+	minMTU = 68
+	maxMTU = 65535
+)
+
+var offloadNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// validateLinkSettings checks the MTU, queue length, offload names, ring sizes
+// and coalescing values
+func validateLinkSettings(section string, settings *types.LinkSettings) []string {
+	if settings == nil {
+		return []string{section + ": settings are required"}
+	}
+
+	var errors []string
+	if settings.MTU != nil && (*settings.MTU < minMTU || *settings.MTU > maxMTU) {
+		errors = append(errors, fmt.Sprintf("%s: mtu must be between %d and %d", section, minMTU, maxMTU))
+	}
+	if settings.TxQueueLen != nil && *settings.TxQueueLen < 0 {
+		errors = append(errors, fmt.Sprintf("%s: txqueuelen must be non-negative", section))
+	}
+	for _, name := range sortedKeys(settings.Offloads) {
+		if !offloadNameRegex.MatchString(name) {
+			errors = append(errors, fmt.Sprintf("%s: invalid offload name '%s'", section, name))
+		}
+	}
+
+	validRings := make(map[string]bool)
+	for _, name := range adapter.LinkRingParams {
+		validRings[name] = true
+	}
+	for _, name := range sortedKeys(settings.Rings) {
+		if !validRings[name] {
+			errors = append(errors, fmt.Sprintf("%s: invalid ring '%s', must be one of %v", section, name, adapter.LinkRingParams))
+		} else if settings.Rings[name] < 1 {
+			errors = append(errors, fmt.Sprintf("%s: ring %s must be a positive size", section, name))
+		}
+	}
+
+	flags := make(map[string]bool)
+	for _, name := range adapter.LinkCoalesceFlags {
+		flags[name] = true
+	}
+	counters := make(map[string]bool)
+	for _, name := range adapter.LinkCoalesceParams {
+		counters[name] = true
+	}
+	for _, name := range sortedKeys(settings.Coalesce) {
+		value := settings.Coalesce[name]
+		switch {
+		case flags[name]:
+			if _, ok := value.(bool); !ok {
+				errors = append(errors, fmt.Sprintf("%s: coalesce %s must be true or false", section, name))
+			}
+		case counters[name]:
+			_, isBool := value.(bool)
+			if _, err := strconv.ParseUint(adapter.LinkValueString(value), 10, 32); err != nil || isBool {
+				errors = append(errors, fmt.Sprintf("%s: coalesce %s must be a non-negative integer", section, name))
+			}
+		default:
+			errors = append(errors, fmt.Sprintf("%s: unknown coalesce parameter '%s'", section, name))
+		}
+	}
+	return errors
+}
+
+// validateSteeringSettings checks the CPU masks and flow count of steering
+// settings. Masks are checked against the online CPUs at apply time.
+func validateSteeringSettings(section string, settings *types.SteeringSettings) []string {
+	if settings == nil {
+		return []string{section + ": settings are required"}
+	}
+
+	var errors []string
+	masks := []struct {
+		name   string
+		value  string
+		spread bool
+	}{
+		{"rps_cpus", settings.RPSCPUs, false},
+		{"xps_cpus", settings.XPSCPUs, true},
+		{"irq_affinity", settings.IRQAffinity, true},
+	}
+	for _, mask := range masks {
+		switch {
+		case mask.value == "" || mask.value == adapter.CPUMaskAll:
+		case mask.value == adapter.CPUMaskSpread:
+			if !mask.spread {
+				errors = append(errors, fmt.Sprintf("%s: %s does not support '%s'", section, mask.name, adapter.CPUMaskSpread))
+			}
+		default:
+			if _, err := adapter.ParseCPUMask(mask.value); err != nil {
+				errors = append(errors, fmt.Sprintf("%s: %s: %v", section, mask.name, err))
+			}
+		}
+	}
+
+	// The kernel rounds the flow count up to a power of two
+	if n := settings.RPSFlowCnt; n != nil && (*n < 0 || *n&(*n-1) != 0) {
+		errors = append(errors, fmt.Sprintf("%s: rps_flow_cnt must be 0 or a power of two, got %d", section, *n))
+	}
+	return errors
+}
+
+// Bounds of initcwnd and initrwnd, in segments
+const (
+	minRouteWindow = 1
+	maxRouteWindow = 65535
+)
+
+var congCtlRegex = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// validateRouteAttrs checks the windows and congestion control of route attributes
+func validateRouteAttrs(section string, attrs *types.RouteAttrs) []string {
+	if attrs.IsEmpty() {
+		return []string{section + ": set initcwnd, initrwnd or congctl"}
+	}
+
+	var errors []string
+	windows := []struct {
+		name  string
+		value *int
+	}{
+		{"initcwnd", attrs.InitCwnd},
+		{"initrwnd", attrs.InitRwnd},
+	}
+	for _, window := range windows {
+		if window.value != nil && (*window.value < minRouteWindow || *window.value > maxRouteWindow) {
+			errors = append(errors, fmt.Sprintf("%s: %s must be between %d and %d", section, window.name, minRouteWindow, maxRouteWindow))
+		}
+	}
+	if attrs.CongCtl != "" && !congCtlRegex.MatchString(attrs.CongCtl) {
+		errors = append(errors, fmt.Sprintf("%s: invalid congctl '%s'", section, attrs.CongCtl))
+	}
+	return errors
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // validQdiscParams defines valid parameters for each qdisc type
 var validQdiscParams = map[string][]string{
 	"fq": {
@@ -277,12 +550,13 @@ var validQdiscParams = map[string][]string{
 	},
 	"fq_codel": {
 		"limit", "flows", "target", "interval", "quantum",
-		"ecn", "noecn", "ce_threshold", "memory_limit",
+		"ecn", "noecn", "ce_threshold", "memory_limit", "drop_batch",
 	},
 	"cake": {
-		"bandwidth", "besteffort", "diffserv3", "diffserv4", "diffserv8",
+		"bandwidth", "unlimited", "besteffort", "precedence",
+		"diffserv3", "diffserv4", "diffserv8",
 		"flowblind", "srchost", "dsthost", "hosts", "flows",
-		"dual-srchost", "dual-dsthost", "nat", "nonat",
+		"dual-srchost", "dual-dsthost", "triple-isolate", "nat", "nonat",
 		"wash", "nowash", "split-gso", "no-split-gso",
 		"ack-filter", "ack-filter-aggressive", "no-ack-filter",
 		"memlimit", "fwmark", "atm", "noatm", "ptm", "noptm",
@@ -3,6 +3,7 @@ package service
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/jtsang4/nettune/internal/shared/types"
@@ -99,6 +100,185 @@ func TestProfileServiceValidate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "misordered tcp_rmem",
+			profile: &types.Profile{
+				ID:        "bad-rmem",
+				Name:      "Bad Rmem",
+				RiskLevel: "low",
+				Sysctl: map[string]interface{}{
+					"net.ipv4.tcp_rmem": "87380 4096 6291456",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "qdisc with interface selector",
+			profile: &types.Profile{
+				ID:        "multi-nic",
+				Name:      "Multi NIC",
+				RiskLevel: "medium",
+				Qdisc: &types.QdiscConfig{
+					Type:       "fq",
+					Interfaces: "eth0,ens1f*",
+					Exclude:    []string{"docker*", "veth*"},
+					PerInterface: map[string]*types.QdiscOverride{
+						"ens1f*": {Type: "cake", Params: map[string]interface{}{"bandwidth": "1gbit"}},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid per-interface override",
+			profile: &types.Profile{
+				ID:        "multi-nic",
+				Name:      "Multi NIC",
+				RiskLevel: "medium",
+				Qdisc: &types.QdiscConfig{
+					Type:       "fq",
+					Interfaces: "all",
+					PerInterface: map[string]*types.QdiscOverride{
+						"wg*": {Type: "fq_codel", Params: map[string]interface{}{"bandwidth": "1gbit"}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid interface pattern",
+			profile: &types.Profile{
+				ID:        "bad-iface",
+				Name:      "Bad Iface",
+				RiskLevel: "low",
+				Qdisc: &types.QdiscConfig{
+					Type:       "fq",
+					Interfaces: "eth0;reboot",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid with link settings",
+			profile: &types.Profile{
+				ID:        "nic-test",
+				Name:      "NIC Test",
+				RiskLevel: "medium",
+				Link: &types.LinkConfig{
+					Interfaces: "ens*",
+					LinkSettings: types.LinkSettings{
+						Offloads: map[string]bool{"gro": true, "rx-gro-hw": false},
+						Rings:    map[string]int{"rx": 4096},
+						Coalesce: map[string]interface{}{"adaptive-rx": false, "rx-usecs": float64(50)},
+					},
+					PerInterface: map[string]*types.LinkSettings{"ens1f0": {Rings: map[string]int{"tx": 2048}}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "empty link section",
+			profile: &types.Profile{
+				ID:        "nic-test",
+				Name:      "NIC Test",
+				RiskLevel: "medium",
+				Link:      &types.LinkConfig{Interfaces: "default-route"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid link ring and coalesce values",
+			profile: &types.Profile{
+				ID:        "nic-test",
+				Name:      "NIC Test",
+				RiskLevel: "medium",
+				Link: &types.LinkConfig{
+					Interfaces: "default-route",
+					LinkSettings: types.LinkSettings{
+						Rings:    map[string]int{"rx-huge": 4096},
+						Coalesce: map[string]interface{}{"adaptive-rx": "on", "rx-usecs": float64(-1), "rx-magic": float64(1)},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid mtu and txqueuelen",
+			profile: &types.Profile{
+				ID:        "nic-test",
+				Name:      "NIC Test",
+				RiskLevel: "medium",
+				Link: &types.LinkConfig{
+					Interfaces:   "eth0",
+					LinkSettings: types.LinkSettings{MTU: intPtr(40), TxQueueLen: intPtr(-1)},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid with steering settings",
+			profile: &types.Profile{
+				ID:        "steer-test",
+				Name:      "Steer Test",
+				RiskLevel: "medium",
+				Steering: &types.SteeringConfig{
+					Interfaces: "default-route",
+					SteeringSettings: types.SteeringSettings{
+						RPSCPUs:     "ff,ffffffff",
+						RPSFlowCnt:  intPtr(4096),
+						XPSCPUs:     "spread",
+						IRQAffinity: "all",
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid steering mask and flow count",
+			profile: &types.Profile{
+				ID:        "steer-test",
+				Name:      "Steer Test",
+				RiskLevel: "medium",
+				Steering: &types.SteeringConfig{
+					Interfaces: "default-route",
+					SteeringSettings: types.SteeringSettings{
+						RPSCPUs:    "spread",
+						RPSFlowCnt: intPtr(1000),
+						XPSCPUs:    "0xzz",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid with route attributes",
+			profile: &types.Profile{
+				ID:        "route-test",
+				Name:      "Route Test",
+				RiskLevel: "medium",
+				Routes: &types.RouteConfig{
+					Default:  &types.RouteAttrs{InitCwnd: intPtr(10), InitRwnd: intPtr(10)},
+					Prefixes: map[string]*types.RouteAttrs{"2001:db8::/32": {CongCtl: "bbr"}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid route attributes",
+			profile: &types.Profile{
+				ID:        "route-test",
+				Name:      "Route Test",
+				RiskLevel: "medium",
+				Routes: &types.RouteConfig{
+					Default: &types.RouteAttrs{InitCwnd: intPtr(0), CongCtl: "bbr; reboot"},
+					Prefixes: map[string]*types.RouteAttrs{
+						"default":    {InitCwnd: intPtr(10)},
+						"10.0.0.0/8": {},
+					},
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "invalid qdisc type",
 			profile: &types.Profile{
@@ -263,3 +443,71 @@ func TestIsValidQdiscType(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateSysctlValue(t *testing.T) {
+	tests := []struct {
+		key     string
+		value   interface{}
+		wantErr string
+	}{
+		{"net.ipv4.tcp_rmem", "4096 87380 33554432", ""},
+		{"net.ipv4.tcp_rmem", "4096\t87380\t33554432", ""},
+		{"net.ipv4.tcp_rmem", "87380 4096 33554432", "min <= default <= max"},
+		{"net.ipv4.tcp_wmem", "4096 65536", "expected 3 integers"},
+		{"net.ipv4.tcp_wmem", "4096 abc 65536", "default value \"abc\" is not an integer"},
+		{"net.ipv4.tcp_mem", "100 50 200", "low <= pressure <= high"},
+		{"net.ipv4.ip_local_port_range", "1024 65535", ""},
+		{"net.ipv4.ip_local_port_range", "1024 70000", "high value 70000 is out of range"},
+		{"net.ipv4.ip_local_port_range", "60000 1024", "low <= high"},
+		{"net.core.rmem_max", float64(33554432), ""},
+		{"net.core.rmem_max", 33554432, ""},
+		{"net.core.rmem_max", float64(-1), "out of range"},
+		{"net.core.rmem_max", 1.5, "not an integer"},
+		{"net.core.rmem_max", true, "unsupported value type"},
+		{"net.ipv4.tcp_mtu_probing", float64(1), ""},
+		{"net.ipv4.tcp_mtu_probing", float64(3), "out of range [0, 2]"},
+		{"net.ipv4.tcp_slow_start_after_idle", "2", "out of range [0, 1]"},
+		{"net.core.default_qdisc", "fq", ""},
+		{"net.core.default_qdisc", "htb", "is not one of"},
+		{"net.ipv4.tcp_congestion_control", "bbr", ""},
+		{"net.ipv4.tcp_congestion_control", "bbr; reboot", "not a valid name"},
+		{"net.ipv4.conf.all.rp_filter", "anything", ""},
+	}
+
+	for _, tt := range tests {
+		err := validateSysctlValue(tt.key, tt.value)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("validateSysctlValue(%s, %v) error = %v, want nil", tt.key, tt.value, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("validateSysctlValue(%s, %v) error = %v, want containing %q", tt.key, tt.value, err, tt.wantErr)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), "sysctl "+tt.key+":") {
+			t.Errorf("validateSysctlValue(%s, %v) error = %v, want key prefix", tt.key, tt.value, err)
+		}
+	}
+}
+
+func TestBuiltinProfilesMatchSchema(t *testing.T) {
+	svc, err := NewProfileService(t.TempDir(), zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewProfileService failed: %v", err)
+	}
+	for _, id := range []string{"bbr-fq-default", "bbr-fq-tuned-32mb"} {
+		profile, err := svc.Get(id)
+		if err != nil {
+			t.Fatalf("Get(%s) failed: %v", id, err)
+		}
+		if err := svc.Validate(profile); err != nil {
+			t.Errorf("builtin profile %s: %v", id, err)
+		}
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jtsang4/nettune/internal/server/adapter"
+	"github.com/jtsang4/nettune/internal/shared/types"
+)
+
+// Interface selection modes of a qdisc config
+const (
+	qdiscInterfacesDefaultRoute = "default-route"
+	qdiscInterfacesAll          = "all"
+)
+
+// qdiscTargets resolves the interfaces a qdisc config selects on this host
+func (s *ApplyService) qdiscTargets(cfg *types.QdiscConfig) ([]adapter.QdiscTarget, error) {
+	candidates, err := s.interfaceCandidates(cfg.Interfaces)
+	if err != nil {
+		return nil, err
+	}
+	return selectQdiscTargets(cfg, candidates)
+}
+
+// interfaceCandidates returns the interfaces a selector picks from: the IPv4 and
+// IPv6 default route interfaces in default-route mode, otherwise the interfaces
+// that are up
+func (s *ApplyService) interfaceCandidates(interfaces string) ([]string, error) {
+	if interfaces == qdiscInterfacesDefaultRoute {
+		routes, err := s.adapter.Qdisc.GetDefaultRoutes()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get default route interface: %w", err)
+		}
+		return routes.Interfaces(), nil
+	}
+
+	available, err := s.adapter.Qdisc.ListInterfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	return available, nil
+}
+
+// selectQdiscTargets picks the interfaces of cfg from the candidates, drops the
+// excluded ones and assigns each its qdisc. In default-route mode the candidates
+// are the IPv4 and IPv6 default route interfaces, so dual-stack hosts whose
+// families egress through different interfaces get the qdisc on both.
+// Otherwise they are the interfaces that are up.
+func selectQdiscTargets(cfg *types.QdiscConfig, candidates []string) ([]adapter.QdiscTarget, error) {
+	names, err := selectInterfaces(cfg.Interfaces, cfg.Exclude, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]adapter.QdiscTarget, 0, len(names))
+	for _, iface := range names {
+		target := adapter.QdiscTarget{Interface: iface, Type: cfg.Type, Params: cfg.Params}
+		if override, ok := overrideFor(cfg.PerInterface, iface); ok && override != nil {
+			target.Type = override.Type
+			target.Params = override.Params
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// selectInterfaces returns the sorted candidates an interface selector matches,
+// minus the excluded ones
+func selectInterfaces(interfaces string, exclude []string, candidates []string) ([]string, error) {
+	selected := make(map[string]bool)
+
+	switch interfaces {
+	case qdiscInterfacesDefaultRoute, qdiscInterfacesAll:
+		for _, iface := range candidates {
+			selected[iface] = true
+		}
+	default:
+		for _, pattern := range qdiscInterfacePatterns(interfaces) {
+			matched := false
+			for _, iface := range candidates {
+				if ok, _ := filepath.Match(pattern, iface); ok {
+					selected[iface] = true
+					matched = true
+				}
+			}
+			// A named interface must exist; a glob may match nothing
+			if !matched && !isGlobPattern(pattern) {
+				return nil, fmt.Errorf("interface %s not found or not up", pattern)
+			}
+		}
+	}
+
+	for iface := range selected {
+		for _, pattern := range exclude {
+			if ok, _ := filepath.Match(pattern, iface); ok {
+				delete(selected, iface)
+				break
+			}
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no interfaces match %q", interfaces)
+	}
+
+	names := make([]string, 0, len(selected))
+	for iface := range selected {
+		names = append(names, iface)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// overrideFor returns the per-interface override for an interface. An exact
+// name wins over glob patterns, and overlapping globs are tried in sorted order.
+func overrideFor[T any](overrides map[string]T, iface string) (T, bool) {
+	if override, ok := overrides[iface]; ok {
+		return override, true
+	}
+
+	patterns := make([]string, 0, len(overrides))
+	for pattern := range overrides {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, iface); ok {
+			return overrides[pattern], true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// qdiscInterfacePatterns splits a comma-separated interface list
+func qdiscInterfacePatterns(interfaces string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(interfaces, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// isGlobPattern reports whether a pattern contains glob metacharacters
+func isGlobPattern(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// validateInterfacePattern checks an interface name or glob pattern
+func validateInterfacePattern(pattern string) error {
+	if !interfacePatternRegex.MatchString(pattern) {
+		return fmt.Errorf("invalid interface pattern '%s'", pattern)
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid interface pattern '%s': %v", pattern, err)
+	}
+	return nil
+}
+
+// qdiscSummary describes a qdisc as its type and the parameters target sets,
+// e.g. "fq maxrate 1gbit", for plans and verification errors
+func qdiscSummary(info *types.QdiscInfo, target adapter.QdiscTarget) string {
+	params := make(map[string]interface{})
+	if info.Type == target.Type {
+		restorable := adapter.RestorableParams(info.Type, info.Params)
+		for key := range adapter.RestorableParams(target.Type, target.Params) {
+			if value, ok := restorable[key]; ok {
+				params[key] = value
+			}
+		}
+	}
+	return strings.Join(append([]string{info.Type}, adapter.QdiscArgs(params)...), " ")
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jtsang4/nettune/internal/server/adapter"
+	"github.com/jtsang4/nettune/internal/shared/types"
+)
+
+func TestSelectQdiscTargets(t *testing.T) {
+	up := []string{"docker0", "eth0", "eth1", "ens1f0", "ens1f1", "veth12ab", "wg0"}
+	fq := map[string]interface{}{"flow_limit": float64(200)}
+
+	tests := []struct {
+		name    string
+		cfg     *types.QdiscConfig
+		want    []adapter.QdiscTarget
+		wantErr bool
+	}{
+		{
+			name: "all with exclusions",
+			cfg:  &types.QdiscConfig{Type: "fq", Interfaces: "all", Exclude: []string{"docker*", "veth*", "wg*"}},
+			want: []adapter.QdiscTarget{
+				{Interface: "ens1f0", Type: "fq"},
+				{Interface: "ens1f1", Type: "fq"},
+				{Interface: "eth0", Type: "fq"},
+				{Interface: "eth1", Type: "fq"},
+			},
+		},
+		{
+			name: "names and globs",
+			cfg:  &types.QdiscConfig{Type: "fq", Interfaces: "eth0, ens1f*", Params: fq, Exclude: []string{"ens1f1"}},
+			want: []adapter.QdiscTarget{
+				{Interface: "ens1f0", Type: "fq", Params: fq},
+				{Interface: "eth0", Type: "fq", Params: fq},
+			},
+		},
+		{
+			name: "per-interface overrides",
+			cfg: &types.QdiscConfig{
+				Type:       "fq",
+				Interfaces: "eth*,wg0",
+				PerInterface: map[string]*types.QdiscOverride{
+					"eth*": {Type: "fq_codel"},
+					"eth1": {Type: "cake", Params: map[string]interface{}{"bandwidth": "1gbit"}},
+					"wg*":  {Type: "pfifo_fast"},
+				},
+			},
+			want: []adapter.QdiscTarget{
+				{Interface: "eth0", Type: "fq_codel"},
+				{Interface: "eth1", Type: "cake", Params: map[string]interface{}{"bandwidth": "1gbit"}},
+				{Interface: "wg0", Type: "pfifo_fast"},
+			},
+		},
+		{
+			name:    "missing named interface",
+			cfg:     &types.QdiscConfig{Type: "fq", Interfaces: "eth0,bond0"},
+			wantErr: true,
+		},
+		{
+			name:    "everything excluded",
+			cfg:     &types.QdiscConfig{Type: "fq", Interfaces: "eth*", Exclude: []string{"eth*"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectQdiscTargets(tt.cfg, up)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectQdiscTargets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectQdiscTargets() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
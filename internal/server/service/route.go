@@ -0,0 +1,251 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"slices"
+
+	"github.com/jtsang4/nettune/internal/server/adapter"
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"go.uber.org/zap"
+)
+
+// routeTargets resolves a route config to one target per family and
+// destination; the default attributes target the default route of each family
+func routeTargets(cfg *types.RouteConfig) ([]adapter.RouteTarget, error) {
+	var targets []adapter.RouteTarget
+	if !cfg.Default.IsEmpty() {
+		for _, family := range adapter.RouteFamilies {
+			targets = append(targets, adapter.RouteTarget{Family: family, Dest: "default", Attrs: cfg.Default})
+		}
+	}
+
+	for _, prefix := range sortedKeys(cfg.Prefixes) {
+		attrs := cfg.Prefixes[prefix]
+		if attrs.IsEmpty() {
+			continue
+		}
+		family, err := adapter.RouteFamily(prefix)
+		if err != nil {
+			return nil, err
+		}
+		dest := prefix
+		if _, network, err := net.ParseCIDR(prefix); err == nil {
+			dest = network.String()
+		}
+		targets = append(targets, adapter.RouteTarget{Family: family, Dest: dest, Attrs: attrs})
+	}
+	return targets, nil
+}
+
+// planRouteChanges adds the routes, attribute changes and preflight of a
+// profile to a plan. A missing prefix route blocks a commit; a default route
+// is only required in one family.
+func (s *ApplyService) planRouteChanges(plan *types.ApplyPlan, cfg *types.RouteConfig) {
+	plan.RouteChanges = make(map[string]*types.Change)
+	plan.RoutePreflight = make(map[string]*types.SysctlPreflight)
+
+	targets, err := routeTargets(cfg)
+	if err != nil {
+		plan.RoutePreflight["routes"] = &types.SysctlPreflight{Status: types.PreflightMissing, Detail: err.Error()}
+		return
+	}
+
+	defaultFound := false
+	for _, target := range targets {
+		name := target.Family + " " + target.Dest
+		routes, err := s.adapter.Route.Find(target.Family, target.Dest)
+		if err != nil {
+			plan.RoutePreflight[name] = &types.SysctlPreflight{Status: types.PreflightMissing, Detail: err.Error()}
+			continue
+		}
+		if len(routes) == 0 {
+			if target.Dest != "default" {
+				plan.RoutePreflight[name] = &types.SysctlPreflight{
+					Status: types.PreflightMissing,
+					Detail: fmt.Sprintf("no route to %s in the main table", target.Dest),
+				}
+			}
+			continue
+		}
+		if target.Dest == "default" {
+			defaultFound = true
+		}
+		plan.RoutePreflight[name] = &types.SysctlPreflight{Status: types.PreflightOK}
+
+		for _, route := range routes {
+			plan.RouteTargets = append(plan.RouteTargets, route.Key())
+			current := adapter.RouteAttrValues(&route.Attrs)
+			for attr, value := range adapter.RouteAttrValues(target.Attrs) {
+				if from, ok := current[attr]; !ok || from != value {
+					plan.RouteChanges[route.Key()+"/"+attr] = &types.Change{From: from, To: value}
+				}
+			}
+		}
+	}
+
+	if !cfg.Default.IsEmpty() && !defaultFound {
+		plan.RoutePreflight["default"] = &types.SysctlPreflight{
+			Status: types.PreflightMissing,
+			Detail: "no IPv4 or IPv6 default route in the main table",
+		}
+	}
+}
+
+// applyRoutes sets the attributes of every route a target matches, keeping
+// the attributes the target leaves unset
+func (s *ApplyService) applyRoutes(targets []adapter.RouteTarget) error {
+	for _, target := range targets {
+		routes, err := s.adapter.Route.Find(target.Family, target.Dest)
+		if err != nil {
+			return err
+		}
+		for _, route := range routes {
+			merged := adapter.MergeRouteAttrs(&route.Attrs, target.Attrs)
+			if reflect.DeepEqual(adapter.RouteAttrValues(&merged), adapter.RouteAttrValues(&route.Attrs)) {
+				continue
+			}
+			route.Attrs = merged
+			if err := s.adapter.Route.Set(route); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// verifyRoutes checks that every route a target matches carries its attributes
+func (s *ApplyService) verifyRoutes(cfg *types.RouteConfig, result *types.VerificationResult) {
+	targets, err := routeTargets(cfg)
+	if err != nil {
+		result.RouteOK = false
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to resolve routes: %v", err))
+		return
+	}
+
+	for _, target := range targets {
+		routes, err := s.adapter.Route.Find(target.Family, target.Dest)
+		if err != nil {
+			result.RouteOK = false
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to read %s routes to %s: %v", target.Family, target.Dest, err))
+			continue
+		}
+		expected := adapter.RouteAttrValues(target.Attrs)
+		for _, route := range routes {
+			live := adapter.RouteAttrValues(&route.Attrs)
+			for _, attr := range sortedKeys(expected) {
+				if got, ok := live[attr]; !ok || got != expected[attr] {
+					result.RouteOK = false
+					result.Errors = append(result.Errors, fmt.Sprintf("route %s %s: expected %v, got %v", route.Key(), attr, expected[attr], got))
+				}
+			}
+		}
+	}
+}
+
+// restoreRoutes brings the attributes of the routes in keys back to the
+// snapshot state, clearing those the snapshot did not record on them. Other
+// routes are left alone, and routes that no longer exist are skipped.
+// Snapshots without route state are left alone.
+func (s *ApplyService) restoreRoutes(saved map[string]*types.RouteAttrs, keys []string) error {
+	if saved == nil {
+		return nil
+	}
+
+	for _, key := range keys {
+		want, err := adapter.ParseRouteKey(key)
+		if err != nil {
+			return err
+		}
+		routes, err := s.adapter.Route.Find(want.Family, want.Dest())
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, route := range routes {
+			if route.Key() == key {
+				found = true
+				if err := s.restoreRoute(route, saved[key]); err != nil {
+					return err
+				}
+			}
+		}
+		if !found {
+			s.logger.Warn("route no longer exists, skipping restore",
+				zap.String("route", key))
+		}
+	}
+	return nil
+}
+
+// restoreRoute gives a route the saved attributes if they differ
+func (s *ApplyService) restoreRoute(route *adapter.Route, saved *types.RouteAttrs) error {
+	want := types.RouteAttrs{}
+	if saved != nil {
+		want = *saved
+	}
+	if reflect.DeepEqual(adapter.RouteAttrValues(&want), adapter.RouteAttrValues(&route.Attrs)) {
+		return nil
+	}
+	route.Attrs = want
+	return s.adapter.Route.Set(route)
+}
+
+// ensureRouteService creates and enables the route persistence service, which
+// reapplies at boot the route attributes of every target, merged into those
+// earlier applies persisted
+func (s *ApplyService) ensureRouteService(targets []adapter.RouteTarget) error {
+	content, err := s.readSetupScript(adapter.NettuneRouteScriptPath)
+	if err != nil {
+		return err
+	}
+	persisted, err := adapter.ParseRouteSetupScript(content)
+	if err != nil {
+		s.logger.Warn("failed to parse persisted route attributes, replacing them", zap.Error(err))
+		persisted = nil
+	}
+
+	return s.ensureService(adapter.NettuneRouteServiceName,
+		adapter.NettuneRouteScriptPath, adapter.GenerateRouteSetupScript(mergeRouteTargets(persisted, targets)),
+		adapter.GenerateRouteServiceUnit())
+}
+
+// mergeRouteTargets merges targets into the persisted ones per family,
+// destination and attribute; the attributes of targets take precedence
+func mergeRouteTargets(persisted, targets []adapter.RouteTarget) []adapter.RouteTarget {
+	var merged []adapter.RouteTarget
+	byRoute := make(map[string]*types.RouteAttrs)
+	for _, target := range append(slices.Clone(persisted), targets...) {
+		key := target.Family + " " + target.Dest
+		attrs := byRoute[key]
+		if attrs == nil {
+			attrs = &types.RouteAttrs{}
+			byRoute[key] = attrs
+			merged = append(merged, adapter.RouteTarget{Family: target.Family, Dest: target.Dest, Attrs: attrs})
+		}
+		if target.Attrs == nil {
+			continue
+		}
+		if target.Attrs.InitCwnd != nil {
+			attrs.InitCwnd = target.Attrs.InitCwnd
+		}
+		if target.Attrs.InitRwnd != nil {
+			attrs.InitRwnd = target.Attrs.InitRwnd
+		}
+		if target.Attrs.CongCtl != "" {
+			attrs.CongCtl = target.Attrs.CongCtl
+		}
+	}
+	return merged
+}
+
+// routeStateMap converts routes to the "family spec" -> attributes map snapshots record
+func routeStateMap(routes []*adapter.Route) map[string]*types.RouteAttrs {
+	state := make(map[string]*types.RouteAttrs, len(routes))
+	for _, route := range routes {
+		attrs := route.Attrs
+		state[route.Key()] = &attrs
+	}
+	return state
+}
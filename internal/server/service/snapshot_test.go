@@ -1,11 +1,17 @@
 package service
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jtsang4/nettune/internal/server/adapter"
 	"github.com/jtsang4/nettune/internal/shared/types"
+	"go.uber.org/zap"
 )
 
 func TestSnapshotDirectory(t *testing.T) {
@@ -273,3 +279,532 @@ func TestRollbackResult(t *testing.T) {
 		t.Errorf("SnapshotID = %s, want snapshot-123", result.SnapshotID)
 	}
 }
+
+func TestSnapshotSysctlKeys(t *testing.T) {
+	keys := snapshotSysctlKeys([]string{
+		"net.core.netdev_max_backlog",
+		"net.ipv4.tcp_congestion_control", // already tracked
+		"net.ipv4.tcp_moderate_rcvbuf",
+	})
+
+	seen := make(map[string]int)
+	for _, key := range keys {
+		seen[key]++
+	}
+
+	for _, key := range []string{"net.core.netdev_max_backlog", "net.ipv4.tcp_moderate_rcvbuf", "net.core.rmem_max"} {
+		if seen[key] != 1 {
+			t.Errorf("key %s appears %d times, want 1", key, seen[key])
+		}
+	}
+	if seen["net.ipv4.tcp_congestion_control"] != 1 {
+		t.Error("tracked keys should not be duplicated")
+	}
+	for i := 1; i < len(keys); i++ {
+		if keys[i-1] > keys[i] {
+			t.Fatalf("keys are not sorted: %v", keys)
+		}
+	}
+}
+
+func TestCreateBackups_Tombstones(t *testing.T) {
+	tmpDir := t.TempDir()
+	svc, err := NewSnapshotService(filepath.Join(tmpDir, "snapshots"), &adapter.SystemAdapter{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewSnapshotService failed: %v", err)
+	}
+
+	present := filepath.Join(tmpDir, "99-nettune.conf")
+	if err := os.WriteFile(present, []byte("net.core.rmem_max = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	absent := filepath.Join(tmpDir, "nettune-qdisc-setup.sh")
+
+	backups, tombstones, err := svc.createBackups(filepath.Join(tmpDir, "snap"), []string{present, absent})
+	if err != nil {
+		t.Fatalf("createBackups failed: %v", err)
+	}
+
+	if backups[present] != "net.core.rmem_max = 1\n" {
+		t.Errorf("backup of %s = %q", present, backups[present])
+	}
+	if _, ok := backups[absent]; ok {
+		t.Errorf("absent file %s should not be backed up", absent)
+	}
+	if len(tombstones) != 1 || tombstones[0] != absent {
+		t.Errorf("tombstones = %v, want [%s]", tombstones, absent)
+	}
+}
+
+func TestRemoveTombstones(t *testing.T) {
+	svc, sys := newFakeApplyService(t)
+
+	created := adapter.NettuneSysctlFilePath
+	if err := os.WriteFile(sys.Path(created), []byte("net.core.rmem_max = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := &types.Snapshot{
+		Tombstones: []string{created, adapter.NettuneQdiscScriptPath},
+	}
+	if !snapshot.HasTombstone(created) {
+		t.Fatal("HasTombstone should report recorded paths")
+	}
+
+	if errs := svc.removeTombstones(snapshot); len(errs) != 0 {
+		t.Fatalf("removeTombstones errors: %v", errs)
+	}
+	if _, err := os.Stat(sys.Path(created)); !os.IsNotExist(err) {
+		t.Error("file created after the snapshot should be removed")
+	}
+}
+
+func TestMergeSysctlEntries(t *testing.T) {
+	persisted := map[string]*adapter.SysctlFileEntry{
+		"net.core.rmem_max":               {Value: "67108864", ProfileID: "high-bdp", ApplyID: "snap-1"},
+		"net.ipv4.tcp_congestion_control": {Value: "cubic", ProfileID: "high-bdp", ApplyID: "snap-1"},
+	}
+
+	merged := mergeSysctlEntries(persisted, map[string]string{
+		"net.ipv4.tcp_congestion_control": "bbr",
+	}, "bbr-fq-default", "snap-2")
+
+	if len(merged) != 2 {
+		t.Fatalf("merged has %d keys, want 2", len(merged))
+	}
+	if entry := merged["net.core.rmem_max"]; entry.Value != "67108864" || entry.ProfileID != "high-bdp" {
+		t.Errorf("earlier key should be kept with its provenance, got %+v", entry)
+	}
+	if entry := merged["net.ipv4.tcp_congestion_control"]; entry.Value != "bbr" || entry.ApplyID != "snap-2" {
+		t.Errorf("profile key should be updated, got %+v", entry)
+	}
+	if persisted["net.ipv4.tcp_congestion_control"].Value != "cubic" {
+		t.Error("persisted entries should not be modified")
+	}
+}
+
+func TestPreflightProblems(t *testing.T) {
+	blocking, notices := preflightProblems("sysctl", map[string]*types.SysctlPreflight{
+		"net.ipv4.tcp_tw_recycle":         {Status: types.PreflightMissing, Detail: "not available"},
+		"net.core.rmem_max":               {Status: types.PreflightReadOnly, Detail: "read-only file system"},
+		"net.ipv4.tcp_congestion_control": {Status: types.PreflightOK},
+		"net.ipv4.tcp_fastopen":           {Status: types.PreflightNamespaced, Detail: "only affects the current network namespace"},
+	})
+
+	if len(blocking) != 2 {
+		t.Fatalf("blocking = %v, want 2 entries", blocking)
+	}
+	if !strings.HasPrefix(blocking[0], "sysctl net.core.rmem_max is read-only") {
+		t.Errorf("blocking should be sorted by key, got %v", blocking)
+	}
+	if len(notices) != 1 || !strings.Contains(notices[0], "net.ipv4.tcp_fastopen") {
+		t.Errorf("notices = %v, want the namespaced key", notices)
+	}
+}
+
+func TestRequiredModules(t *testing.T) {
+	bbr := &types.Profile{
+		Sysctl:        map[string]interface{}{"net.ipv4.tcp_congestion_control": "bbr"},
+		KernelModules: []string{"sch_fq"},
+	}
+
+	tests := []struct {
+		name      string
+		profile   *types.Profile
+		available []string
+		loaded    map[string]bool
+		want      []string
+	}{
+		{"not available", bbr, []string{"reno", "cubic"}, map[string]bool{}, []string{"sch_fq", "tcp_bbr"}},
+		{"loaded module", bbr, []string{"reno", "cubic", "bbr"}, map[string]bool{"tcp_bbr": true}, []string{"sch_fq", "tcp_bbr"}},
+		{"built in", bbr, []string{"reno", "cubic", "bbr"}, map[string]bool{}, []string{"sch_fq"}},
+		{"no congestion control", &types.Profile{}, nil, nil, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := requiredModules(tt.profile, tt.available, tt.loaded)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requiredModules() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModuleChanges(t *testing.T) {
+	loaded := map[string]bool{"tcp_bbr": true, "sch_fq": true}
+	changes := moduleChanges([]string{"sch_fq", "tcp_bbr", "tcp_htcp"}, loaded, []string{"tcp_bbr"})
+
+	if _, ok := changes["tcp_bbr"]; ok {
+		t.Error("loaded and persisted module should have no change")
+	}
+	if c := changes["sch_fq"]; c == nil || c.From != types.ModuleLoaded || c.To != types.ModulePersisted {
+		t.Errorf("sch_fq change = %+v", c)
+	}
+	if c := changes["tcp_htcp"]; c == nil || c.From != types.ModuleNotLoaded {
+		t.Errorf("tcp_htcp change = %+v", c)
+	}
+
+	merged := mergeModules([]string{"tcp_htcp", "tcp_bbr"}, []string{"tcp_bbr", "sch_fq"})
+	if !reflect.DeepEqual(merged, []string{"sch_fq", "tcp_bbr", "tcp_htcp"}) {
+		t.Errorf("mergeModules() = %v", merged)
+	}
+}
+
+// writeTestSnapshot stores a minimal snapshot taken at createdAt
+func writeTestSnapshot(t *testing.T, svc *SnapshotService, id string, createdAt time.Time, pinned bool) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(svc.snapshotsDir, id), 0755); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := &types.Snapshot{ID: id, CreatedAt: createdAt, State: &types.SystemState{}, Pinned: pinned}
+	if err := svc.saveSnapshot(snapshot); err != nil {
+		t.Fatalf("saveSnapshot failed: %v", err)
+	}
+}
+
+func snapshotIDs(t *testing.T, svc *SnapshotService) []string {
+	t.Helper()
+	snapshots, err := svc.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var ids []string
+	for _, meta := range snapshots {
+		ids = append(ids, meta.ID)
+	}
+	return ids
+}
+
+func TestSnapshotRetention(t *testing.T) {
+	tmpDir := t.TempDir()
+	svc, err := NewSnapshotService(filepath.Join(tmpDir, "snapshots"), &adapter.SystemAdapter{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewSnapshotService failed: %v", err)
+	}
+	history, err := NewHistoryService(filepath.Join(tmpDir, "history"), zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewHistoryService failed: %v", err)
+	}
+
+	now := time.Now().UTC()
+	for i, id := range []string{"s1", "s2", "s3", "s4", "s5", "s6"} {
+		writeTestSnapshot(t, svc, id, now.Add(time.Duration(i-6)*time.Hour), id == "s1")
+	}
+	history.RecordApply("bbr-fq-default", "s2", true, nil)
+	history.RecordApply("bbr-fq-default", "s3", false, nil)
+	svc.hold("s3", snapshotHoldPendingRollback)
+
+	// Nothing is pruned until a policy is set
+	if pruned := svc.Prune(); len(pruned) != 0 {
+		t.Fatalf("Prune() without a policy = %v", pruned)
+	}
+
+	svc.SetRetention(SnapshotRetention{MaxCount: 2, KeepApplies: 1}, history)
+	pruned := svc.Prune()
+	if !reflect.DeepEqual(pruned, []string{"s4"}) {
+		t.Errorf("Prune() = %v, want [s4]", pruned)
+	}
+	// s6 and s5 fill the count; s3 is held, s2 belongs to the last apply, s1 is pinned
+	if ids := snapshotIDs(t, svc); !reflect.DeepEqual(ids, []string{"s6", "s5", "s3", "s2", "s1"}) {
+		t.Errorf("kept snapshots = %v", ids)
+	}
+
+	svc.release("s3", snapshotHoldPendingRollback)
+	svc.SetRetention(SnapshotRetention{MaxAge: 90 * time.Minute, KeepApplies: 1}, history)
+	if pruned := svc.Prune(); !reflect.DeepEqual(pruned, []string{"s5", "s3"}) {
+		t.Errorf("Prune() by age = %v, want [s5 s3]", pruned)
+	}
+	if ids := snapshotIDs(t, svc); !reflect.DeepEqual(ids, []string{"s6", "s2", "s1"}) {
+		t.Errorf("kept snapshots = %v", ids)
+	}
+
+	entries, _ := history.GetRecentEntries(1)
+	if len(entries) != 1 || entries[0].Action != "snapshot_delete" || entries[0].Details["reason"] != "retention" {
+		t.Errorf("pruning should be recorded in history, got %+v", entries)
+	}
+}
+
+func TestSnapshotDeleteProtected(t *testing.T) {
+	svc, err := NewSnapshotService(filepath.Join(t.TempDir(), "snapshots"), &adapter.SystemAdapter{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewSnapshotService failed: %v", err)
+	}
+	now := time.Now().UTC()
+	writeTestSnapshot(t, svc, "pinned", now, true)
+	writeTestSnapshot(t, svc, "held", now, false)
+	writeTestSnapshot(t, svc, "plain", now, false)
+	svc.hold("held", snapshotHoldRecovery)
+
+	if err := svc.Delete("pinned"); !errors.Is(err, types.ErrSnapshotProtected) {
+		t.Errorf("Delete(pinned) error = %v, want ErrSnapshotProtected", err)
+	}
+	if err := svc.Delete("held"); !errors.Is(err, types.ErrSnapshotProtected) || !strings.Contains(err.Error(), snapshotHoldRecovery) {
+		t.Errorf("Delete(held) error = %v, want ErrSnapshotProtected naming the hold", err)
+	}
+	for _, id := range []string{"..", "missing", ""} {
+		if err := svc.Delete(id); !errors.Is(err, types.ErrSnapshotNotFound) {
+			t.Errorf("Delete(%q) error = %v, want ErrSnapshotNotFound", id, err)
+		}
+	}
+
+	if err := svc.Delete("plain"); err != nil {
+		t.Errorf("Delete(plain) failed: %v", err)
+	}
+	if _, err := svc.Get("plain"); !errors.Is(err, types.ErrSnapshotNotFound) {
+		t.Errorf("deleted snapshot still readable: %v", err)
+	}
+
+	meta, err := svc.SetPinned("pinned", false)
+	if err != nil || meta.Pinned {
+		t.Fatalf("SetPinned(false) = %+v, %v", meta, err)
+	}
+	if err := svc.Delete("pinned"); err != nil {
+		t.Errorf("Delete after unpinning failed: %v", err)
+	}
+}
+
+func TestSnapshotProvenanceAndFilter(t *testing.T) {
+	svc, _ := newFakeApplyService(t)
+	snapshots := svc.snapshotService
+
+	manual, err := snapshots.Create(&SnapshotOptions{Label: "Weekly", Note: "taken before the maintenance window"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if manual.Provenance == nil || manual.Provenance.Reason != types.SnapshotReasonManual {
+		t.Errorf("provenance = %+v, want a manual snapshot", manual.Provenance)
+	}
+
+	result, err := svc.Apply(&types.ApplyRequest{
+		ProfileID:     "bbr-fq-default",
+		Mode:          "commit",
+		SnapshotLabel: "before bbr",
+		ClientIP:      "198.51.100.7",
+	})
+	if err != nil || !result.Success {
+		t.Fatalf("Apply failed: %v %v", err, result)
+	}
+	applied, err := snapshots.Get(result.SnapshotID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	want := &types.SnapshotProvenance{
+		Reason:    types.SnapshotReasonApply,
+		ProfileID: "bbr-fq-default",
+		ClientIP:  "198.51.100.7",
+	}
+	if !reflect.DeepEqual(applied.Provenance, want) || applied.Label != "before bbr" {
+		t.Errorf("apply snapshot = label %q provenance %+v", applied.Label, applied.Provenance)
+	}
+
+	tests := []struct {
+		name   string
+		filter *types.SnapshotFilter
+		want   []string
+	}{
+		{"no filter", nil, []string{result.SnapshotID, manual.ID}},
+		{"profile", &types.SnapshotFilter{ProfileID: "bbr-fq-default"}, []string{result.SnapshotID}},
+		{"reason", &types.SnapshotFilter{Reason: types.SnapshotReasonManual}, []string{manual.ID}},
+		{"label ignores case", &types.SnapshotFilter{Label: "weekly"}, []string{manual.ID}},
+		{"query in note", &types.SnapshotFilter{Query: "MAINTENANCE"}, []string{manual.ID}},
+		{"client", &types.SnapshotFilter{ClientIP: "198.51.100.7"}, []string{result.SnapshotID}},
+		{"pinned", &types.SnapshotFilter{Pinned: true}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metas, err := snapshots.ListMatching(tt.filter)
+			if err != nil {
+				t.Fatalf("ListMatching failed: %v", err)
+			}
+			var ids []string
+			for _, meta := range metas {
+				ids = append(ids, meta.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("ListMatching() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	if _, err := snapshots.Create(&SnapshotOptions{Label: "two\nlines"}); !errors.Is(err, types.ErrValidationFailed) {
+		t.Errorf("a multi-line label error = %v, want ErrValidationFailed", err)
+	}
+	_, err = svc.Apply(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "dry_run", SnapshotNote: strings.Repeat("x", 2000)})
+	if !errors.Is(err, types.ErrValidationFailed) {
+		t.Errorf("an oversized note error = %v, want ErrValidationFailed", err)
+	}
+}
+
+func TestSnapshotBaseline(t *testing.T) {
+	svc, sys := newFakeApplyService(t)
+	snapshots := svc.snapshotService
+	snapshots.SetRetention(SnapshotRetention{MaxCount: 1}, svc.historyService)
+	const key = "net.ipv4.tcp_congestion_control"
+	pristine := mustSysctl(t, sys, key)
+
+	id, err := snapshots.EnsureBaseline()
+	if err != nil || id == "" {
+		t.Fatalf("EnsureBaseline() = %q, %v", id, err)
+	}
+	baseline, err := snapshots.Get(types.SnapshotBaseline)
+	if err != nil {
+		t.Fatalf("Get(baseline) failed: %v", err)
+	}
+	if baseline.ID != id || !baseline.Pinned || baseline.Provenance.Reason != types.SnapshotReasonBaseline ||
+		baseline.Metadata["sysctl_scope"] != "full" {
+		t.Errorf("baseline = %+v, want a pinned full snapshot", baseline)
+	}
+
+	for i := 0; i < 2; i++ {
+		result, err := svc.Apply(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "commit"})
+		if err != nil || !result.Success {
+			t.Fatalf("Apply failed: %v %v", err, result)
+		}
+	}
+	metas, err := snapshots.ListMatching(&types.SnapshotFilter{Reason: types.SnapshotReasonBaseline})
+	if err != nil || len(metas) != 1 || !metas[0].Baseline {
+		t.Errorf("baseline should survive retention, got %+v, %v", metas, err)
+	}
+
+	if err := snapshots.Delete(types.SnapshotBaseline); !errors.Is(err, types.ErrSnapshotProtected) {
+		t.Errorf("Delete(baseline) error = %v, want ErrSnapshotProtected", err)
+	}
+	if _, err := snapshots.SetPinned(id, false); !errors.Is(err, types.ErrSnapshotProtected) {
+		t.Errorf("SetPinned(baseline, false) error = %v, want ErrSnapshotProtected", err)
+	}
+
+	if err := svc.Rollback(id); err != nil {
+		t.Fatalf("Rollback to baseline failed: %v", err)
+	}
+	if got := mustSysctl(t, sys, key); got != pristine {
+		t.Errorf("%s = %q after rolling back to the baseline, want %q", key, got, pristine)
+	}
+
+	// The baseline is only captured once
+	restarted, err := NewSnapshotService(snapshots.snapshotsDir, sys, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewSnapshotService failed: %v", err)
+	}
+	restarted.SetRetention(SnapshotRetention{}, svc.historyService)
+	before := len(snapshotIDs(t, restarted))
+	if again, err := restarted.EnsureBaseline(); err != nil || again != id {
+		t.Errorf("EnsureBaseline() after restart = %q, %v, want %q", again, err, id)
+	}
+	if after := len(snapshotIDs(t, restarted)); after != before {
+		t.Errorf("restart took another baseline: %d snapshots, had %d", after, before)
+	}
+}
+
+func TestSnapshotBaselineMissing(t *testing.T) {
+	svc, _ := newFakeApplyService(t)
+
+	// An empty marker leaves the host without a baseline
+	marker := filepath.Join(svc.snapshotService.snapshotsDir, baselineMarkerFile)
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := svc.snapshotService.EnsureBaseline(); err != nil || id != "" {
+		t.Fatalf("EnsureBaseline() = %q, %v, want no baseline", id, err)
+	}
+
+	if _, err := svc.snapshotService.Get(types.SnapshotBaseline); !errors.Is(err, types.ErrSnapshotNotFound) {
+		t.Errorf("Get(baseline) error = %v, want ErrSnapshotNotFound", err)
+	}
+	if err := svc.snapshotService.Delete(types.SnapshotBaseline); !errors.Is(err, types.ErrSnapshotNotFound) {
+		t.Errorf("Delete(baseline) error = %v, want ErrSnapshotNotFound", err)
+	}
+	if err := svc.Rollback(types.SnapshotBaseline); !errors.Is(err, types.ErrSnapshotNotFound) {
+		t.Errorf("Rollback(baseline) error = %v, want ErrSnapshotNotFound", err)
+	}
+}
+
+func TestRollbackToBaselineKeepsForeignSysctls(t *testing.T) {
+	svc, sys := newFakeApplyService(t)
+	const (
+		ours    = "net.ipv4.tcp_congestion_control"
+		foreign = "net.ipv4.tcp_keepalive_time"
+	)
+	pristine := mustSysctl(t, sys, ours)
+
+	if _, err := svc.snapshotService.EnsureBaseline(); err != nil {
+		t.Fatalf("EnsureBaseline failed: %v", err)
+	}
+	result, err := svc.Apply(&types.ApplyRequest{ProfileID: "bbr-fq-default", Mode: "commit"})
+	if err != nil || !result.Success {
+		t.Fatalf("Apply failed: %v %v", err, result)
+	}
+
+	// Another tool changes a key the full baseline records but nettune never set
+	if err := sys.Sysctl.Set(foreign, "600"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Rollback(types.SnapshotBaseline); err != nil {
+		t.Fatalf("Rollback to baseline failed: %v", err)
+	}
+	if got := mustSysctl(t, sys, ours); got != pristine {
+		t.Errorf("%s = %q after rolling back to the baseline, want %q", ours, got, pristine)
+	}
+	if got := mustSysctl(t, sys, foreign); got != "600" {
+		t.Errorf("%s = %q, the rollback should leave it at 600", foreign, got)
+	}
+}
+
+func TestSnapshotBaselineOnUsedHost(t *testing.T) {
+	newServices := func(t *testing.T) (*SnapshotService, *HistoryService) {
+		tmpDir := t.TempDir()
+		svc, err := NewSnapshotService(filepath.Join(tmpDir, "snapshots"), &adapter.SystemAdapter{}, zap.NewNop())
+		if err != nil {
+			t.Fatalf("NewSnapshotService failed: %v", err)
+		}
+		history, err := NewHistoryService(filepath.Join(tmpDir, "history"), zap.NewNop())
+		if err != nil {
+			t.Fatalf("NewHistoryService failed: %v", err)
+		}
+		svc.SetRetention(SnapshotRetention{}, history)
+		return svc, history
+	}
+	now := time.Now().UTC()
+
+	t.Run("oldest snapshot predates every change", func(t *testing.T) {
+		svc, history := newServices(t)
+		writeTestSnapshot(t, svc, "old", now.Add(-2*time.Hour), false)
+		writeTestSnapshot(t, svc, "new", now.Add(-time.Hour), false)
+		history.RecordApply("bbr-fq-default", "old", true, nil)
+
+		if id, err := svc.EnsureBaseline(); err != nil || id != "old" {
+			t.Fatalf("EnsureBaseline() = %q, %v, want old", id, err)
+		}
+		if snapshot, _ := svc.Get("old"); !snapshot.Pinned {
+			t.Error("the adopted baseline should be pinned")
+		}
+	})
+
+	t.Run("interrupted commit", func(t *testing.T) {
+		svc, _ := newServices(t)
+		writeTestSnapshot(t, svc, "commit", now, false)
+		snapshot, _ := svc.Get("commit")
+		snapshot.Provenance = &types.SnapshotProvenance{Reason: types.SnapshotReasonApply}
+		if err := svc.saveSnapshot(snapshot); err != nil {
+			t.Fatal(err)
+		}
+
+		if id, err := svc.EnsureBaseline(); err != nil || id != "commit" {
+			t.Errorf("EnsureBaseline() = %q, %v, want the interrupted commit's snapshot", id, err)
+		}
+	})
+
+	t.Run("changed before the oldest snapshot", func(t *testing.T) {
+		svc, history := newServices(t)
+		history.RecordApply("bbr-fq-default", "pruned", true, nil)
+		writeTestSnapshot(t, svc, "later", now.Add(time.Hour), false)
+
+		if id, err := svc.EnsureBaseline(); err != nil || id != "" {
+			t.Errorf("EnsureBaseline() = %q, %v, want no baseline", id, err)
+		}
+		if _, err := svc.Get(types.SnapshotBaseline); !errors.Is(err, types.ErrSnapshotNotFound) {
+			t.Errorf("Get(baseline) error = %v, want ErrSnapshotNotFound", err)
+		}
+	})
+}
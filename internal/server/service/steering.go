@@ -0,0 +1,199 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/jtsang4/nettune/internal/server/adapter"
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"go.uber.org/zap"
+)
+
+// irqbalanceServiceName is the daemon that rewrites IRQ affinity on its own
+const irqbalanceServiceName = "irqbalance.service"
+
+// steeringTarget is the steering settings to apply to one interface
+type steeringTarget struct {
+	Interface string
+	Settings  *types.SteeringSettings
+}
+
+// steeringTargets resolves the interfaces a steering config selects on this host
+func (s *ApplyService) steeringTargets(cfg *types.SteeringConfig) ([]steeringTarget, error) {
+	candidates, err := s.interfaceCandidates(cfg.Interfaces)
+	if err != nil {
+		return nil, err
+	}
+	return selectSteeringTargets(cfg, candidates)
+}
+
+// selectSteeringTargets picks the interfaces of cfg from the candidates and
+// assigns each its settings; a per-interface entry replaces the shared settings
+func selectSteeringTargets(cfg *types.SteeringConfig, candidates []string) ([]steeringTarget, error) {
+	names, err := selectInterfaces(cfg.Interfaces, cfg.Exclude, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]steeringTarget, 0, len(names))
+	for _, iface := range names {
+		settings := &cfg.SteeringSettings
+		if override, ok := overrideFor(cfg.PerInterface, iface); ok && override != nil {
+			settings = override
+		}
+		if settings.IsEmpty() {
+			continue
+		}
+		targets = append(targets, steeringTarget{Interface: iface, Settings: settings})
+	}
+	return targets, nil
+}
+
+// steeringValues resolves a steering config to host path -> value for every
+// target, checking each CPU mask against the online CPUs
+func (s *ApplyService) steeringValues(cfg *types.SteeringConfig) ([]string, map[string]string, error) {
+	targets, err := s.steeringTargets(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cpus, err := s.adapter.Steering.OnlineCPUs()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := make([]string, 0, len(targets))
+	values := make(map[string]string)
+	for _, target := range targets {
+		names = append(names, target.Interface)
+		layout, err := s.adapter.Steering.Layout(target.Interface)
+		if err != nil {
+			return names, nil, err
+		}
+		resolved, err := adapter.SteeringValues(target.Interface, layout, target.Settings, cpus)
+		if err != nil {
+			return names, nil, fmt.Errorf("%s: %w", target.Interface, err)
+		}
+		for path, value := range resolved {
+			values[path] = value
+		}
+	}
+	return names, values, nil
+}
+
+// planSteeringChanges adds the steering targets and changes of a profile to a plan
+func (s *ApplyService) planSteeringChanges(plan *types.ApplyPlan, cfg *types.SteeringConfig, currentState *types.SystemState) {
+	names, values, err := s.steeringValues(cfg)
+	plan.SteeringTargets = names
+	plan.SteeringChanges = make(map[string]*types.Change)
+	if err != nil {
+		plan.SteeringError = err.Error()
+		return
+	}
+
+	for path, value := range values {
+		from, ok := currentState.Steering[path]
+		if !ok || !adapter.SteeringValueEqual(path, from, value) {
+			plan.SteeringChanges[path] = &types.Change{From: from, To: value}
+		}
+	}
+}
+
+// steeringWarnings returns the warnings for a steering config, such as
+// irqbalance overriding a pinned IRQ affinity
+func (s *ApplyService) steeringWarnings(cfg *types.SteeringConfig) []string {
+	if cfg == nil || !steeringSetsIRQAffinity(cfg) {
+		return nil
+	}
+	if active, _ := s.adapter.Systemd.IsActive(irqbalanceServiceName); active {
+		return []string{fmt.Sprintf("%s is active and may overwrite irq_affinity; consider stopping it or banning these IRQs", irqbalanceServiceName)}
+	}
+	return nil
+}
+
+// steeringSetsIRQAffinity reports whether a steering config pins any IRQ
+func steeringSetsIRQAffinity(cfg *types.SteeringConfig) bool {
+	if cfg.IRQAffinity != "" {
+		return true
+	}
+	for _, settings := range cfg.PerInterface {
+		if settings != nil && settings.IRQAffinity != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// applySteering writes the steering values of every target
+func (s *ApplyService) applySteering(cfg *types.SteeringConfig) error {
+	_, values, err := s.steeringValues(cfg)
+	if err != nil {
+		return err
+	}
+	if err := s.adapter.Steering.Set(values); err != nil {
+		return fmt.Errorf("failed to apply steering: %w", err)
+	}
+	return nil
+}
+
+// verifySteering checks that every steering file holds the requested value
+func (s *ApplyService) verifySteering(cfg *types.SteeringConfig, result *types.VerificationResult) {
+	names, values, err := s.steeringValues(cfg)
+	if err != nil {
+		result.SteeringOK = false
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to resolve steering: %v", err))
+		return
+	}
+
+	live := make(map[string]string)
+	for _, iface := range names {
+		current, err := s.adapter.Steering.Get(iface)
+		if err != nil {
+			result.SteeringOK = false
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to read steering for %s: %v", iface, err))
+			continue
+		}
+		for path, value := range current {
+			live[path] = value
+		}
+	}
+
+	for _, path := range sortedKeys(values) {
+		got, ok := live[path]
+		if !ok || !adapter.SteeringValueEqual(path, got, values[path]) {
+			result.SteeringOK = false
+			result.Errors = append(result.Errors, fmt.Sprintf("steering %s: expected %s, got %s", path, values[path], got))
+		}
+	}
+}
+
+// restoreSteering brings the steering files in paths back to the snapshot
+// state. Files that no longer exist, such as queues of a removed interface, are
+// skipped, and so are files the snapshot did not record.
+func (s *ApplyService) restoreSteering(saved map[string]string, paths []string) error {
+	if len(saved) == 0 || len(paths) == 0 {
+		return nil
+	}
+
+	current, err := s.adapter.Steering.GetAll()
+	if err != nil {
+		return err
+	}
+
+	changed := make(map[string]string)
+	for _, path := range paths {
+		value, ok := saved[path]
+		if !ok {
+			continue
+		}
+		live, ok := current[path]
+		if !ok {
+			s.logger.Warn("steering file no longer exists, skipping restore",
+				zap.String("path", path))
+			continue
+		}
+		if !adapter.SteeringValueEqual(path, live, value) {
+			changed[path] = value
+		}
+	}
+	return s.adapter.Steering.Set(changed)
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jtsang4/nettune/internal/server/adapter"
+	"github.com/jtsang4/nettune/internal/shared/types"
+	"go.uber.org/zap"
+)
+
+// sysctlConflicts checks the drop-in values against every sysctl configuration
+// file that systemd-sysctl applies after it
+func (s *ApplyService) sysctlConflicts(values map[string]string) []*types.SysctlConflict {
+	files := s.adapter.SysctlConfigFiles(adapter.NettuneSysctlFilePath)
+	return findSysctlConflicts(files, s.adapter.Path(adapter.NettuneSysctlFilePath), values, s.logger)
+}
+
+// findSysctlConflicts returns the keys whose last assignment after nettuneFile,
+// in boot order, sets a different value than nettune does
+func findSysctlConflicts(files []string, nettuneFile string, values map[string]string, logger *zap.Logger) []*types.SysctlConflict {
+	if len(values) == 0 {
+		return nil
+	}
+
+	winners := make(map[string]adapter.SysctlAssignment)
+	after := false
+
+	for _, file := range files {
+		if file == nettuneFile {
+			after = true
+			continue
+		}
+		if !after {
+			continue
+		}
+
+		assignments, err := adapter.ParseSysctlConfig(file)
+		if err != nil {
+			logger.Warn("failed to parse sysctl configuration file",
+				zap.String("file", file),
+				zap.Error(err))
+			continue
+		}
+		for _, assignment := range assignments {
+			if _, ok := values[assignment.Key]; ok {
+				winners[assignment.Key] = assignment
+			}
+		}
+	}
+
+	var conflicts []*types.SysctlConflict
+	for key, winner := range winners {
+		if normalizeSysctlValue(winner.Value) == normalizeSysctlValue(values[key]) {
+			continue
+		}
+		conflicts = append(conflicts, &types.SysctlConflict{
+			Key:          key,
+			NettuneValue: values[key],
+			File:         winner.File,
+			Line:         winner.Line,
+			Value:        winner.Value,
+		})
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Key < conflicts[j].Key
+	})
+	return conflicts
+}
+
+// conflictWarning describes a conflict for the warnings of an apply result
+func conflictWarning(c *types.SysctlConflict) string {
+	return fmt.Sprintf("%s will be reset to %s at boot by %s:%d (nettune sets %s)",
+		c.Key, c.Value, c.File, c.Line, c.NettuneValue)
+}
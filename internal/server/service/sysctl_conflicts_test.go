@@ -0,0 +1,42 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestFindSysctlConflicts(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	early := write("10-early.conf", "net.core.rmem_max = 1\n")
+	nettune := write("99-nettune.conf", "")
+	late := write("99-zz-custom.conf", "net.core.rmem_max = 2\nnet.core.default_qdisc = fq\nnet.ipv4.tcp_congestion_control = cubic\n")
+	conf := write("sysctl.conf", "net.ipv4.tcp_congestion_control = bbr\n")
+
+	values := map[string]string{
+		"net.core.rmem_max":               "67108864",
+		"net.core.default_qdisc":          "fq",
+		"net.ipv4.tcp_congestion_control": "bbr",
+	}
+
+	conflicts := findSysctlConflicts([]string{early, nettune, late, conf}, nettune, values, zap.NewNop())
+
+	// default_qdisc agrees with nettune and the late congestion control is undone by sysctl.conf
+	if len(conflicts) != 1 {
+		t.Fatalf("got %d conflicts, want 1: %+v", len(conflicts), conflicts)
+	}
+	c := conflicts[0]
+	if c.Key != "net.core.rmem_max" || c.File != late || c.Line != 1 || c.Value != "2" || c.NettuneValue != "67108864" {
+		t.Errorf("conflict = %+v", c)
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sysctlKind is the value type of a known sysctl key
+type sysctlKind int
+
+const (
+	sysctlInt      sysctlKind = iota // single integer within [min, max]
+	sysctlIntTuple                   // count integers, each within [min, max]
+	sysctlEnum                       // one of enum
+	sysctlName                       // identifier such as a congestion control name
+)
+
+// sysctlSchema describes the values accepted for a sysctl key
+type sysctlSchema struct {
+	kind    sysctlKind
+	min     int64
+	max     int64
+	count   int      // number of tuple elements
+	ordered bool     // tuple elements must not decrease
+	labels  []string // tuple element names used in errors
+	enum    []string
+}
+
+// sysctlNamePattern matches module-provided names like congestion control algorithms
+var sysctlNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Common schemas
+var (
+	sysctlBool       = &sysctlSchema{kind: sysctlInt, min: 0, max: 1}
+	sysctlTriState   = &sysctlSchema{kind: sysctlInt, min: 0, max: 2}
+	sysctlNonNeg     = &sysctlSchema{kind: sysctlInt, min: 0, max: math.MaxInt32}
+	sysctlPositive   = &sysctlSchema{kind: sysctlInt, min: 1, max: math.MaxInt32}
+	sysctlBufferSize = &sysctlSchema{
+		kind: sysctlIntTuple, min: 1, max: math.MaxInt32, count: 3, ordered: true,
+		labels: []string{"min", "default", "max"},
+	}
+	sysctlMemPages = &sysctlSchema{
+		kind: sysctlIntTuple, min: 1, max: math.MaxInt64, count: 3, ordered: true,
+		labels: []string{"low", "pressure", "high"},
+	}
+)
+
+// sysctlSchemas lists the known net.* keys and their accepted values
+var sysctlSchemas = map[string]*sysctlSchema{
+	// net.core
+	"net.core.rmem_max":           sysctlNonNeg,
+	"net.core.wmem_max":           sysctlNonNeg,
+	"net.core.rmem_default":       sysctlNonNeg,
+	"net.core.wmem_default":       sysctlNonNeg,
+	"net.core.optmem_max":         sysctlNonNeg,
+	"net.core.netdev_max_backlog": sysctlPositive,
+	"net.core.netdev_budget":      sysctlPositive,
+	"net.core.somaxconn":          sysctlNonNeg,
+	"net.core.busy_poll":          sysctlNonNeg,
+	"net.core.busy_read":          sysctlNonNeg,
+	"net.core.default_qdisc": {
+		kind: sysctlEnum,
+		enum: []string{"pfifo_fast", "fq", "fq_codel", "fq_pie", "cake", "sfq", "pie", "pfifo", "bfifo"},
+	},
+
+	// net.ipv4 TCP
+	"net.ipv4.tcp_congestion_control":    {kind: sysctlName},
+	"net.ipv4.tcp_rmem":                  sysctlBufferSize,
+	"net.ipv4.tcp_wmem":                  sysctlBufferSize,
+	"net.ipv4.tcp_mem":                   sysctlMemPages,
+	"net.ipv4.tcp_mtu_probing":           sysctlTriState,
+	"net.ipv4.tcp_slow_start_after_idle": sysctlBool,
+	"net.ipv4.tcp_sack":                  sysctlBool,
+	"net.ipv4.tcp_dsack":                 sysctlBool,
+	"net.ipv4.tcp_window_scaling":        sysctlBool,
+	"net.ipv4.tcp_timestamps":            sysctlTriState,
+	"net.ipv4.tcp_moderate_rcvbuf":       sysctlBool,
+	"net.ipv4.tcp_no_metrics_save":       sysctlBool,
+	"net.ipv4.tcp_autocorking":           sysctlBool,
+	"net.ipv4.tcp_rfc1337":               sysctlBool,
+	"net.ipv4.tcp_ecn":                   sysctlTriState,
+	"net.ipv4.tcp_ecn_fallback":          sysctlBool,
+	"net.ipv4.tcp_frto":                  sysctlTriState,
+	"net.ipv4.tcp_tw_reuse":              sysctlTriState,
+	"net.ipv4.tcp_syncookies":            sysctlTriState,
+	"net.ipv4.tcp_fastopen":              {kind: sysctlInt, min: 0, max: 0x7ff},
+	"net.ipv4.tcp_notsent_lowat":         {kind: sysctlInt, min: 0, max: math.MaxUint32},
+	"net.ipv4.tcp_adv_win_scale":         {kind: sysctlInt, min: -31, max: 31},
+	"net.ipv4.tcp_fin_timeout":           sysctlNonNeg,
+	"net.ipv4.tcp_keepalive_time":        sysctlPositive,
+	"net.ipv4.tcp_keepalive_intvl":       sysctlPositive,
+	"net.ipv4.tcp_keepalive_probes":      {kind: sysctlInt, min: 1, max: 127},
+	"net.ipv4.tcp_max_syn_backlog":       sysctlPositive,
+	"net.ipv4.tcp_max_tw_buckets":        sysctlNonNeg,
+	"net.ipv4.tcp_base_mss":              sysctlPositive,
+	"net.ipv4.tcp_limit_output_bytes":    sysctlNonNeg,
+
+	// net.ipv4 other
+	"net.ipv4.udp_mem":    sysctlMemPages,
+	"net.ipv4.ip_forward": sysctlBool,
+	"net.ipv4.ip_local_port_range": {
+		kind: sysctlIntTuple, min: 1, max: 65535, count: 2, ordered: true,
+		labels: []string{"low", "high"},
+	},
+}
+
+// validateSysctlValue checks a value against the schema of a known key.
+// Keys without a schema are accepted as is.
+func validateSysctlValue(key string, value interface{}) error {
+	schema, ok := sysctlSchemas[key]
+	if !ok {
+		return nil
+	}
+
+	switch value.(type) {
+	case string, float64, int, int32, int64, uint, uint32, uint64:
+	default:
+		return fmt.Errorf("sysctl %s: unsupported value type %T", key, value)
+	}
+	str := strings.TrimSpace(formatSysctlValue(value))
+
+	switch schema.kind {
+	case sysctlInt:
+		n, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return fmt.Errorf("sysctl %s: %q is not an integer", key, str)
+		}
+		if n < schema.min || n > schema.max {
+			return fmt.Errorf("sysctl %s: %d is out of range [%d, %d]", key, n, schema.min, schema.max)
+		}
+
+	case sysctlIntTuple:
+		fields := strings.Fields(str)
+		if len(fields) != schema.count {
+			return fmt.Errorf("sysctl %s: expected %d integers (%s), got %q",
+				key, schema.count, strings.Join(schema.labels, " "), str)
+		}
+		values := make([]int64, len(fields))
+		for i, field := range fields {
+			n, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return fmt.Errorf("sysctl %s: %s value %q is not an integer", key, schema.labels[i], field)
+			}
+			if n < schema.min || n > schema.max {
+				return fmt.Errorf("sysctl %s: %s value %d is out of range [%d, %d]", key, schema.labels[i], n, schema.min, schema.max)
+			}
+			values[i] = n
+		}
+		if schema.ordered {
+			for i := 1; i < len(values); i++ {
+				if values[i] < values[i-1] {
+					return fmt.Errorf("sysctl %s: values must satisfy %s, got %q",
+						key, strings.Join(schema.labels, " <= "), str)
+				}
+			}
+		}
+
+	case sysctlEnum:
+		for _, allowed := range schema.enum {
+			if str == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("sysctl %s: %q is not one of %s", key, str, strings.Join(schema.enum, ", "))
+
+	case sysctlName:
+		if !sysctlNamePattern.MatchString(str) {
+			return fmt.Errorf("sysctl %s: %q is not a valid name", key, str)
+		}
+	}
+
+	return nil
+}
@@ -4,6 +4,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // ServerConfig represents server mode configuration
@@ -15,6 +16,13 @@ type ServerConfig struct {
 	WriteTimeout    int    `mapstructure:"write-timeout"`
 	MaxBodyBytes    int64  `mapstructure:"max-body-bytes"`
 	AllowUnsafeHTTP bool   `mapstructure:"allow-unsafe-http"`
+	AutoRecover     bool   `mapstructure:"auto-recover"`
+	Simulate        bool   `mapstructure:"simulate"`
+
+	// Snapshot retention, enforced after every snapshot; zero disables a limit
+	SnapshotMaxCount    int           `mapstructure:"snapshot-max-count"`
+	SnapshotMaxAge      time.Duration `mapstructure:"snapshot-max-age"`
+	SnapshotKeepApplies int           `mapstructure:"snapshot-keep-applies"`
 }
 
 // ClientConfig represents client mode configuration
@@ -34,6 +42,10 @@ func DefaultServerConfig() *ServerConfig {
 		WriteTimeout:    60,
 		MaxBodyBytes:    100 * 1024 * 1024, // 100MB
 		AllowUnsafeHTTP: true,
+		AutoRecover:     true,
+
+		SnapshotMaxCount:    0,
+		SnapshotKeepApplies: 5,
 	}
 }
 
@@ -72,6 +84,11 @@ func (c *ServerConfig) GetSnapshotsDir() string {
 	return filepath.Join(c.StateDir, "snapshots")
 }
 
+// GetSimulateRootDir returns the root of the emulated host used in simulate mode
+func (c *ServerConfig) GetSimulateRootDir() string {
+	return filepath.Join(c.StateDir, "root")
+}
+
 // GetHistoryDir returns the history directory path
 func (c *ServerConfig) GetHistoryDir() string {
 	return filepath.Join(c.StateDir, "history")
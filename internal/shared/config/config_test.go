@@ -24,6 +24,11 @@ func TestDefaultServerConfig(t *testing.T) {
 	if cfg.MaxBodyBytes != 100*1024*1024 {
 		t.Errorf("MaxBodyBytes = %d, want %d", cfg.MaxBodyBytes, 100*1024*1024)
 	}
+
+	if cfg.SnapshotMaxCount != 0 || cfg.SnapshotMaxAge != 0 || cfg.SnapshotKeepApplies != 5 {
+		t.Errorf("snapshot retention = %d/%s/%d, want 0/0s/5",
+			cfg.SnapshotMaxCount, cfg.SnapshotMaxAge, cfg.SnapshotKeepApplies)
+	}
 }
 
 func TestDefaultClientConfig(t *testing.T) {
@@ -7,27 +7,89 @@ type ApplyRequest struct {
 	ProfileID           string `json:"profile_id" validate:"required"`
 	Mode                string `json:"mode" validate:"required,oneof=dry_run commit"`
 	AutoRollbackSeconds int    `json:"auto_rollback_seconds,omitempty"`
+	// Async returns a job immediately instead of waiting for the apply to finish
+	Async bool `json:"async,omitempty"`
+	// SnapshotLabel and SnapshotNote annotate the snapshot a commit takes
+	SnapshotLabel string `json:"snapshot_label,omitempty"`
+	SnapshotNote  string `json:"snapshot_note,omitempty"`
+	// ClientIP identifies the caller in the snapshot provenance, set by the server
+	ClientIP string `json:"-"`
+	// Origin is the local address the API request arrived on, set by the server.
+	// A commit that changes the MTU of its interface requires auto-rollback.
+	Origin string `json:"-"`
 }
 
 // ApplyResult represents the result of an apply operation
 type ApplyResult struct {
 	Mode         string              `json:"mode"`
 	ProfileID    string              `json:"profile_id"`
+	JobID        string              `json:"job_id,omitempty"`
 	SnapshotID   string              `json:"snapshot_id,omitempty"`
 	Plan         *ApplyPlan          `json:"plan"`
 	Success      bool                `json:"success"`
 	AppliedAt    time.Time           `json:"applied_at,omitempty"`
 	Verification *VerificationResult `json:"verification,omitempty"`
+	Pending      *PendingRollback    `json:"pending_rollback,omitempty"`
+	Warnings     []string            `json:"warnings,omitempty"`
 	Errors       []string            `json:"errors,omitempty"`
 }
 
 // ApplyPlan represents the planned changes
 type ApplyPlan struct {
-	SysctlChanges  map[string]*Change `json:"sysctl_changes"`
-	QdiscChanges   map[string]*Change `json:"qdisc_changes"`
-	SystemdChanges map[string]*Change `json:"systemd_changes"`
+	SysctlChanges      map[string]*Change          `json:"sysctl_changes"`      // runtime values
+	PersistenceChanges map[string]*Change          `json:"persistence_changes"` // lines in the nettune sysctl drop-in
+	QdiscChanges       map[string]*Change          `json:"qdisc_changes"`
+	QdiscTargets       []string                    `json:"qdisc_targets,omitempty"`    // interfaces the qdisc selector resolves to
+	QdiscError         string                      `json:"qdisc_error,omitempty"`      // why the selector could not be resolved
+	DefaultRoutes      *DefaultRoutes              `json:"default_routes,omitempty"`   // per-family default route interfaces for default-route mode
+	LinkChanges        map[string]*Change          `json:"link_changes,omitempty"`     // "iface/section/name" -> value change
+	LinkTargets        []string                    `json:"link_targets,omitempty"`     // interfaces the link selector resolves to
+	LinkError          string                      `json:"link_error,omitempty"`       // why the link selector could not be resolved
+	LinkPreflight      map[string]*SysctlPreflight `json:"link_preflight,omitempty"`   // "iface/section/name" -> support on the NIC
+	SteeringChanges    map[string]*Change          `json:"steering_changes,omitempty"` // sysfs or procfs path -> value change
+	SteeringTargets    []string                    `json:"steering_targets,omitempty"` // interfaces the steering selector resolves to
+	SteeringError      string                      `json:"steering_error,omitempty"`   // why the selector or a CPU mask could not be resolved
+	RouteChanges       map[string]*Change          `json:"route_changes,omitempty"`    // "family spec/attribute" -> value change
+	RouteTargets       []string                    `json:"route_targets,omitempty"`    // "family spec" of the routes the profile changes
+	RoutePreflight     map[string]*SysctlPreflight `json:"route_preflight,omitempty"`  // "family destination" -> whether the route exists
+	SystemdChanges     map[string]*Change          `json:"systemd_changes"`
+	SysctlConflicts    []*SysctlConflict           `json:"sysctl_conflicts,omitempty"`
+	Preflight          map[string]*SysctlPreflight `json:"preflight,omitempty"` // sysctl key -> probe result
+	ModuleChanges      map[string]*Change          `json:"module_changes,omitempty"`
+	ModulePreflight    map[string]*SysctlPreflight `json:"module_preflight,omitempty"` // module -> modprobe lookup
 }
 
+// Preflight statuses for sysctl keys and kernel modules
+const (
+	PreflightOK         = "ok"
+	PreflightMissing    = "missing"
+	PreflightReadOnly   = "read_only"
+	PreflightNamespaced = "namespaced"
+)
+
+// SysctlPreflight is the result of probing a sysctl key before commit
+type SysctlPreflight struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// SysctlConflict is a nettune-managed key that a configuration file applied
+// after the nettune drop-in overrides at boot
+type SysctlConflict struct {
+	Key          string `json:"key"`
+	NettuneValue string `json:"nettune_value"`
+	File         string `json:"file"`
+	Line         int    `json:"line"`
+	Value        string `json:"value"`
+}
+
+// Kernel module states used in module changes
+const (
+	ModuleNotLoaded = "not_loaded"
+	ModuleLoaded    = "loaded"
+	ModulePersisted = "loaded_persisted" // loaded and listed in modules-load.d
+)
+
 // Change represents a single configuration change
 type Change struct {
 	From interface{} `json:"from"`
@@ -36,16 +98,25 @@ type Change struct {
 
 // VerificationResult represents the verification after apply
 type VerificationResult struct {
-	SysctlOK  bool     `json:"sysctl_ok"`
-	QdiscOK   bool     `json:"qdisc_ok"`
-	SystemdOK bool     `json:"systemd_ok"`
-	Errors    []string `json:"errors,omitempty"`
+	SysctlOK   bool     `json:"sysctl_ok"`
+	QdiscOK    bool     `json:"qdisc_ok"`
+	LinkOK     bool     `json:"link_ok"`
+	SteeringOK bool     `json:"steering_ok"`
+	RouteOK    bool     `json:"route_ok"`
+	SystemdOK  bool     `json:"systemd_ok"`
+	Errors     []string `json:"errors,omitempty"`
 }
 
 // RollbackRequest represents a rollback request
 type RollbackRequest struct {
 	SnapshotID   string `json:"snapshot_id,omitempty"`
 	RollbackLast bool   `json:"rollback_last,omitempty"`
+	// RollbackBaseline rolls back to the baseline captured the first time the server ran
+	RollbackBaseline bool `json:"rollback_baseline,omitempty"`
+	// InterfaceMap renames the interfaces of the snapshot to interfaces of this
+	// host; an empty name skips the interface. Rolling back to an imported
+	// snapshot requires every interface it names to be mapped, skipped or present.
+	InterfaceMap map[string]string `json:"interface_map,omitempty"`
 }
 
 // RollbackResult represents the result of a rollback operation
@@ -56,12 +127,68 @@ type RollbackResult struct {
 	Errors       []string     `json:"errors,omitempty"`
 }
 
+// PendingRollback represents a committed apply that reverts automatically
+// unless it is confirmed before the deadline
+type PendingRollback struct {
+	ProfileID  string    `json:"profile_id"`
+	SnapshotID string    `json:"snapshot_id"`
+	AppliedAt  time.Time `json:"applied_at"`
+	Deadline   time.Time `json:"deadline"`
+}
+
+// AutoRollbackInfo describes the last auto-rollback of an unconfirmed apply
+type AutoRollbackInfo struct {
+	ProfileID    string    `json:"profile_id"`
+	SnapshotID   string    `json:"snapshot_id"`
+	RolledBackAt time.Time `json:"rolled_back_at"`
+	Error        string    `json:"error,omitempty"` // why the rollback failed, if it did
+}
+
+// ConfirmRequest represents a request to confirm a pending apply
+type ConfirmRequest struct {
+	SnapshotID string `json:"snapshot_id,omitempty"`
+}
+
+// ConfirmResult represents the result of a confirm operation
+type ConfirmResult struct {
+	ProfileID   string    `json:"profile_id"`
+	SnapshotID  string    `json:"snapshot_id"`
+	ConfirmedAt time.Time `json:"confirmed_at"`
+}
+
 // SystemStatus represents the current system status
 type SystemStatus struct {
-	LastApply        *LastApplyInfo `json:"last_apply,omitempty"`
-	CurrentState     *SystemState   `json:"current_state"`
-	SnapshotsCount   int            `json:"snapshots_count"`
-	LatestSnapshotID string         `json:"latest_snapshot_id,omitempty"`
+	LastApply          *LastApplyInfo    `json:"last_apply,omitempty"`
+	PendingRollback    *PendingRollback  `json:"pending_rollback,omitempty"`
+	LastAutoRollback   *AutoRollbackInfo `json:"last_auto_rollback,omitempty"`
+	Recovery           *RecoveryInfo     `json:"recovery,omitempty"`
+	SysctlConflicts    []*SysctlConflict `json:"sysctl_conflicts,omitempty"`
+	CurrentState       *SystemState      `json:"current_state"`
+	SnapshotsCount     int               `json:"snapshots_count"`
+	LatestSnapshotID   string            `json:"latest_snapshot_id,omitempty"`
+	BaselineSnapshotID string            `json:"baseline_snapshot_id,omitempty"`
+}
+
+// ApplyJournal is the write-ahead record of a commit in progress
+type ApplyJournal struct {
+	ProfileID      string    `json:"profile_id"`
+	SnapshotID     string    `json:"snapshot_id"`
+	StartedAt      time.Time `json:"started_at"`
+	CompletedSteps []string  `json:"completed_steps"`
+	CurrentStep    string    `json:"current_step,omitempty"`
+}
+
+// RecoveryInfo describes an interrupted apply found at server startup
+type RecoveryInfo struct {
+	ProfileID       string     `json:"profile_id"`
+	SnapshotID      string     `json:"snapshot_id"`
+	StartedAt       time.Time  `json:"started_at"`
+	CompletedSteps  []string   `json:"completed_steps"`
+	InterruptedStep string     `json:"interrupted_step,omitempty"`
+	DetectedAt      time.Time  `json:"detected_at"`
+	RolledBack      bool       `json:"rolled_back"`
+	RolledBackAt    *time.Time `json:"rolled_back_at,omitempty"`
+	Error           string     `json:"error,omitempty"`
 }
 
 // LastApplyInfo represents information about the last apply operation
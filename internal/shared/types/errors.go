@@ -10,12 +10,17 @@ import (
 var (
 	ErrProfileNotFound   = errors.New("profile not found")
 	ErrSnapshotNotFound  = errors.New("snapshot not found")
+	ErrSnapshotProtected = errors.New("snapshot is protected")
 	ErrApplyInProgress   = errors.New("another apply operation is in progress")
 	ErrRollbackFailed    = errors.New("rollback failed")
 	ErrValidationFailed  = errors.New("validation failed")
 	ErrUnauthorized      = errors.New("unauthorized")
 	ErrInvalidRequest    = errors.New("invalid request")
 	ErrSystemUnavailable = errors.New("system operation unavailable")
+	ErrNoPendingRollback = errors.New("no apply is awaiting confirmation")
+	ErrConfirmPending    = errors.New("a previous apply is awaiting confirmation")
+	ErrRecoveryPending   = errors.New("an interrupted apply has not been rolled back")
+	ErrJobNotFound       = errors.New("job not found")
 )
 
 // APIError represents an API error response
@@ -53,6 +58,7 @@ func NewAPIErrorWithDetails(code, message, details string) *APIError {
 const (
 	ErrCodeProfileNotFound   = "PROFILE_NOT_FOUND"
 	ErrCodeSnapshotNotFound  = "SNAPSHOT_NOT_FOUND"
+	ErrCodeSnapshotProtected = "SNAPSHOT_PROTECTED"
 	ErrCodeApplyInProgress   = "APPLY_IN_PROGRESS"
 	ErrCodeRollbackFailed    = "ROLLBACK_FAILED"
 	ErrCodeValidationFailed  = "VALIDATION_FAILED"
@@ -60,4 +66,8 @@ const (
 	ErrCodeInvalidRequest    = "INVALID_REQUEST"
 	ErrCodeInternalError     = "INTERNAL_ERROR"
 	ErrCodeSystemUnavailable = "SYSTEM_UNAVAILABLE"
+	ErrCodeNoPendingRollback = "NO_PENDING_ROLLBACK"
+	ErrCodeConfirmPending    = "CONFIRM_PENDING"
+	ErrCodeRecoveryPending   = "RECOVERY_PENDING"
+	ErrCodeJobNotFound       = "JOB_NOT_FOUND"
 )
@@ -50,6 +50,7 @@ func TestPredefinedErrors(t *testing.T) {
 	}{
 		{"ErrProfileNotFound", ErrProfileNotFound},
 		{"ErrSnapshotNotFound", ErrSnapshotNotFound},
+		{"ErrSnapshotProtected", ErrSnapshotProtected},
 		{"ErrApplyInProgress", ErrApplyInProgress},
 		{"ErrValidationFailed", ErrValidationFailed},
 	}
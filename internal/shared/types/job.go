@@ -0,0 +1,45 @@
+package types
+
+import "time"
+
+// Job statuses
+const (
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+// Job step statuses
+const (
+	JobStepPending = "pending"
+	JobStepRunning = "running"
+	JobStepDone    = "done"
+	JobStepSkipped = "skipped"
+	JobStepFailed  = "failed"
+)
+
+// Job represents an apply running in the background
+type Job struct {
+	ID         string       `json:"id"`
+	ProfileID  string       `json:"profile_id"`
+	Mode       string       `json:"mode"`
+	Status     string       `json:"status"`
+	Steps      []*JobStep   `json:"steps"`
+	CreatedAt  time.Time    `json:"created_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+	Result     *ApplyResult `json:"result,omitempty"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// JobStep represents the progress of one stage of a job
+type JobStep struct {
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Done reports whether the job has finished
+func (j *Job) Done() bool {
+	return j.Status == JobStatusSucceeded || j.Status == JobStatusFailed
+}
@@ -63,6 +63,7 @@ type ServerInfo struct {
 	CongestionControl string            `json:"congestion_control"`
 	DefaultQdisc      string            `json:"default_qdisc"`
 	DefaultInterface  string            `json:"default_interface"`
+	DefaultRoutes     *DefaultRoutes    `json:"default_routes,omitempty"`
 	InterfaceMTU      int               `json:"interface_mtu"`
 	InterfaceSpeed    string            `json:"interface_speed,omitempty"`
 	InterfaceStats    *InterfaceStats   `json:"interface_stats,omitempty"`
@@ -70,6 +71,33 @@ type ServerInfo struct {
 	Dependencies      map[string]string `json:"dependencies"` // dependency name -> status
 }
 
+// DefaultRoutes holds the default route interface of each address family.
+// An empty field means the family has no default route.
+type DefaultRoutes struct {
+	IPv4 string `json:"ipv4,omitempty"`
+	IPv6 string `json:"ipv6,omitempty"`
+}
+
+// Primary returns the IPv4 default route interface, or the IPv6 one on IPv6-only hosts
+func (r *DefaultRoutes) Primary() string {
+	if r.IPv4 != "" {
+		return r.IPv4
+	}
+	return r.IPv6
+}
+
+// Interfaces returns the distinct default route interfaces, IPv4 first
+func (r *DefaultRoutes) Interfaces() []string {
+	var ifaces []string
+	if r.IPv4 != "" {
+		ifaces = append(ifaces, r.IPv4)
+	}
+	if r.IPv6 != "" && r.IPv6 != r.IPv4 {
+		ifaces = append(ifaces, r.IPv6)
+	}
+	return ifaces
+}
+
 // InterfaceStats represents network interface statistics
 type InterfaceStats struct {
 	RxPackets int64 `json:"rx_packets"`
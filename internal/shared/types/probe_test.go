@@ -0,0 +1,27 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDefaultRoutes(t *testing.T) {
+	tests := []struct {
+		routes     DefaultRoutes
+		primary    string
+		interfaces []string
+	}{
+		{DefaultRoutes{IPv4: "eth0", IPv6: "eth0"}, "eth0", []string{"eth0"}},
+		{DefaultRoutes{IPv4: "eth0", IPv6: "he-ipv6"}, "eth0", []string{"eth0", "he-ipv6"}},
+		{DefaultRoutes{IPv6: "eth0"}, "eth0", []string{"eth0"}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.routes.Primary(); got != tt.primary {
+			t.Errorf("%+v Primary() = %q, want %q", tt.routes, got, tt.primary)
+		}
+		if got := tt.routes.Interfaces(); !reflect.DeepEqual(got, tt.interfaces) {
+			t.Errorf("%+v Interfaces() = %v, want %v", tt.routes, got, tt.interfaces)
+		}
+	}
+}
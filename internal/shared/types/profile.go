@@ -9,14 +9,95 @@ type Profile struct {
 	RequiresReboot bool                   `json:"requires_reboot"`
 	Sysctl         map[string]interface{} `json:"sysctl,omitempty"`
 	Qdisc          *QdiscConfig           `json:"qdisc,omitempty"`
+	Link           *LinkConfig            `json:"link,omitempty"`
+	Steering       *SteeringConfig        `json:"steering,omitempty"`
+	Routes         *RouteConfig           `json:"routes,omitempty"`
 	Systemd        *SystemdConfig         `json:"systemd,omitempty"`
+	KernelModules  []string               `json:"kernel_modules,omitempty"` // loaded before sysctl, persisted in modules-load.d
 }
 
 // QdiscConfig represents qdisc configuration
 type QdiscConfig struct {
-	Type       string                 `json:"type" validate:"oneof=fq fq_codel cake pfifo_fast"`
-	Interfaces string                 `json:"interfaces" validate:"oneof=default-route all"`
-	Params     map[string]interface{} `json:"params,omitempty"`
+	Type string `json:"type" validate:"oneof=fq fq_codel cake pfifo_fast"`
+	// Interfaces is "default-route", "all", or a comma-separated list of
+	// interface names and glob patterns such as "eth0,ens1f*"
+	Interfaces   string                    `json:"interfaces"`
+	Exclude      []string                  `json:"exclude,omitempty"` // glob patterns removed from the selection
+	Params       map[string]interface{}    `json:"params,omitempty"`
+	PerInterface map[string]*QdiscOverride `json:"per_interface,omitempty"` // interface name or glob -> qdisc override
+}
+
+// QdiscOverride replaces the qdisc type and params for matching interfaces
+type QdiscOverride struct {
+	Type   string                 `json:"type"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+// LinkConfig represents per-interface NIC settings applied with ethtool
+type LinkConfig struct {
+	// Interfaces selects interfaces with the same syntax as QdiscConfig.Interfaces
+	Interfaces   string                   `json:"interfaces"`
+	Exclude      []string                 `json:"exclude,omitempty"` // glob patterns removed from the selection
+	LinkSettings                          // settings for every selected interface
+	PerInterface map[string]*LinkSettings `json:"per_interface,omitempty"` // interface name or glob -> settings that replace the shared ones
+}
+
+// LinkSettings are the MTU, transmit queue length, offload, ring buffer and
+// interrupt coalescing settings of an interface
+type LinkSettings struct {
+	MTU        *int                   `json:"mtu,omitempty"`
+	TxQueueLen *int                   `json:"txqueuelen,omitempty"` // packets the device queue holds in front of the qdisc
+	Offloads   map[string]bool        `json:"offloads,omitempty"`   // feature -> enabled, e.g. "gro", "tso" or "rx-gro-hw"
+	Rings      map[string]int         `json:"rings,omitempty"`      // "rx", "tx", "rx-mini" or "rx-jumbo" -> ring size
+	Coalesce   map[string]interface{} `json:"coalesce,omitempty"`   // "rx-usecs", "tx-frames", ... -> count; "adaptive-rx" and "adaptive-tx" -> bool
+}
+
+// IsEmpty reports whether the settings change nothing
+func (s *LinkSettings) IsEmpty() bool {
+	return s == nil || s.MTU == nil && s.TxQueueLen == nil &&
+		len(s.Offloads) == 0 && len(s.Rings) == 0 && len(s.Coalesce) == 0
+}
+
+// SteeringConfig represents per-interface RPS, XPS and IRQ affinity settings
+type SteeringConfig struct {
+	// Interfaces selects interfaces with the same syntax as QdiscConfig.Interfaces
+	Interfaces       string                       `json:"interfaces"`
+	Exclude          []string                     `json:"exclude,omitempty"` // glob patterns removed from the selection
+	SteeringSettings                              // settings for every selected interface
+	PerInterface     map[string]*SteeringSettings `json:"per_interface,omitempty"` // interface name or glob -> settings that replace the shared ones
+}
+
+// SteeringSettings are the queue steering and IRQ affinity settings of an interface.
+// CPU masks are hex as sysfs prints them ("f", "ff,ffffffff"); "all" selects every online CPU.
+type SteeringSettings struct {
+	RPSCPUs     string `json:"rps_cpus,omitempty"`     // mask for every rx queue; "0" disables RPS
+	RPSFlowCnt  *int   `json:"rps_flow_cnt,omitempty"` // RFS flow table size of every rx queue, a power of two
+	XPSCPUs     string `json:"xps_cpus,omitempty"`     // mask for every tx queue, or "spread" for one CPU per queue
+	IRQAffinity string `json:"irq_affinity,omitempty"` // mask for every IRQ of the device, or "spread" for one CPU per IRQ
+}
+
+// IsEmpty reports whether the settings change nothing
+func (s *SteeringSettings) IsEmpty() bool {
+	return s == nil || s.RPSCPUs == "" && s.RPSFlowCnt == nil && s.XPSCPUs == "" && s.IRQAffinity == ""
+}
+
+// RouteConfig represents TCP attributes of routes in the main routing table
+type RouteConfig struct {
+	Default  *RouteAttrs            `json:"default,omitempty"`  // applied to the IPv4 and IPv6 default routes
+	Prefixes map[string]*RouteAttrs `json:"prefixes,omitempty"` // destination prefix such as "10.0.0.0/8" -> attributes
+}
+
+// RouteAttrs are the TCP attributes of a route. Attributes left unset keep
+// their current value.
+type RouteAttrs struct {
+	InitCwnd *int   `json:"initcwnd,omitempty"` // initial congestion window, in segments
+	InitRwnd *int   `json:"initrwnd,omitempty"` // initial receive window advertised, in segments
+	CongCtl  string `json:"congctl,omitempty"`  // congestion control for connections over the route
+}
+
+// IsEmpty reports whether the attributes change nothing
+func (a *RouteAttrs) IsEmpty() bool {
+	return a == nil || a.InitCwnd == nil && a.InitRwnd == nil && a.CongCtl == ""
 }
 
 // SystemdConfig represents systemd configuration
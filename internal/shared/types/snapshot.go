@@ -1,22 +1,113 @@
 package types
 
-import "time"
+import (
+	"slices"
+	"strings"
+	"time"
+)
 
 // Snapshot represents a system state snapshot for rollback
 type Snapshot struct {
-	ID        string                 `json:"id"`
-	CreatedAt time.Time              `json:"created_at"`
-	State     *SystemState           `json:"state"`
-	Backups   map[string]string      `json:"backups"` // file path -> backup content
-	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	ID         string                 `json:"id"`
+	CreatedAt  time.Time              `json:"created_at"`
+	State      *SystemState           `json:"state"`
+	Backups    map[string]string      `json:"backups"`              // file path -> backup content
+	Tombstones []string               `json:"tombstones,omitempty"` // managed files that did not exist
+	Pinned     bool                   `json:"pinned,omitempty"`     // exempt from retention and deletion
+	Label      string                 `json:"label,omitempty"`
+	Note       string                 `json:"note,omitempty"`
+	Provenance *SnapshotProvenance    `json:"provenance,omitempty"`
+	Scope      *ChangeScope           `json:"scope,omitempty"` // what the apply that took the snapshot was about to change
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// ChangeScope lists the sysctl keys, link settings, steering files and routes
+// an apply or rollback changed. A rollback restores only what the applies and
+// rollbacks since its snapshot changed, so settings nettune never touched are
+// left as they are.
+type ChangeScope struct {
+	Sysctl   []string `json:"sysctl,omitempty"`   // sysctl keys
+	Link     []string `json:"link,omitempty"`     // "iface/name" as in ApplyPlan.LinkChanges
+	Steering []string `json:"steering,omitempty"` // sysfs or procfs paths
+	Routes   []string `json:"routes,omitempty"`   // "family spec" as in ApplyPlan.RouteTargets
+}
+
+// Merge adds the entries of other that the scope does not list yet
+func (s *ChangeScope) Merge(other *ChangeScope) {
+	if other == nil {
+		return
+	}
+	s.Sysctl = mergeUnique(s.Sysctl, other.Sysctl)
+	s.Link = mergeUnique(s.Link, other.Link)
+	s.Steering = mergeUnique(s.Steering, other.Steering)
+	s.Routes = mergeUnique(s.Routes, other.Routes)
+}
+
+// mergeUnique appends the items of more missing from list
+func mergeUnique(list, more []string) []string {
+	for _, item := range more {
+		if !slices.Contains(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Reasons a snapshot was taken
+const (
+	SnapshotReasonManual   = "manual"   // POST /sys/snapshot
+	SnapshotReasonApply    = "apply"    // before a commit
+	SnapshotReasonBaseline = "baseline" // the first time the server runs on a host
+	SnapshotReasonImport   = "import"   // POST /sys/snapshot/import
+)
+
+// SnapshotBaseline addresses the baseline snapshot wherever a snapshot ID is accepted
+const SnapshotBaseline = "baseline"
+
+// SnapshotProvenance records why a snapshot was taken and who asked for it
+type SnapshotProvenance struct {
+	Reason    string `json:"reason"`
+	ProfileID string `json:"profile_id,omitempty"` // profile the commit was about to apply
+	ClientIP  string `json:"client_ip,omitempty"`
+	// ImportedFrom and SourceHost identify the exported snapshot an import came from
+	ImportedFrom string `json:"imported_from,omitempty"`
+	SourceHost   string `json:"source_host,omitempty"`
+}
+
+// Imported reports whether a snapshot was imported from an archive, possibly of another host
+func (s *Snapshot) Imported() bool {
+	return s.Provenance != nil && s.Provenance.Reason == SnapshotReasonImport
+}
+
+// HasTombstone reports whether path was absent when the snapshot was taken
+func (s *Snapshot) HasTombstone(path string) bool {
+	for _, tombstone := range s.Tombstones {
+		if tombstone == path {
+			return true
+		}
+	}
+	return false
+}
+
+// SnapshotRequest represents a request to create a snapshot
+type SnapshotRequest struct {
+	// Full captures every writable sysctl under /proc/sys/net instead of the tracked keys
+	Full bool `json:"full,omitempty"`
+	// Pin exempts the snapshot from retention until it is unpinned
+	Pin   bool   `json:"pin,omitempty"`
+	Label string `json:"label,omitempty"`
+	Note  string `json:"note,omitempty"`
 }
 
 // SystemState represents the current system configuration state
 type SystemState struct {
-	Sysctl       map[string]string     `json:"sysctl"`
-	Qdisc        map[string]*QdiscInfo `json:"qdisc"`         // interface name -> qdisc info
-	SystemdUnits map[string]bool       `json:"systemd_units"` // unit name -> is active
-	FileHashes   map[string]string     `json:"file_hashes"`
+	Sysctl       map[string]string        `json:"sysctl"`
+	Qdisc        map[string]*QdiscInfo    `json:"qdisc"`              // interface name -> qdisc info
+	Link         map[string]*LinkSettings `json:"link,omitempty"`     // interface name -> MTU, queue length, offloads, rings and coalescing
+	Steering     map[string]string        `json:"steering,omitempty"` // rps_cpus, rps_flow_cnt, xps_cpus and smp_affinity path -> value
+	Routes       map[string]*RouteAttrs   `json:"routes,omitempty"`   // "family spec" of default routes and routes with TCP attributes -> attributes
+	SystemdUnits map[string]bool          `json:"systemd_units"`      // unit name -> is active
+	FileHashes   map[string]string        `json:"file_hashes"`
 }
 
 // QdiscInfo represents qdisc information for an interface
@@ -31,12 +122,101 @@ type SnapshotMeta struct {
 	ID        string    `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	Size      int64     `json:"size"` // snapshot size in bytes
+	Pinned    bool      `json:"pinned,omitempty"`
+	Baseline  bool      `json:"baseline,omitempty"` // the state of the host before nettune changed it
+	HeldBy    string    `json:"held_by,omitempty"`  // operation that keeps the snapshot from being deleted, e.g. a pending auto-rollback
+	Label     string    `json:"label,omitempty"`
+	Note      string    `json:"note,omitempty"`
+
+	Provenance *SnapshotProvenance `json:"provenance,omitempty"`
 }
 
 // ToMeta converts a Snapshot to SnapshotMeta
 func (s *Snapshot) ToMeta() *SnapshotMeta {
 	return &SnapshotMeta{
-		ID:        s.ID,
-		CreatedAt: s.CreatedAt,
+		ID:         s.ID,
+		CreatedAt:  s.CreatedAt,
+		Pinned:     s.Pinned,
+		Label:      s.Label,
+		Note:       s.Note,
+		Provenance: s.Provenance,
+	}
+}
+
+// SnapshotFilter narrows a snapshot listing; empty fields match every snapshot
+type SnapshotFilter struct {
+	Label     string // label, ignoring case
+	ProfileID string // profile of the commit that took the snapshot
+	Reason    string // "manual", "apply", ...
+	ClientIP  string
+	Query     string // text contained in the label or note, ignoring case
+	Pinned    bool   // only pinned snapshots
+}
+
+// Matches reports whether a snapshot passes the filter
+func (f *SnapshotFilter) Matches(meta *SnapshotMeta) bool {
+	if f == nil {
+		return true
+	}
+	if f.Label != "" && !strings.EqualFold(f.Label, meta.Label) {
+		return false
+	}
+	if f.Pinned && !meta.Pinned {
+		return false
 	}
+	if f.Query != "" {
+		query := strings.ToLower(f.Query)
+		if !strings.Contains(strings.ToLower(meta.Label), query) && !strings.Contains(strings.ToLower(meta.Note), query) {
+			return false
+		}
+	}
+
+	provenance := meta.Provenance
+	if provenance == nil {
+		// Snapshots from before provenance was recorded
+		provenance = &SnapshotProvenance{}
+	}
+	return (f.ProfileID == "" || f.ProfileID == provenance.ProfileID) &&
+		(f.Reason == "" || f.Reason == provenance.Reason) &&
+		(f.ClientIP == "" || f.ClientIP == provenance.ClientIP)
+}
+
+// SnapshotArchiveVersion is the format version of snapshot archives this build reads and writes
+const SnapshotArchiveVersion = 1
+
+// SnapshotManifest is the manifest.json of a snapshot archive. It lists the
+// SHA-256 of every other file in the archive.
+type SnapshotManifest struct {
+	FormatVersion  int               `json:"format_version"`
+	SnapshotID     string            `json:"snapshot_id"`
+	CreatedAt      time.Time         `json:"created_at"`
+	ExportedAt     time.Time         `json:"exported_at"`
+	Hostname       string            `json:"hostname,omitempty"`
+	NettuneVersion string            `json:"nettune_version,omitempty"`
+	Files          map[string]string `json:"files"` // archive path -> SHA-256
+}
+
+// SnapshotCurrent names the live system state when diffing a snapshot
+const SnapshotCurrent = "current"
+
+// SnapshotDiff lists what differs between a snapshot and another snapshot or
+// the live system. Each change goes from the snapshot to the state it is compared against;
+// a nil side means the key, interface or file is absent there.
+type SnapshotDiff struct {
+	SnapshotID   string             `json:"snapshot_id"`
+	Against      string             `json:"against"`                 // snapshot ID or "current"
+	Sysctl       map[string]*Change `json:"sysctl,omitempty"`        // key -> value
+	Qdisc        map[string]*Change `json:"qdisc,omitempty"`         // "iface/type" and "iface/param" -> value
+	Link         map[string]*Change `json:"link,omitempty"`          // "iface/mtu", "iface/offloads/gro", ... -> value
+	Steering     map[string]*Change `json:"steering,omitempty"`      // steering file path -> value
+	Routes       map[string]*Change `json:"routes,omitempty"`        // "family spec/attribute" -> value
+	SystemdUnits map[string]*Change `json:"systemd_units,omitempty"` // unit -> active
+	FileHashes   map[string]*Change `json:"file_hashes,omitempty"`   // managed file -> content hash
+	Total        int                `json:"total"`                   // number of changes across all sections
+	// Skipped names the sections one side did not record, e.g. link state in
+	// snapshots taken before it was captured
+	Skipped []string `json:"skipped,omitempty"`
+	// UncomparedSysctls counts sysctl keys only one side captured, e.g. when a
+	// full snapshot is compared with a tracked one
+	UncomparedSysctls int `json:"uncompared_sysctls,omitempty"`
 }